@@ -18,6 +18,14 @@ func main() {
 	// 设置日志格式
 	log.SetFlags(log.Ldate | log.Ltime | log.Lmicroseconds | log.Lshortfile)
 
+	// 子命令：stats/list/check/purge；没有子命令或为crawl时运行geonode爬虫
+	if len(os.Args) > 1 && os.Args[1] != "crawl" {
+		if err := runCommand(os.Args[1], os.Args[2:]); err != nil {
+			log.Fatalf("%s 执行失败: %v", os.Args[1], err)
+		}
+		return
+	}
+
 	// 创建上下文和取消函数
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
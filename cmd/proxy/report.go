@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"japan_spider/pkg/mongodb"
+	"japan_spider/pkg/proxy"
+	"japan_spider/pkg/redis"
+)
+
+// usage 子命令说明
+const usage = `用法: proxy <命令> [参数]
+
+命令:
+  crawl           运行geonode代理爬虫（默认）
+  stats           按状态、来源、国家、协议统计代理池，并输出延迟分位数和成功率
+  list            列出代理，可按状态和国家筛选
+  check <addr>    验证单个代理并更新其生命周期状态
+  purge           清除失效超过保留期的代理
+
+通用参数:
+  -format table|json   输出格式（默认table）
+  -mongo URI           MongoDB连接URI
+  -redis-host HOST     Redis主机地址
+  -redis-port PORT     Redis端口
+`
+
+// commandEnv 子命令运行环境
+type commandEnv struct {
+	pool        *proxy.ProxyPool
+	mongoClient *mongodb.MongoClient
+	redisClient *redis.RedisClient
+	format      string
+}
+
+// close 释放连接
+func (e *commandEnv) close() {
+	e.mongoClient.Close()
+	e.redisClient.Close()
+}
+
+// runCommand 执行子命令
+func runCommand(name string, args []string) error {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	format := fs.String("format", "table", "输出格式: table/json")
+	mongoURI := fs.String("mongo", "mongodb://192.168.20.6:30643", "MongoDB连接URI")
+	redisHost := fs.String("redis-host", "192.168.20.6", "Redis主机地址")
+	redisPort := fs.Int("redis-port", 32430, "Redis端口")
+	country := fs.String("country", "", "只统计指定国家的代理")
+	state := fs.String("state", "", "list: 只列出指定状态的代理")
+	limit := fs.Int("limit", 50, "list: 最多列出的代理数量，0表示不限制")
+	checkURL := fs.String("url", "", "check: 验证地址")
+	timeout := fs.Duration("timeout", 10*time.Second, "check: 请求超时时间")
+	fs.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+
+	switch name {
+	case "stats", "list", "check", "purge":
+	case "help", "-h", "--help":
+		fs.Usage()
+		return nil
+	default:
+		fs.Usage()
+		return fmt.Errorf("未知命令: %s", name)
+	}
+	fs.Parse(args)
+
+	if *format != "table" && *format != "json" {
+		return fmt.Errorf("不支持的输出格式: %s", *format)
+	}
+
+	env, err := newCommandEnv(*mongoURI, *redisHost, *redisPort, proxy.Config{
+		Timeout:  *timeout,
+		Selector: proxy.Selector{Country: *country},
+		CheckURL: *checkURL,
+	})
+	if err != nil {
+		return err
+	}
+	defer env.close()
+	env.format = *format
+
+	switch name {
+	case "stats":
+		return env.stats()
+	case "list":
+		return env.list(proxy.State(*state), *limit)
+	case "check":
+		if fs.NArg() != 1 {
+			return fmt.Errorf("用法: proxy check <addr>")
+		}
+		return env.check(fs.Arg(0))
+	default:
+		return env.purge()
+	}
+}
+
+// newCommandEnv 连接MongoDB和Redis并加载代理池
+func newCommandEnv(mongoURI, redisHost string, redisPort int, config proxy.Config) (*commandEnv, error) {
+	mongoClient, err := mongodb.NewMongoClient(&mongodb.Config{
+		URI:      mongoURI,
+		Database: "proxy_pool",
+		Timeout:  5 * time.Second,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("MongoDB初始化失败: %w", err)
+	}
+
+	redisClient, err := redis.NewRedisClient(&redis.Config{
+		Host:    redisHost,
+		Port:    redisPort,
+		Timeout: 5 * time.Second,
+	})
+	if err != nil {
+		mongoClient.Close()
+		return nil, fmt.Errorf("Redis初始化失败: %w", err)
+	}
+
+	config.StateStore = proxy.NewRedisStateStore(redisClient, "", config.Lifecycle)
+	pool := proxy.NewProxyPool(config)
+	if _, err := pool.SyncFromMongo(mongoClient, 0); err != nil {
+		mongoClient.Close()
+		redisClient.Close()
+		return nil, err
+	}
+
+	return &commandEnv{pool: pool, mongoClient: mongoClient, redisClient: redisClient}, nil
+}
+
+// stats 输出代理池统计
+func (e *commandEnv) stats() error {
+	stats, err := e.pool.Stats()
+	if err != nil {
+		return err
+	}
+	if e.format == "json" {
+		return printJSON(stats)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "代理总数\t%d\n", stats.Total)
+	fmt.Fprintf(w, "当前可用\t%d\n", stats.Usable)
+	fmt.Fprintf(w, "测得延迟 p50/p90/p99\t%s\n\n", formatLatency(stats.Latency))
+
+	fmt.Fprintln(w, "状态\t数量")
+	for _, state := range proxy.AllStates {
+		fmt.Fprintf(w, "%s\t%d\n", state, stats.ByState[state])
+	}
+
+	fmt.Fprintln(w, "\n来源\t数量\t可用\t成功\t失败\t成功率\t测得延迟 p50/p90/p99")
+	for _, source := range sortedKeys(stats.BySource) {
+		src := stats.Sources[source]
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%.1f%%\t%s\n",
+			source, src.Proxies, src.Usable, src.Successes, src.Errors, src.SuccessRate*100, formatLatency(src.Latency))
+	}
+
+	fmt.Fprintln(w, "\n国家\t数量")
+	for _, country := range sortedKeys(stats.ByCountry) {
+		fmt.Fprintf(w, "%s\t%d\n", country, stats.ByCountry[country])
+	}
+
+	fmt.Fprintln(w, "\n协议\t数量")
+	for _, protocol := range sortedKeys(stats.ByProtocol) {
+		fmt.Fprintf(w, "%s\t%d\n", protocol, stats.ByProtocol[protocol])
+	}
+	return w.Flush()
+}
+
+// list 列出代理
+func (e *commandEnv) list(state proxy.State, limit int) error {
+	reports, err := e.pool.Reports(e.pool.Selector(), state)
+	if err != nil {
+		return err
+	}
+	if limit > 0 && len(reports) > limit {
+		reports = reports[:limit]
+	}
+	if e.format == "json" {
+		return printJSON(reports)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "代理\t协议\t国家\t匿名\t来源\t状态\t测得延迟\t成功/失败\t最后错误")
+	for _, r := range reports {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d/%d\t%s\n",
+			r.URL, r.Protocol, r.CountryCode, r.Anonymity, r.Source, r.Status.State,
+			formatDuration(r.Measured), r.Status.Successes, r.Status.Errors, r.Status.LastError)
+	}
+	return w.Flush()
+}
+
+// check 验证单个代理
+func (e *commandEnv) check(addr string) error {
+	var target *proxy.Proxy
+	reports, err := e.pool.Reports(proxy.Selector{}, "")
+	if err != nil {
+		return err
+	}
+	for _, r := range reports {
+		if r.URL == addr {
+			target = r.Proxy
+			break
+		}
+	}
+	if target == nil {
+		target = &proxy.Proxy{URL: addr, Protocol: "http"}
+	}
+
+	st, latency, checkErr := e.pool.Check(context.Background(), target)
+	if err := e.pool.SaveHealth(e.mongoClient, e.pool.HealthUpdate(target, checkErr)); err != nil {
+		log.Printf("%v", err)
+	}
+	if e.format == "json" {
+		result := map[string]interface{}{"proxy": addr, "ok": checkErr == nil, "latency": latency, "status": st}
+		if checkErr != nil {
+			result["error"] = checkErr.Error()
+		}
+		return printJSON(result)
+	}
+
+	if checkErr != nil {
+		fmt.Printf("%s 不可用: %v\n状态: %s\n", addr, checkErr, st.State)
+		return nil
+	}
+	fmt.Printf("%s 可用，耗时 %s\n状态: %s\n", addr, formatDuration(latency), st.State)
+	return nil
+}
+
+// purge 清除失效代理
+func (e *commandEnv) purge() error {
+	purged, err := e.pool.PurgeDead(e.mongoClient)
+	if err != nil {
+		return err
+	}
+	if e.format == "json" {
+		return printJSON(map[string]interface{}{"purged": purged})
+	}
+	fmt.Printf("已清除 %d 个失效代理\n", len(purged))
+	for _, addr := range purged {
+		fmt.Println(addr)
+	}
+	return nil
+}
+
+// printJSON 以JSON格式输出
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// formatLatency 格式化延迟分位数
+func formatLatency(l proxy.LatencyStats) string {
+	if l.Samples == 0 {
+		return "-"
+	}
+	return strings.Join([]string{formatDuration(l.P50), formatDuration(l.P90), formatDuration(l.P99)}, "/")
+}
+
+// formatDuration 格式化时长，0显示为-
+func formatDuration(d time.Duration) string {
+	if d <= 0 {
+		return "-"
+	}
+	return d.Round(time.Millisecond).String()
+}
+
+// sortedKeys 按数量从多到少排列统计项
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if m[keys[i]] != m[keys[j]] {
+			return m[keys[i]] > m[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
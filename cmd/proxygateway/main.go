@@ -0,0 +1,142 @@
+// proxygateway 本地转发代理网关
+// 在本地端口提供HTTP/HTTPS（CONNECT）代理服务，每个请求通过代理池中的上游代理转发，
+// 使Python脚本、curl和浏览器等工具也能使用代理池
+//
+// 使用示例:
+//
+//	go run ./cmd/proxygateway -listen 127.0.0.1:8899 -country Japan -strategy weighted
+//	curl -x http://127.0.0.1:8899 https://www.amazon.co.jp/
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"japan_spider/pkg/mongodb"
+	"japan_spider/pkg/proxy"
+	"japan_spider/pkg/redis"
+)
+
+func main() {
+	// 设置日志格式
+	log.SetFlags(log.Ldate | log.Ltime | log.Lmicroseconds | log.Lshortfile)
+
+	listen := flag.String("listen", "127.0.0.1:8899", "本地监听地址")
+	strategyName := flag.String("strategy", "round_robin", "轮换策略: round_robin/random/weighted/best")
+	country := flag.String("country", "", "只使用指定国家的代理，例如 Japan 或 JP")
+	anonymity := flag.String("anonymity", "", "只使用指定匿名级别的代理，例如 elite")
+	minReliability := flag.Float64("min-reliability", 0, "最低可用性（百分比）")
+	limit := flag.Int("limit", 2000, "从MongoDB加载的代理数量上限")
+	refresh := flag.Duration("refresh", 10*time.Minute, "从MongoDB刷新代理的间隔")
+	checkInterval := flag.Duration("check-interval", time.Minute, "健康检查间隔")
+	mongoURI := flag.String("mongo", "mongodb://192.168.20.6:30643", "MongoDB连接URI")
+	redisHost := flag.String("redis-host", "192.168.20.6", "Redis主机地址，为空时代理状态只保存在本进程")
+	redisPort := flag.Int("redis-port", 32430, "Redis端口")
+	flag.Parse()
+
+	strategy, err := proxy.ParseStrategy(*strategyName)
+	if err != nil {
+		log.Fatalf("参数错误: %v", err)
+	}
+
+	// 初始化MongoDB
+	mongoClient, err := mongodb.NewMongoClient(&mongodb.Config{
+		URI:      *mongoURI,
+		Database: "proxy_pool",
+		Timeout:  5 * time.Second,
+	})
+	if err != nil {
+		log.Fatalf("MongoDB初始化失败: %v", err)
+	}
+	defer mongoClient.Close()
+
+	selector := proxy.Selector{
+		Country:        *country,
+		Anonymity:      *anonymity,
+		MinReliability: *minReliability,
+	}
+	poolConfig := proxy.Config{
+		Timeout:  10 * time.Second,
+		Selector: selector,
+		Strategy: strategy,
+	}
+
+	// 配置Redis时代理状态在所有节点之间共享
+	if *redisHost != "" {
+		redisClient, err := redis.NewRedisClient(&redis.Config{
+			Host:    *redisHost,
+			Port:    *redisPort,
+			DB:      0,
+			Timeout: 5 * time.Second,
+		})
+		if err != nil {
+			log.Fatalf("Redis初始化失败: %v", err)
+		}
+		defer redisClient.Close()
+		poolConfig.StateStore = proxy.NewRedisStateStore(redisClient, "", poolConfig.Lifecycle)
+	}
+
+	pool := proxy.NewProxyPool(poolConfig)
+	added, err := pool.SyncFromMongo(mongoClient, *limit)
+	if err != nil {
+		log.Fatalf("加载代理失败: %v", err)
+	}
+	log.Printf("已加载 %d 个代理", added)
+
+	gateway := proxy.NewGateway(pool, proxy.GatewayConfig{
+		Strategy: strategy,
+		Selector: selector,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// 定期健康检查和从MongoDB刷新代理
+	go pool.RunMaintenance(ctx, mongoClient, *checkInterval)
+	go func() {
+		ticker := time.NewTicker(*refresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if added, err := pool.SyncFromMongo(mongoClient, *limit); err != nil {
+					log.Printf("刷新代理失败: %v", err)
+				} else if added > 0 {
+					log.Printf("新增 %d 个代理", added)
+				}
+				gateway.PruneTransports()
+			}
+		}
+	}()
+
+	server := &http.Server{
+		Addr:    *listen,
+		Handler: gateway,
+	}
+
+	// 设置信号处理
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		log.Println("收到终止信号，正在优雅关闭...")
+		cancel()
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer shutdownCancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("代理网关已启动: %s (策略: %s)", *listen, strategy)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatalf("代理网关运行失败: %v", err)
+	}
+	log.Println("代理网关已关闭")
+}
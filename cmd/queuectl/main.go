@@ -0,0 +1,246 @@
+// queuectl 队列运维工具
+// 查看、编辑、重放和删除重试耗尽后转入死信集合的队列项
+//
+// 使用示例:
+//
+//	go run ./cmd/queuectl list -error timeout
+//	go run ./cmd/queuectl show <id>
+//	go run ./cmd/queuectl edit <id> -data '{"type":"product","url":"https://..."}'
+//	go run ./cmd/queuectl replay -error timeout
+//	go run ./cmd/queuectl delete -all
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"japan_spider/pkg/mongodb"
+	"japan_spider/pkg/queue"
+	"japan_spider/pkg/redis"
+)
+
+// usage 命令说明
+const usage = `用法: queuectl <命令> [参数] [ID...]
+
+命令:
+  list            列出死信
+  show <id>       查看单个死信的完整内容
+  edit <id>       修改死信的数据内容（-data 或 -file）
+  replay [ID...]  把死信重新放回队列
+  delete [ID...]  删除死信
+
+筛选参数（list/replay/delete）:
+  -error TEXT     错误信息包含该文本
+  -since DURATION 只处理最近一段时间内转入的死信，例如 24h
+  -limit N        最多处理的数量
+  -all            replay/delete没有指定ID或筛选条件时，必须指定该参数才会处理全部死信
+
+连接参数:
+  -mongo URI -database NAME -collection NAME -redis-host HOST -redis-port PORT -prefix PREFIX
+`
+
+func main() {
+	// 设置日志格式
+	log.SetFlags(log.Ldate | log.Ltime | log.Lmicroseconds | log.Lshortfile)
+
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err := run(os.Args[1], os.Args[2:]); err != nil {
+		log.Fatalf("%s 执行失败: %v", os.Args[1], err)
+	}
+}
+
+// run 执行子命令
+func run(name string, args []string) error {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	mongoURI := fs.String("mongo", "mongodb://192.168.20.6:30643", "MongoDB连接URI")
+	database := fs.String("database", "spider", "MongoDB数据库名")
+	collection := fs.String("collection", "queue", "队列使用的MongoDB集合名")
+	redisHost := fs.String("redis-host", "192.168.20.6", "Redis主机地址")
+	redisPort := fs.Int("redis-port", 32430, "Redis端口")
+	prefix := fs.String("prefix", "queue:", "队列的Redis键前缀")
+	errorContains := fs.String("error", "", "错误信息包含该文本")
+	since := fs.Duration("since", 0, "只处理最近一段时间内转入的死信")
+	limit := fs.Int("limit", 0, "最多处理的数量，0表示不限制")
+	all := fs.Bool("all", false, "没有筛选条件时处理全部死信")
+	format := fs.String("format", "table", "输出格式: table/json")
+	data := fs.String("data", "", "edit: 新的数据内容（JSON）")
+	file := fs.String("file", "", "edit: 从文件读取新的数据内容（JSON）")
+	fs.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+
+	switch name {
+	case "list", "show", "edit", "replay", "delete":
+	case "help", "-h", "--help":
+		fs.Usage()
+		return nil
+	default:
+		fs.Usage()
+		return fmt.Errorf("未知命令: %s", name)
+	}
+	fs.Parse(reorderArgs(fs, args))
+
+	mongoClient, err := mongodb.NewMongoClient(&mongodb.Config{
+		URI:      *mongoURI,
+		Database: *database,
+		Timeout:  5 * time.Second,
+	})
+	if err != nil {
+		return fmt.Errorf("MongoDB初始化失败: %w", err)
+	}
+	defer mongoClient.Close()
+
+	redisClient, err := redis.NewRedisClient(&redis.Config{
+		Host:    *redisHost,
+		Port:    *redisPort,
+		Timeout: 5 * time.Second,
+	})
+	if err != nil {
+		return fmt.Errorf("Redis初始化失败: %w", err)
+	}
+	defer redisClient.Close()
+
+	qc, err := queue.OpenQueueController(redisClient, mongoClient, queue.Config{
+		RedisKeyPrefix:  *prefix,
+		MongoDatabase:   *database,
+		MongoCollection: *collection,
+	})
+	if err != nil {
+		return err
+	}
+	defer qc.Close()
+
+	query := queue.DeadLetterQuery{
+		IDs:           fs.Args(),
+		ErrorContains: *errorContains,
+		Limit:         *limit,
+	}
+	if *since > 0 {
+		query.Since = time.Now().Add(-*since)
+	}
+
+	switch name {
+	case "list":
+		items, err := qc.ListDeadLetters(query)
+		if err != nil {
+			return err
+		}
+		if *format == "json" {
+			return printJSON(items)
+		}
+		printTable(items)
+		return nil
+
+	case "show":
+		if fs.NArg() != 1 {
+			return fmt.Errorf("用法: queuectl show <id>")
+		}
+		item, err := qc.GetDeadLetter(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		return printJSON(item)
+
+	case "edit":
+		if fs.NArg() != 1 {
+			return fmt.Errorf("用法: queuectl edit <id> -data JSON")
+		}
+		raw := []byte(*data)
+		if *file != "" {
+			if raw, err = os.ReadFile(*file); err != nil {
+				return err
+			}
+		}
+		if len(raw) == 0 {
+			return fmt.Errorf("需要通过 -data 或 -file 指定新的数据内容")
+		}
+		var value interface{}
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return fmt.Errorf("数据内容不是合法的JSON: %w", err)
+		}
+		if err := qc.UpdateDeadLetter(fs.Arg(0), value); err != nil {
+			return err
+		}
+		fmt.Printf("已修改 %s\n", fs.Arg(0))
+		return nil
+
+	case "replay":
+		if query.IsZero() && !*all {
+			return fmt.Errorf("没有指定ID或筛选条件，如需重放全部死信请加 -all")
+		}
+		replayed, err := qc.ReplayDeadLetters(query)
+		fmt.Printf("已重放 %d 个死信\n", replayed)
+		return err
+
+	default:
+		if query.IsZero() && !*all {
+			return fmt.Errorf("没有指定ID或筛选条件，如需删除全部死信请加 -all")
+		}
+		deleted, err := qc.DeleteDeadLetters(query)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("已删除 %d 个死信\n", deleted)
+		return nil
+	}
+}
+
+// reorderArgs 把参数移到位置参数之前，使 "show <id> -format json" 这样的写法也能解析
+func reorderArgs(fs *flag.FlagSet, args []string) []string {
+	var flags, positional []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			positional = append(positional, arg)
+			continue
+		}
+		flags = append(flags, arg)
+		name := strings.TrimLeft(arg, "-")
+		if strings.Contains(name, "=") {
+			continue
+		}
+		// 非布尔参数的值在下一个位置
+		if f := fs.Lookup(name); f != nil && i+1 < len(args) {
+			if b, ok := f.Value.(interface{ IsBoolFlag() bool }); !ok || !b.IsBoolFlag() {
+				i++
+				flags = append(flags, args[i])
+			}
+		}
+	}
+	return append(flags, positional...)
+}
+
+// printTable 以表格形式输出死信
+func printTable(items []queue.QueueItem) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\t重试次数\t转入时间\t错误")
+	for _, item := range items {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n",
+			item.ID, item.Retries, item.UpdatedAt.Local().Format("2006-01-02 15:04:05"), truncate(item.Error, 80))
+	}
+	w.Flush()
+	fmt.Printf("共 %d 个死信\n", len(items))
+}
+
+// printJSON 以JSON格式输出
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// truncate 截断过长的文本
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n]) + "..."
+}
@@ -0,0 +1,190 @@
+// urlctl URL去重运维工具
+// 把已有的Redis URL集合迁移到Redis Bloom过滤器，查看过滤器状态
+//
+// 使用示例:
+//
+//	go run ./cmd/urlctl migrate -prefix url -capacity 50000000
+//	go run ./cmd/urlctl stats -prefix url
+//	go run ./cmd/urlctl check -prefix url https://www.amazon.co.jp/dp/B000000000
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"japan_spider/pkg/redis"
+	"japan_spider/pkg/url"
+)
+
+// usage 命令说明
+const usage = `用法: urlctl <命令> [参数] [URL...]
+
+命令:
+  migrate         把URL集合（<prefix>:urls）中的URL规范化后全部加入Bloom过滤器（<prefix>:bloom）
+  stats           查看Bloom过滤器的层数、URL数量和占用空间
+  check <URL...>  检查规范化后的URL是否已在Bloom过滤器中
+
+Bloom过滤器参数（必须与爬虫使用的配置一致）:
+  -capacity N       第一层的容量，默认1000万
+  -error-rate RATE  误判率，默认0.001
+
+迁移参数:
+  -batch N          每批迁移的URL数量，默认1000
+  -delete-set       迁移完成后删除URL集合
+
+连接参数:
+  -redis-host HOST -redis-port PORT -prefix PREFIX
+`
+
+func main() {
+	// 设置日志格式
+	log.SetFlags(log.Ldate | log.Ltime | log.Lmicroseconds | log.Lshortfile)
+
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err := run(os.Args[1], os.Args[2:]); err != nil {
+		log.Fatalf("%s 执行失败: %v", os.Args[1], err)
+	}
+}
+
+// run 执行子命令
+func run(name string, args []string) error {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	redisHost := fs.String("redis-host", "192.168.20.6", "Redis主机地址")
+	redisPort := fs.Int("redis-port", 32430, "Redis端口")
+	prefix := fs.String("prefix", "url", "URL管理器的Redis键前缀")
+	capacity := fs.Int64("capacity", 0, "Bloom过滤器第一层的容量")
+	errorRate := fs.Float64("error-rate", 0, "Bloom过滤器的误判率")
+	batch := fs.Int("batch", 1000, "每批迁移的URL数量")
+	deleteSet := fs.Bool("delete-set", false, "迁移完成后删除URL集合")
+	fs.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+
+	switch name {
+	case "migrate", "stats", "check":
+	case "help", "-h", "--help":
+		fs.Usage()
+		return nil
+	default:
+		fs.Usage()
+		return fmt.Errorf("未知命令: %s", name)
+	}
+	fs.Parse(args)
+
+	redisClient, err := redis.NewRedisClient(&redis.Config{
+		Host:    *redisHost,
+		Port:    *redisPort,
+		Timeout: 5 * time.Second,
+	})
+	if err != nil {
+		return fmt.Errorf("Redis初始化失败: %w", err)
+	}
+	defer redisClient.Close()
+
+	store, err := url.NewDedupStore(redisClient, url.Config{
+		RedisKeyPrefix: *prefix,
+		Dedup:          url.DedupRedisBloom,
+		BloomCapacity:  *capacity,
+		BloomErrorRate: *errorRate,
+	})
+	if err != nil {
+		return err
+	}
+	bloom := store.(*url.RedisBloom)
+	ctx := context.Background()
+
+	switch name {
+	case "migrate":
+		return migrate(ctx, redisClient, bloom, fmt.Sprintf("%s:urls", *prefix), *batch, *deleteSet)
+
+	case "stats":
+		stats, err := bloom.Stats(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("层数: %d\nURL数量: %d\n占用空间: %.1fMB\n", stats.Layers, stats.Count, float64(stats.Bytes)/1024/1024)
+		return nil
+
+	default:
+		if fs.NArg() == 0 {
+			return fmt.Errorf("用法: urlctl check <URL...>")
+		}
+		// 过滤器中保存的是规范化后的URL
+		canonical := url.NewCanonicalizer()
+		for _, raw := range fs.Args() {
+			u, err := canonical.Canonicalize(raw)
+			if err != nil {
+				return err
+			}
+			exists, err := bloom.Contains(ctx, u)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%v\t%s\n", exists, u)
+		}
+		return nil
+	}
+}
+
+// migrate 用SSCAN分批读取URL集合，规范化后加入Bloom过滤器
+// 集合中是旧版本只去掉片段的URL，按当前规则规范化后才能与爬虫去重时使用的URL一致；
+// 无法规范化的URL按原样加入。迁移期间爬虫可以继续运行，重复执行不会重复计数
+func migrate(ctx context.Context, redisClient *redis.RedisClient, bloom *url.RedisBloom, setKey string, batch int, deleteSet bool) error {
+	client := redisClient.Client()
+	canonical := url.NewCanonicalizer()
+	total, err := client.SCard(ctx, setKey).Result()
+	if err != nil {
+		return err
+	}
+	log.Printf("开始迁移 %s，共 %d 个URL", setKey, total)
+
+	var cursor uint64
+	var scanned, added, invalid int64
+	lastReport := time.Now()
+	for {
+		urls, next, err := client.SScan(ctx, setKey, cursor, "", int64(batch)).Result()
+		if err != nil {
+			return err
+		}
+		for i, raw := range urls {
+			if u, err := canonical.Canonicalize(raw); err == nil {
+				urls[i] = u
+			} else {
+				invalid++
+			}
+		}
+		if len(urls) > 0 {
+			results, err := bloom.AddBatch(ctx, urls)
+			if err != nil {
+				return err
+			}
+			for _, isNew := range results {
+				if isNew {
+					added++
+				}
+			}
+			scanned += int64(len(urls))
+		}
+		if time.Since(lastReport) > 10*time.Second {
+			log.Printf("已迁移 %d/%d", scanned, total)
+			lastReport = time.Now()
+		}
+		if cursor = next; cursor == 0 {
+			break
+		}
+	}
+	log.Printf("迁移完成: 读取 %d 个URL，新加入 %d 个（其余已在过滤器中、规范化后重复或被误判为已存在），%d 个无法规范化按原样加入", scanned, added, invalid)
+
+	if deleteSet {
+		if err := client.Unlink(ctx, setKey).Err(); err != nil {
+			return err
+		}
+		log.Printf("已删除 %s", setKey)
+	}
+	return nil
+}
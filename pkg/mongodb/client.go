@@ -98,6 +98,8 @@ func NewMongoClient(cfg *Config) (*MongoClient, error) {
 //
 // 返回:
 //   - error: 如果保存失败则返回错误
+//
+// Deprecated: 每次调用都会插入已存在代理的重复记录，请使用 UpsertProxies
 func (m *MongoClient) SaveProxies(database, collection string, proxies []interface{}) error {
 	// 获取指定的集合
 	coll := m.client.Database(database).Collection(collection)
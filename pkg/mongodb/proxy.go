@@ -0,0 +1,520 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ProxyDocument 代理在MongoDB中的完整记录
+// 除地址外还保存国家、协议、匿名级别、速度和可靠性等元数据
+type ProxyDocument struct {
+	Proxy       string      `bson:"proxy" json:"proxy"`               // 代理地址，格式为 ip:port
+	IP          string      `bson:"ip" json:"ip"`                     // 代理IP
+	Port        string      `bson:"port" json:"port"`                 // 代理端口
+	Protocols   []string    `bson:"protocols" json:"protocols"`       // 支持的协议（http/https/socks4/socks5）
+	Country     string      `bson:"country" json:"country"`           // 国家名称，例如 Japan
+	CountryCode string      `bson:"country_code" json:"country_code"` // 国家代码，例如 JP
+	City        string      `bson:"city" json:"city"`                 // 城市
+	Anonymity   string      `bson:"anonymity" json:"anonymity"`       // 匿名级别：elite/anonymous/transparent
+	Speed       float64     `bson:"speed" json:"speed"`               // 速度评分
+	Latency     float64     `bson:"latency" json:"latency"`           // 延迟（毫秒）
+	Uptime      float64     `bson:"uptime" json:"uptime"`             // 在线率（百分比）
+	Reliability float64     `bson:"reliability" json:"reliability"`   // 可用性（百分比）
+	LastChecked time.Time   `bson:"last_checked" json:"last_checked"` // 来源方最后检查时间
+	Source      string      `bson:"source" json:"source"`             // 代理来源，例如 geonode
+	Sources     []string    `bson:"sources" json:"sources"`           // 所有出现过的来源
+	CreateAt    time.Time   `bson:"createAt" json:"createAt"`         // 入库时间
+	FirstSeen   time.Time   `bson:"first_seen" json:"first_seen"`     // 第一次采集到的时间
+	LastSeen    time.Time   `bson:"last_seen" json:"last_seen"`       // 最后一次采集到的时间
+	Verified    bool        `bson:"verified" json:"verified"`         // 是否已经本地验证
+	Health      ProxyHealth `bson:"health" json:"health"`             // 历史健康统计，采集时不会被覆盖
+}
+
+// ProxyHealth 代理的历史健康统计
+// 由本地验证累计，重复采集时保留原值
+type ProxyHealth struct {
+	SuccessCount int64     `bson:"success_count" json:"success_count"`                   // 成功次数
+	FailureCount int64     `bson:"failure_count" json:"failure_count"`                   // 失败次数
+	AvgLatency   float64   `bson:"avg_latency" json:"avg_latency"`                       // 测得延迟的移动平均（毫秒）
+	LastSuccess  time.Time `bson:"last_success,omitempty" json:"last_success,omitempty"` // 最后成功时间
+	LastFailure  time.Time `bson:"last_failure,omitempty" json:"last_failure,omitempty"` // 最后失败时间
+}
+
+// UpsertResult 代理入库结果统计
+type UpsertResult struct {
+	Inserted  int // 新增的代理数量
+	Updated   int // 元数据或来源发生变化的代理数量
+	Unchanged int // 只刷新了last_seen的代理数量
+}
+
+// EnsureProxyIndexes 为代理集合创建查询所需的索引
+// 代理地址使用唯一索引；其余索引覆盖国家、协议、匿名级别和最后检查时间，用于按条件筛选代理
+// 如果集合中已有重复地址导致唯一索引创建失败，会先清理重复记录再重试
+//
+// 参数:
+//   - database: 数据库名称
+//   - collection: 集合名称
+//
+// 返回:
+//   - error: 如果创建索引失败则返回错误
+func (m *MongoClient) EnsureProxyIndexes(database, collection string) error {
+	coll := m.client.Database(database).Collection(collection)
+
+	models := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "proxy", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "country", Value: 1}}},
+		{Keys: bson.D{{Key: "country_code", Value: 1}}},
+		{Keys: bson.D{{Key: "protocols", Value: 1}}},
+		{Keys: bson.D{{Key: "anonymity", Value: 1}}},
+		{Keys: bson.D{{Key: "last_checked", Value: -1}}},
+	}
+
+	ctx, cancel := context.WithTimeout(m.ctx, 30*time.Second)
+	defer cancel()
+
+	_, err := coll.Indexes().CreateMany(ctx, models)
+	if err != nil && mongo.IsDuplicateKeyError(err) {
+		log.Printf("代理集合存在重复地址，开始清理...")
+		removed, dedupErr := m.RemoveDuplicateProxies(database, collection)
+		if dedupErr != nil {
+			return fmt.Errorf("清理重复代理失败: %w", dedupErr)
+		}
+		log.Printf("已清理 %d 条重复代理", removed)
+		_, err = coll.Indexes().CreateMany(ctx, models)
+	}
+	if err != nil {
+		return fmt.Errorf("创建代理索引失败: %w", err)
+	}
+	return nil
+}
+
+// RemoveDuplicateProxies 删除地址重复的代理记录
+// 每个地址只保留最早入库的一条记录
+//
+// 参数:
+//   - database: 数据库名称
+//   - collection: 集合名称
+//
+// 返回:
+//   - int: 删除的记录数
+//   - error: 如果清理失败则返回错误
+func (m *MongoClient) RemoveDuplicateProxies(database, collection string) (int, error) {
+	coll := m.client.Database(database).Collection(collection)
+
+	ctx, cancel := context.WithTimeout(m.ctx, 5*time.Minute)
+	defer cancel()
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$sort", Value: bson.D{{Key: "createAt", Value: 1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$proxy"},
+			{Key: "ids", Value: bson.D{{Key: "$push", Value: "$_id"}}},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+		{{Key: "$match", Value: bson.D{{Key: "count", Value: bson.D{{Key: "$gt", Value: 1}}}}}},
+	}
+
+	cursor, err := coll.Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return 0, fmt.Errorf("查询重复代理失败: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	removed := 0
+	for cursor.Next(ctx) {
+		var group struct {
+			IDs []interface{} `bson:"ids"`
+		}
+		if err := cursor.Decode(&group); err != nil {
+			return removed, fmt.Errorf("解析重复代理失败: %w", err)
+		}
+
+		result, err := coll.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": group.IDs[1:]}})
+		if err != nil {
+			return removed, fmt.Errorf("删除重复代理失败: %w", err)
+		}
+		removed += int(result.DeletedCount)
+	}
+
+	return removed, cursor.Err()
+}
+
+// UpsertProxies 以代理地址为键批量写入代理
+// 该方法替代InsertMany的重复插入，包含以下特性：
+// - 新代理插入，已有代理更新元数据并刷新last_seen
+// - 来源列表合并而不是覆盖
+// - 历史健康统计只在插入时初始化，之后保持不变
+// - 统计新增、更新和未变化的数量
+//
+// 参数:
+//   - database: 目标数据库名称
+//   - collection: 目标集合名称
+//   - docs: 要写入的代理记录，Proxy字段不能为空
+//
+// 返回:
+//   - UpsertResult: 写入结果统计
+//   - error: 如果写入失败则返回错误
+func (m *MongoClient) UpsertProxies(database, collection string, docs []ProxyDocument) (UpsertResult, error) {
+	var result UpsertResult
+	coll := m.client.Database(database).Collection(collection)
+
+	ctx, cancel := context.WithTimeout(m.ctx, 5*time.Minute)
+	defer cancel()
+
+	now := time.Now()
+	batchSize := 1000
+	for i := 0; i < len(docs); i += batchSize {
+		end := i + batchSize
+		if end > len(docs) {
+			end = len(docs)
+		}
+		batch := docs[i:end]
+
+		// 查询已存在的记录，用于区分新增、更新和未变化
+		addrs := make([]string, 0, len(batch))
+		for _, doc := range batch {
+			addrs = append(addrs, doc.Proxy)
+		}
+		existing, err := m.findProxiesByAddress(ctx, coll, addrs)
+		if err != nil {
+			return result, err
+		}
+
+		models := make([]mongo.WriteModel, 0, len(batch))
+		for _, doc := range batch {
+			if doc.Proxy == "" {
+				continue
+			}
+
+			sources := proxySources(doc)
+			classifyProxy(existing, doc, sources, &result)
+
+			createAt := doc.CreateAt
+			if createAt.IsZero() {
+				createAt = now
+			}
+
+			update := bson.M{
+				"$set": bson.M{
+					"ip":           doc.IP,
+					"port":         doc.Port,
+					"protocols":    doc.Protocols,
+					"country":      doc.Country,
+					"country_code": doc.CountryCode,
+					"city":         doc.City,
+					"anonymity":    doc.Anonymity,
+					"speed":        doc.Speed,
+					"latency":      doc.Latency,
+					"uptime":       doc.Uptime,
+					"reliability":  doc.Reliability,
+					"last_checked": doc.LastChecked,
+					"source":       doc.Source,
+					"last_seen":    now,
+				},
+				"$setOnInsert": bson.M{
+					"createAt":   createAt,
+					"first_seen": now,
+					"verified":   false,
+					"health":     ProxyHealth{},
+				},
+			}
+			// $each不接受null，没有来源时不更新sources
+			if len(sources) > 0 {
+				update["$addToSet"] = bson.M{
+					"sources": bson.M{"$each": sources},
+				}
+			}
+
+			models = append(models, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"proxy": doc.Proxy}).
+				SetUpdate(update).
+				SetUpsert(true))
+		}
+
+		if len(models) == 0 {
+			continue
+		}
+
+		// 添加重试机制，最多重试3次
+		for retries := 0; retries < 3; retries++ {
+			_, err = coll.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+			if err == nil {
+				break
+			}
+			log.Printf("批量写入失败(第%d次重试): %v", retries+1, err)
+			time.Sleep(time.Duration(retries+1) * time.Second)
+		}
+		if err != nil {
+			return result, fmt.Errorf("保存到MongoDB失败: %w", err)
+		}
+		log.Printf("成功写入批次 %d-%d", i, end)
+	}
+
+	return result, nil
+}
+
+// findProxiesByAddress 按地址查询已存在的代理记录
+func (m *MongoClient) findProxiesByAddress(ctx context.Context, coll *mongo.Collection, addrs []string) (map[string]ProxyDocument, error) {
+	cursor, err := coll.Find(ctx, bson.M{"proxy": bson.M{"$in": addrs}})
+	if err != nil {
+		return nil, fmt.Errorf("查询已有代理失败: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	existing := make(map[string]ProxyDocument, len(addrs))
+	for cursor.Next(ctx) {
+		var doc ProxyDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("解析已有代理失败: %w", err)
+		}
+		existing[doc.Proxy] = doc
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("读取已有代理失败: %w", err)
+	}
+
+	return existing, nil
+}
+
+// proxySources 返回代理记录的来源列表，包含当前来源
+func proxySources(doc ProxyDocument) []string {
+	sources := append([]string(nil), doc.Sources...)
+	if doc.Source != "" && !containsString(sources, doc.Source) {
+		sources = append(sources, doc.Source)
+	}
+	return sources
+}
+
+// classifyProxy 对照已有记录统计代理属于新增、更新还是未变化，并把写入后的记录放回existing
+// 同一批次中重复出现的代理与前一次写入的结果比较，只计一次新增
+func classifyProxy(existing map[string]ProxyDocument, doc ProxyDocument, sources []string, result *UpsertResult) {
+	old, ok := existing[doc.Proxy]
+	switch {
+	case !ok:
+		result.Inserted++
+	case proxyMetadataChanged(old, doc, sources):
+		result.Updated++
+	default:
+		result.Unchanged++
+	}
+
+	merged := append([]string(nil), old.Sources...)
+	for _, source := range sources {
+		if !containsString(merged, source) {
+			merged = append(merged, source)
+		}
+	}
+	doc.Sources = merged
+	existing[doc.Proxy] = doc
+}
+
+// proxyMetadataChanged 判断采集到的元数据或来源是否与已有记录不同
+func proxyMetadataChanged(old, doc ProxyDocument, sources []string) bool {
+	if old.IP != doc.IP || old.Port != doc.Port ||
+		old.Country != doc.Country || old.CountryCode != doc.CountryCode || old.City != doc.City ||
+		old.Anonymity != doc.Anonymity || old.Speed != doc.Speed || old.Latency != doc.Latency ||
+		old.Uptime != doc.Uptime || old.Reliability != doc.Reliability ||
+		!old.LastChecked.Equal(doc.LastChecked) || old.Source != doc.Source {
+		return true
+	}
+
+	if len(old.Protocols) != len(doc.Protocols) {
+		return true
+	}
+	for i := range old.Protocols {
+		if old.Protocols[i] != doc.Protocols[i] {
+			return true
+		}
+	}
+
+	for _, source := range sources {
+		if !containsString(old.Sources, source) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsString 判断字符串切片中是否包含指定值
+func containsString(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
+
+// FindProxies 按条件查询代理的完整记录
+// 结果按最后检查时间倒序排列，优先返回最新检查过的代理
+//
+// 参数:
+//   - database: 数据库名称
+//   - collection: 集合名称
+//   - filter: 查询条件，为nil时返回全部
+//   - limit: 限制返回数量，小于等于0表示不限制
+//
+// 返回:
+//   - []ProxyDocument: 代理记录列表
+//   - error: 如果查询失败则返回错误
+func (m *MongoClient) FindProxies(database, collection string, filter bson.M, limit int) ([]ProxyDocument, error) {
+	coll := m.client.Database(database).Collection(collection)
+
+	if filter == nil {
+		filter = bson.M{}
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "last_checked", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+
+	ctx, cancel := context.WithTimeout(m.ctx, 10*time.Second)
+	defer cancel()
+
+	cursor, err := coll.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("查询MongoDB失败: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var docs []ProxyDocument
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("解析查询结果失败: %w", err)
+	}
+
+	return docs, nil
+}
+
+// DeleteProxies 按地址删除代理记录
+//
+// 参数:
+//   - database: 数据库名称
+//   - collection: 集合名称
+//   - proxies: 要删除的代理地址
+//
+// 返回:
+//   - int: 删除的记录数
+//   - error: 如果删除失败则返回错误
+func (m *MongoClient) DeleteProxies(database, collection string, proxies []string) (int, error) {
+	if len(proxies) == 0 {
+		return 0, nil
+	}
+
+	coll := m.client.Database(database).Collection(collection)
+
+	ctx, cancel := context.WithTimeout(m.ctx, 30*time.Second)
+	defer cancel()
+
+	result, err := coll.DeleteMany(ctx, bson.M{"proxy": bson.M{"$in": proxies}})
+	if err != nil {
+		return 0, fmt.Errorf("删除代理失败: %w", err)
+	}
+	return int(result.DeletedCount), nil
+}
+
+// ProxyHealthUpdate 一次本地验证的结果，用于更新代理的历史健康统计
+type ProxyHealthUpdate struct {
+	Proxy      string        // 代理地址
+	Success    bool          // 是否通过验证
+	AvgLatency time.Duration // 测得延迟的移动平均，小于等于0时不更新
+	At         time.Time     // 验证时间
+}
+
+// UpdateProxyHealth 批量更新代理的历史健康统计
+// 成功和失败次数累加，同时记录最后成功或失败的时间；不存在的代理不会被插入
+//
+// 参数:
+//   - database: 数据库名称
+//   - collection: 集合名称
+//   - updates: 验证结果
+//
+// 返回:
+//   - error: 如果更新失败则返回错误
+func (m *MongoClient) UpdateProxyHealth(database, collection string, updates []ProxyHealthUpdate) error {
+	models := make([]mongo.WriteModel, 0, len(updates))
+	for _, u := range updates {
+		if u.Proxy == "" {
+			continue
+		}
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"proxy": u.Proxy}).
+			SetUpdate(proxyHealthUpdate(u)))
+	}
+	if len(models) == 0 {
+		return nil
+	}
+
+	coll := m.client.Database(database).Collection(collection)
+
+	ctx, cancel := context.WithTimeout(m.ctx, 30*time.Second)
+	defer cancel()
+
+	if _, err := coll.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)); err != nil {
+		return fmt.Errorf("更新代理健康统计失败: %w", err)
+	}
+	return nil
+}
+
+// proxyHealthUpdate 生成单个验证结果对应的更新语句
+func proxyHealthUpdate(u ProxyHealthUpdate) bson.M {
+	at := u.At
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	set := bson.M{"verified": true}
+	inc := bson.M{}
+	if u.Success {
+		inc["health.success_count"] = 1
+		set["health.last_success"] = at
+		if u.AvgLatency > 0 {
+			set["health.avg_latency"] = float64(u.AvgLatency) / float64(time.Millisecond)
+		}
+	} else {
+		inc["health.failure_count"] = 1
+		set["health.last_failure"] = at
+	}
+	return bson.M{"$set": set, "$inc": inc}
+}
+
+// UpdateProxyLatency 批量保存代理测得延迟的移动平均
+// 用于保存运行时请求测得的延迟，不改变成功和失败次数
+//
+// 参数:
+//   - database: 数据库名称
+//   - collection: 集合名称
+//   - latencies: 代理地址到测得延迟的映射
+//
+// 返回:
+//   - error: 如果更新失败则返回错误
+func (m *MongoClient) UpdateProxyLatency(database, collection string, latencies map[string]time.Duration) error {
+	models := make([]mongo.WriteModel, 0, len(latencies))
+	for proxy, latency := range latencies {
+		if proxy == "" || latency <= 0 {
+			continue
+		}
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"proxy": proxy}).
+			SetUpdate(bson.M{"$set": bson.M{"health.avg_latency": float64(latency) / float64(time.Millisecond)}}))
+	}
+	if len(models) == 0 {
+		return nil
+	}
+
+	coll := m.client.Database(database).Collection(collection)
+
+	ctx, cancel := context.WithTimeout(m.ctx, 30*time.Second)
+	defer cancel()
+
+	if _, err := coll.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)); err != nil {
+		return fmt.Errorf("保存代理测得延迟失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package mongodb
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// 测试元数据变化的判断
+func TestProxyMetadataChanged(t *testing.T) {
+	checked := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	base := ProxyDocument{
+		Proxy:       "1.2.3.4:8080",
+		IP:          "1.2.3.4",
+		Port:        "8080",
+		Protocols:   []string{"http", "socks5"},
+		Country:     "Japan",
+		CountryCode: "JP",
+		Anonymity:   "elite",
+		Speed:       80,
+		Latency:     120,
+		LastChecked: checked,
+		Source:      "geonode",
+		Sources:     []string{"geonode", "free-proxy-list"},
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(doc *ProxyDocument)
+		sources []string
+		want    bool
+	}{
+		{"未变化", func(doc *ProxyDocument) {}, []string{"geonode"}, false},
+		{"时区不同的同一时间", func(doc *ProxyDocument) { doc.LastChecked = checked.In(time.FixedZone("JST", 9*3600)) }, []string{"geonode"}, false},
+		{"国家变化", func(doc *ProxyDocument) { doc.CountryCode = "US" }, []string{"geonode"}, true},
+		{"延迟变化", func(doc *ProxyDocument) { doc.Latency = 200 }, []string{"geonode"}, true},
+		{"检查时间变化", func(doc *ProxyDocument) { doc.LastChecked = checked.Add(time.Minute) }, []string{"geonode"}, true},
+		{"协议顺序变化", func(doc *ProxyDocument) { doc.Protocols = []string{"socks5", "http"} }, []string{"geonode"}, true},
+		{"协议减少", func(doc *ProxyDocument) { doc.Protocols = []string{"http"} }, []string{"geonode"}, true},
+		{"已有来源", func(doc *ProxyDocument) {}, []string{"free-proxy-list"}, false},
+		{"新来源", func(doc *ProxyDocument) {}, []string{"proxyscrape"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := base
+			tt.modify(&doc)
+			if got := proxyMetadataChanged(base, doc, tt.sources); got != tt.want {
+				t.Errorf("proxyMetadataChanged() = %v, 期望 %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// 测试入库结果的统计，包括同一批次中重复出现的代理
+func TestClassifyProxy(t *testing.T) {
+	existing := map[string]ProxyDocument{
+		"1.1.1.1:80": {Proxy: "1.1.1.1:80", Country: "Japan", Source: "geonode", Sources: []string{"geonode"}},
+		"2.2.2.2:80": {Proxy: "2.2.2.2:80", Country: "Japan", Source: "geonode", Sources: []string{"geonode"}},
+	}
+
+	docs := []ProxyDocument{
+		{Proxy: "1.1.1.1:80", Country: "Japan", Source: "geonode"},            // 未变化
+		{Proxy: "2.2.2.2:80", Country: "United States", Source: "geonode"},    // 元数据变化
+		{Proxy: "3.3.3.3:80", Country: "Japan", Source: "geonode"},            // 新增
+		{Proxy: "3.3.3.3:80", Country: "Japan", Source: "geonode"},            // 同批次重复，与上一条相同
+		{Proxy: "3.3.3.3:80", Country: "Japan", Source: "proxyscrape"},        // 同批次重复，来源变化
+		{Proxy: "1.1.1.1:80", Country: "Japan", Sources: []string{"geonode"}}, // 当前来源变为空
+	}
+
+	var result UpsertResult
+	for _, doc := range docs {
+		classifyProxy(existing, doc, proxySources(doc), &result)
+	}
+
+	want := UpsertResult{Inserted: 1, Updated: 3, Unchanged: 2}
+	if result != want {
+		t.Errorf("统计结果 = %+v, 期望 %+v", result, want)
+	}
+
+	sources := existing["3.3.3.3:80"].Sources
+	if len(sources) != 2 || sources[0] != "geonode" || sources[1] != "proxyscrape" {
+		t.Errorf("合并后的来源 = %v, 期望 [geonode proxyscrape]", sources)
+	}
+}
+
+// 测试来源列表不修改原记录
+func TestProxySources(t *testing.T) {
+	backing := make([]string, 1, 4)
+	backing[0] = "geonode"
+	doc := ProxyDocument{Source: "proxyscrape", Sources: backing}
+
+	sources := proxySources(doc)
+	if len(sources) != 2 || sources[1] != "proxyscrape" {
+		t.Fatalf("proxySources() = %v", sources)
+	}
+	if backing[:2][1] != "" {
+		t.Errorf("proxySources修改了原记录的来源列表")
+	}
+}
+
+// 测试健康统计的更新语句
+func TestProxyHealthUpdate(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	update := proxyHealthUpdate(ProxyHealthUpdate{Proxy: "1.1.1.1:80", Success: true, AvgLatency: 250 * time.Millisecond, At: at})
+	set := update["$set"].(bson.M)
+	inc := update["$inc"].(bson.M)
+	if inc["health.success_count"] != 1 || inc["health.failure_count"] != nil {
+		t.Errorf("成功时的计数更新错误: %v", inc)
+	}
+	if set["health.last_success"] != at || set["health.avg_latency"] != 250.0 || set["verified"] != true {
+		t.Errorf("成功时的字段更新错误: %v", set)
+	}
+
+	update = proxyHealthUpdate(ProxyHealthUpdate{Proxy: "1.1.1.1:80", At: at})
+	set = update["$set"].(bson.M)
+	inc = update["$inc"].(bson.M)
+	if inc["health.failure_count"] != 1 || inc["health.success_count"] != nil {
+		t.Errorf("失败时的计数更新错误: %v", inc)
+	}
+	if set["health.last_failure"] != at {
+		t.Errorf("失败时的字段更新错误: %v", set)
+	}
+	if _, ok := set["health.avg_latency"]; ok {
+		t.Errorf("失败时不应更新平均延迟: %v", set)
+	}
+}
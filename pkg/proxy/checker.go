@@ -0,0 +1,350 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"japan_spider/pkg/mongodb"
+)
+
+// defaultCheckURL 默认的代理验证地址
+const defaultCheckURL = "http://httpbin.org/ip"
+
+// ErrNoMongoClient 没有MongoDB客户端，无法修改代理的来源记录
+var ErrNoMongoClient = errors.New("没有MongoDB客户端，无法修改代理记录")
+
+// ProxyURL 返回代理的URL形式，用于http.Transport
+// 没有协议前缀的地址按代理协议补全，https代理通过CONNECT使用http前缀
+func (p *Proxy) ProxyURL() (*url.URL, error) {
+	raw := p.URL
+	if !strings.Contains(raw, "://") {
+		scheme := strings.ToLower(p.Protocol)
+		if !usableProtocol(scheme) {
+			return nil, fmt.Errorf("不支持的代理协议: %s", p.Protocol)
+		}
+		if scheme == "" || scheme == "https" {
+			scheme = "http"
+		}
+		raw = scheme + "://" + raw
+	}
+	return url.Parse(raw)
+}
+
+// usableProtocol 判断http.Transport能否通过该协议使用代理
+func usableProtocol(protocol string) bool {
+	switch strings.ToLower(protocol) {
+	case "", "http", "https", "socks5", "socks5h":
+		return true
+	}
+	return false
+}
+
+// preferredProtocol 按代理记录中协议的顺序返回第一个可以使用的协议
+// 都不能使用时返回第一个协议，没有协议时默认http
+func preferredProtocol(protocols []string) string {
+	for _, protocol := range protocols {
+		if usableProtocol(protocol) {
+			return protocol
+		}
+	}
+	if len(protocols) > 0 {
+		return protocols[0]
+	}
+	return "http"
+}
+
+// CheckProxy 通过代理请求验证地址，检查代理是否可用
+// 参数:
+//   - ctx: 上下文
+//   - proxy: 要检查的代理
+//   - checkURL: 验证地址
+//   - timeout: 请求超时时间
+//
+// 返回:
+//   - time.Duration: 请求耗时
+//   - error: 代理不可用时返回错误
+func CheckProxy(ctx context.Context, proxy *Proxy, checkURL string, timeout time.Duration) (time.Duration, error) {
+	proxyURL, err := proxy.ProxyURL()
+	if err != nil {
+		return 0, err
+	}
+
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:             http.ProxyURL(proxyURL),
+			DisableKeepAlives: true,
+		},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, checkURL, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("验证请求返回状态码 %d", resp.StatusCode)
+	}
+	return time.Since(start), nil
+}
+
+// HealthCheck 验证新代理和隔离期已结束的代理，并驱动状态流转
+// 提供mongoClient时同时把验证结果写入MongoDB的健康统计
+// 参数:
+//   - ctx: 上下文
+//   - mongoClient: MongoDB客户端，为nil时不更新健康统计
+//   - concurrency: 并发检查数量
+//
+// 返回:
+//   - passed: 通过验证的数量
+//   - failed: 未通过验证的数量
+func (p *ProxyPool) HealthCheck(ctx context.Context, mongoClient *mongodb.MongoClient, concurrency int) (passed, failed int) {
+	if concurrency <= 0 {
+		concurrency = 10
+	}
+
+	proxies := p.snapshot()
+	addrs := make([]string, len(proxies))
+	for i, proxy := range proxies {
+		addrs[i] = proxy.URL
+	}
+	states, err := p.States().GetMany(addrs)
+	if err != nil {
+		log.Printf("读取代理状态失败: %v", err)
+		return 0, 0
+	}
+
+	now := time.Now()
+	due := make([]*Proxy, 0)
+	for _, proxy := range proxies {
+		if states[proxy.URL].DueForCheck(now) {
+			due = append(due, proxy)
+		}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	updates := make([]mongodb.ProxyHealthUpdate, 0, len(due))
+	sem := make(chan struct{}, concurrency)
+	for _, proxy := range due {
+		select {
+		case <-ctx.Done():
+		case sem <- struct{}{}:
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(proxy *Proxy) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			_, _, err := p.Check(ctx, proxy)
+			if err != nil && ctx.Err() != nil {
+				// 被取消的检查不计入结果
+				return
+			}
+			update := p.HealthUpdate(proxy, err)
+			mu.Lock()
+			if err == nil {
+				passed++
+			} else {
+				failed++
+			}
+			updates = append(updates, update)
+			mu.Unlock()
+		}(proxy)
+	}
+	wg.Wait()
+
+	if err := p.SaveHealth(mongoClient, updates...); err != nil {
+		log.Printf("%v", err)
+	}
+	return passed, failed
+}
+
+// SaveHealth 把验证结果写入MongoDB中代理的健康统计，mongoClient为nil时不写入
+func (p *ProxyPool) SaveHealth(mongoClient *mongodb.MongoClient, updates ...mongodb.ProxyHealthUpdate) error {
+	if mongoClient == nil {
+		return nil
+	}
+	return mongoClient.UpdateProxyHealth(proxyDatabase, proxyCollection, updates)
+}
+
+// HealthUpdate 根据一次验证结果生成MongoDB健康统计的更新
+// 成功时带上代理当前测得延迟的移动平均
+func (p *ProxyPool) HealthUpdate(proxy *Proxy, checkErr error) mongodb.ProxyHealthUpdate {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return mongodb.ProxyHealthUpdate{
+		Proxy:      proxy.URL,
+		Success:    checkErr == nil,
+		AvgLatency: proxy.Measured,
+		At:         time.Now(),
+	}
+}
+
+// Check 验证单个代理，并根据结果驱动状态流转
+// 参数:
+//   - ctx: 上下文
+//   - proxy: 要检查的代理
+//
+// 返回:
+//   - ProxyState: 检查后的状态
+//   - time.Duration: 验证请求耗时
+//   - error: 代理不可用时返回错误
+func (p *ProxyPool) Check(ctx context.Context, proxy *Proxy) (ProxyState, time.Duration, error) {
+	if _, err := p.States().Transition(proxy.URL, EventCheckStart, ""); err != nil {
+		return ProxyState{}, 0, fmt.Errorf("更新代理状态失败: %w", err)
+	}
+
+	latency, checkErr := CheckProxy(ctx, proxy, p.checkURL, p.timeout)
+	if checkErr != nil && ctx.Err() != nil {
+		// 检查被取消不是代理的问题，保持验证中，超过CheckTimeout后重新检查
+		return ProxyState{}, latency, checkErr
+	}
+	ev, errMsg := EventCheckPass, ""
+	if checkErr != nil {
+		ev, errMsg = EventCheckFail, checkErr.Error()
+	}
+
+	st, err := p.States().Transition(proxy.URL, ev, errMsg)
+	if err != nil {
+		return ProxyState{}, latency, fmt.Errorf("更新代理状态失败: %w", err)
+	}
+	p.applyState(proxy, st)
+
+	if checkErr == nil {
+		p.mu.Lock()
+		proxy.observeLatency(latency)
+		p.mu.Unlock()
+	}
+	return st, latency, checkErr
+}
+
+// PurgeDead 清除失效时间超过保留期的代理
+// 同时从状态存储、代理池和MongoDB中删除。只删除状态而保留MongoDB记录时，
+// 下次SyncFromMongo会把失效代理当作新代理重新加入，所以mongoClient为nil时不清除
+//
+// 返回:
+//   - []string: 被清除的代理地址
+//   - error: 如果清除失败则返回错误
+func (p *ProxyPool) PurgeDead(mongoClient *mongodb.MongoClient) ([]string, error) {
+	if mongoClient == nil {
+		return nil, ErrNoMongoClient
+	}
+
+	dead, err := p.States().List(StateDead)
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-p.lifecycle.DeadRetention)
+	purged := make([]string, 0)
+	for _, st := range dead {
+		if st.Since.Before(cutoff) {
+			purged = append(purged, st.Proxy)
+		}
+	}
+	if len(purged) == 0 {
+		return purged, nil
+	}
+
+	if _, err := mongoClient.DeleteProxies(proxyDatabase, proxyCollection, purged); err != nil {
+		return nil, err
+	}
+	if err := p.States().Remove(purged...); err != nil {
+		return nil, err
+	}
+	for _, proxyURL := range purged {
+		p.RemoveProxy(proxyURL)
+	}
+
+	log.Printf("已清除 %d 个失效代理", len(purged))
+	return purged, nil
+}
+
+// SaveMeasured 把上次保存后变化了的测得延迟写入MongoDB
+// 运行时请求测得的延迟只保存在内存中，定期保存后其它进程加载代理时才能使用
+//
+// 返回:
+//   - int: 保存的代理数量
+//   - error: 如果保存失败则返回错误
+func (p *ProxyPool) SaveMeasured(mongoClient *mongodb.MongoClient) (int, error) {
+	if mongoClient == nil {
+		return 0, ErrNoMongoClient
+	}
+
+	changed := make(map[string]time.Duration)
+	p.mu.RLock()
+	for _, proxy := range p.proxies {
+		if proxy.Measured > 0 && proxy.Measured != proxy.savedMeasured {
+			changed[proxy.URL] = proxy.Measured
+		}
+	}
+	p.mu.RUnlock()
+	if len(changed) == 0 {
+		return 0, nil
+	}
+
+	if err := mongoClient.UpdateProxyLatency(proxyDatabase, proxyCollection, changed); err != nil {
+		return 0, err
+	}
+
+	p.mu.Lock()
+	for _, proxy := range p.proxies {
+		if d, ok := changed[proxy.URL]; ok {
+			proxy.savedMeasured = d
+		}
+	}
+	p.mu.Unlock()
+	return len(changed), nil
+}
+
+// RunMaintenance 定期执行健康检查、测得延迟保存和失效代理清除，直到上下文取消
+// mongoClient为nil时只做健康检查，不更新健康统计，也不清除失效代理
+func (p *ProxyPool) RunMaintenance(ctx context.Context, mongoClient *mongodb.MongoClient, interval time.Duration) {
+	if mongoClient == nil {
+		log.Printf("未提供MongoDB客户端，不清除失效代理")
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		passed, failed := p.HealthCheck(ctx, mongoClient, 0)
+		if passed+failed > 0 {
+			log.Printf("代理健康检查完成: 通过 %d，失败 %d", passed, failed)
+		}
+		if mongoClient != nil {
+			if _, err := p.SaveMeasured(mongoClient); err != nil {
+				log.Printf("%v", err)
+			}
+			if _, err := p.PurgeDead(mongoClient); err != nil {
+				log.Printf("清除失效代理失败: %v", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GatewayConfig 本地转发代理网关配置
+type GatewayConfig struct {
+	Strategy    Strategy      // 上游代理轮换策略
+	Selector    Selector      // 上游代理筛选条件
+	DialTimeout time.Duration // 连接上游代理的超时时间
+	MaxAttempts int           // 每个请求最多尝试的上游代理数量
+}
+
+// Gateway 本地HTTP/HTTPS转发代理
+// 其他工具（Python脚本、curl、浏览器）把它当作普通HTTP代理使用，
+// 网关为每个请求从代理池中选择上游代理转发，并把上游的失败反馈给代理池
+type Gateway struct {
+	pool       *ProxyPool                 // 代理池
+	config     GatewayConfig              // 网关配置
+	transports map[string]*http.Transport // 每个上游代理复用一个Transport
+	mu         sync.Mutex                 // 保护transports
+}
+
+// hopHeaders 逐跳头部，转发时需要删除
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// NewGateway 创建转发代理网关
+// 参数:
+//   - pool: 提供上游代理的代理池
+//   - config: 网关配置
+func NewGateway(pool *ProxyPool, config GatewayConfig) *Gateway {
+	if config.DialTimeout <= 0 {
+		config.DialTimeout = 10 * time.Second
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 3
+	}
+	return &Gateway{
+		pool:       pool,
+		config:     config,
+		transports: make(map[string]*http.Transport),
+	}
+}
+
+// ServeHTTP 处理代理请求
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		g.handleConnect(w, r)
+		return
+	}
+	if !r.URL.IsAbs() {
+		http.Error(w, "该服务只能作为代理使用", http.StatusBadRequest)
+		return
+	}
+	g.handleHTTP(w, r)
+}
+
+// nextUpstream 从代理池选择一个支持HTTP CONNECT的上游代理
+// socks代理无法用于CONNECT隧道，这里只使用http/https代理
+func (g *Gateway) nextUpstream(tried map[string]bool) *Proxy {
+	for i := 0; i < 10; i++ {
+		upstream := g.pool.NextWith(g.config.Strategy, g.config.Selector)
+		if upstream == nil {
+			return nil
+		}
+		protocol := strings.ToLower(upstream.Protocol)
+		if tried[upstream.URL] || (protocol != "" && protocol != "http" && protocol != "https") {
+			continue
+		}
+		return upstream
+	}
+	return nil
+}
+
+// report 把上游结果反馈给代理池，代理失效时释放它的Transport
+func (g *Gateway) report(upstream *Proxy, feedback Feedback) {
+	st, err := g.pool.ReportResult(upstream.URL, feedback)
+	if err != nil {
+		log.Printf("上报代理结果失败: %v", err)
+		return
+	}
+	if st.State == StateDead {
+		g.evict(upstream.URL)
+	}
+}
+
+// handleConnect 通过上游代理建立HTTPS隧道
+func (g *Gateway) handleConnect(w http.ResponseWriter, r *http.Request) {
+	tried := make(map[string]bool)
+	for attempt := 0; attempt < g.config.MaxAttempts; attempt++ {
+		upstream := g.nextUpstream(tried)
+		if upstream == nil {
+			break
+		}
+		tried[upstream.URL] = true
+
+		start := time.Now()
+		conn, reader, err := g.dialTunnel(upstream, r.Host)
+		if err != nil {
+			log.Printf("上游代理 %s 建立隧道失败: %v", upstream.URL, err)
+			g.report(upstream, feedbackFromError(err))
+			continue
+		}
+		g.report(upstream, Feedback{StatusCode: http.StatusOK, Latency: time.Since(start)})
+
+		hijacker, ok := w.(http.Hijacker)
+		if !ok {
+			conn.Close()
+			http.Error(w, "不支持连接劫持", http.StatusInternalServerError)
+			return
+		}
+		client, clientBuf, err := hijacker.Hijack()
+		if err != nil {
+			conn.Close()
+			return
+		}
+		if _, err := client.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+			client.Close()
+			conn.Close()
+			return
+		}
+
+		// 双向转发，通过缓冲读取器读取以免丢失已经缓冲的数据
+		go tunnel(conn, clientBuf.Reader, conn, client)
+		tunnel(client, reader, client, conn)
+		return
+	}
+
+	http.Error(w, "没有可用的上游代理", http.StatusBadGateway)
+}
+
+// dialTunnel 连接上游代理并发送CONNECT请求
+func (g *Gateway) dialTunnel(upstream *Proxy, target string) (net.Conn, *bufio.Reader, error) {
+	proxyURL, err := upstream.ProxyURL()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	conn, err := net.DialTimeout("tcp", proxyURL.Host, g.config.DialTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	conn.SetDeadline(time.Now().Add(g.config.DialTimeout))
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    proxyURL,
+		Host:   target,
+		Header: make(http.Header),
+	}
+	req.URL.Opaque = target
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		conn.Close()
+		return nil, nil, &upstreamStatusError{StatusCode: resp.StatusCode}
+	}
+	conn.SetDeadline(time.Time{})
+
+	return conn, reader, nil
+}
+
+// handleHTTP 通过上游代理转发普通HTTP请求
+// 只有没有请求体的请求才会在上游失败时换代理重试
+func (g *Gateway) handleHTTP(w http.ResponseWriter, r *http.Request) {
+	attempts := g.config.MaxAttempts
+	if r.Body != nil && r.ContentLength != 0 {
+		attempts = 1
+	}
+
+	tried := make(map[string]bool)
+	for attempt := 0; attempt < attempts; attempt++ {
+		upstream := g.nextUpstream(tried)
+		if upstream == nil {
+			break
+		}
+		tried[upstream.URL] = true
+
+		transport, err := g.transport(upstream)
+		if err != nil {
+			g.report(upstream, Feedback{Err: err})
+			continue
+		}
+
+		out := r.Clone(r.Context())
+		out.RequestURI = ""
+		removeHopHeaders(out.Header)
+
+		start := time.Now()
+		resp, err := transport.RoundTrip(out)
+		if err != nil && r.Context().Err() != nil {
+			// 客户端取消了请求，不是上游代理的问题
+			return
+		}
+		if err != nil {
+			log.Printf("上游代理 %s 转发失败: %v", upstream.URL, err)
+			g.report(upstream, Feedback{Err: err})
+			continue
+		}
+		g.report(upstream, Feedback{StatusCode: resp.StatusCode, Latency: time.Since(start)})
+
+		defer resp.Body.Close()
+		removeHopHeaders(resp.Header)
+		for key, values := range resp.Header {
+			for _, value := range values {
+				w.Header().Add(key, value)
+			}
+		}
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+		return
+	}
+
+	http.Error(w, "没有可用的上游代理", http.StatusBadGateway)
+}
+
+// transport 获取上游代理对应的Transport
+func (g *Gateway) transport(upstream *Proxy) (*http.Transport, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if t, ok := g.transports[upstream.URL]; ok {
+		return t, nil
+	}
+
+	proxyURL, err := upstream.ProxyURL()
+	if err != nil {
+		return nil, err
+	}
+	t := &http.Transport{
+		Proxy:                 http.ProxyURL(proxyURL),
+		DialContext:           (&net.Dialer{Timeout: g.config.DialTimeout}).DialContext,
+		ResponseHeaderTimeout: 30 * time.Second,
+		MaxIdleConnsPerHost:   4,
+		IdleConnTimeout:       90 * time.Second,
+	}
+	g.transports[upstream.URL] = t
+	return t, nil
+}
+
+// evict 关闭并删除上游代理的Transport
+func (g *Gateway) evict(proxyURL string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if t, ok := g.transports[proxyURL]; ok {
+		t.CloseIdleConnections()
+		delete(g.transports, proxyURL)
+	}
+}
+
+// PruneTransports 删除已不在代理池中的上游代理的Transport，返回删除的数量
+// 代理被清除或刷新后移出代理池时调用
+func (g *Gateway) PruneTransports() int {
+	live := make(map[string]bool)
+	for _, proxy := range g.pool.snapshot() {
+		live[proxy.URL] = true
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	pruned := 0
+	for proxyURL, t := range g.transports {
+		if !live[proxyURL] {
+			t.CloseIdleConnections()
+			delete(g.transports, proxyURL)
+			pruned++
+		}
+	}
+	return pruned
+}
+
+// upstreamStatusError 上游代理拒绝CONNECT请求
+type upstreamStatusError struct {
+	StatusCode int
+}
+
+func (e *upstreamStatusError) Error() string {
+	return fmt.Sprintf("上游代理返回状态码 %d", e.StatusCode)
+}
+
+// feedbackFromError 将建立隧道的错误转换为反馈
+func feedbackFromError(err error) Feedback {
+	if statusErr, ok := err.(*upstreamStatusError); ok {
+		return Feedback{StatusCode: statusErr.StatusCode}
+	}
+	return Feedback{Err: err}
+}
+
+// removeHopHeaders 删除逐跳头部
+func removeHopHeaders(header http.Header) {
+	for _, key := range hopHeaders {
+		header.Del(key)
+	}
+}
+
+// tunnel 单向转发数据，结束时关闭两端连接
+func tunnel(dst io.Writer, src io.Reader, closers ...io.Closer) {
+	io.Copy(dst, src)
+	for _, c := range closers {
+		c.Close()
+	}
+}
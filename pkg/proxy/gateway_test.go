@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 测试网关通过上游代理转发HTTP请求，并把失败的上游反馈给代理池
+func TestGatewayForwardHTTP(t *testing.T) {
+	// 模拟上游代理：收到绝对URL形式的请求并直接应答
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "via upstream "+r.URL.Host)
+	}))
+	defer upstream.Close()
+
+	// 一个无法连接的上游代理
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadAddr := listener.Addr().String()
+	listener.Close()
+
+	pool := NewProxyPool(Config{Timeout: 5 * time.Second})
+	pool.AddProxyRecord(&Proxy{URL: deadAddr, Protocol: "http", Available: true})
+	pool.AddProxyRecord(&Proxy{URL: strings.TrimPrefix(upstream.URL, "http://"), Protocol: "http", Available: true})
+
+	gateway := httptest.NewServer(NewGateway(pool, GatewayConfig{
+		Strategy:    StrategyRoundRobin,
+		DialTimeout: time.Second,
+		MaxAttempts: 2,
+	}))
+	defer gateway.Close()
+
+	gatewayURL, _ := url.Parse(gateway.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(gatewayURL)}}
+
+	resp, err := client.Get("http://example.test/page")
+	if err != nil {
+		t.Fatalf("通过网关请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK || string(body) != "via upstream example.test" {
+		t.Fatalf("响应 = %d %q", resp.StatusCode, body)
+	}
+
+	st, _ := pool.States().Get(deadAddr)
+	if st.State != StateCoolingDown {
+		t.Errorf("失败的上游状态 = %s, 期望 %s", st.State, StateCoolingDown)
+	}
+}
+
+// 测试移出代理池的上游代理的Transport被删除
+func TestGatewayPruneTransports(t *testing.T) {
+	pool := NewProxyPool(Config{Timeout: 5 * time.Second})
+	pool.AddProxyRecord(&Proxy{URL: "10.0.0.1:8080", Protocol: "http", Available: true})
+	pool.AddProxyRecord(&Proxy{URL: "10.0.0.2:8080", Protocol: "http", Available: true})
+
+	gateway := NewGateway(pool, GatewayConfig{})
+	for _, proxy := range pool.snapshot() {
+		if _, err := gateway.transport(proxy); err != nil {
+			t.Fatalf("transport() error = %v", err)
+		}
+	}
+
+	pool.RemoveProxy("10.0.0.1:8080")
+	if n := gateway.PruneTransports(); n != 1 {
+		t.Errorf("PruneTransports() = %d, 期望 1", n)
+	}
+	if _, ok := gateway.transports["10.0.0.2:8080"]; !ok || len(gateway.transports) != 1 {
+		t.Errorf("剩余Transport = %v", gateway.transports)
+	}
+
+	// 认证失败的代理直接失效，Transport随之释放
+	gateway.report(&Proxy{URL: "10.0.0.2:8080"}, Feedback{StatusCode: http.StatusProxyAuthRequired})
+	if len(gateway.transports) != 0 {
+		t.Errorf("失效代理的Transport未释放: %v", gateway.transports)
+	}
+}
@@ -0,0 +1,287 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// State 代理的生命周期状态
+type State string
+
+const (
+	StateNew         State = "new"          // 新采集，尚未验证
+	StateValidating  State = "validating"   // 正在进行健康检查
+	StateActive      State = "active"       // 可正常使用
+	StateCoolingDown State = "cooling_down" // 短暂失败后冷却，冷却结束自动恢复
+	StateQuarantined State = "quarantined"  // 被隔离，隔离结束后需重新验证
+	StateDead        State = "dead"         // 已失效，超过保留期后清除
+)
+
+// AllStates 所有生命周期状态，按流转顺序排列
+var AllStates = []State{StateNew, StateValidating, StateActive, StateCoolingDown, StateQuarantined, StateDead}
+
+// Event 驱动状态流转的事件
+type Event string
+
+const (
+	EventCheckStart   Event = "check_start"   // 开始健康检查
+	EventCheckPass    Event = "check_pass"    // 健康检查通过
+	EventCheckFail    Event = "check_fail"    // 健康检查失败
+	EventSuccess      Event = "success"       // 运行时请求成功
+	EventTimeout      Event = "timeout"       // 运行时请求超时
+	EventError        Event = "error"         // 运行时连接错误
+	EventBanned       Event = "banned"        // 目标站点封禁了该出口IP
+	EventAuthRequired Event = "auth_required" // 代理要求认证（HTTP 407）
+)
+
+// ProxyState 代理当前的生命周期状态记录
+type ProxyState struct {
+	Proxy       string    `json:"proxy"`                // 代理地址
+	State       State     `json:"state"`                // 当前状态
+	Since       time.Time `json:"since"`                // 进入当前状态的时间
+	Until       time.Time `json:"until,omitempty"`      // 冷却、隔离或验证的结束时间
+	Failures    int       `json:"failures"`             // 连续失败次数
+	Quarantines int       `json:"quarantines"`          // 连续被隔离的次数，决定隔离时长
+	Successes   int64     `json:"successes"`            // 累计成功次数（健康检查和运行时）
+	Errors      int64     `json:"errors"`               // 累计失败次数（健康检查和运行时）
+	LastEvent   Event     `json:"last_event,omitempty"` // 最后一次事件
+	LastError   string    `json:"last_error,omitempty"` // 最后一次错误信息
+	UpdatedAt   time.Time `json:"updated_at"`           // 最后更新时间
+}
+
+// Usable 判断代理在指定时间是否可以使用
+// 新代理尚未验证，也允许使用；冷却结束的代理视为可用
+func (s ProxyState) Usable(now time.Time) bool {
+	switch s.State {
+	case StateActive, StateNew:
+		return true
+	case StateCoolingDown:
+		return !now.Before(s.Until)
+	default:
+		return false
+	}
+}
+
+// DueForCheck 判断代理是否需要进行健康检查
+// 新代理和隔离期已结束的代理需要重新验证；
+// 检查超时仍处于验证中的代理说明检查被中断（进程崩溃、取消等），也需要重新验证
+func (s ProxyState) DueForCheck(now time.Time) bool {
+	switch s.State {
+	case StateNew:
+		return true
+	case StateQuarantined, StateValidating:
+		return !now.Before(s.Until)
+	default:
+		return false
+	}
+}
+
+// LifecycleConfig 生命周期配置
+type LifecycleConfig struct {
+	CooldownDuration time.Duration // 短暂失败后的冷却时间
+	QuarantineBase   time.Duration // 第一次隔离的时长，之后每次翻倍
+	QuarantineMax    time.Duration // 隔离时长上限
+	MaxFailures      int           // 连续失败达到该次数后进入隔离
+	MaxQuarantines   int           // 连续隔离超过该次数后判定失效
+	DeadRetention    time.Duration // 失效代理的保留时间，超过后清除
+	CheckTimeout     time.Duration // 一次健康检查的最长时间，超过后仍在验证中的代理重新检查，应大于代理池的Timeout
+}
+
+// DefaultLifecycleConfig 默认生命周期配置
+var DefaultLifecycleConfig = LifecycleConfig{
+	CooldownDuration: time.Minute,
+	QuarantineBase:   5 * time.Minute,
+	QuarantineMax:    6 * time.Hour,
+	MaxFailures:      3,
+	MaxQuarantines:   5,
+	DeadRetention:    7 * 24 * time.Hour,
+	CheckTimeout:     2 * time.Minute,
+}
+
+// withDefaults 用默认值补全未设置的配置项
+func (c LifecycleConfig) withDefaults() LifecycleConfig {
+	if c.CooldownDuration <= 0 {
+		c.CooldownDuration = DefaultLifecycleConfig.CooldownDuration
+	}
+	if c.QuarantineBase <= 0 {
+		c.QuarantineBase = DefaultLifecycleConfig.QuarantineBase
+	}
+	if c.QuarantineMax <= 0 {
+		c.QuarantineMax = DefaultLifecycleConfig.QuarantineMax
+	}
+	if c.MaxFailures <= 0 {
+		c.MaxFailures = DefaultLifecycleConfig.MaxFailures
+	}
+	if c.MaxQuarantines <= 0 {
+		c.MaxQuarantines = DefaultLifecycleConfig.MaxQuarantines
+	}
+	if c.DeadRetention <= 0 {
+		c.DeadRetention = DefaultLifecycleConfig.DeadRetention
+	}
+	if c.CheckTimeout <= 0 {
+		c.CheckTimeout = DefaultLifecycleConfig.CheckTimeout
+	}
+	return c
+}
+
+// QuarantineDuration 计算第n次隔离的时长（指数退避）
+func (c LifecycleConfig) QuarantineDuration(n int) time.Duration {
+	c = c.withDefaults()
+	d := c.QuarantineBase
+	for i := 1; i < n && d < c.QuarantineMax; i++ {
+		d *= 2
+	}
+	if d > c.QuarantineMax {
+		d = c.QuarantineMax
+	}
+	return d
+}
+
+// Apply 根据事件计算新的状态
+// 该方法不修改传入的状态，失效的代理不会再被任何事件恢复
+//
+// 参数:
+//   - st: 当前状态
+//   - ev: 发生的事件
+//   - errMsg: 事件附带的错误信息，可为空
+//   - now: 事件发生时间
+//
+// 返回:
+//   - ProxyState: 流转后的状态
+func (c LifecycleConfig) Apply(st ProxyState, ev Event, errMsg string, now time.Time) ProxyState {
+	next := c.transition(st, ev, errMsg, now)
+	if st.State == StateDead {
+		return next
+	}
+
+	// 累计成功和失败次数，用于统计成功率
+	switch ev {
+	case EventSuccess, EventCheckPass:
+		next.Successes++
+	case EventCheckFail, EventTimeout, EventError, EventBanned, EventAuthRequired:
+		next.Errors++
+	}
+	return next
+}
+
+// transition 计算事件触发的状态流转
+func (c LifecycleConfig) transition(st ProxyState, ev Event, errMsg string, now time.Time) ProxyState {
+	c = c.withDefaults()
+	if st.State == "" {
+		st.State = StateNew
+		st.Since = now
+	}
+	if st.State == StateDead {
+		return st
+	}
+
+	next := st
+	next.LastEvent = ev
+	next.UpdatedAt = now
+	if errMsg != "" {
+		next.LastError = errMsg
+	}
+
+	switch ev {
+	case EventCheckStart:
+		next.setState(StateValidating, now)
+		next.Until = now.Add(c.CheckTimeout)
+
+	case EventCheckPass:
+		next.Failures = 0
+		next.setState(StateActive, now)
+
+	case EventCheckFail:
+		next.Failures++
+		c.quarantine(&next, now)
+
+	case EventSuccess:
+		// 隔离中的代理收到的成功反馈可能是过期的，不改变状态
+		if st.State == StateQuarantined || st.State == StateValidating {
+			return st
+		}
+		next.Failures = 0
+		next.Quarantines = 0
+		next.setState(StateActive, now)
+
+	case EventTimeout, EventError:
+		if st.State == StateQuarantined {
+			return st
+		}
+		next.Failures++
+		if next.Failures >= c.MaxFailures {
+			c.quarantine(&next, now)
+		} else {
+			next.setState(StateCoolingDown, now)
+			next.Until = now.Add(c.CooldownDuration)
+		}
+
+	case EventBanned:
+		if st.State == StateQuarantined {
+			return st
+		}
+		next.Failures++
+		c.quarantine(&next, now)
+
+	case EventAuthRequired:
+		// 代理要求认证，我们没有凭据，不会自行恢复
+		next.setState(StateDead, now)
+	}
+
+	return next
+}
+
+// quarantine 将状态置为隔离，隔离次数过多时判定失效
+func (c LifecycleConfig) quarantine(st *ProxyState, now time.Time) {
+	st.Quarantines++
+	if st.Quarantines > c.MaxQuarantines {
+		st.setState(StateDead, now)
+		return
+	}
+	st.setState(StateQuarantined, now)
+	st.Until = now.Add(c.QuarantineDuration(st.Quarantines))
+}
+
+// setState 切换状态并记录进入时间
+func (s *ProxyState) setState(state State, now time.Time) {
+	if s.State != state {
+		s.Since = now
+	}
+	s.State = state
+	s.Until = time.Time{}
+}
+
+// Feedback 抓取器对一次代理请求的反馈
+type Feedback struct {
+	StatusCode int           // 目标站点返回的HTTP状态码，请求失败时为0
+	Err        error         // 请求错误
+	Banned     bool          // 抓取器是否识别到封禁（例如验证码页面）
+	Latency    time.Duration // 请求耗时
+}
+
+// Event 将反馈归类为生命周期事件
+func (f Feedback) Event() Event {
+	if f.Err != nil {
+		var netErr net.Error
+		if errors.Is(f.Err, context.DeadlineExceeded) || (errors.As(f.Err, &netErr) && netErr.Timeout()) {
+			return EventTimeout
+		}
+		return EventError
+	}
+	if f.Banned {
+		return EventBanned
+	}
+
+	switch f.StatusCode {
+	case http.StatusProxyAuthRequired:
+		return EventAuthRequired
+	case http.StatusForbidden, http.StatusTooManyRequests:
+		return EventBanned
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return EventError
+	}
+	return EventSuccess
+}
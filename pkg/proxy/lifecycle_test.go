@@ -0,0 +1,143 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 测试健康检查驱动的状态流转
+func TestLifecycleCheck(t *testing.T) {
+	cfg := LifecycleConfig{QuarantineBase: time.Minute, QuarantineMax: 3 * time.Minute, MaxQuarantines: 3}
+	now := time.Now()
+
+	st := cfg.Apply(ProxyState{}, EventCheckStart, "", now)
+	if st.State != StateValidating {
+		t.Fatalf("状态 = %s, 期望 %s", st.State, StateValidating)
+	}
+	// 检查被中断时，验证状态超时后重新检查
+	if st.DueForCheck(now) || !st.DueForCheck(now.Add(DefaultLifecycleConfig.CheckTimeout)) {
+		t.Errorf("验证中的代理复检时间不正确: %+v", st)
+	}
+
+	st = cfg.Apply(st, EventCheckPass, "", now)
+	if st.State != StateActive || !st.Usable(now) {
+		t.Fatalf("状态 = %s, 期望 %s", st.State, StateActive)
+	}
+
+	// 连续隔离时长指数增长，并受上限约束
+	want := []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute}
+	for i, d := range want {
+		st = cfg.Apply(st, EventCheckFail, "timeout", now)
+		if st.State != StateQuarantined {
+			t.Fatalf("第%d次失败后状态 = %s, 期望 %s", i+1, st.State, StateQuarantined)
+		}
+		if got := st.Until.Sub(now); got != d {
+			t.Errorf("第%d次隔离时长 = %v, 期望 %v", i+1, got, d)
+		}
+		if st.DueForCheck(now) || !st.DueForCheck(st.Until) {
+			t.Errorf("第%d次隔离的复检时间不正确", i+1)
+		}
+	}
+
+	// 超过最大隔离次数后失效，且不再恢复
+	st = cfg.Apply(st, EventCheckFail, "timeout", now)
+	if st.State != StateDead {
+		t.Fatalf("状态 = %s, 期望 %s", st.State, StateDead)
+	}
+	if st = cfg.Apply(st, EventCheckPass, "", now); st.State != StateDead {
+		t.Errorf("失效代理被恢复为 %s", st.State)
+	}
+}
+
+// 测试运行时反馈驱动的状态流转
+func TestLifecycleFeedback(t *testing.T) {
+	cfg := LifecycleConfig{CooldownDuration: 10 * time.Second, MaxFailures: 2}
+	now := time.Now()
+	st := ProxyState{State: StateActive, Since: now}
+
+	st = cfg.Apply(st, Feedback{Err: timeoutError{}}.Event(), "", now)
+	if st.State != StateCoolingDown || st.Usable(now) || !st.Usable(now.Add(10*time.Second)) {
+		t.Fatalf("超时后状态 = %+v, 期望冷却10秒", st)
+	}
+
+	st = cfg.Apply(st, Feedback{Err: errors.New("connection refused")}.Event(), "", now)
+	if st.State != StateQuarantined {
+		t.Fatalf("连续失败后状态 = %s, 期望 %s", st.State, StateQuarantined)
+	}
+
+	st = ProxyState{State: StateActive, Since: now}
+	if st = cfg.Apply(st, Feedback{StatusCode: http.StatusTooManyRequests}.Event(), "", now); st.State != StateQuarantined {
+		t.Errorf("429后状态 = %s, 期望 %s", st.State, StateQuarantined)
+	}
+
+	st = ProxyState{State: StateActive, Since: now}
+	if st = cfg.Apply(st, Feedback{StatusCode: http.StatusProxyAuthRequired}.Event(), "", now); st.State != StateDead {
+		t.Errorf("407后状态 = %s, 期望 %s", st.State, StateDead)
+	}
+}
+
+// 测试上报结果后代理池不再返回被隔离的代理
+func TestReportResult(t *testing.T) {
+	pool := NewProxyPool(Config{Timeout: 5 * time.Second})
+	pool.AddProxyRecord(&Proxy{URL: "10.0.0.1:8080", Protocol: "http", Available: true})
+	pool.AddProxyRecord(&Proxy{URL: "10.0.0.2:8080", Protocol: "http", Available: true})
+
+	if _, err := pool.ReportResult("10.0.0.1:8080", Feedback{Banned: true}); err != nil {
+		t.Fatalf("ReportResult() error = %v", err)
+	}
+
+	proxy := pool.GetProxy()
+	if proxy == nil || proxy.URL != "10.0.0.2:8080" {
+		t.Fatalf("GetProxy() = %v, 期望 10.0.0.2:8080", proxy)
+	}
+}
+
+// 测试健康检查只验证到期的代理
+func TestHealthCheck(t *testing.T) {
+	// 模拟HTTP代理，对所有请求返回200
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+	good := strings.TrimPrefix(upstream.URL, "http://")
+
+	pool := NewProxyPool(Config{Timeout: 2 * time.Second, CheckURL: "http://check.invalid/ip"})
+	pool.AddProxyRecord(&Proxy{URL: good, Protocol: "http"})
+	pool.AddProxyRecord(&Proxy{URL: "127.0.0.1:1", Protocol: "http"})
+	pool.AddProxyRecord(&Proxy{URL: "127.0.0.2:1", Protocol: "http"})
+
+	// 已验证通过的代理不到期，不应再次检查
+	pool.States().Transition("127.0.0.2:1", EventCheckStart, "")
+	before, _ := pool.States().Transition("127.0.0.2:1", EventCheckPass, "")
+
+	passed, failed := pool.HealthCheck(context.Background(), nil, 2)
+	if passed != 1 || failed != 1 {
+		t.Fatalf("HealthCheck() = %d, %d, 期望 1, 1", passed, failed)
+	}
+
+	want := map[string]State{good: StateActive, "127.0.0.1:1": StateQuarantined, "127.0.0.2:1": StateActive}
+	for addr, state := range want {
+		st, err := pool.States().Get(addr)
+		if err != nil {
+			t.Fatalf("Get(%s) error = %v", addr, err)
+		}
+		if st.State != state {
+			t.Errorf("%s 状态 = %s, 期望 %s", addr, st.State, state)
+		}
+	}
+	if st, _ := pool.States().Get("127.0.0.2:1"); !st.UpdatedAt.Equal(before.UpdatedAt) {
+		t.Errorf("未到期的代理被重新检查: %+v", st)
+	}
+}
+
+// timeoutError 模拟网络超时错误
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
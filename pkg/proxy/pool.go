@@ -3,6 +3,7 @@
 package proxy
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/url"
@@ -13,29 +14,62 @@ import (
 	"japan_spider/pkg/redis"
 )
 
+const (
+	proxyDatabase   = "proxy_pool"          // 代理所在的MongoDB数据库
+	proxyCollection = "proxies"             // 代理所在的MongoDB集合
+	currentBatchKey = "current_proxy_batch" // Redis中当前代理批次的键
+	proxyDetailsKey = "proxy_details"       // Redis中代理元数据的哈希表键
+)
+
 // Proxy 定义单个代理的详细信息
 // 包含代理的地址、协议、评分等属性
 type Proxy struct {
-	URL       string // 代理服务器的完整URL地址
-	Protocol  string // 代理协议类型
-	Available bool   // 代理当前是否可用
+	URL         string        // 代理服务器的完整URL地址
+	Protocol    string        // 代理协议类型，连接代理时使用
+	Protocols   []string      // 代理支持的全部协议，为空时视为只支持Protocol
+	Available   bool          // 代理当前是否可用，与生命周期状态保持一致
+	State       State         // 生命周期状态
+	Country     string        // 国家名称，例如 Japan
+	CountryCode string        // 国家代码，例如 JP
+	Anonymity   string        // 匿名级别：elite/anonymous/transparent
+	Speed       float64       // 速度评分
+	Latency     time.Duration // 来源方报告的延迟
+	Measured    time.Duration // 健康检查和运行时请求测得的延迟（指数移动平均），保存在MongoDB的health.avg_latency中，0表示尚未测量
+	Uptime      float64       // 在线率（百分比）
+	Reliability float64       // 可用性（百分比）
+	Source      string        // 代理来源
+	LastChecked time.Time     // 来源方最后检查时间
+	Successes   int64         // 运行时成功次数
+	Failures    int64         // 运行时失败次数
+
+	savedMeasured time.Duration // 最后一次保存到MongoDB的测得延迟
 }
 
 // ProxyPool 代理池的核心结构
 // 管理代理列表并提供线程安全的操作方法
 type ProxyPool struct {
-	proxies    []*Proxy      // 代理列表，存储所有已添加的代理
-	mu         sync.RWMutex  // 读写锁，保护并发访问代理列表
-	maxRetries int           // 最大重试次数，超过此次数的代理将被标记为不可用
-	checkURL   string        // 用于验证代理可用性的测试URL
-	timeout    time.Duration // 代理请求超时时间
+	proxies    []*Proxy        // 代理列表，存储所有已添加的代理
+	mu         sync.RWMutex    // 读写锁，保护并发访问代理列表
+	maxRetries int             // 最大重试次数，超过此次数的代理将被标记为不可用
+	checkURL   string          // 用于验证代理可用性的测试URL
+	timeout    time.Duration   // 代理请求超时时间
+	selector   Selector        // 代理筛选条件，只返回满足条件的代理
+	states     StateStore      // 生命周期状态存储
+	lifecycle  LifecycleConfig // 生命周期配置
+	strategy   Strategy        // 轮换策略
+	cursor     int             // 依次轮换的位置
 }
 
 // Config 代理池配置选项
 // 用于初始化代理池时的参数设置
 type Config struct {
-	BatchSize int           // 每批加载的代理数量
-	Timeout   time.Duration // 操作超时时间
+	BatchSize  int             // 每批加载的代理数量
+	Timeout    time.Duration   // 操作超时时间
+	Selector   Selector        // 代理筛选条件，例如只使用日本的代理
+	CheckURL   string          // 验证代理可用性的地址，为空时使用默认地址
+	Lifecycle  LifecycleConfig // 生命周期配置，未设置的项使用默认值
+	StateStore StateStore      // 生命周期状态存储，为nil时使用内存存储
+	Strategy   Strategy        // 轮换策略，为空时依次轮换
 }
 
 // MongoDBConfig MongoDB连接配置
@@ -60,12 +94,60 @@ type RedisConfig struct {
 // 返回:
 //   - *ProxyPool: 初始化好的代理池实例
 func NewProxyPool(config Config) *ProxyPool {
+	lifecycle := config.Lifecycle.withDefaults()
+
+	// 未指定状态存储时使用内存存储；多节点部署应使用RedisStateStore
+	states := config.StateStore
+	if states == nil {
+		states = NewMemoryStateStore(lifecycle)
+	}
+
+	checkURL := config.CheckURL
+	if checkURL == "" {
+		checkURL = defaultCheckURL
+	}
+
 	return &ProxyPool{
-		proxies: make([]*Proxy, 0), // 初始化空的代理列表
-		timeout: config.Timeout,    // 设置超时时间
+		proxies:   make([]*Proxy, 0), // 初始化空的代理列表
+		timeout:   config.Timeout,    // 设置超时时间
+		selector:  config.Selector,   // 设置筛选条件
+		checkURL:  checkURL,          // 设置验证地址
+		states:    states,            // 设置状态存储
+		lifecycle: lifecycle,         // 设置生命周期配置
+		strategy:  config.Strategy,   // 设置轮换策略
 	}
 }
 
+// SetStateStore 设置生命周期状态存储
+// 使用RedisStateStore时所有节点共享同一份代理状态
+func (p *ProxyPool) SetStateStore(store StateStore) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.states = store
+}
+
+// States 获取生命周期状态存储
+func (p *ProxyPool) States() StateStore {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.states
+}
+
+// SetSelector 设置代理筛选条件
+// 之后获取代理时只返回满足条件的代理
+func (p *ProxyPool) SetSelector(selector Selector) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.selector = selector
+}
+
+// Selector 获取当前的代理筛选条件
+func (p *ProxyPool) Selector() Selector {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.selector
+}
+
 // AddProxy 向代理池添加新的代理
 // 参数:
 //   - proxyURL: 代理服务器URL
@@ -88,6 +170,7 @@ func (p *ProxyPool) AddProxy(proxyURL string, protocol string) error {
 		URL:       proxyURL,
 		Protocol:  protocol,
 		Available: true,
+		State:     StateNew,
 	}
 
 	// 将代理添加到列表
@@ -95,19 +178,145 @@ func (p *ProxyPool) AddProxy(proxyURL string, protocol string) error {
 	return nil
 }
 
-// GetProxy 获取一个可用代理
+// AddProxyRecord 向代理池添加带有完整元数据的代理
+// 参数:
+//   - proxy: 代理信息，URL不能为空
+//
+// 返回:
+//   - error: 如果添加失败则返回错误
+func (p *ProxyPool) AddProxyRecord(proxy *Proxy) error {
+	if proxy == nil || proxy.URL == "" {
+		return fmt.Errorf("代理地址不能为空")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if proxy.State == "" {
+		proxy.State = StateNew
+	}
+	p.proxies = append(p.proxies, proxy)
+	return nil
+}
+
+// GetProxy 获取一个满足筛选条件的可用代理
+// 代理是否可用以状态存储中的生命周期状态为准
 func (p *ProxyPool) GetProxy() *Proxy {
+	return p.GetProxyWith(p.Selector())
+}
+
+// GetProxyWith 按指定的筛选条件获取一个可用代理
+// 不影响代理池当前的筛选条件
+func (p *ProxyPool) GetProxyWith(selector Selector) *Proxy {
+	for _, proxy := range p.candidates(selector) {
+		if p.usable(proxy) {
+			return proxy
+		}
+	}
+	return nil
+}
+
+// candidates 返回满足筛选条件的代理列表
+func (p *ProxyPool) candidates(selector Selector) []*Proxy {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
-	// 返回第一个可用的代理
+	result := make([]*Proxy, 0, len(p.proxies))
 	for _, proxy := range p.proxies {
-		if proxy.Available {
-			return proxy
+		if selector.Match(proxy) {
+			result = append(result, proxy)
 		}
 	}
+	return result
+}
 
-	return nil
+// snapshot 返回代理列表的副本
+func (p *ProxyPool) snapshot() []*Proxy {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	result := make([]*Proxy, len(p.proxies))
+	copy(result, p.proxies)
+	return result
+}
+
+// usable 从状态存储读取代理状态并判断是否可用
+func (p *ProxyPool) usable(proxy *Proxy) bool {
+	st, err := p.States().Get(proxy.URL)
+	if err != nil {
+		log.Printf("读取代理状态失败: %v", err)
+		return false
+	}
+	p.applyState(proxy, st)
+	return st.Usable(time.Now())
+}
+
+// applyState 将生命周期状态同步到代理实例
+func (p *ProxyPool) applyState(proxy *Proxy, st ProxyState) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	proxy.State = st.State
+	proxy.Available = st.Usable(time.Now())
+}
+
+// ReportResult 上报抓取器使用代理的结果
+// 超时、封禁、407等反馈会驱动代理进入冷却、隔离或失效状态
+// 参数:
+//   - proxyURL: 代理地址
+//   - feedback: 请求结果
+//
+// 返回:
+//   - ProxyState: 流转后的状态
+//   - error: 如果更新状态失败则返回错误
+func (p *ProxyPool) ReportResult(proxyURL string, feedback Feedback) (ProxyState, error) {
+	errMsg := ""
+	if feedback.Err != nil {
+		errMsg = feedback.Err.Error()
+	} else if feedback.StatusCode != 0 {
+		errMsg = fmt.Sprintf("HTTP %d", feedback.StatusCode)
+	}
+
+	ev := feedback.Event()
+	if ev == EventSuccess {
+		errMsg = ""
+	}
+
+	st, err := p.States().Transition(proxyURL, ev, errMsg)
+	if err != nil {
+		return ProxyState{}, err
+	}
+
+	// 更新代理评分所需的运行时统计
+	p.mu.Lock()
+	for _, proxy := range p.proxies {
+		if proxy.URL != proxyURL {
+			continue
+		}
+		if ev == EventSuccess {
+			proxy.Successes++
+			proxy.observeLatency(feedback.Latency)
+		} else {
+			proxy.Failures++
+		}
+		proxy.State = st.State
+		proxy.Available = st.Usable(time.Now())
+		break
+	}
+	p.mu.Unlock()
+
+	return st, nil
+}
+
+// observeLatency 记录一次测得的延迟，调用方需持有写锁
+func (p *Proxy) observeLatency(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	if p.Measured > 0 {
+		p.Measured = (p.Measured*4 + d) / 5
+	} else {
+		p.Measured = d
+	}
 }
 
 // RemoveProxy 从代理池中移除指定代理
@@ -127,7 +336,8 @@ func (p *ProxyPool) RemoveProxy(proxyURL string) {
 	}
 }
 
-// LoadProxiesFromMongo 从MongoDB加载一组代理到Redis
+// LoadProxiesFromMongo 从MongoDB加载一组满足筛选条件的代理到Redis
+// 代理的元数据同时写入Redis哈希表，供GetNextValidProxy还原完整信息
 // 参数:
 //   - mongoClient: MongoDB客户端
 //   - redisClient: Redis客户端
@@ -138,19 +348,37 @@ func (p *ProxyPool) RemoveProxy(proxyURL string) {
 func (p *ProxyPool) LoadProxiesFromMongo(mongoClient *mongodb.MongoClient, redisClient *redis.RedisClient, batchSize int) error {
 	log.Printf("开始从MongoDB加载新的代理组(数量: %d)...", batchSize)
 
-	// 从MongoDB获取代理
-	proxies, err := mongoClient.GetProxies("proxy_pool", "proxies", batchSize)
+	selector := p.Selector()
+
+	// 从MongoDB获取满足条件的代理
+	docs, err := mongoClient.FindProxies(proxyDatabase, proxyCollection, selector.Filter(), batchSize)
 	if err != nil {
 		return fmt.Errorf("从MongoDB获取代理失败: %w", err)
 	}
 
-	if len(proxies) == 0 {
-		return fmt.Errorf("MongoDB中没有可用的代理")
+	if len(docs) == 0 {
+		return fmt.Errorf("MongoDB中没有满足条件的代理")
+	}
+
+	proxies := make([]string, 0, len(docs))
+	details := make(map[string]string, len(docs))
+	for _, doc := range docs {
+		if doc.Proxy == "" {
+			continue
+		}
+		proxies = append(proxies, doc.Proxy)
+		if data, err := json.Marshal(doc); err == nil {
+			details[doc.Proxy] = string(data)
+		}
+	}
+
+	// 保存元数据到Redis
+	if err := redisClient.HSetAll(proxyDetailsKey, details); err != nil {
+		return fmt.Errorf("保存代理元数据到Redis失败: %w", err)
 	}
 
 	// 保存到Redis
-	redisKey := "current_proxy_batch"
-	if err := redisClient.SaveProxies(redisKey, proxies); err != nil {
+	if err := redisClient.SaveProxies(batchKey(selector), proxies); err != nil {
 		return fmt.Errorf("保存代理到Redis失败: %w", err)
 	}
 
@@ -158,6 +386,53 @@ func (p *ProxyPool) LoadProxiesFromMongo(mongoClient *mongodb.MongoClient, redis
 	return nil
 }
 
+// SyncFromMongo 从MongoDB加载满足筛选条件的代理到内存代理池
+// 已在池中的代理保留运行时统计，只更新元数据
+// 参数:
+//   - mongoClient: MongoDB客户端
+//   - limit: 最多加载的代理数量
+//
+// 返回:
+//   - int: 新增到池中的代理数量
+//   - error: 如果加载失败则返回错误
+func (p *ProxyPool) SyncFromMongo(mongoClient *mongodb.MongoClient, limit int) (int, error) {
+	docs, err := mongoClient.FindProxies(proxyDatabase, proxyCollection, p.Selector().Filter(), limit)
+	if err != nil {
+		return 0, fmt.Errorf("从MongoDB获取代理失败: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	existing := make(map[string]*Proxy, len(p.proxies))
+	for _, proxy := range p.proxies {
+		existing[proxy.URL] = proxy
+	}
+
+	added := 0
+	for _, doc := range docs {
+		if doc.Proxy == "" {
+			continue
+		}
+		fresh := proxyFromDocument(doc)
+		if old, ok := existing[doc.Proxy]; ok {
+			fresh.State, fresh.Available = old.State, old.Available
+			fresh.Successes, fresh.Failures = old.Successes, old.Failures
+			// 本进程测得的延迟比MongoDB中保存的更新
+			if old.Measured > 0 {
+				fresh.Measured, fresh.savedMeasured = old.Measured, old.savedMeasured
+			}
+			*old = *fresh
+			continue
+		}
+		p.proxies = append(p.proxies, fresh)
+		existing[doc.Proxy] = fresh
+		added++
+	}
+
+	return added, nil
+}
+
 // GetNextValidProxy 从Redis获取下一个可用的代理
 // 参数:
 //   - redisClient: Redis客户端
@@ -167,36 +442,61 @@ func (p *ProxyPool) LoadProxiesFromMongo(mongoClient *mongodb.MongoClient, redis
 //   - *Proxy: 可用的代理，如果没有则返回nil
 //   - error: 如果发生错误则返回
 func (p *ProxyPool) GetNextValidProxy(redisClient *redis.RedisClient, mongoClient *mongodb.MongoClient) (*Proxy, error) {
-	const redisKey = "current_proxy_batch"
+	redisKey := batchKey(p.Selector())
 
-	// 尝试从Redis获取代理
-	proxyStr, err := redisClient.GetRandomProxy(redisKey)
-	if err != nil || proxyStr == "" {
-		// Redis中没有代理，尝试加载新的一批
-		if err := p.LoadProxiesFromMongo(mongoClient, redisClient, 500); err != nil {
-			return nil, fmt.Errorf("加载新代理失败: %w", err)
+	// 随机抽取代理，跳过生命周期状态不可用的代理
+	const maxAttempts = 10
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		// 尝试从Redis获取代理
+		proxyStr, err := redisClient.GetRandomProxy(redisKey)
+		if err != nil || proxyStr == "" {
+			// Redis中没有代理，尝试加载新的一批
+			if err := p.LoadProxiesFromMongo(mongoClient, redisClient, 500); err != nil {
+				return nil, fmt.Errorf("加载新代理失败: %w", err)
+			}
+			// 重新尝试获取
+			proxyStr, err = redisClient.GetRandomProxy(redisKey)
+			if err != nil {
+				return nil, fmt.Errorf("从Redis获取代理失败: %w", err)
+			}
 		}
-		// 重新尝试获取
-		proxyStr, err = redisClient.GetRandomProxy(redisKey)
+
+		st, err := p.States().Get(proxyStr)
 		if err != nil {
-			return nil, fmt.Errorf("从Redis获取代理失败: %w", err)
+			return nil, err
+		}
+		if !st.Usable(time.Now()) {
+			// 失效的代理直接从当前批次移除
+			if st.State == StateDead {
+				redisClient.RemoveProxy(redisKey, proxyStr)
+			}
+			continue
 		}
-	}
 
-	// 创建代理实例
-	proxy := &Proxy{
-		URL:       proxyStr,
-		Protocol:  "http", // 默认协议
-		Available: true,
+		// 优先使用Redis中保存的元数据还原代理
+		proxy := &Proxy{
+			URL:       proxyStr,
+			Protocol:  "http", // 默认协议
+			Available: true,
+		}
+		if data, err := redisClient.HGet(proxyDetailsKey, proxyStr); err == nil {
+			var doc mongodb.ProxyDocument
+			if err := json.Unmarshal([]byte(data), &doc); err == nil {
+				proxy = proxyFromDocument(doc)
+			}
+		}
+		proxy.State = st.State
+
+		return proxy, nil
 	}
 
-	return proxy, nil
+	return nil, fmt.Errorf("连续 %d 次抽取的代理均不可用", maxAttempts)
 }
 
 // RefreshProxyPool 刷新代理池
 // 当Redis中的代理数量低于阈值时，从MongoDB加载新的代理
 func (p *ProxyPool) RefreshProxyPool(redisClient *redis.RedisClient, mongoClient *mongodb.MongoClient, threshold int) error {
-	const redisKey = "current_proxy_batch"
+	redisKey := batchKey(p.Selector())
 
 	// 获取当前Redis中的代理数量
 	proxies, err := redisClient.GetProxies(redisKey)
@@ -214,3 +514,35 @@ func (p *ProxyPool) RefreshProxyPool(redisClient *redis.RedisClient, mongoClient
 
 	return nil
 }
+
+// batchKey 返回筛选条件对应的Redis代理批次键
+// 没有筛选条件时沿用原来的键，保持兼容
+func batchKey(selector Selector) string {
+	if selector.IsZero() {
+		return currentBatchKey
+	}
+	return currentBatchKey + ":" + selector.Key()
+}
+
+// proxyFromDocument 将MongoDB中的代理记录转换为代理实例
+func proxyFromDocument(doc mongodb.ProxyDocument) *Proxy {
+	measured := time.Duration(doc.Health.AvgLatency * float64(time.Millisecond))
+	return &Proxy{
+		URL:           doc.Proxy,
+		Protocol:      preferredProtocol(doc.Protocols),
+		Protocols:     doc.Protocols,
+		Available:     true,
+		State:         StateNew,
+		Country:       doc.Country,
+		CountryCode:   doc.CountryCode,
+		Anonymity:     doc.Anonymity,
+		Speed:         doc.Speed,
+		Latency:       time.Duration(doc.Latency * float64(time.Millisecond)),
+		Measured:      measured,
+		Uptime:        doc.Uptime,
+		Reliability:   doc.Reliability,
+		Source:        doc.Source,
+		LastChecked:   doc.LastChecked,
+		savedMeasured: measured,
+	}
+}
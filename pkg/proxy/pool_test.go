@@ -180,3 +180,86 @@ func TestRemoveProxy(t *testing.T) {
 		t.Error("代理移除失败")
 	}
 }
+
+// 测试按条件筛选代理
+func TestGetProxyWithSelector(t *testing.T) {
+	pool := NewProxyPool(Config{
+		Timeout:  5 * time.Second,
+		Selector: Selector{Country: "Japan", MinReliability: 80},
+	})
+
+	pool.AddProxyRecord(&Proxy{URL: "10.0.0.1:8080", Protocol: "http", Available: true, Country: "United States", CountryCode: "US", Reliability: 99})
+	pool.AddProxyRecord(&Proxy{URL: "10.0.0.2:8080", Protocol: "http", Available: true, Country: "Japan", CountryCode: "JP", Reliability: 50})
+	pool.AddProxyRecord(&Proxy{URL: "10.0.0.3:8080", Protocol: "http", Available: true, Country: "Japan", CountryCode: "JP", Reliability: 95})
+
+	proxy := pool.GetProxy()
+	if proxy == nil || proxy.URL != "10.0.0.3:8080" {
+		t.Fatalf("GetProxy() = %v, 期望 10.0.0.3:8080", proxy)
+	}
+
+	// 按国家代码筛选，并放宽可用性要求
+	proxy = pool.GetProxyWith(Selector{Country: "jp"})
+	if proxy == nil || proxy.URL != "10.0.0.2:8080" {
+		t.Fatalf("GetProxyWith() = %v, 期望 10.0.0.2:8080", proxy)
+	}
+
+	if proxy = pool.GetProxyWith(Selector{Country: "Germany"}); proxy != nil {
+		t.Errorf("GetProxyWith() = %v, 期望 nil", proxy)
+	}
+}
+
+// 测试按协议筛选时与MongoDB查询一样匹配代理支持的全部协议
+func TestSelectorMatchProtocols(t *testing.T) {
+	p := &Proxy{URL: "10.0.0.1:1080", Protocol: "socks4", Protocols: []string{"socks4", "socks5"}}
+	if !(Selector{Protocol: "SOCKS5"}).Match(p) {
+		t.Error("支持socks5的代理应满足筛选条件")
+	}
+	if (Selector{Protocol: "http"}).Match(p) {
+		t.Error("不支持http的代理不应满足筛选条件")
+	}
+	if !(Selector{Protocol: "http"}).Match(&Proxy{URL: "10.0.0.2:8080", Protocol: "http"}) {
+		t.Error("没有protocols的代理应按Protocol匹配")
+	}
+}
+
+// 测试从MongoDB记录转换时选择第一个可以使用的协议
+func TestProxyFromDocumentProtocol(t *testing.T) {
+	tests := []struct {
+		protocols []string
+		want      string
+	}{
+		{nil, "http"},
+		{[]string{"socks4", "socks5", "http"}, "socks5"},
+		{[]string{"https", "http"}, "https"},
+		{[]string{"socks4"}, "socks4"},
+	}
+	for _, tt := range tests {
+		p := proxyFromDocument(mongodb.ProxyDocument{Proxy: "10.0.0.1:1080", Protocols: tt.protocols})
+		if p.Protocol != tt.want {
+			t.Errorf("protocols=%v 时 Protocol = %s, 期望 %s", tt.protocols, p.Protocol, tt.want)
+		}
+	}
+
+	p := proxyFromDocument(mongodb.ProxyDocument{Proxy: "10.0.0.1:1080", Protocols: []string{"socks4", "http"}})
+	if u, err := p.ProxyURL(); err != nil || u.Scheme != "http" {
+		t.Errorf("ProxyURL() = %v, %v", u, err)
+	}
+}
+
+// 测试筛选条件转换为MongoDB查询
+func TestSelectorFilter(t *testing.T) {
+	if filter := (Selector{}).Filter(); len(filter) != 0 {
+		t.Errorf("空筛选条件应生成空查询, 实际: %v", filter)
+	}
+
+	filter := Selector{Country: "Japan", Protocol: "HTTP", MinReliability: 80}.Filter()
+	if _, ok := filter["$or"]; !ok {
+		t.Error("缺少国家查询条件")
+	}
+	if filter["protocols"] != "http" {
+		t.Errorf("协议查询条件错误: %v", filter["protocols"])
+	}
+	if _, ok := filter["reliability"]; !ok {
+		t.Error("缺少可用性查询条件")
+	}
+}
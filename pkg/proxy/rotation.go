@@ -0,0 +1,163 @@
+package proxy
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Strategy 代理轮换策略
+type Strategy string
+
+const (
+	StrategyRoundRobin Strategy = "round_robin" // 依次轮换
+	StrategyRandom     Strategy = "random"      // 随机选择
+	StrategyWeighted   Strategy = "weighted"    // 按评分加权随机选择
+	StrategyBest       Strategy = "best"        // 总是选择评分最高的代理
+)
+
+// ParseStrategy 解析轮换策略名称，为空时使用依次轮换
+func ParseStrategy(name string) (Strategy, error) {
+	switch s := Strategy(name); s {
+	case "":
+		return StrategyRoundRobin, nil
+	case StrategyRoundRobin, StrategyRandom, StrategyWeighted, StrategyBest:
+		return s, nil
+	default:
+		return "", fmt.Errorf("未知的轮换策略: %s", name)
+	}
+}
+
+// Score 计算代理评分，范围为(0, 1]
+// 综合运行时成功率、来源方给出的可用性和延迟，评分越高越优先；
+// 延迟优先使用测得的值，尚未测量时使用来源方报告的值
+func (p *Proxy) Score() float64 {
+	// 平滑后的成功率，没有使用记录的代理得分0.5
+	success := (float64(p.Successes) + 1) / (float64(p.Successes+p.Failures) + 2)
+
+	reliability := 1.0
+	if p.Reliability > 0 {
+		reliability = 0.5 + p.Reliability/200
+	}
+
+	latency := 1.0
+	if d := p.Measured; d > 0 {
+		latency = 1 / (1 + d.Seconds())
+	} else if p.Latency > 0 {
+		latency = 1 / (1 + p.Latency.Seconds())
+	}
+
+	return success * reliability * latency
+}
+
+// Next 按代理池的轮换策略和筛选条件选择一个可用代理
+func (p *ProxyPool) Next() *Proxy {
+	p.mu.RLock()
+	strategy, selector := p.strategy, p.selector
+	p.mu.RUnlock()
+
+	return p.NextWith(strategy, selector)
+}
+
+// NextWith 按指定的轮换策略和筛选条件选择一个可用代理
+// 参数:
+//   - strategy: 轮换策略
+//   - selector: 筛选条件
+//
+// 返回:
+//   - *Proxy: 选中的代理，没有可用代理时返回nil
+func (p *ProxyPool) NextWith(strategy Strategy, selector Selector) *Proxy {
+	candidates := p.usableCandidates(selector)
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	switch strategy {
+	case StrategyRandom:
+		return candidates[rand.Intn(len(candidates))]
+
+	case StrategyWeighted:
+		scores := p.scores(candidates)
+		total := 0.0
+		for _, score := range scores {
+			total += score
+		}
+		r := rand.Float64() * total
+		for i, score := range scores {
+			r -= score
+			if r <= 0 {
+				return candidates[i]
+			}
+		}
+		return candidates[len(candidates)-1]
+
+	case StrategyBest:
+		scores := p.scores(candidates)
+		best := 0
+		for i := range candidates {
+			if scores[i] > scores[best] {
+				best = i
+			}
+		}
+		return candidates[best]
+
+	default:
+		p.mu.Lock()
+		index := p.cursor % len(candidates)
+		p.cursor++
+		p.mu.Unlock()
+		return candidates[index]
+	}
+}
+
+// scores 在读锁保护下计算代理评分
+func (p *ProxyPool) scores(proxies []*Proxy) []float64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	scores := make([]float64, len(proxies))
+	for i, proxy := range proxies {
+		scores[i] = proxy.Score()
+	}
+	return scores
+}
+
+// SetStrategy 设置代理池的轮换策略
+func (p *ProxyPool) SetStrategy(strategy Strategy) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.strategy = strategy
+}
+
+// usableCandidates 返回满足筛选条件且生命周期状态可用的代理
+// 状态批量读取，避免逐个访问状态存储
+func (p *ProxyPool) usableCandidates(selector Selector) []*Proxy {
+	candidates := p.candidates(selector)
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	addrs := make([]string, len(candidates))
+	for i, proxy := range candidates {
+		addrs[i] = proxy.URL
+	}
+	states, err := p.States().GetMany(addrs)
+	if err != nil {
+		return nil
+	}
+
+	now := time.Now()
+	usable := make([]*Proxy, 0, len(candidates))
+	p.mu.Lock()
+	for _, proxy := range candidates {
+		st := states[proxy.URL]
+		proxy.State = st.State
+		proxy.Available = st.Usable(now)
+		if proxy.Available {
+			usable = append(usable, proxy)
+		}
+	}
+	p.mu.Unlock()
+
+	return usable
+}
@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Selector 代理筛选条件
+// 零值表示不做任何限制，各字段之间为“与”关系
+type Selector struct {
+	Country        string        // 国家名称或代码，例如 "Japan" 或 "JP"，不区分大小写
+	Protocol       string        // 协议类型，例如 "http"
+	Anonymity      string        // 匿名级别，例如 "elite"
+	MinReliability float64       // 最低可用性（百分比）
+	MinUptime      float64       // 最低在线率（百分比）
+	MaxLatency     time.Duration // 最大延迟，0表示不限制
+}
+
+// IsZero 判断是否没有设置任何筛选条件
+func (s Selector) IsZero() bool {
+	return s == Selector{}
+}
+
+// Key 返回筛选条件的唯一标识
+// 用于区分不同筛选条件在Redis中的代理批次
+func (s Selector) Key() string {
+	if s.IsZero() {
+		return ""
+	}
+	return strings.ToLower(fmt.Sprintf("%s|%s|%s|%g|%g|%d",
+		s.Country, s.Protocol, s.Anonymity, s.MinReliability, s.MinUptime, s.MaxLatency.Milliseconds()))
+}
+
+// Match 判断代理是否满足筛选条件
+func (s Selector) Match(p *Proxy) bool {
+	if p == nil {
+		return false
+	}
+	if s.Country != "" && !strings.EqualFold(p.Country, s.Country) && !strings.EqualFold(p.CountryCode, s.Country) {
+		return false
+	}
+	if s.Protocol != "" && !p.Supports(s.Protocol) {
+		return false
+	}
+	if s.Anonymity != "" && !strings.EqualFold(p.Anonymity, s.Anonymity) {
+		return false
+	}
+	if p.Reliability < s.MinReliability {
+		return false
+	}
+	if p.Uptime < s.MinUptime {
+		return false
+	}
+	if s.MaxLatency > 0 && (p.Latency <= 0 || p.Latency > s.MaxLatency) {
+		return false
+	}
+	return true
+}
+
+// Supports 判断代理是否支持指定协议，与Filter一样按protocols字段匹配
+func (p *Proxy) Supports(protocol string) bool {
+	if len(p.Protocols) == 0 {
+		return strings.EqualFold(p.Protocol, protocol)
+	}
+	for _, supported := range p.Protocols {
+		if strings.EqualFold(supported, protocol) {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter 将筛选条件转换为MongoDB查询条件
+func (s Selector) Filter() bson.M {
+	filter := bson.M{}
+	if s.Country != "" {
+		filter["$or"] = bson.A{
+			bson.M{"country": equalFoldRegex(s.Country)},
+			bson.M{"country_code": equalFoldRegex(s.Country)},
+		}
+	}
+	if s.Protocol != "" {
+		filter["protocols"] = strings.ToLower(s.Protocol)
+	}
+	if s.Anonymity != "" {
+		filter["anonymity"] = equalFoldRegex(s.Anonymity)
+	}
+	if s.MinReliability > 0 {
+		filter["reliability"] = bson.M{"$gte": s.MinReliability}
+	}
+	if s.MinUptime > 0 {
+		filter["uptime"] = bson.M{"$gte": s.MinUptime}
+	}
+	if s.MaxLatency > 0 {
+		filter["latency"] = bson.M{"$gt": 0, "$lte": float64(s.MaxLatency.Milliseconds())}
+	}
+	return filter
+}
+
+// equalFoldRegex 构造不区分大小写的完整匹配正则
+func equalFoldRegex(value string) bson.M {
+	return bson.M{"$regex": "^" + regexp.QuoteMeta(value) + "$", "$options": "i"}
+}
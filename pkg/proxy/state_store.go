@@ -0,0 +1,318 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"japan_spider/pkg/redis"
+
+	goredis "github.com/go-redis/redis/v8"
+)
+
+// StateStore 代理生命周期状态存储接口
+// 所有节点共享同一份状态视图
+type StateStore interface {
+	// Get 获取代理状态，不存在时返回新代理状态
+	Get(proxy string) (ProxyState, error)
+
+	// GetMany 批量获取代理状态
+	GetMany(proxies []string) (map[string]ProxyState, error)
+
+	// Transition 原子地对代理应用事件并保存新状态
+	Transition(proxy string, ev Event, errMsg string) (ProxyState, error)
+
+	// List 列出指定状态的所有代理
+	List(state State) ([]ProxyState, error)
+
+	// Count 获取指定状态的代理数量
+	Count(state State) (int, error)
+
+	// Remove 删除代理的状态记录
+	Remove(proxies ...string) error
+}
+
+// RedisStateStore 基于Redis的代理状态存储
+// 每个代理的状态保存为一个JSON字符串，另外按状态维护有序集合索引：
+// 冷却和隔离状态的分数为结束时间，其余状态的分数为进入时间
+type RedisStateStore struct {
+	redisClient *redis.RedisClient // Redis客户端
+	prefix      string             // Redis键前缀
+	lifecycle   LifecycleConfig    // 生命周期配置
+}
+
+// NewRedisStateStore 创建基于Redis的状态存储
+// 参数:
+//   - redisClient: Redis客户端
+//   - prefix: Redis键前缀，为空时使用 proxy:state
+//   - lifecycle: 生命周期配置
+func NewRedisStateStore(redisClient *redis.RedisClient, prefix string, lifecycle LifecycleConfig) *RedisStateStore {
+	if prefix == "" {
+		prefix = "proxy:state"
+	}
+	return &RedisStateStore{
+		redisClient: redisClient,
+		prefix:      prefix,
+		lifecycle:   lifecycle.withDefaults(),
+	}
+}
+
+// stateKey 返回代理状态的键
+func (s *RedisStateStore) stateKey(proxy string) string {
+	return s.prefix + ":" + proxy
+}
+
+// indexKey 返回状态索引的键
+func (s *RedisStateStore) indexKey(state State) string {
+	return s.prefix + ":index:" + string(state)
+}
+
+// Get 获取代理状态
+func (s *RedisStateStore) Get(proxy string) (ProxyState, error) {
+	data, err := s.redisClient.Get(s.stateKey(proxy))
+	if errors.Is(err, goredis.Nil) {
+		return ProxyState{Proxy: proxy, State: StateNew}, nil
+	}
+	if err != nil {
+		return ProxyState{}, fmt.Errorf("读取代理状态失败: %w", err)
+	}
+
+	var st ProxyState
+	if err := json.Unmarshal([]byte(data), &st); err != nil {
+		return ProxyState{}, fmt.Errorf("解析代理状态失败: %w", err)
+	}
+	return st, nil
+}
+
+// GetMany 使用MGET批量获取代理状态
+func (s *RedisStateStore) GetMany(proxies []string) (map[string]ProxyState, error) {
+	states := make(map[string]ProxyState, len(proxies))
+	if len(proxies) == 0 {
+		return states, nil
+	}
+
+	keys := make([]string, len(proxies))
+	for i, proxy := range proxies {
+		keys[i] = s.stateKey(proxy)
+	}
+	values, err := s.redisClient.Client().MGet(s.redisClient.Context(), keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("批量读取代理状态失败: %w", err)
+	}
+
+	for i, proxy := range proxies {
+		st := ProxyState{Proxy: proxy, State: StateNew}
+		if data, ok := values[i].(string); ok {
+			if err := json.Unmarshal([]byte(data), &st); err != nil {
+				return nil, fmt.Errorf("解析代理状态失败: %w", err)
+			}
+		}
+		states[proxy] = st
+	}
+	return states, nil
+}
+
+// Transition 使用乐观锁原子地应用事件
+// 多个节点同时修改同一代理时会自动重试
+func (s *RedisStateStore) Transition(proxy string, ev Event, errMsg string) (ProxyState, error) {
+	client := s.redisClient.Client()
+	ctx := s.redisClient.Context()
+	key := s.stateKey(proxy)
+
+	var next ProxyState
+	txf := func(tx *goredis.Tx) error {
+		current := ProxyState{Proxy: proxy}
+		data, err := tx.Get(ctx, key).Result()
+		if err != nil && !errors.Is(err, goredis.Nil) {
+			return err
+		}
+		if err == nil {
+			if err := json.Unmarshal([]byte(data), &current); err != nil {
+				return err
+			}
+		}
+
+		next = s.lifecycle.Apply(current, ev, errMsg, time.Now())
+		next.Proxy = proxy
+		encoded, err := json.Marshal(next)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+			pipe.Set(ctx, key, encoded, 0)
+			if current.State != "" && current.State != next.State {
+				pipe.ZRem(ctx, s.indexKey(current.State), proxy)
+			}
+			pipe.ZAdd(ctx, s.indexKey(next.State), &goredis.Z{Score: stateScore(next), Member: proxy})
+			return nil
+		})
+		return err
+	}
+
+	for retries := 0; retries < 5; retries++ {
+		err := client.Watch(ctx, txf, key)
+		if err == nil {
+			return next, nil
+		}
+		if !errors.Is(err, goredis.TxFailedErr) {
+			return ProxyState{}, fmt.Errorf("更新代理状态失败: %w", err)
+		}
+	}
+	return ProxyState{}, fmt.Errorf("更新代理状态失败: %s 并发冲突", proxy)
+}
+
+// List 列出指定状态的所有代理
+func (s *RedisStateStore) List(state State) ([]ProxyState, error) {
+	return s.listByScore(state, "-inf", "+inf")
+}
+
+// listByScore 按分数范围读取状态索引中的代理
+func (s *RedisStateStore) listByScore(state State, min, max string) ([]ProxyState, error) {
+	client := s.redisClient.Client()
+	ctx := s.redisClient.Context()
+
+	members, err := client.ZRangeByScore(ctx, s.indexKey(state), &goredis.ZRangeBy{Min: min, Max: max}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("读取状态索引失败: %w", err)
+	}
+
+	states := make([]ProxyState, 0, len(members))
+	for _, member := range members {
+		st, err := s.Get(member)
+		if err != nil {
+			return nil, err
+		}
+		states = append(states, st)
+	}
+	return states, nil
+}
+
+// Count 获取指定状态的代理数量
+func (s *RedisStateStore) Count(state State) (int, error) {
+	n, err := s.redisClient.Client().ZCard(s.redisClient.Context(), s.indexKey(state)).Result()
+	if err != nil {
+		return 0, fmt.Errorf("统计代理状态失败: %w", err)
+	}
+	return int(n), nil
+}
+
+// Remove 删除代理的状态记录和索引
+func (s *RedisStateStore) Remove(proxies ...string) error {
+	if len(proxies) == 0 {
+		return nil
+	}
+
+	ctx := s.redisClient.Context()
+	pipe := s.redisClient.Client().Pipeline()
+	members := make([]interface{}, len(proxies))
+	for i, proxy := range proxies {
+		pipe.Del(ctx, s.stateKey(proxy))
+		members[i] = proxy
+	}
+	for _, state := range AllStates {
+		pipe.ZRem(ctx, s.indexKey(state), members...)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("删除代理状态失败: %w", err)
+	}
+	return nil
+}
+
+// stateScore 计算代理在状态索引中的分数（毫秒时间戳）
+func stateScore(st ProxyState) float64 {
+	if !st.Until.IsZero() {
+		return float64(st.Until.UnixMilli())
+	}
+	return float64(st.Since.UnixMilli())
+}
+
+// MemoryStateStore 基于内存的代理状态存储
+// 用于单进程运行和测试，不在节点之间共享
+type MemoryStateStore struct {
+	states    map[string]ProxyState // 代理状态
+	lifecycle LifecycleConfig       // 生命周期配置
+	mu        sync.Mutex            // 互斥锁
+}
+
+// NewMemoryStateStore 创建基于内存的状态存储
+func NewMemoryStateStore(lifecycle LifecycleConfig) *MemoryStateStore {
+	return &MemoryStateStore{
+		states:    make(map[string]ProxyState),
+		lifecycle: lifecycle.withDefaults(),
+	}
+}
+
+// Get 获取代理状态
+func (s *MemoryStateStore) Get(proxy string) (ProxyState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if st, ok := s.states[proxy]; ok {
+		return st, nil
+	}
+	return ProxyState{Proxy: proxy, State: StateNew}, nil
+}
+
+// GetMany 批量获取代理状态
+func (s *MemoryStateStore) GetMany(proxies []string) (map[string]ProxyState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	states := make(map[string]ProxyState, len(proxies))
+	for _, proxy := range proxies {
+		st, ok := s.states[proxy]
+		if !ok {
+			st = ProxyState{Proxy: proxy, State: StateNew}
+		}
+		states[proxy] = st
+	}
+	return states, nil
+}
+
+// Transition 对代理应用事件并保存新状态
+func (s *MemoryStateStore) Transition(proxy string, ev Event, errMsg string) (ProxyState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next := s.lifecycle.Apply(s.states[proxy], ev, errMsg, time.Now())
+	next.Proxy = proxy
+	s.states[proxy] = next
+	return next, nil
+}
+
+// List 列出指定状态的所有代理，按进入时间排序
+func (s *MemoryStateStore) List(state State) ([]ProxyState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	states := make([]ProxyState, 0)
+	for _, st := range s.states {
+		if st.State == state {
+			states = append(states, st)
+		}
+	}
+	sort.Slice(states, func(i, j int) bool { return stateScore(states[i]) < stateScore(states[j]) })
+	return states, nil
+}
+
+// Count 获取指定状态的代理数量
+func (s *MemoryStateStore) Count(state State) (int, error) {
+	states, err := s.List(state)
+	return len(states), err
+}
+
+// Remove 删除代理的状态记录
+func (s *MemoryStateStore) Remove(proxies ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, proxy := range proxies {
+		delete(s.states, proxy)
+	}
+	return nil
+}
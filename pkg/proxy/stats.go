@@ -0,0 +1,174 @@
+package proxy
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// LatencyStats 延迟分位数统计
+type LatencyStats struct {
+	Samples int           `json:"samples"` // 样本数量
+	P50     time.Duration `json:"p50"`     // 中位数
+	P90     time.Duration `json:"p90"`     // 90分位
+	P99     time.Duration `json:"p99"`     // 99分位
+}
+
+// SourceStats 单个来源的代理统计
+type SourceStats struct {
+	Proxies     int          `json:"proxies"`      // 代理数量
+	Usable      int          `json:"usable"`       // 当前可用的代理数量
+	Successes   int64        `json:"successes"`    // 累计成功次数
+	Errors      int64        `json:"errors"`       // 累计失败次数
+	SuccessRate float64      `json:"success_rate"` // 成功率，没有记录时为0
+	Latency     LatencyStats `json:"latency"`      // 测得延迟的分位数
+}
+
+// PoolStats 代理池健康统计
+type PoolStats struct {
+	Total      int                     `json:"total"`       // 代理总数
+	Usable     int                     `json:"usable"`      // 当前可用的代理数量
+	ByState    map[State]int           `json:"by_state"`    // 各生命周期状态的数量
+	BySource   map[string]int          `json:"by_source"`   // 各来源的数量
+	ByCountry  map[string]int          `json:"by_country"`  // 各国家的数量
+	ByProtocol map[string]int          `json:"by_protocol"` // 各协议的数量
+	Latency    LatencyStats            `json:"latency"`     // 全部代理测得延迟的分位数，来源方报告的延迟不计入
+	Sources    map[string]*SourceStats `json:"sources"`     // 各来源的成功率和延迟
+}
+
+// ProxyReport 单个代理的完整信息，包括生命周期状态
+type ProxyReport struct {
+	*Proxy
+	Status ProxyState `json:"status"` // 生命周期状态
+}
+
+// Stats 统计代理池中代理的状态、来源、国家、协议分布以及延迟和成功率
+// 状态和成功次数来自状态存储，使用RedisStateStore时反映所有节点的数据；
+// 测得延迟在SyncFromMongo时从MongoDB的health.avg_latency加载
+func (p *ProxyPool) Stats() (PoolStats, error) {
+	reports, err := p.Reports(Selector{}, "")
+	if err != nil {
+		return PoolStats{}, err
+	}
+
+	stats := PoolStats{
+		Total:      len(reports),
+		ByState:    make(map[State]int),
+		BySource:   make(map[string]int),
+		ByCountry:  make(map[string]int),
+		ByProtocol: make(map[string]int),
+		Sources:    make(map[string]*SourceStats),
+	}
+
+	now := time.Now()
+	all := make([]time.Duration, 0, len(reports))
+	bySource := make(map[string][]time.Duration)
+	for _, r := range reports {
+		source := orUnknown(r.Source)
+		country := orUnknown(r.Country)
+		protocol := orUnknown(strings.ToLower(r.Protocol))
+
+		stats.ByState[r.Status.State]++
+		stats.BySource[source]++
+		stats.ByCountry[country]++
+		stats.ByProtocol[protocol]++
+
+		src, ok := stats.Sources[source]
+		if !ok {
+			src = &SourceStats{}
+			stats.Sources[source] = src
+		}
+		src.Proxies++
+		src.Successes += r.Status.Successes
+		src.Errors += r.Status.Errors
+
+		if r.Status.Usable(now) {
+			stats.Usable++
+			src.Usable++
+		}
+		if r.Measured > 0 {
+			all = append(all, r.Measured)
+			bySource[source] = append(bySource[source], r.Measured)
+		}
+	}
+
+	stats.Latency = latencyStats(all)
+	for source, src := range stats.Sources {
+		if total := src.Successes + src.Errors; total > 0 {
+			src.SuccessRate = float64(src.Successes) / float64(total)
+		}
+		src.Latency = latencyStats(bySource[source])
+	}
+
+	return stats, nil
+}
+
+// Reports 列出满足条件的代理及其生命周期状态
+// 参数:
+//   - selector: 筛选条件
+//   - state: 只返回指定状态的代理，为空时返回全部
+func (p *ProxyPool) Reports(selector Selector, state State) ([]ProxyReport, error) {
+	candidates := p.candidates(selector)
+	addrs := make([]string, len(candidates))
+	for i, proxy := range candidates {
+		addrs[i] = proxy.URL
+	}
+
+	states, err := p.States().GetMany(addrs)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	reports := make([]ProxyReport, 0, len(candidates))
+	for _, proxy := range candidates {
+		st := states[proxy.URL]
+		if state != "" && st.State != state {
+			continue
+		}
+		copied := *proxy
+		reports = append(reports, ProxyReport{Proxy: &copied, Status: st})
+	}
+	return reports, nil
+}
+
+// latencyStats 计算延迟分位数
+func latencyStats(samples []time.Duration) LatencyStats {
+	if len(samples) == 0 {
+		return LatencyStats{}
+	}
+
+	sorted := make([]time.Duration, len(samples))
+	copy(sorted, samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	return LatencyStats{
+		Samples: len(sorted),
+		P50:     percentile(sorted, 0.50),
+		P90:     percentile(sorted, 0.90),
+		P99:     percentile(sorted, 0.99),
+	}
+}
+
+// percentile 返回已排序样本的分位数（最近秩法）
+func percentile(sorted []time.Duration, q float64) time.Duration {
+	index := int(math.Ceil(q*float64(len(sorted)))) - 1
+	if index < 0 {
+		index = 0
+	}
+	if index >= len(sorted) {
+		index = len(sorted) - 1
+	}
+	return sorted[index]
+}
+
+// orUnknown 空值统计为unknown
+func orUnknown(value string) string {
+	if value == "" {
+		return "unknown"
+	}
+	return value
+}
@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"japan_spider/pkg/mongodb"
+)
+
+// 测试代理池统计按状态和来源汇总
+func TestPoolStats(t *testing.T) {
+	pool := NewProxyPool(Config{Timeout: 5 * time.Second})
+	pool.AddProxyRecord(&Proxy{URL: "10.0.0.1:8080", Protocol: "http", Country: "Japan", Source: "geonode", Available: true})
+	pool.AddProxyRecord(&Proxy{URL: "10.0.0.2:8080", Protocol: "socks5", Country: "Japan", Source: "geonode", Available: true})
+	pool.AddProxyRecord(&Proxy{URL: "10.0.0.3:8080", Protocol: "http", Source: "free", Available: true, Latency: time.Second})
+
+	pool.ReportResult("10.0.0.1:8080", Feedback{StatusCode: 200, Latency: 100 * time.Millisecond})
+	pool.ReportResult("10.0.0.1:8080", Feedback{StatusCode: 200, Latency: 100 * time.Millisecond})
+	pool.ReportResult("10.0.0.2:8080", Feedback{Banned: true})
+
+	stats, err := pool.Stats()
+	if err != nil {
+		t.Fatalf("Stats() error = %v", err)
+	}
+
+	if stats.Total != 3 || stats.Usable != 2 {
+		t.Errorf("Total/Usable = %d/%d, 期望 3/2", stats.Total, stats.Usable)
+	}
+	if stats.ByState[StateActive] != 1 || stats.ByState[StateQuarantined] != 1 || stats.ByState[StateNew] != 1 {
+		t.Errorf("ByState = %v", stats.ByState)
+	}
+	if stats.ByCountry["Japan"] != 2 || stats.ByCountry["unknown"] != 1 {
+		t.Errorf("ByCountry = %v", stats.ByCountry)
+	}
+
+	geonode := stats.Sources["geonode"]
+	if geonode == nil || geonode.Successes != 2 || geonode.Errors != 1 {
+		t.Fatalf("Sources[geonode] = %+v", geonode)
+	}
+	if rate := geonode.SuccessRate; rate < 0.66 || rate > 0.67 {
+		t.Errorf("SuccessRate = %v, 期望 2/3", rate)
+	}
+	// 来源方报告的延迟不计入统计
+	if stats.Latency.Samples != 1 || stats.Latency.P50 != 100*time.Millisecond {
+		t.Errorf("Latency = %+v", stats.Latency)
+	}
+
+	reports, err := pool.Reports(Selector{}, StateQuarantined)
+	if err != nil || len(reports) != 1 || reports[0].URL != "10.0.0.2:8080" {
+		t.Errorf("Reports(quarantined) = %v, %v", reports, err)
+	}
+}
+
+// 测试从MongoDB记录恢复测得延迟，新进程中的统计也能使用
+func TestStatsMeasuredFromDocument(t *testing.T) {
+	pool := NewProxyPool(Config{Timeout: 5 * time.Second})
+	docs := []mongodb.ProxyDocument{
+		{Proxy: "10.0.0.1:8080", Protocols: []string{"http"}, Source: "geonode", Health: mongodb.ProxyHealth{AvgLatency: 200}},
+		{Proxy: "10.0.0.2:8080", Protocols: []string{"http"}, Source: "geonode", Health: mongodb.ProxyHealth{AvgLatency: 400}},
+		{Proxy: "10.0.0.3:8080", Protocols: []string{"http"}, Source: "free", Latency: 1000},
+	}
+	for _, doc := range docs {
+		pool.AddProxyRecord(proxyFromDocument(doc))
+	}
+
+	stats, err := pool.Stats()
+	if err != nil {
+		t.Fatalf("Stats() error = %v", err)
+	}
+	if stats.Latency.Samples != 2 || stats.Latency.P90 != 400*time.Millisecond {
+		t.Errorf("Latency = %+v", stats.Latency)
+	}
+	if src := stats.Sources["geonode"]; src == nil || src.Latency.Samples != 2 {
+		t.Errorf("Sources[geonode] = %+v", src)
+	}
+	if src := stats.Sources["free"]; src == nil || src.Latency.Samples != 0 {
+		t.Errorf("Sources[free] = %+v", src)
+	}
+
+	// 从MongoDB加载的延迟已经保存过，运行时测得新的延迟后才需要保存
+	proxy := pool.snapshot()[0]
+	if proxy.Measured != 200*time.Millisecond || proxy.Measured != proxy.savedMeasured {
+		t.Fatalf("Measured/savedMeasured = %v/%v, 期望 200ms", proxy.Measured, proxy.savedMeasured)
+	}
+	pool.ReportResult(proxy.URL, Feedback{StatusCode: 200, Latency: 100 * time.Millisecond})
+	if proxy.Measured == proxy.savedMeasured {
+		t.Errorf("运行时测得的延迟没有标记为需要保存: %v", proxy.Measured)
+	}
+}
@@ -0,0 +1,359 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultAdminLimit 列表接口默认返回的数量
+const defaultAdminLimit = 100
+
+// errBadRequest 请求参数错误
+var errBadRequest = errors.New("请求参数错误")
+
+// QueueInfo 队列及其当前深度
+type QueueInfo struct {
+	Name     string   `json:"name"`
+	Priority int      `json:"priority"`
+	Weight   int      `json:"weight"`
+	Workers  int      `json:"workers"`
+	Types    []string `json:"types,omitempty"`
+	Pending  int64    `json:"pending"` // 等待处理的数量
+	Paused   bool     `json:"paused"`  // 本进程是否暂停消费
+}
+
+// AdminHandler 队列管理HTTP接口
+// 在消费队列的进程中挂载，例如:
+//
+//	http.Handle("/queue/", http.StripPrefix("/queue", queue.NewAdminHandler(qc)))
+//
+// 接口（除特别说明外均返回JSON）:
+//
+//	GET    /queues                    队列列表和各状态的数量
+//	GET    /queues/{name}/items       查看队列中接下来会被处理的项（?limit=）
+//	POST   /queues/{name}/pause       暂停本进程对该队列的消费
+//	POST   /queues/{name}/resume      恢复本进程对该队列的消费
+//	POST   /pause                     暂停本进程对全部队列的消费
+//	POST   /resume                    恢复本进程对全部队列的消费
+//	GET    /metrics                   当前指标
+//	GET    /metrics/history           指标时间序列（?since=1h）
+//	GET    /retrying                  处理失败、等待重试的项（?limit=）
+//	GET    /dead                      死信列表（?error=&since=&id=&limit=）
+//	GET    /dead/{id}                 单个死信
+//	POST   /dead/{id}/requeue         重放单个死信
+//	POST   /dead/requeue              按条件重放死信，没有条件时需要?all=true
+//	DELETE /dead/{id}                 删除单个死信
+//	DELETE /dead                      按条件删除死信，没有条件时需要?all=true
+//	GET    /quarantine                隔离队列（?limit=）
+//	POST   /quarantine/release        释放隔离的项（?type=，为空时释放全部）
+type AdminHandler struct {
+	qc  *QueueController
+	mux *http.ServeMux
+}
+
+// NewAdminHandler 创建队列管理HTTP接口
+func NewAdminHandler(qc *QueueController) *AdminHandler {
+	h := &AdminHandler{qc: qc, mux: http.NewServeMux()}
+	h.mux.HandleFunc("GET /queues", h.listQueues)
+	h.mux.HandleFunc("GET /queues/{name}/items", h.peekQueue)
+	h.mux.HandleFunc("POST /queues/{name}/pause", h.pauseQueue)
+	h.mux.HandleFunc("POST /queues/{name}/resume", h.resumeQueue)
+	h.mux.HandleFunc("POST /pause", h.pauseQueue)
+	h.mux.HandleFunc("POST /resume", h.resumeQueue)
+	h.mux.HandleFunc("GET /metrics", h.metrics)
+	h.mux.HandleFunc("GET /metrics/history", h.metricsHistory)
+	h.mux.HandleFunc("GET /retrying", h.listRetrying)
+	h.mux.HandleFunc("GET /dead", h.listDead)
+	h.mux.HandleFunc("GET /dead/{id}", h.getDead)
+	h.mux.HandleFunc("POST /dead/{id}/requeue", h.requeueDead)
+	h.mux.HandleFunc("POST /dead/requeue", h.requeueDead)
+	h.mux.HandleFunc("DELETE /dead/{id}", h.deleteDead)
+	h.mux.HandleFunc("DELETE /dead", h.deleteDead)
+	h.mux.HandleFunc("GET /quarantine", h.listQuarantined)
+	h.mux.HandleFunc("POST /quarantine/release", h.releaseQuarantined)
+	return h
+}
+
+// ServeHTTP 实现http.Handler接口
+func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// listQueues 列出队列和各状态的数量
+func (h *AdminHandler) listQueues(w http.ResponseWriter, r *http.Request) {
+	specs := h.qc.Queues()
+	names := make([]string, len(specs))
+	for i, spec := range specs {
+		names[i] = spec.Name
+	}
+	depths, err := h.qc.backend.Depths(names)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	queues := make([]QueueInfo, len(specs))
+	for i, spec := range specs {
+		queues[i] = QueueInfo{
+			Name:     spec.Name,
+			Priority: spec.Priority,
+			Weight:   spec.Weight,
+			Workers:  spec.Workers,
+			Types:    spec.Types,
+			Pending:  depths.Pending[spec.Name],
+			Paused:   h.qc.IsPaused(spec.Name),
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"queues": queues, "depths": depths})
+}
+
+// peekQueue 查看队列中接下来会被处理的项
+func (h *AdminHandler) peekQueue(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if !h.qc.queues.has(name) {
+		writeError(w, fmt.Errorf("%w: %s", ErrUnknownQueue, name))
+		return
+	}
+	limit, err := parseLimit(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	items, err := h.qc.backend.Peek(name, limit)
+	writeItems(w, items, err)
+}
+
+// pauseQueue 暂停消费，路径中没有队列名时暂停全部队列
+func (h *AdminHandler) pauseQueue(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if err := h.qc.Pause(name); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"queue": name, "paused": true})
+}
+
+// resumeQueue 恢复消费，路径中没有队列名时恢复全部队列
+func (h *AdminHandler) resumeQueue(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if err := h.qc.Resume(name); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"queue": name, "paused": false})
+}
+
+// metrics 返回当前指标
+func (h *AdminHandler) metrics(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.qc.GetMetrics())
+}
+
+// metricsHistory 返回指标时间序列，默认最近1小时
+func (h *AdminHandler) metricsHistory(w http.ResponseWriter, r *http.Request) {
+	window := time.Hour
+	if v := r.URL.Query().Get("since"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			writeError(w, fmt.Errorf("%w: since=%s", errBadRequest, v))
+			return
+		}
+		window = d
+	}
+	points, err := h.qc.MetricsHistory(time.Now().Add(-window))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if points == nil {
+		points = []MetricsPoint{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"points": points})
+}
+
+// listRetrying 列出处理失败、等待重试的项
+func (h *AdminHandler) listRetrying(w http.ResponseWriter, r *http.Request) {
+	limit, err := parseLimit(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	items, err := h.qc.backend.Retrying(limit)
+	writeItems(w, items, err)
+}
+
+// listDead 按条件列出死信
+func (h *AdminHandler) listDead(w http.ResponseWriter, r *http.Request) {
+	query, err := parseDeadLetterQuery(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if query.Limit == 0 {
+		query.Limit = defaultAdminLimit
+	}
+	items, err := h.qc.ListDeadLetters(query)
+	writeItems(w, items, err)
+}
+
+// getDead 返回单个死信
+func (h *AdminHandler) getDead(w http.ResponseWriter, r *http.Request) {
+	item, err := h.qc.GetDeadLetter(r.PathValue("id"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, item)
+}
+
+// requeueDead 重放死信，路径中有ID时只重放该死信
+func (h *AdminHandler) requeueDead(w http.ResponseWriter, r *http.Request) {
+	query, err := h.deadTarget(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	requeued, err := h.qc.ReplayDeadLetters(query)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if id := r.PathValue("id"); id != "" && requeued == 0 {
+		writeError(w, fmt.Errorf("%w: %s", ErrDeadLetterNotFound, id))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"requeued": requeued})
+}
+
+// deleteDead 删除死信，路径中有ID时只删除该死信
+func (h *AdminHandler) deleteDead(w http.ResponseWriter, r *http.Request) {
+	query, err := h.deadTarget(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	deleted, err := h.qc.DeleteDeadLetters(query)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if id := r.PathValue("id"); id != "" && deleted == 0 {
+		writeError(w, fmt.Errorf("%w: %s", ErrDeadLetterNotFound, id))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"deleted": deleted})
+}
+
+// deadTarget 解析重放和删除的目标
+// 路径中有ID时只处理该死信；否则按查询参数筛选，没有任何条件时必须指定all=true，避免误操作全部死信
+func (h *AdminHandler) deadTarget(r *http.Request) (DeadLetterQuery, error) {
+	if id := r.PathValue("id"); id != "" {
+		return DeadLetterQuery{IDs: []string{id}}, nil
+	}
+	query, err := parseDeadLetterQuery(r)
+	if err != nil {
+		return query, err
+	}
+	if query.IsZero() && r.URL.Query().Get("all") != "true" {
+		return query, fmt.Errorf("%w: 没有指定筛选条件，如需处理全部死信请加 all=true", errBadRequest)
+	}
+	return query, nil
+}
+
+// listQuarantined 列出隔离队列
+func (h *AdminHandler) listQuarantined(w http.ResponseWriter, r *http.Request) {
+	limit, err := parseLimit(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	items, err := h.qc.ListQuarantined(limit)
+	writeItems(w, items, err)
+}
+
+// releaseQuarantined 把隔离的项放回队列
+func (h *AdminHandler) releaseQuarantined(w http.ResponseWriter, r *http.Request) {
+	released, err := h.qc.ReleaseQuarantined(r.URL.Query().Get("type"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"released": released})
+}
+
+// parseLimit 解析limit参数，默认defaultAdminLimit
+func parseLimit(r *http.Request) (int, error) {
+	v := r.URL.Query().Get("limit")
+	if v == "" {
+		return defaultAdminLimit, nil
+	}
+	limit, err := strconv.Atoi(v)
+	if err != nil || limit < 0 {
+		return 0, fmt.Errorf("%w: limit=%s", errBadRequest, v)
+	}
+	return limit, nil
+}
+
+// parseDeadLetterQuery 解析死信筛选参数
+// id可以重复或用逗号分隔，since为时长（例如24h），limit为0表示不限制
+func parseDeadLetterQuery(r *http.Request) (DeadLetterQuery, error) {
+	values := r.URL.Query()
+	query := DeadLetterQuery{ErrorContains: values.Get("error")}
+	for _, v := range values["id"] {
+		for _, id := range strings.Split(v, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				query.IDs = append(query.IDs, id)
+			}
+		}
+	}
+	if v := values.Get("since"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return query, fmt.Errorf("%w: since=%s", errBadRequest, v)
+		}
+		query.Since = time.Now().Add(-d)
+	}
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			return query, fmt.Errorf("%w: limit=%s", errBadRequest, v)
+		}
+		query.Limit = limit
+	}
+	return query, nil
+}
+
+// writeItems 输出队列项列表
+func writeItems(w http.ResponseWriter, items []QueueItem, err error) {
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if items == nil {
+		items = []QueueItem{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"items": items, "count": len(items)})
+}
+
+// writeJSON 以JSON格式输出
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError 按错误类型输出对应的状态码
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, errBadRequest):
+		status = http.StatusBadRequest
+	case errors.Is(err, ErrDeadLetterNotFound), errors.Is(err, ErrUnknownQueue):
+		status = http.StatusNotFound
+	}
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
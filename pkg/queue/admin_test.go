@@ -0,0 +1,149 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// adminRequest 发送请求并解码JSON应答
+func adminRequest(t *testing.T, server *httptest.Server, method, path string, want int, v interface{}) {
+	t.Helper()
+	req, _ := http.NewRequest(method, server.URL+path, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s error = %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != want {
+		t.Fatalf("%s %s 状态码 = %d，期望 %d", method, path, resp.StatusCode, want)
+	}
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("%s %s 解码应答失败: %v", method, path, err)
+		}
+	}
+}
+
+// 测试暂停消费后查看队列中的项，恢复后继续处理
+func TestAdminPauseAndPeek(t *testing.T) {
+	config := testConfig()
+	config.Queues = []QueueSpec{{Name: "detail", Priority: 10, Types: []string{"product"}}}
+	qc, err := NewQueueControllerWithBackend(NewMemoryBackend(), config)
+	if err != nil {
+		t.Fatalf("NewQueueControllerWithBackend() error = %v", err)
+	}
+	defer qc.Close()
+	server := httptest.NewServer(NewAdminHandler(qc))
+	defer server.Close()
+
+	var processed atomic.Int64
+	RegisterHandlerFunc(qc, "product", func(p testProduct, item *QueueItem) error {
+		processed.Add(1)
+		return nil
+	})
+
+	adminRequest(t, server, "POST", "/queues/detail/pause", http.StatusOK, nil)
+	for _, url := range []string{"a", "b", "c"} {
+		if err := Push(qc, "product", 1, testProduct{URL: url}); err != nil {
+			t.Fatalf("Push() error = %v", err)
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	var queues struct {
+		Queues []QueueInfo `json:"queues"`
+	}
+	adminRequest(t, server, "GET", "/queues", http.StatusOK, &queues)
+	if len(queues.Queues) != 2 || queues.Queues[0].Name != "detail" || !queues.Queues[0].Paused || queues.Queues[0].Pending != 3 {
+		t.Fatalf("GET /queues = %+v", queues.Queues)
+	}
+
+	var peek struct {
+		Items []QueueItem `json:"items"`
+	}
+	adminRequest(t, server, "GET", "/queues/detail/items?limit=2", http.StatusOK, &peek)
+	if len(peek.Items) != 2 || peek.Items[0].Data.(map[string]interface{})["url"] != "a" {
+		t.Fatalf("GET /queues/detail/items = %+v", peek.Items)
+	}
+	adminRequest(t, server, "GET", "/queues/missing/items", http.StatusNotFound, nil)
+	if processed.Load() != 0 {
+		t.Fatal("暂停期间不应处理队列项")
+	}
+
+	adminRequest(t, server, "POST", "/resume", http.StatusOK, nil)
+	waitFor(t, "恢复后处理完成", func() bool { return processed.Load() == 3 })
+}
+
+// 测试查看、重放和删除死信
+func TestAdminDeadLetters(t *testing.T) {
+	qc, err := NewQueueControllerWithBackend(NewMemoryBackend(), testConfig())
+	if err != nil {
+		t.Fatalf("NewQueueControllerWithBackend() error = %v", err)
+	}
+	defer qc.Close()
+	server := httptest.NewServer(NewAdminHandler(qc))
+	defer server.Close()
+
+	var failing atomic.Bool
+	failing.Store(true)
+	RegisterHandlerFunc(qc, "product", func(p testProduct, item *QueueItem) error {
+		if failing.Load() {
+			return errors.New("timeout: " + p.URL)
+		}
+		return nil
+	})
+	for _, url := range []string{"a", "b"} {
+		if err := Push(qc, "product", 1, testProduct{URL: url}); err != nil {
+			t.Fatalf("Push() error = %v", err)
+		}
+	}
+	waitFor(t, "转入死信", func() bool {
+		n, _ := qc.CountDeadLetters(DeadLetterQuery{})
+		return n == 2
+	})
+
+	var dead struct {
+		Items []QueueItem `json:"items"`
+		Count int         `json:"count"`
+	}
+	adminRequest(t, server, "GET", "/dead?error=timeout:+a", http.StatusOK, &dead)
+	if dead.Count != 1 || dead.Items[0].Error != "timeout: a" {
+		t.Fatalf("GET /dead = %+v", dead)
+	}
+	id := dead.Items[0].ID
+	adminRequest(t, server, "GET", "/dead/"+id, http.StatusOK, nil)
+	adminRequest(t, server, "GET", "/dead/missing", http.StatusNotFound, nil)
+
+	// 没有筛选条件时必须指定all=true
+	adminRequest(t, server, "DELETE", "/dead", http.StatusBadRequest, nil)
+
+	failing.Store(false)
+	var requeued struct {
+		Requeued int `json:"requeued"`
+	}
+	adminRequest(t, server, "POST", "/dead/"+id+"/requeue", http.StatusOK, &requeued)
+	if requeued.Requeued != 1 {
+		t.Fatalf("POST /dead/{id}/requeue = %+v", requeued)
+	}
+
+	var deleted struct {
+		Deleted int64 `json:"deleted"`
+	}
+	adminRequest(t, server, "DELETE", "/dead?all=true", http.StatusOK, &deleted)
+	if deleted.Deleted != 1 {
+		t.Fatalf("DELETE /dead?all=true = %+v", deleted)
+	}
+	adminRequest(t, server, "DELETE", "/dead/"+id, http.StatusNotFound, nil)
+
+	var metrics MetricsSnapshot
+	waitFor(t, "重放的项处理完成", func() bool { return qc.GetMetrics().Processed == 1 })
+	adminRequest(t, server, "GET", "/metrics", http.StatusOK, &metrics)
+	if metrics.Processed != 1 || metrics.Depths.Dead != 0 {
+		t.Errorf("GET /metrics = %+v", metrics)
+	}
+}
@@ -0,0 +1,121 @@
+package queue
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// 归档类型
+const (
+	ArchiveCompleted = "completed" // 处理成功的记录
+	ArchiveDead      = "dead"      // 重试耗尽的死信
+)
+
+// errEmpty 队列中没有可取的项
+var errEmpty = errors.New("队列为空")
+
+// Backend 队列存储后端
+// 后端分两部分：投递状态（pending/processing/延迟/隔离）和持久化记录（主记录、归档、指标）。
+// 所有实现的语义一致：
+//   - 同一队列先入先出；回收的项放回队首，重试到期和释放的项放到队尾
+//   - Take登记的租约过期前，只有持有者可以Ack、Retry或Quarantine该项
+//   - Ack、Retry、Quarantine在租约已被回收时不做任何修改，并返回false或少于传入的数量
+//
+// 后端由创建者负责关闭，QueueController关闭时不会关闭后端
+type Backend interface {
+	// Enqueue 保存队列项并放入item.Queue对应队列的队尾
+	Enqueue(item *QueueItem) error
+	// Take 为工作协程从队列取出最多n个项，租约在deadline到期；队列为空时返回空切片
+	Take(worker, queue string, n int, deadline time.Time) ([]*QueueItem, error)
+	// Ack 确认处理完毕并删除投递状态，返回确认的数量
+	Ack(worker string, ids ...string) (int, error)
+	// Retry 把持有的项移入延迟队列，到due后重新投递，同时保存item的最新内容
+	Retry(item *QueueItem, due time.Time) (bool, error)
+	// Promote 把最多limit个到期的延迟项放回所属队列，返回移动的数量
+	Promote(now time.Time, limit int) (int, error)
+	// Reap 把最多limit个租约过期的项放回所属队列的队首，返回这些项
+	Reap(now time.Time, limit int) ([]QueueItem, error)
+	// Quarantine 把持有的项移入隔离队列，同时保存item的最新内容
+	Quarantine(item *QueueItem) (bool, error)
+	// Quarantined 列出隔离队列中的项，最近隔离的在前，limit为0表示不限制
+	Quarantined(limit int) ([]QueueItem, error)
+	// Release 把隔离的项放回所属队列的队尾
+	Release(id string) (bool, error)
+	// Peek 查看队列中接下来会被取出的最多limit个项，不改变队列，limit为0表示不限制
+	Peek(queue string, limit int) ([]QueueItem, error)
+	// Retrying 列出等待延迟重试的项，最早到期的在前，limit为0表示不限制
+	Retrying(limit int) ([]QueueItem, error)
+	// Depths 统计各队列和各状态的项数量
+	Depths(queues []string) (Depths, error)
+
+	// Claim 登记幂等键，window内已登记过时返回false
+	Claim(key string, window time.Duration) (bool, error)
+	// Unclaim 删除幂等键的登记，用于入队失败后允许重新推入
+	Unclaim(key string) error
+	// MarkProcessed 记录幂等键已处理，保留ttl
+	MarkProcessed(key string, ttl time.Duration) error
+	// Processed 判断幂等键是否已处理
+	Processed(key string) (bool, error)
+
+	// Save 更新队列项的主记录
+	Save(items ...*QueueItem) error
+	// Archive 写入归档（ArchiveCompleted或ArchiveDead），重复写入覆盖原记录
+	// 带幂等键的成功记录按幂等键覆盖，同一幂等键只保留一条；其余按ID覆盖
+	Archive(kind string, items ...*QueueItem) error
+	// DeadLetters 按条件列出死信，最近转入的在前
+	DeadLetters(query DeadLetterQuery) ([]QueueItem, error)
+	// CountDeadLetters 统计满足条件的死信数量
+	CountDeadLetters(query DeadLetterQuery) (int64, error)
+	// UpdateDeadLetter 修改死信的数据内容，死信不存在时返回false
+	UpdateDeadLetter(id string, data interface{}) (bool, error)
+	// DeleteDeadLetters 删除满足条件的死信（不受Limit限制），返回删除的数量
+	DeleteDeadLetters(query DeadLetterQuery) (int64, error)
+	// SaveMetrics 保存指标时间序列中的一个点
+	SaveMetrics(point MetricsPoint) error
+	// Metrics 返回since之后保存的指标，按时间先后排列
+	Metrics(since time.Time) ([]MetricsPoint, error)
+}
+
+// Depths 队列中各状态的项数量
+type Depths struct {
+	Pending     map[string]int64 `json:"pending"`     // 各队列等待处理的数量
+	Processing  int64            `json:"processing"`  // 已被取出、尚未确认的数量
+	Retrying    int64            `json:"retrying"`    // 等待延迟重试的数量
+	Quarantined int64            `json:"quarantined"` // 隔离队列中的数量
+	Dead        int64            `json:"dead"`        // 死信数量
+}
+
+// archiveKey 返回归档记录的唯一标识
+func archiveKey(kind string, item *QueueItem) string {
+	if kind == ArchiveCompleted && item.Key != "" {
+		return "key:" + item.Key
+	}
+	return item.ID
+}
+
+// match 判断死信是否满足查询条件，供不使用MongoDB的后端使用
+func (q DeadLetterQuery) match(item *QueueItem) bool {
+	if len(q.IDs) > 0 {
+		found := false
+		for _, id := range q.IDs {
+			if id == item.ID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if q.ErrorContains != "" && !strings.Contains(strings.ToLower(item.Error), strings.ToLower(q.ErrorContains)) {
+		return false
+	}
+	if !q.Since.IsZero() && item.UpdatedAt.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !item.UpdatedAt.Before(q.Until) {
+		return false
+	}
+	return true
+}
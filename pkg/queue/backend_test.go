@@ -0,0 +1,292 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testBackends 需要保持相同语义的后端
+var testBackends = []struct {
+	name string
+	open func(t *testing.T) Backend
+}{
+	{"memory", func(t *testing.T) Backend { return NewMemoryBackend() }},
+	{"file", func(t *testing.T) Backend {
+		b, err := NewFileBackend(t.TempDir())
+		if err != nil {
+			t.Fatalf("NewFileBackend() error = %v", err)
+		}
+		t.Cleanup(func() { b.Close() })
+		return b
+	}},
+}
+
+// testConfig 缩短各种间隔，使测试不需要等待
+func testConfig() Config {
+	return Config{
+		WorkerCount:     2,
+		MaxRetries:      2,
+		RetryBackoff:    5 * time.Millisecond,
+		MaxRetryBackoff: 5 * time.Millisecond,
+		PollInterval:    5 * time.Millisecond,
+		ReapInterval:    time.Hour,
+		DrainTimeout:    time.Second,
+	}
+}
+
+// waitFor 等待条件满足
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("等待%s超时", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// 测试各后端的完整流程：处理成功、重试耗尽转入死信、重放死信
+func TestBackendProcessRetryAndReplay(t *testing.T) {
+	for _, tb := range testBackends {
+		t.Run(tb.name, func(t *testing.T) {
+			backend := tb.open(t)
+			qc, err := NewQueueControllerWithBackend(backend, testConfig())
+			if err != nil {
+				t.Fatalf("NewQueueControllerWithBackend() error = %v", err)
+			}
+			defer qc.Close()
+
+			var processed atomic.Int64
+			var failing atomic.Bool
+			RegisterHandlerFunc(qc, "product", func(p testProduct, item *QueueItem) error {
+				if failing.Load() && p.URL == "bad" {
+					return errors.New("页面解析失败")
+				}
+				processed.Add(1)
+				return nil
+			})
+
+			failing.Store(true)
+			for _, url := range []string{"a", "b", "bad", "c"} {
+				if err := Push(qc, "product", 1, testProduct{URL: url}); err != nil {
+					t.Fatalf("Push() error = %v", err)
+				}
+			}
+
+			waitFor(t, "处理完成", func() bool {
+				n, _ := qc.CountDeadLetters(DeadLetterQuery{})
+				return processed.Load() == 3 && n == 1
+			})
+
+			dead, err := qc.ListDeadLetters(DeadLetterQuery{ErrorContains: "解析"})
+			if err != nil || len(dead) != 1 {
+				t.Fatalf("ListDeadLetters() = %v, %v", dead, err)
+			}
+			if dead[0].Retries != 2 || dead[0].Status != StatusDead {
+				t.Errorf("死信 = %+v", dead[0])
+			}
+
+			failing.Store(false)
+			if n, err := qc.ReplayDeadLetters(DeadLetterQuery{}); n != 1 || err != nil {
+				t.Fatalf("ReplayDeadLetters() = %d, %v", n, err)
+			}
+			waitFor(t, "重放的项处理完成", func() bool { return processed.Load() == 4 })
+
+			depths, err := backend.Depths(qc.queues.names())
+			if err != nil {
+				t.Fatalf("Depths() error = %v", err)
+			}
+			if depths.Pending[DefaultQueue] != 0 || depths.Processing != 0 || depths.Retrying != 0 {
+				t.Errorf("Depths() = %+v", depths)
+			}
+			if n, _ := qc.CountDeadLetters(DeadLetterQuery{}); n != 0 {
+				t.Errorf("重放后死信数量 = %d", n)
+			}
+		})
+	}
+}
+
+// 测试租约过期的项被回收，原持有者不能再确认
+func TestBackendReapExpiredLease(t *testing.T) {
+	for _, tb := range testBackends {
+		t.Run(tb.name, func(t *testing.T) {
+			config := testConfig()
+			config.VisibilityTimeout = time.Millisecond
+			qc, err := OpenQueueControllerWithBackend(tb.open(t), config)
+			if err != nil {
+				t.Fatalf("OpenQueueControllerWithBackend() error = %v", err)
+			}
+			defer qc.Close()
+
+			for _, url := range []string{"a", "b"} {
+				if err := Push(qc, "product", 1, testProduct{URL: url}); err != nil {
+					t.Fatalf("Push() error = %v", err)
+				}
+			}
+			taken, err := qc.take("crashed", DefaultQueue, 1)
+			if err != nil {
+				t.Fatalf("take() error = %v", err)
+			}
+
+			time.Sleep(5 * time.Millisecond)
+			if n, err := qc.reap(); n != 1 || err != nil {
+				t.Fatalf("reap() = %d, %v", n, err)
+			}
+
+			// 回收的项放回队首，先于其他项被取出
+			again, err := qc.take("other", DefaultQueue, 1)
+			if err != nil || again[0].ID != taken[0].ID {
+				t.Fatalf("回收后取出 = %v, %v，期望 %s", again, err, taken[0].ID)
+			}
+			if n, _ := qc.ack("crashed", taken[0].ID); n != 0 {
+				t.Error("租约过期后原持有者不应能确认")
+			}
+			if n, _ := qc.ack("other", taken[0].ID); n != 1 {
+				t.Error("新持有者应能确认")
+			}
+		})
+	}
+}
+
+// 测试没有处理器的项进入隔离队列，注册处理器后释放回队列
+func TestBackendQuarantine(t *testing.T) {
+	for _, tb := range testBackends {
+		t.Run(tb.name, func(t *testing.T) {
+			backend := tb.open(t)
+			qc, err := OpenQueueControllerWithBackend(backend, testConfig())
+			if err != nil {
+				t.Fatalf("OpenQueueControllerWithBackend() error = %v", err)
+			}
+			defer qc.Close()
+
+			if err := Push(qc, "review", 1, testProduct{URL: "a"}); err != nil {
+				t.Fatalf("Push() error = %v", err)
+			}
+			items, err := qc.take("w", DefaultQueue, 1)
+			if err != nil {
+				t.Fatalf("take() error = %v", err)
+			}
+			qc.processOne(items[0])
+
+			quarantined, err := qc.ListQuarantined(0)
+			if err != nil || len(quarantined) != 1 || quarantined[0].Status != StatusQuarantined {
+				t.Fatalf("ListQuarantined() = %+v, %v", quarantined, err)
+			}
+
+			qc.RegisterHandler("review", HandlerFunc(func(*QueueItem) error { return nil }))
+			if n, err := qc.ReleaseQuarantined("review"); n != 1 || err != nil {
+				t.Fatalf("ReleaseQuarantined() = %d, %v", n, err)
+			}
+			depths, _ := backend.Depths([]string{DefaultQueue})
+			if depths.Pending[DefaultQueue] != 1 || depths.Quarantined != 0 {
+				t.Errorf("释放后 Depths() = %+v", depths)
+			}
+		})
+	}
+}
+
+// 测试文件后端重新打开后恢复状态，包括写入快照和进程崩溃留下的不完整日志
+func TestFileBackendReopen(t *testing.T) {
+	for _, segmentSize := range []int64{defaultSegmentSize, 256} {
+		dir := t.TempDir()
+		backend, err := NewFileBackend(dir)
+		if err != nil {
+			t.Fatalf("NewFileBackend() error = %v", err)
+		}
+		backend.segmentSize = segmentSize
+
+		qc, err := OpenQueueControllerWithBackend(backend, testConfig())
+		if err != nil {
+			t.Fatalf("OpenQueueControllerWithBackend() error = %v", err)
+		}
+		for _, url := range []string{"a", "b", "c"} {
+			if err := Push(qc, "product", 1, testProduct{URL: url}); err != nil {
+				t.Fatalf("Push() error = %v", err)
+			}
+		}
+		items, err := qc.take("w", DefaultQueue, 2)
+		if err != nil {
+			t.Fatalf("take() error = %v", err)
+		}
+		qc.ack("w", items[0].ID)
+		qc.Close()
+		backend.Close()
+
+		// 模拟写入一半时进程崩溃
+		segments, _ := backend.segments()
+		f, _ := os.OpenFile(backend.segmentPath(segments[len(segments)-1]), os.O_WRONLY|os.O_APPEND, 0o644)
+		f.WriteString(`{"op":"enqueue","item":{"id":`)
+		f.Close()
+
+		reopened, err := NewFileBackend(dir)
+		if err != nil {
+			t.Fatalf("segmentSize=%d 重新打开 error = %v", segmentSize, err)
+		}
+		depths, _ := reopened.Depths([]string{DefaultQueue})
+		if depths.Pending[DefaultQueue] != 1 || depths.Processing != 1 {
+			t.Errorf("segmentSize=%d 重新打开后 Depths() = %+v", segmentSize, depths)
+		}
+		if n, _ := reopened.Ack("w", items[1].ID); n != 1 {
+			t.Errorf("segmentSize=%d 重新打开后租约丢失", segmentSize)
+		}
+		reopened.Close()
+	}
+}
+
+// 测试同一目录不能同时打开两个文件后端，关闭后可以重新打开
+func TestFileBackendLock(t *testing.T) {
+	dir := t.TempDir()
+	backend, err := NewFileBackend(dir)
+	if err != nil {
+		t.Fatalf("NewFileBackend() error = %v", err)
+	}
+	if _, err := NewFileBackend(dir); !errors.Is(err, ErrBackendLocked) {
+		t.Fatalf("重复打开 error = %v, 期望 ErrBackendLocked", err)
+	}
+	backend.Close()
+
+	reopened, err := NewFileBackend(dir)
+	if err != nil {
+		t.Fatalf("关闭后重新打开 error = %v", err)
+	}
+	reopened.Close()
+}
+
+// 测试主记录和归档超过上限后删除最早更新的记录，投递中的项的记录保留
+func TestMemoryBackendTrimRecords(t *testing.T) {
+	b := NewMemoryBackend()
+	b.maxRecords = 10
+	b.maxArchived = 10
+
+	base := time.Now()
+	if err := b.Enqueue(&QueueItem{ID: "inflight", Queue: DefaultQueue}); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	b.Save(&QueueItem{ID: "inflight", UpdatedAt: base})
+	for i := 0; i < 20; i++ {
+		item := &QueueItem{ID: fmt.Sprintf("item-%02d", i), UpdatedAt: base.Add(time.Duration(i+1) * time.Second)}
+		b.Save(item)
+		b.Archive(ArchiveDead, item)
+	}
+
+	if n := len(b.state.Records); n > 10 {
+		t.Errorf("主记录数量 = %d, 期望不超过 10", n)
+	}
+	if _, ok := b.Record("inflight"); !ok {
+		t.Error("投递中的项的记录被删除")
+	}
+	if _, ok := b.Record("item-19"); !ok {
+		t.Error("最近更新的记录被删除")
+	}
+	if _, ok := b.Record("item-00"); ok {
+		t.Error("最早更新的记录未删除")
+	}
+	if n := len(b.Archived(ArchiveDead)); n > 10 {
+		t.Errorf("归档数量 = %d, 期望不超过 10", n)
+	}
+}
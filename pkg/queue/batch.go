@@ -0,0 +1,291 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// batchPollInterval 凑批时检查新队列项的间隔
+const batchPollInterval = 100 * time.Millisecond
+
+// BatchHandler 批量数据处理器接口
+// 返回nil表示全部成功；返回*BatchError表示其中部分项失败；返回其他错误表示整批失败
+type BatchHandler interface {
+	ProcessBatch(items []*QueueItem) error
+}
+
+// BatchHandlerFunc 函数形式的批量数据处理器
+type BatchHandlerFunc func(items []*QueueItem) error
+
+// ProcessBatch 实现BatchHandler接口
+func (f BatchHandlerFunc) ProcessBatch(items []*QueueItem) error {
+	return f(items)
+}
+
+// BatchError 批处理中部分项失败，没有出现在Failed中的项视为成功
+type BatchError struct {
+	Failed map[string]error // 队列项ID -> 失败原因
+}
+
+// Add 记录一个失败的队列项
+func (e *BatchError) Add(id string, err error) {
+	if e.Failed == nil {
+		e.Failed = make(map[string]error)
+	}
+	e.Failed[id] = err
+}
+
+// Error 实现error接口
+func (e *BatchError) Error() string {
+	for id, err := range e.Failed {
+		return fmt.Sprintf("批处理中 %d 项失败，例如 %s: %v", len(e.Failed), id, err)
+	}
+	return "批处理没有失败项"
+}
+
+// ErrOrNil 没有失败项时返回nil
+func (e *BatchError) ErrOrNil() error {
+	if len(e.Failed) == 0 {
+		return nil
+	}
+	return e
+}
+
+// RegisterBatchHandler 注册批量数据处理器
+// 同一类型同时注册了批量处理器和逐项处理器时，使用批量处理器
+func (qc *QueueController) RegisterBatchHandler(dataType string, handler BatchHandler) {
+	qc.mu.Lock()
+	defer qc.mu.Unlock()
+	qc.batches[dataType] = handler
+}
+
+// RegisterBatchHandlerFunc 注册类型化的批量处理函数
+// 解码失败的项单独记为失败，其余项解码为T后一起交给处理函数
+//
+// 参数:
+//   - qc: 队列控制器
+//   - dataType: 数据类型
+//   - fn: 处理函数，payloads与items一一对应；部分失败时返回*BatchError
+func RegisterBatchHandlerFunc[T any](qc *QueueController, dataType string, fn func(payloads []T, items []*QueueItem) error) {
+	qc.RegisterBatchHandler(dataType, BatchHandlerFunc(func(items []*QueueItem) error {
+		result := &BatchError{}
+		payloads := make([]T, 0, len(items))
+		decoded := make([]*QueueItem, 0, len(items))
+		for _, item := range items {
+			var payload T
+			if err := item.Decode(&payload); err != nil {
+				result.Add(item.ID, fmt.Errorf("解码 %s 数据失败: %w", dataType, err))
+				continue
+			}
+			payloads = append(payloads, payload)
+			decoded = append(decoded, item)
+		}
+		if len(decoded) == 0 {
+			return result.ErrOrNil()
+		}
+
+		if err := fn(payloads, decoded); err != nil {
+			var partial *BatchError
+			if errors.As(err, &partial) {
+				for id, itemErr := range partial.Failed {
+					result.Add(id, itemErr)
+				}
+			} else {
+				for _, item := range decoded {
+					result.Add(item.ID, err)
+				}
+			}
+		}
+		return result.ErrOrNil()
+	}))
+}
+
+// getBatchHandler 获取数据类型对应的批量处理器
+func (qc *QueueController) getBatchHandler(item *QueueItem) (BatchHandler, bool) {
+	qc.mu.RLock()
+	defer qc.mu.RUnlock()
+	handler, exists := qc.batches[itemType(item)]
+	return handler, exists
+}
+
+// nextBatch 按队列顺序获取下一批待处理项
+// BatchSize不大于1时每次只取一项；否则从第一个非空队列最多取BatchSize项，
+// 不足时在FlushInterval内继续等待该队列的新项
+func (qc *QueueController) nextBatch(worker string, queues []string) ([]*QueueItem, error) {
+	size := qc.config.BatchSize
+	if size <= 1 {
+		item, err := qc.getNextItem(worker, queues)
+		if err != nil {
+			return nil, err
+		}
+		return []*QueueItem{item}, nil
+	}
+
+	var items []*QueueItem
+	var queue string
+	for _, queue = range queues {
+		var err error
+		items, err = qc.take(worker, queue, size)
+		if err == nil {
+			break
+		}
+		if err != errEmpty {
+			return nil, err
+		}
+	}
+	if items == nil {
+		return nil, errEmpty
+	}
+
+	deadline := time.Now().Add(qc.config.FlushInterval)
+	for len(items) < size {
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			break
+		}
+		if wait > batchPollInterval {
+			wait = batchPollInterval
+		}
+		select {
+		case <-qc.drainCh:
+			return items, nil
+		case <-time.After(wait):
+		}
+
+		more, err := qc.take(worker, queue, size-len(items))
+		if err == errEmpty {
+			continue
+		}
+		if err != nil {
+			log.Printf("获取队列项失败: %v", err)
+			break
+		}
+		items = append(items, more...)
+	}
+	return items, nil
+}
+
+// processItems 处理一批队列项
+// 注册了批量处理器的类型按类型分组批量处理，其余项和幂等键已处理过的项逐项处理
+func (qc *QueueController) processItems(items []*QueueItem) {
+	groups := make(map[string][]*QueueItem)
+	handlers := make(map[string]BatchHandler)
+	var order []string
+
+	for _, item := range items {
+		handler, ok := qc.getBatchHandler(item)
+		if !ok || qc.isProcessed(item) {
+			qc.processOne(item)
+			continue
+		}
+		dataType := itemType(item)
+		if _, seen := groups[dataType]; !seen {
+			order = append(order, dataType)
+			handlers[dataType] = handler
+		}
+		groups[dataType] = append(groups[dataType], item)
+	}
+
+	for _, dataType := range order {
+		qc.processBatch(handlers[dataType], groups[dataType])
+	}
+}
+
+// processBatch 用批量处理器处理同一类型的一批队列项
+func (qc *QueueController) processBatch(handler BatchHandler, items []*QueueItem) {
+	start := time.Now()
+
+	// 记录处理中状态
+	var err error
+	if err = qc.backend.Save(items...); err == nil {
+		err = handler.ProcessBatch(items)
+	}
+
+	failed := make(map[string]error)
+	var partial *BatchError
+	switch {
+	case err == nil:
+	case errors.As(err, &partial):
+		failed = partial.Failed
+	default:
+		for _, item := range items {
+			failed[item.ID] = err
+		}
+	}
+	qc.finishBatch(items, failed)
+
+	// 按平均耗时计入每一项
+	perItem := time.Since(start) / time.Duration(len(items))
+	for _, item := range items {
+		qc.metrics.observe(itemType(item), perItem)
+	}
+}
+
+// finishBatch 根据每项的处理结果完成、重试或转入死信，并批量持久化
+// 与逐项处理相同，先持久化再确认，确认前崩溃的项会被重新投递
+func (qc *QueueController) finishBatch(items []*QueueItem, failed map[string]error) {
+	now := time.Now()
+	var completed, dead, persisted []*QueueItem
+	failures := 0
+
+	for _, item := range items {
+		item.UpdatedAt = now
+		err := failed[item.ID]
+		if err == nil {
+			item.Status = StatusCompleted
+			completed = append(completed, item)
+			persisted = append(persisted, item)
+			continue
+		}
+
+		failures++
+		item.Error = err.Error()
+		item.Retries++
+		if item.Retries < qc.config.MaxRetries {
+			item.Status = StatusRetrying
+			if err := qc.scheduleRetry(item, qc.config.retryDelay(item.Retries)); err != nil {
+				log.Printf("队列项 %s 安排重试失败: %v", item.ID, err)
+				continue
+			}
+		} else {
+			item.Status = StatusDead
+			dead = append(dead, item)
+		}
+		persisted = append(persisted, item)
+	}
+
+	if err := qc.backend.Save(persisted...); err != nil {
+		log.Printf("批量更新队列项状态失败: %v", err)
+		return
+	}
+
+	var acked []string
+	if err := qc.backend.Archive(ArchiveCompleted, completed...); err != nil {
+		log.Printf("批量保存成功记录失败: %v", err)
+	} else {
+		qc.markProcessed(completed...)
+		for _, item := range completed {
+			acked = append(acked, item.ID)
+		}
+	}
+	if err := qc.backend.Archive(ArchiveDead, dead...); err != nil {
+		log.Printf("批量保存死信失败: %v", err)
+	} else {
+		for _, item := range dead {
+			acked = append(acked, item.ID)
+		}
+	}
+
+	if len(acked) > 0 {
+		n, err := qc.ack(items[0].Worker, acked...)
+		if err != nil {
+			log.Printf("批量确认队列项失败: %v", err)
+		} else if n < len(acked) {
+			log.Printf("%d 个队列项的租约已过期，已被重新投递", len(acked)-n)
+		}
+	}
+
+	qc.metrics.addResults(len(completed), failures)
+}
@@ -0,0 +1,49 @@
+package queue
+
+import (
+	"errors"
+	"testing"
+)
+
+// 测试批量处理函数的解码失败和部分失败都按项报告
+func TestRegisterBatchHandlerFuncPartialFailure(t *testing.T) {
+	qc := &QueueController{handlers: make(map[string]Handler), batches: make(map[string]BatchHandler)}
+
+	var received []testProduct
+	RegisterBatchHandlerFunc(qc, "product", func(payloads []testProduct, items []*QueueItem) error {
+		received = payloads
+		result := &BatchError{}
+		for i, p := range payloads {
+			if p.Price < 0 {
+				result.Add(items[i].ID, errors.New("价格无效"))
+			}
+		}
+		return result.ErrOrNil()
+	})
+
+	items := []*QueueItem{
+		{ID: "ok", Type: "product", Data: map[string]interface{}{"url": "https://example.com/1", "price": 10.0}},
+		{ID: "bad-price", Type: "product", Data: map[string]interface{}{"url": "https://example.com/2", "price": -1.0}},
+		{ID: "bad-json", Type: "product", Data: map[string]interface{}{"url": 123}},
+	}
+
+	handler, ok := qc.getBatchHandler(items[0])
+	if !ok {
+		t.Fatal("getBatchHandler() 未找到product批量处理器")
+	}
+
+	err := handler.ProcessBatch(items)
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("ProcessBatch() error = %v, 期望 *BatchError", err)
+	}
+	if len(received) != 2 {
+		t.Errorf("处理函数收到 %d 项, 期望 2", len(received))
+	}
+	if _, failed := batchErr.Failed["ok"]; failed {
+		t.Error("ok 不应失败")
+	}
+	if batchErr.Failed["bad-price"] == nil || batchErr.Failed["bad-json"] == nil {
+		t.Errorf("Failed = %v, 期望 bad-price 和 bad-json 失败", batchErr.Failed)
+	}
+}
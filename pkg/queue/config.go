@@ -4,12 +4,66 @@ import "time"
 
 // Config 队列控制器配置
 type Config struct {
-	WorkerCount     int           // 工作协程数量
-	MaxRetries      int           // 最大重试次数
-	BatchSize       int           // 批处理大小
-	FlushInterval   time.Duration // 刷新间隔
-	MetricsInterval time.Duration // 指标收集间隔
-	RedisKeyPrefix  string        // Redis键前缀
-	MongoDatabase   string        // MongoDB数据库名
-	MongoCollection string        // MongoDB集合名
+	WorkerCount       int           // 工作协程数量
+	MaxRetries        int           // 最大重试次数
+	BatchSize         int           // 批处理大小，大于1时工作协程一次最多取出该数量的项
+	FlushInterval     time.Duration // 刷新间隔，批处理时凑满一批的最长等待时间
+	MetricsInterval   time.Duration // 指标收集间隔
+	VisibilityTimeout time.Duration // 可见性超时，取出后超过该时间未确认的项会被重新入队
+	ReapInterval      time.Duration // 回收超时项的检查间隔
+	RetryBackoff      time.Duration // 第一次重试前的等待时间，之后每次翻倍
+	MaxRetryBackoff   time.Duration // 重试等待时间上限
+	DrainTimeout      time.Duration // Close时等待正在处理的项完成的最长时间
+	PollInterval      time.Duration // 队列为空时再次获取的等待时间，也是检查到期重试项的间隔
+	DedupWindow       time.Duration // 去重窗口，相同幂等键的项在该时间内只入队一次，默认1小时
+	ProcessedTTL      time.Duration // 幂等键已处理标记的保留时间，默认7天
+	RedisKeyPrefix    string        // Redis键前缀
+	MongoDatabase     string        // MongoDB数据库名
+	MongoCollection   string        // MongoDB集合名
+	Queues            []QueueSpec   // 命名队列，没有配置default队列时自动添加
+	Scheduling        string        // 共享工作协程的跨队列调度方式: strict/weighted，默认strict
+}
+
+// withDefaults 用默认值补全未设置的配置项
+func (c Config) withDefaults() Config {
+	if c.MetricsInterval <= 0 {
+		c.MetricsInterval = time.Minute
+	}
+	if c.VisibilityTimeout <= 0 {
+		c.VisibilityTimeout = 5 * time.Minute
+	}
+	if c.ReapInterval <= 0 {
+		c.ReapInterval = 30 * time.Second
+	}
+	if c.RetryBackoff <= 0 {
+		c.RetryBackoff = 5 * time.Second
+	}
+	if c.MaxRetryBackoff <= 0 {
+		c.MaxRetryBackoff = 10 * time.Minute
+	}
+	if c.DrainTimeout <= 0 {
+		c.DrainTimeout = 30 * time.Second
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = time.Second
+	}
+	if c.DedupWindow <= 0 {
+		c.DedupWindow = time.Hour
+	}
+	if c.ProcessedTTL <= 0 {
+		c.ProcessedTTL = 7 * 24 * time.Hour
+	}
+	return c
+}
+
+// retryDelay 计算第n次重试前的等待时间（指数退避）
+func (c Config) retryDelay(n int) time.Duration {
+	d := c.RetryBackoff
+	for i := 1; i < n && d < c.MaxRetryBackoff; i++ {
+		d *= 2
+	}
+	if d > c.MaxRetryBackoff {
+		d = c.MaxRetryBackoff
+	}
+	return d
 }
@@ -0,0 +1,107 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrDeadLetterNotFound 死信不存在
+var ErrDeadLetterNotFound = errors.New("死信不存在")
+
+// DeadLetterQuery 死信查询条件，所有条件同时满足
+type DeadLetterQuery struct {
+	IDs           []string  // 只匹配指定ID
+	ErrorContains string    // 错误信息包含该文本
+	Since         time.Time // 转入死信的时间不早于该时间
+	Until         time.Time // 转入死信的时间早于该时间
+	Limit         int       // 返回数量上限，0表示不限制
+}
+
+// IsZero 判断是否没有设置任何条件（匹配全部死信）
+func (q DeadLetterQuery) IsZero() bool {
+	return len(q.IDs) == 0 && q.ErrorContains == "" && q.Since.IsZero() && q.Until.IsZero()
+}
+
+// ListDeadLetters 按条件列出死信，最近转入的在前
+func (qc *QueueController) ListDeadLetters(query DeadLetterQuery) ([]QueueItem, error) {
+	return qc.backend.DeadLetters(query)
+}
+
+// CountDeadLetters 统计满足条件的死信数量
+func (qc *QueueController) CountDeadLetters(query DeadLetterQuery) (int64, error) {
+	return qc.backend.CountDeadLetters(query)
+}
+
+// GetDeadLetter 获取单个死信
+func (qc *QueueController) GetDeadLetter(id string) (*QueueItem, error) {
+	items, err := qc.backend.DeadLetters(DeadLetterQuery{IDs: []string{id}, Limit: 1})
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrDeadLetterNotFound, id)
+	}
+	return &items[0], nil
+}
+
+// UpdateDeadLetter 修改死信的数据内容，用于修正导致处理失败的数据后再重放
+func (qc *QueueController) UpdateDeadLetter(id string, data interface{}) error {
+	ok, err := qc.backend.UpdateDeadLetter(id, data)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrDeadLetterNotFound, id)
+	}
+	return nil
+}
+
+// ReplayDeadLetters 把满足条件的死信重新放回队列
+// 重放的项保留原ID，重试次数清零，重放成功后从死信集合删除
+//
+// 返回:
+//   - int: 成功重放的数量
+//   - error: 第一个重放失败的错误，出错时仍会继续处理其余死信
+func (qc *QueueController) ReplayDeadLetters(query DeadLetterQuery) (int, error) {
+	items, err := qc.ListDeadLetters(query)
+	if err != nil {
+		return 0, err
+	}
+
+	replayed := 0
+	var firstErr error
+	for i := range items {
+		if err := qc.replay(&items[i]); err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("重放 %s 失败: %w", items[i].ID, err)
+			}
+			continue
+		}
+		replayed++
+	}
+	return replayed, firstErr
+}
+
+// replay 重放单个死信
+func (qc *QueueController) replay(item *QueueItem) error {
+	item.Status = StatusPending
+	item.Retries = 0
+	item.Error = ""
+	item.Worker = ""
+	item.UpdatedAt = time.Now()
+
+	if err := qc.persistItem(item); err != nil {
+		return err
+	}
+	if err := qc.enqueue(item); err != nil {
+		return err
+	}
+	_, err := qc.backend.DeleteDeadLetters(DeadLetterQuery{IDs: []string{item.ID}})
+	return err
+}
+
+// DeleteDeadLetters 删除满足条件的死信，返回删除的数量（不受Limit限制）
+func (qc *QueueController) DeleteDeadLetters(query DeadLetterQuery) (int64, error) {
+	return qc.backend.DeleteDeadLetters(query)
+}
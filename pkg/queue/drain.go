@@ -0,0 +1,159 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrDraining 队列正在排空或已关闭，不再接受新数据
+var ErrDraining = errors.New("队列正在关闭，不再接受新数据")
+
+// ShutdownReport 关闭队列时的处理情况
+type ShutdownReport struct {
+	Drained     bool             `json:"drained"`     // 所有工作协程是否在期限内处理完手头的项
+	Duration    time.Duration    `json:"duration"`    // 关闭耗时
+	InFlight    []string         `json:"in_flight"`   // 期限到达时仍在处理的ID，可见性超时后会被重新投递
+	Pending     map[string]int64 `json:"pending"`     // 各队列剩余的待处理数量
+	Retrying    int64            `json:"retrying"`    // 等待延迟重试的数量
+	Quarantined int64            `json:"quarantined"` // 隔离队列中的数量
+	Processed   int64            `json:"processed"`   // 本进程累计处理成功的数量
+	Failed      int64            `json:"failed"`      // 本进程累计处理失败的数量
+}
+
+// String 返回便于记录日志的摘要
+func (r ShutdownReport) String() string {
+	names := make([]string, 0, len(r.Pending))
+	for name := range r.Pending {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pending := make([]string, 0, len(names))
+	for _, name := range names {
+		pending = append(pending, fmt.Sprintf("%s=%d", name, r.Pending[name]))
+	}
+	return fmt.Sprintf("排空完成=%t 耗时=%s 未完成=%d 待处理[%s] 等待重试=%d 隔离=%d 成功=%d 失败=%d",
+		r.Drained, r.Duration.Round(time.Millisecond), len(r.InFlight), strings.Join(pending, " "),
+		r.Retrying, r.Quarantined, r.Processed, r.Failed)
+}
+
+// Drain 进入排空模式
+// Push不再接受新数据，工作协程不再取新项，处理完手头的项后退出
+func (qc *QueueController) Drain() {
+	qc.drainOnce.Do(func() { close(qc.drainCh) })
+}
+
+// isDraining 判断是否处于排空模式
+func (qc *QueueController) isDraining() bool {
+	select {
+	case <-qc.drainCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// Shutdown 排空队列并关闭
+// 等待工作协程处理完手头的项，直到ctx结束；之后停止后台任务并保存最终指标
+//
+// 返回:
+//   - ShutdownReport: 关闭时的处理情况，包括未处理完的项
+//   - error: ctx结束时仍有项未处理完
+func (qc *QueueController) Shutdown(ctx context.Context) (ShutdownReport, error) {
+	start := time.Now()
+	qc.Drain()
+
+	done := make(chan struct{})
+	go func() {
+		qc.workers.Wait()
+		close(done)
+	}()
+
+	var report ShutdownReport
+	var waitErr error
+	select {
+	case <-done:
+		report.Drained = true
+	case <-ctx.Done():
+		waitErr = ctx.Err()
+	}
+	report.InFlight = qc.inFlightIDs()
+
+	// 停止回收、调度和监控
+	qc.cancel()
+	qc.background.Wait()
+
+	// 保存最终指标
+	if qc.started {
+		if err := qc.persistMetrics(); err != nil {
+			log.Printf("保存队列指标失败: %v", err)
+		}
+	}
+
+	snapshot := qc.metrics.snapshot(time.Now())
+	report.Processed = snapshot.Processed
+	report.Failed = snapshot.Failed
+
+	if err := qc.countRemaining(&report); err != nil {
+		log.Printf("统计剩余队列项失败: %v", err)
+	}
+	report.Duration = time.Since(start)
+	return report, waitErr
+}
+
+// countRemaining 统计各队列剩余的项
+func (qc *QueueController) countRemaining(report *ShutdownReport) error {
+	depths, err := qc.backend.Depths(qc.queues.names())
+	if err != nil {
+		return err
+	}
+	report.Pending = depths.Pending
+	report.Retrying = depths.Retrying
+	report.Quarantined = depths.Quarantined
+	return nil
+}
+
+// goBackground 启动受跟踪的后台任务
+func (qc *QueueController) goBackground(fn func()) {
+	qc.background.Add(1)
+	go func() {
+		defer qc.background.Done()
+		fn()
+	}()
+}
+
+// track 记录工作协程正在处理的项
+func (qc *QueueController) track(worker string, items []*QueueItem) {
+	qc.inFlightMu.Lock()
+	defer qc.inFlightMu.Unlock()
+	for _, item := range items {
+		qc.inFlight[item.ID] = worker
+	}
+}
+
+// untrack 移除处理完毕的项
+func (qc *QueueController) untrack(items []*QueueItem) {
+	qc.inFlightMu.Lock()
+	defer qc.inFlightMu.Unlock()
+	for _, item := range items {
+		delete(qc.inFlight, item.ID)
+	}
+}
+
+// inFlightIDs 返回正在处理的项ID
+func (qc *QueueController) inFlightIDs() []string {
+	qc.inFlightMu.Lock()
+	defer qc.inFlightMu.Unlock()
+
+	ids := make([]string, 0, len(qc.inFlight))
+	for id := range qc.inFlight {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,138 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newDrainController 创建只有一个工作协程的队列控制器，处理器在release关闭前阻塞
+func newDrainController(t *testing.T) (*QueueController, chan string, chan struct{}) {
+	config := testConfig()
+	config.WorkerCount = 1
+	qc, err := NewQueueControllerWithBackend(NewMemoryBackend(), config)
+	if err != nil {
+		t.Fatalf("NewQueueControllerWithBackend() error = %v", err)
+	}
+
+	started := make(chan string, 10)
+	release := make(chan struct{})
+	RegisterHandlerFunc(qc, "product", func(p testProduct, item *QueueItem) error {
+		started <- item.ID
+		<-release
+		return nil
+	})
+	return qc, started, release
+}
+
+// 测试排空模式下Push返回ErrDraining
+func TestDrainRejectsPush(t *testing.T) {
+	qc, _, release := newDrainController(t)
+	close(release)
+	defer qc.Close()
+
+	if err := Push(qc, "product", 1, testProduct{URL: "a"}); err != nil {
+		t.Fatalf("排空前 Push() error = %v", err)
+	}
+	qc.Drain()
+	if err := Push(qc, "product", 1, testProduct{URL: "b"}); !errors.Is(err, ErrDraining) {
+		t.Errorf("排空后 Push() error = %v, 期望 ErrDraining", err)
+	}
+	if err := qc.Push(map[string]interface{}{"type": "product", "url": "c"}); !errors.Is(err, ErrDraining) {
+		t.Errorf("排空后 qc.Push() error = %v, 期望 ErrDraining", err)
+	}
+}
+
+// 测试关闭时等待正在处理的项完成，不再取出新项
+func TestShutdownWaitsForInFlight(t *testing.T) {
+	qc, started, release := newDrainController(t)
+
+	for _, url := range []string{"a", "b"} {
+		if err := Push(qc, "product", 1, testProduct{URL: url}); err != nil {
+			t.Fatalf("Push() error = %v", err)
+		}
+	}
+	first := <-started
+
+	type result struct {
+		report ShutdownReport
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		report, err := qc.Shutdown(context.Background())
+		done <- result{report, err}
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("处理中的项完成前Shutdown就返回了")
+	case <-time.After(20 * time.Millisecond):
+	}
+	if err := Push(qc, "product", 1, testProduct{URL: "c"}); !errors.Is(err, ErrDraining) {
+		t.Errorf("关闭中 Push() error = %v, 期望 ErrDraining", err)
+	}
+
+	close(release)
+	var r result
+	select {
+	case r = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("等待Shutdown超时")
+	}
+	if r.err != nil {
+		t.Fatalf("Shutdown() error = %v", r.err)
+	}
+
+	report := r.report
+	if !report.Drained || len(report.InFlight) != 0 {
+		t.Errorf("Drained/InFlight = %v/%v, 期望 true/[]", report.Drained, report.InFlight)
+	}
+	if report.Processed != 1 || report.Failed != 0 {
+		t.Errorf("Processed/Failed = %d/%d, 期望 1/0", report.Processed, report.Failed)
+	}
+	// 排空后不再取出新项，第二个项留在队列中
+	if report.Pending[DefaultQueue] != 1 {
+		t.Errorf("Pending = %v, 期望 %s=1", report.Pending, DefaultQueue)
+	}
+	select {
+	case id := <-started:
+		t.Errorf("排空后仍取出了 %s（第一个为 %s）", id, first)
+	default:
+	}
+	if s := report.String(); !strings.Contains(s, "排空完成=true") || !strings.Contains(s, DefaultQueue+"=1") {
+		t.Errorf("String() = %s", s)
+	}
+}
+
+// 测试期限到达时返回错误，并报告仍在处理的项
+func TestShutdownDeadline(t *testing.T) {
+	qc, started, release := newDrainController(t)
+	defer close(release)
+
+	if err := Push(qc, "product", 1, testProduct{URL: "a"}); err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+	id := <-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	report, err := qc.Shutdown(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown() error = %v, 期望 context.DeadlineExceeded", err)
+	}
+	if report.Drained {
+		t.Error("期限到达时 Drained 应为 false")
+	}
+	if len(report.InFlight) != 1 || report.InFlight[0] != id {
+		t.Errorf("InFlight = %v, 期望 [%s]", report.InFlight, id)
+	}
+	if report.Processed != 0 {
+		t.Errorf("Processed = %d, 期望 0", report.Processed)
+	}
+	if report.Duration < 20*time.Millisecond {
+		t.Errorf("Duration = %v, 期望不少于期限", report.Duration)
+	}
+}
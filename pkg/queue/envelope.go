@@ -0,0 +1,132 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrUnknownType 队列项的类型没有注册处理器，该项会被转入隔离队列
+var ErrUnknownType = errors.New("未找到处理器")
+
+// Envelope 类型化的队列数据
+// Type决定由哪个处理器处理，Version是数据结构的版本，处理器可以据此兼容旧数据
+type Envelope struct {
+	Type    string          `json:"type"`          // 数据类型
+	Version int             `json:"version"`       // 数据结构版本
+	Key     string          `json:"key,omitempty"` // 幂等键，为空表示不去重
+	Payload json.RawMessage `json:"payload"`       // 原始JSON数据
+}
+
+// Envelope 返回队列项的类型信息和原始JSON数据
+func (item *QueueItem) Envelope() (Envelope, error) {
+	payload, err := json.Marshal(item.Data)
+	if err != nil {
+		return Envelope{}, err
+	}
+	return Envelope{Type: item.Type, Version: item.Version, Key: item.Key, Payload: payload}, nil
+}
+
+// Decode 把队列项的数据内容解码到v
+func (item *QueueItem) Decode(v interface{}) error {
+	payload, err := json.Marshal(item.Data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(payload, v)
+}
+
+// PushEnvelope 将类型化数据推入队列
+func (qc *QueueController) PushEnvelope(env Envelope) error {
+	if env.Type == "" {
+		return fmt.Errorf("数据类型不能为空")
+	}
+
+	// 数据内容按普通JSON值保存，MongoDB中可以直接查看和编辑
+	var data interface{}
+	if len(env.Payload) > 0 {
+		if err := json.Unmarshal(env.Payload, &data); err != nil {
+			return fmt.Errorf("数据内容不是合法的JSON: %w", err)
+		}
+	}
+	return qc.push(env.Key, env.Type, env.Version, data)
+}
+
+// Push 将类型化数据推入队列
+// 参数:
+//   - qc: 队列控制器
+//   - dataType: 数据类型，需要有对应的处理器
+//   - version: 数据结构版本
+//   - payload: 数据内容，按JSON编码
+func Push[T any](qc *QueueController, dataType string, version int, payload T) error {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("编码数据失败: %w", err)
+	}
+	return qc.PushEnvelope(Envelope{Type: dataType, Version: version, Payload: raw})
+}
+
+// PushWithKey 将带幂等键的类型化数据推入队列
+// DedupWindow内相同幂等键的数据只入队一次，重复推入返回ErrDuplicate；
+// 处理成功后幂等键在ProcessedTTL内标记为已处理，之后再入队的相同键的项不会再交给处理器
+//
+// 参数:
+//   - qc: 队列控制器
+//   - key: 幂等键，例如商品URL或商品ID
+//   - dataType: 数据类型，需要有对应的处理器
+//   - version: 数据结构版本
+//   - payload: 数据内容，按JSON编码
+func PushWithKey[T any](qc *QueueController, key, dataType string, version int, payload T) error {
+	if key == "" {
+		return fmt.Errorf("幂等键不能为空")
+	}
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("编码数据失败: %w", err)
+	}
+	return qc.PushEnvelope(Envelope{Type: dataType, Version: version, Key: key, Payload: raw})
+}
+
+// HandlerFunc 函数形式的数据处理器
+type HandlerFunc func(item *QueueItem) error
+
+// Process 实现Handler接口
+func (f HandlerFunc) Process(item *QueueItem) error {
+	return f(item)
+}
+
+// RegisterHandlerFunc 注册类型化的处理函数
+// 队列项的数据内容会先解码为T再交给处理函数，解码失败按处理失败重试
+//
+// 参数:
+//   - qc: 队列控制器
+//   - dataType: 数据类型
+//   - fn: 处理函数，item可用于读取ID、版本和重试次数
+func RegisterHandlerFunc[T any](qc *QueueController, dataType string, fn func(payload T, item *QueueItem) error) {
+	qc.RegisterHandler(dataType, HandlerFunc(func(item *QueueItem) error {
+		var payload T
+		if err := item.Decode(&payload); err != nil {
+			return fmt.Errorf("解码 %s 数据失败: %w", dataType, err)
+		}
+		return fn(payload, item)
+	}))
+}
+
+// itemType 返回队列项的数据类型，兼容旧格式数据
+func itemType(item *QueueItem) string {
+	if item.Type != "" {
+		return item.Type
+	}
+	return legacyType(item.Data)
+}
+
+// legacyType 读取旧格式数据中的type字段
+// 引入Type之前入队的数据以 map["type"] 表示类型
+func legacyType(data interface{}) string {
+	if m, ok := data.(map[string]interface{}); ok {
+		if dataType, ok := m["type"].(string); ok {
+			return dataType
+		}
+	}
+	return ""
+}
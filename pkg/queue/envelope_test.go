@@ -0,0 +1,58 @@
+package queue
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+type testProduct struct {
+	URL   string  `json:"url"`
+	Price float64 `json:"price"`
+}
+
+// 测试经过Redis JSON往返后的数据能解码为注册的类型
+func TestRegisterHandlerFuncDecode(t *testing.T) {
+	qc := &QueueController{handlers: make(map[string]Handler)}
+
+	var got testProduct
+	RegisterHandlerFunc(qc, "product", func(p testProduct, item *QueueItem) error {
+		got = p
+		return nil
+	})
+
+	// 模拟入队后从Redis读出的队列项
+	raw, _ := json.Marshal(&QueueItem{ID: "1", Type: "product", Version: 2, Data: testProduct{URL: "https://example.com/a", Price: 12.5}})
+	var item QueueItem
+	if err := json.Unmarshal(raw, &item); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	handler, ok := qc.getHandler(&item)
+	if !ok {
+		t.Fatal("getHandler() 未找到product处理器")
+	}
+	if err := handler.Process(&item); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if got.URL != "https://example.com/a" || got.Price != 12.5 {
+		t.Errorf("解码结果 = %+v", got)
+	}
+
+	env, err := item.Envelope()
+	if err != nil || env.Type != "product" || env.Version != 2 {
+		t.Errorf("Envelope() = %+v, %v", env, err)
+	}
+}
+
+// 测试未注册的类型和旧格式数据的处理器查找
+func TestGetHandlerUnknownAndLegacy(t *testing.T) {
+	qc := &QueueController{handlers: make(map[string]Handler)}
+	qc.RegisterHandler("legacy", HandlerFunc(func(*QueueItem) error { return nil }))
+
+	if _, ok := qc.getHandler(&QueueItem{Type: "missing"}); ok {
+		t.Error("未注册的类型不应找到处理器")
+	}
+	if _, ok := qc.getHandler(&QueueItem{Data: map[string]interface{}{"type": "legacy"}}); !ok {
+		t.Error("旧格式数据应按type字段找到处理器")
+	}
+}
@@ -0,0 +1,562 @@
+package queue
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	fileSnapshotName   = "snapshot.json" // 快照文件名
+	fileMetricsName    = "metrics.jsonl" // 指标文件名
+	fileLockName       = "LOCK"          // 锁文件名
+	fileSegmentPrefix  = "segment-"      // 日志段文件名前缀
+	fileSegmentSuffix  = ".log"          // 日志段文件名后缀
+	defaultSegmentSize = 16 << 20        // 日志段超过该大小时写入快照并开始新的日志段
+)
+
+// ErrBackendLocked 数据目录已被其他文件后端打开
+var ErrBackendLocked = errors.New("队列数据目录已被其他进程打开")
+
+// 日志操作类型
+const (
+	opEnqueue    = "enqueue"
+	opTake       = "take"
+	opAck        = "ack"
+	opRetry      = "retry"
+	opPromote    = "promote"
+	opReap       = "reap"
+	opQuarantine = "quarantine"
+	opRelease    = "release"
+	opSave       = "save"
+	opArchive    = "archive"
+	opUnarchive  = "unarchive"
+	opClaim      = "claim"
+	opUnclaim    = "unclaim"
+	opProcessed  = "processed"
+)
+
+// FileBackend 基于本地文件的队列后端，用于没有Redis和MongoDB的开发环境
+// 状态保存在内存中，每次修改先应用到内存，再以一行JSON追加到日志段；
+// 打开时从最近的快照和之后的日志段重放恢复状态。日志段超过一定大小时写入快照并删除旧日志段。
+// 写入不做fsync，进程崩溃不会丢数据，操作系统崩溃可能丢失最后的少量操作。
+// 同一目录同时只能由一个后端打开，打开时对目录加锁，已被打开时返回ErrBackendLocked。
+type FileBackend struct {
+	dir         string         // 数据目录
+	lock        *os.File       // 目录锁，关闭时释放
+	mem         *MemoryBackend // 内存中的状态
+	segment     int            // 当前日志段编号
+	file        *os.File       // 当前日志段
+	size        int64          // 当前日志段大小
+	segmentSize int64          // 日志段大小上限
+	metrics     *os.File       // 指标文件
+	mu          sync.Mutex     // 保证修改和日志的顺序一致
+}
+
+// fileOp 日志中的一条操作，重放时以相同参数调用内存后端，得到相同的状态
+type fileOp struct {
+	Op     string       `json:"op"`
+	Item   *QueueItem   `json:"item,omitempty"`
+	Items  []*QueueItem `json:"items,omitempty"`
+	Worker string       `json:"worker,omitempty"`
+	Queue  string       `json:"queue,omitempty"`
+	Kind   string       `json:"kind,omitempty"`
+	IDs    []string     `json:"ids,omitempty"`
+	N      int          `json:"n,omitempty"`
+	Time   time.Time    `json:"time"`
+}
+
+// fileSnapshot 快照，包含写入时最后一个日志段之前的全部状态
+type fileSnapshot struct {
+	Segment int          `json:"segment"` // 快照已包含的最后一个日志段编号
+	State   *memoryState `json:"state"`
+}
+
+// NewFileBackend 打开或创建基于文件的队列后端
+// 参数:
+//   - dir: 数据目录，不存在时自动创建
+func NewFileBackend(dir string) (*FileBackend, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	lock, err := lockDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	b, err := openFileBackend(dir)
+	if err != nil {
+		unlockDir(lock)
+		return nil, err
+	}
+	b.lock = lock
+	return b, nil
+}
+
+// openFileBackend 从快照和日志段恢复状态，调用方已对目录加锁
+func openFileBackend(dir string) (*FileBackend, error) {
+	b := &FileBackend{
+		dir:         dir,
+		mem:         NewMemoryBackend(),
+		segmentSize: defaultSegmentSize,
+	}
+
+	// 加载快照
+	last := 0
+	data, err := os.ReadFile(filepath.Join(dir, fileSnapshotName))
+	if err == nil {
+		snapshot := fileSnapshot{State: newMemoryState()}
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			return nil, fmt.Errorf("解析快照失败: %w", err)
+		}
+		b.mem.state = snapshot.State
+		last = snapshot.Segment
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	// 重放快照之后的日志段
+	segments, err := b.segments()
+	if err != nil {
+		return nil, err
+	}
+	b.segment = last + 1
+	for i, n := range segments {
+		if n <= last {
+			continue
+		}
+		if err := b.replay(n, i == len(segments)-1); err != nil {
+			return nil, err
+		}
+		b.segment = n
+	}
+
+	b.file, err = os.OpenFile(b.segmentPath(b.segment), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := b.file.Stat()
+	if err != nil {
+		b.file.Close()
+		return nil, err
+	}
+	b.size = info.Size()
+
+	b.metrics, err = os.OpenFile(filepath.Join(dir, fileMetricsName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		b.file.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+// segmentPath 返回日志段文件路径
+func (b *FileBackend) segmentPath(n int) string {
+	return filepath.Join(b.dir, fmt.Sprintf("%s%06d%s", fileSegmentPrefix, n, fileSegmentSuffix))
+}
+
+// segments 返回目录中的日志段编号，从小到大排列
+func (b *FileBackend) segments() ([]int, error) {
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []int
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, fileSegmentPrefix) || !strings.HasSuffix(name, fileSegmentSuffix) {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, fileSegmentPrefix), fileSegmentSuffix))
+		if err != nil {
+			continue
+		}
+		segments = append(segments, n)
+	}
+	sort.Ints(segments)
+	return segments, nil
+}
+
+// replay 重放一个日志段
+// 最后一个日志段末尾不完整的一行是写入时进程崩溃留下的，截掉后继续；其他位置的错误说明文件已损坏
+func (b *FileBackend) replay(n int, last bool) error {
+	path := b.segmentPath(n)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(bytes.NewReader(data))
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			return nil
+		}
+
+		var op fileOp
+		decodeErr := json.Unmarshal(line, &op)
+		if err == io.EOF || decodeErr != nil {
+			if !last || (err != io.EOF && reader.Buffered() > 0) {
+				return fmt.Errorf("日志段 %s 在偏移 %d 处损坏", path, offset)
+			}
+			log.Printf("日志段 %s 末尾的操作不完整，已截断", path)
+			return os.Truncate(path, offset)
+		}
+		if err := b.apply(&op); err != nil {
+			return fmt.Errorf("重放日志段 %s 失败: %w", path, err)
+		}
+		offset += int64(len(line))
+	}
+}
+
+// apply 把一条日志操作应用到内存状态
+func (b *FileBackend) apply(op *fileOp) error {
+	var err error
+	switch op.Op {
+	case opEnqueue:
+		err = b.mem.Enqueue(op.Item)
+	case opTake:
+		_, err = b.mem.Take(op.Worker, op.Queue, op.N, op.Time)
+	case opAck:
+		_, err = b.mem.Ack(op.Worker, op.IDs...)
+	case opRetry:
+		_, err = b.mem.Retry(op.Item, op.Time)
+	case opPromote:
+		_, err = b.mem.Promote(op.Time, op.N)
+	case opReap:
+		_, err = b.mem.Reap(op.Time, op.N)
+	case opQuarantine:
+		_, err = b.mem.Quarantine(op.Item)
+	case opRelease:
+		_, err = b.mem.Release(op.IDs[0])
+	case opSave:
+		err = b.mem.Save(op.Items...)
+	case opArchive:
+		err = b.mem.Archive(op.Kind, op.Items...)
+	case opUnarchive:
+		b.mem.unarchive(op.Kind, op.IDs)
+	case opClaim:
+		b.mem.claimUntil(op.IDs[0], op.Time)
+	case opUnclaim:
+		err = b.mem.Unclaim(op.IDs[0])
+	case opProcessed:
+		b.mem.markProcessedUntil(op.IDs[0], op.Time)
+	default:
+		err = fmt.Errorf("未知的操作 %q", op.Op)
+	}
+	return err
+}
+
+// write 追加一条日志操作，日志段超过大小上限时写入快照
+// 调用方需持有锁
+func (b *FileBackend) write(op fileOp) error {
+	data, err := json.Marshal(op)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if _, err := b.file.Write(data); err != nil {
+		return fmt.Errorf("写入日志失败: %w", err)
+	}
+	b.size += int64(len(data))
+
+	if b.size >= b.segmentSize {
+		if err := b.compact(); err != nil {
+			log.Printf("写入队列快照失败: %v", err)
+		}
+	}
+	return nil
+}
+
+// compact 写入包含当前日志段的快照，然后开始新的日志段并删除旧日志段
+// 调用方需持有锁
+func (b *FileBackend) compact() error {
+	b.mem.mu.Lock()
+	data, err := json.Marshal(fileSnapshot{Segment: b.segment, State: b.mem.state})
+	b.mem.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(b.dir, fileSnapshotName)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(b.segmentPath(b.segment+1), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	b.file.Close()
+	b.file = file
+	b.size = 0
+	b.segment++
+
+	segments, err := b.segments()
+	if err != nil {
+		return err
+	}
+	for _, n := range segments {
+		if n < b.segment {
+			os.Remove(b.segmentPath(n))
+		}
+	}
+	return nil
+}
+
+// Close 关闭日志文件
+func (b *FileBackend) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return errors.Join(b.file.Close(), b.metrics.Close(), unlockDir(b.lock))
+}
+
+// Enqueue 实现Backend接口
+func (b *FileBackend) Enqueue(item *QueueItem) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.mem.Enqueue(item); err != nil {
+		return err
+	}
+	return b.write(fileOp{Op: opEnqueue, Item: item})
+}
+
+// Take 实现Backend接口
+func (b *FileBackend) Take(worker, queue string, n int, deadline time.Time) ([]*QueueItem, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	items, err := b.mem.Take(worker, queue, n, deadline)
+	if err != nil || len(items) == 0 {
+		return items, err
+	}
+	return items, b.write(fileOp{Op: opTake, Worker: worker, Queue: queue, N: n, Time: deadline})
+}
+
+// Ack 实现Backend接口
+func (b *FileBackend) Ack(worker string, ids ...string) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	acked, err := b.mem.Ack(worker, ids...)
+	if err != nil || acked == 0 {
+		return acked, err
+	}
+	return acked, b.write(fileOp{Op: opAck, Worker: worker, IDs: ids})
+}
+
+// Retry 实现Backend接口
+func (b *FileBackend) Retry(item *QueueItem, due time.Time) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ok, err := b.mem.Retry(item, due)
+	if err != nil || !ok {
+		return ok, err
+	}
+	return ok, b.write(fileOp{Op: opRetry, Item: item, Time: due})
+}
+
+// Promote 实现Backend接口
+func (b *FileBackend) Promote(now time.Time, limit int) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n, err := b.mem.Promote(now, limit)
+	if err != nil || n == 0 {
+		return n, err
+	}
+	return n, b.write(fileOp{Op: opPromote, N: limit, Time: now})
+}
+
+// Reap 实现Backend接口
+func (b *FileBackend) Reap(now time.Time, limit int) ([]QueueItem, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	items, err := b.mem.Reap(now, limit)
+	if err != nil || len(items) == 0 {
+		return items, err
+	}
+	return items, b.write(fileOp{Op: opReap, N: limit, Time: now})
+}
+
+// Quarantine 实现Backend接口
+func (b *FileBackend) Quarantine(item *QueueItem) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ok, err := b.mem.Quarantine(item)
+	if err != nil || !ok {
+		return ok, err
+	}
+	return ok, b.write(fileOp{Op: opQuarantine, Item: item})
+}
+
+// Quarantined 实现Backend接口
+func (b *FileBackend) Quarantined(limit int) ([]QueueItem, error) {
+	return b.mem.Quarantined(limit)
+}
+
+// Release 实现Backend接口
+func (b *FileBackend) Release(id string) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ok, err := b.mem.Release(id)
+	if err != nil || !ok {
+		return ok, err
+	}
+	return ok, b.write(fileOp{Op: opRelease, IDs: []string{id}})
+}
+
+// Peek 实现Backend接口
+func (b *FileBackend) Peek(queue string, limit int) ([]QueueItem, error) {
+	return b.mem.Peek(queue, limit)
+}
+
+// Retrying 实现Backend接口
+func (b *FileBackend) Retrying(limit int) ([]QueueItem, error) {
+	return b.mem.Retrying(limit)
+}
+
+// Depths 实现Backend接口
+func (b *FileBackend) Depths(queues []string) (Depths, error) {
+	return b.mem.Depths(queues)
+}
+
+// Claim 实现Backend接口，日志中记录登记的过期时间
+func (b *FileBackend) Claim(key string, window time.Duration) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ok, err := b.mem.Claim(key, window)
+	if err != nil || !ok {
+		return ok, err
+	}
+	return ok, b.write(fileOp{Op: opClaim, IDs: []string{key}, Time: time.Now().Add(window)})
+}
+
+// Unclaim 实现Backend接口
+func (b *FileBackend) Unclaim(key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.mem.Unclaim(key); err != nil {
+		return err
+	}
+	return b.write(fileOp{Op: opUnclaim, IDs: []string{key}})
+}
+
+// MarkProcessed 实现Backend接口
+func (b *FileBackend) MarkProcessed(key string, ttl time.Duration) error {
+	until := time.Now().Add(ttl)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.mem.markProcessedUntil(key, until)
+	return b.write(fileOp{Op: opProcessed, IDs: []string{key}, Time: until})
+}
+
+// Processed 实现Backend接口
+func (b *FileBackend) Processed(key string) (bool, error) {
+	return b.mem.Processed(key)
+}
+
+// Save 实现Backend接口
+func (b *FileBackend) Save(items ...*QueueItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.mem.Save(items...); err != nil {
+		return err
+	}
+	return b.write(fileOp{Op: opSave, Items: items})
+}
+
+// Archive 实现Backend接口
+func (b *FileBackend) Archive(kind string, items ...*QueueItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.mem.Archive(kind, items...); err != nil {
+		return err
+	}
+	return b.write(fileOp{Op: opArchive, Kind: kind, Items: items})
+}
+
+// DeadLetters 实现Backend接口
+func (b *FileBackend) DeadLetters(query DeadLetterQuery) ([]QueueItem, error) {
+	return b.mem.DeadLetters(query)
+}
+
+// CountDeadLetters 实现Backend接口
+func (b *FileBackend) CountDeadLetters(query DeadLetterQuery) (int64, error) {
+	return b.mem.CountDeadLetters(query)
+}
+
+// UpdateDeadLetter 实现Backend接口，日志中记录修改后的完整死信
+func (b *FileBackend) UpdateDeadLetter(id string, data interface{}) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ok, err := b.mem.UpdateDeadLetter(id, data)
+	if err != nil || !ok {
+		return ok, err
+	}
+	item, _ := b.mem.archived(ArchiveDead, id)
+	return ok, b.write(fileOp{Op: opArchive, Kind: ArchiveDead, Items: []*QueueItem{item}})
+}
+
+// DeleteDeadLetters 实现Backend接口，日志中记录被删除的ID
+func (b *FileBackend) DeleteDeadLetters(query DeadLetterQuery) (int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ids := b.mem.deleteDead(query)
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	return int64(len(ids)), b.write(fileOp{Op: opUnarchive, Kind: ArchiveDead, IDs: ids})
+}
+
+// SaveMetrics 实现Backend接口，指标以JSON行追加到单独的文件
+func (b *FileBackend) SaveMetrics(point MetricsPoint) error {
+	data, err := json.Marshal(point)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, err = b.metrics.Write(append(data, '\n'))
+	return err
+}
+
+// Metrics 实现Backend接口，跳过无法解析的行
+func (b *FileBackend) Metrics(since time.Time) ([]MetricsPoint, error) {
+	b.mu.Lock()
+	data, err := os.ReadFile(filepath.Join(b.dir, fileMetricsName))
+	b.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	var points []MetricsPoint
+	for _, line := range bytes.Split(data, []byte{'\n'}) {
+		var point MetricsPoint
+		if len(line) == 0 || json.Unmarshal(line, &point) != nil || point.Time.Before(since) {
+			continue
+		}
+		points = append(points, point)
+	}
+	return points, nil
+}
@@ -0,0 +1,25 @@
+//go:build !unix
+
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// lockDir 以独占方式创建锁文件对数据目录加锁
+// 进程崩溃后锁文件会残留，确认没有其他进程使用该目录后手动删除
+func lockDir(dir string) (*os.File, error) {
+	f, err := os.OpenFile(filepath.Join(dir, fileLockName), os.O_CREATE|os.O_EXCL|os.O_RDWR, 0o644)
+	if errors.Is(err, os.ErrExist) {
+		return nil, fmt.Errorf("%w: %s", ErrBackendLocked, dir)
+	}
+	return f, err
+}
+
+// unlockDir 释放数据目录的锁
+func unlockDir(f *os.File) error {
+	return errors.Join(f.Close(), os.Remove(f.Name()))
+}
@@ -0,0 +1,32 @@
+//go:build unix
+
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// lockDir 对数据目录加排他锁，进程退出时操作系统自动释放
+func lockDir(dir string) (*os.File, error) {
+	f, err := os.OpenFile(filepath.Join(dir, fileLockName), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, fmt.Errorf("%w: %s", ErrBackendLocked, dir)
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+// unlockDir 释放数据目录的锁
+func unlockDir(f *os.File) error {
+	return f.Close()
+}
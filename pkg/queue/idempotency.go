@@ -0,0 +1,45 @@
+package queue
+
+import (
+	"errors"
+	"log"
+)
+
+// ErrDuplicate 去重窗口内已推入过相同幂等键的数据
+var ErrDuplicate = errors.New("重复的幂等键")
+
+// AlreadyProcessed 判断幂等键是否已处理，处理器可以据此跳过副作用不能重复的操作
+func (qc *QueueController) AlreadyProcessed(key string) (bool, error) {
+	return qc.backend.Processed(key)
+}
+
+// MarkProcessed 把幂等键标记为已处理，保留ProcessedTTL
+// 带幂等键的项处理成功后会自动标记，处理器也可以对自己的键调用
+func (qc *QueueController) MarkProcessed(key string) error {
+	return qc.backend.MarkProcessed(key, qc.config.ProcessedTTL)
+}
+
+// isProcessed 判断队列项的幂等键是否已处理，查询失败时按未处理继续
+func (qc *QueueController) isProcessed(item *QueueItem) bool {
+	if item.Key == "" {
+		return false
+	}
+	done, err := qc.backend.Processed(item.Key)
+	if err != nil {
+		log.Printf("查询幂等键 %s 失败: %v", item.Key, err)
+		return false
+	}
+	return done
+}
+
+// markProcessed 处理成功后标记队列项的幂等键
+func (qc *QueueController) markProcessed(items ...*QueueItem) {
+	for _, item := range items {
+		if item.Key == "" {
+			continue
+		}
+		if err := qc.MarkProcessed(item.Key); err != nil {
+			log.Printf("标记幂等键 %s 失败: %v", item.Key, err)
+		}
+	}
+}
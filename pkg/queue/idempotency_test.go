@@ -0,0 +1,71 @@
+package queue
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 测试幂等键：窗口内重复推入被丢弃，窗口过后再推入的项不会再交给处理器，成功记录按幂等键只保留一条
+func TestPushWithKeyDeduplicates(t *testing.T) {
+	for _, tb := range testBackends {
+		t.Run(tb.name, func(t *testing.T) {
+			backend := tb.open(t)
+			config := testConfig()
+			config.DedupWindow = 50 * time.Millisecond
+			qc, err := NewQueueControllerWithBackend(backend, config)
+			if err != nil {
+				t.Fatalf("NewQueueControllerWithBackend() error = %v", err)
+			}
+			defer qc.Close()
+
+			var calls atomic.Int64
+			RegisterHandlerFunc(qc, "product", func(p testProduct, item *QueueItem) error {
+				calls.Add(1)
+				return nil
+			})
+
+			const key = "https://example.com/item/1"
+			if err := PushWithKey(qc, key, "product", 1, testProduct{URL: key}); err != nil {
+				t.Fatalf("PushWithKey() error = %v", err)
+			}
+			if err := PushWithKey(qc, key, "product", 1, testProduct{URL: key}); !errors.Is(err, ErrDuplicate) {
+				t.Fatalf("窗口内重复推入 error = %v，期望 ErrDuplicate", err)
+			}
+			waitFor(t, "处理完成", func() bool {
+				done, _ := qc.AlreadyProcessed(key)
+				return done
+			})
+
+			// 窗口过后可以再次推入，但已处理的幂等键不会再交给处理器
+			time.Sleep(config.DedupWindow)
+			if err := PushWithKey(qc, key, "product", 1, testProduct{URL: key, Price: 2}); err != nil {
+				t.Fatalf("窗口过后 PushWithKey() error = %v", err)
+			}
+			waitFor(t, "第二次入队的项完成", func() bool {
+				depths, _ := backend.Depths([]string{DefaultQueue})
+				return depths.Pending[DefaultQueue] == 0 && depths.Processing == 0
+			})
+			if n := calls.Load(); n != 1 {
+				t.Errorf("处理器调用次数 = %d，期望 1", n)
+			}
+
+			completed := memoryOf(backend).Archived(ArchiveCompleted)
+			if len(completed) != 1 || completed[0].Key != key {
+				t.Errorf("成功记录 = %+v，期望按幂等键只有一条", completed)
+			}
+		})
+	}
+}
+
+// memoryOf 返回测试后端的内存状态
+func memoryOf(backend Backend) *MemoryBackend {
+	switch b := backend.(type) {
+	case *MemoryBackend:
+		return b
+	case *FileBackend:
+		return b.mem
+	}
+	return nil
+}
@@ -0,0 +1,652 @@
+package queue
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	maxMemoryMetrics  = 1440   // 内存后端保留的指标记录数量
+	maxMemoryRecords  = 100000 // 内存后端保留的主记录数量，超出后删除最早更新的已结束项的记录
+	maxMemoryArchived = 100000 // 每种归档保留的记录数量，超出后删除最早更新的记录
+)
+
+// MemoryBackend 内存队列后端，用于测试和单进程运行
+// 队列项以JSON副本保存，调用方修改返回的项不会影响后端中的数据，Data的解码结果与其他后端一致
+type MemoryBackend struct {
+	state       *memoryState
+	metrics     []MetricsPoint
+	maxRecords  int // 主记录数量上限
+	maxArchived int // 每种归档的数量上限
+	mu          sync.Mutex
+}
+
+// memoryState 内存后端的全部状态，文件后端以JSON格式保存快照
+type memoryState struct {
+	Items      map[string]*QueueItem            `json:"items"`      // 投递中的项（含状态），确认后删除
+	Pending    map[string][]string              `json:"pending"`    // 队列名 -> 等待处理的ID，队首在前
+	Owners     map[string]string                `json:"owners"`     // ID -> 持有该项的工作协程
+	Leases     map[string]time.Time             `json:"leases"`     // ID -> 可见性截止时间
+	Delayed    map[string]time.Time             `json:"delayed"`    // ID -> 重试时间
+	Quarantine []string                         `json:"quarantine"` // 隔离的ID，最近隔离的在前
+	Claims     map[string]time.Time             `json:"claims"`     // 幂等键 -> 登记的过期时间
+	Done       map[string]time.Time             `json:"done"`       // 幂等键 -> 已处理标记的过期时间
+	Records    map[string]*QueueItem            `json:"records"`    // 主记录
+	Archives   map[string]map[string]*QueueItem `json:"archives"`   // 归档类型 -> ID -> 记录
+}
+
+// newMemoryState 创建空状态
+func newMemoryState() *memoryState {
+	return &memoryState{
+		Items:    make(map[string]*QueueItem),
+		Pending:  make(map[string][]string),
+		Owners:   make(map[string]string),
+		Leases:   make(map[string]time.Time),
+		Delayed:  make(map[string]time.Time),
+		Claims:   make(map[string]time.Time),
+		Done:     make(map[string]time.Time),
+		Records:  make(map[string]*QueueItem),
+		Archives: make(map[string]map[string]*QueueItem),
+	}
+}
+
+// NewMemoryBackend 创建内存队列后端
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		state:       newMemoryState(),
+		maxRecords:  maxMemoryRecords,
+		maxArchived: maxMemoryArchived,
+	}
+}
+
+// cloneItem 通过JSON编解码复制队列项
+func cloneItem(item *QueueItem) (*QueueItem, error) {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+	var clone QueueItem
+	if err := json.Unmarshal(data, &clone); err != nil {
+		return nil, err
+	}
+	return &clone, nil
+}
+
+// queueName 返回项所属的队列名
+func queueName(item *QueueItem) string {
+	if item.Queue == "" {
+		return DefaultQueue
+	}
+	return item.Queue
+}
+
+// Enqueue 实现Backend接口
+func (b *MemoryBackend) Enqueue(item *QueueItem) error {
+	stored, err := cloneItem(item)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.state
+	s.Items[stored.ID] = stored
+	name := queueName(stored)
+	s.Pending[name] = append(s.Pending[name], stored.ID)
+	return nil
+}
+
+// Take 实现Backend接口
+func (b *MemoryBackend) Take(worker, queue string, n int, deadline time.Time) ([]*QueueItem, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.state
+
+	var items []*QueueItem
+	for len(items) < n && len(s.Pending[queue]) > 0 {
+		id := s.Pending[queue][0]
+		s.Pending[queue] = s.Pending[queue][1:]
+		stored, ok := s.Items[id]
+		if !ok {
+			continue
+		}
+		stored.Status = StatusProcessing
+		s.Owners[id] = worker
+		s.Leases[id] = deadline
+
+		item, err := cloneItem(stored)
+		if err != nil {
+			return items, err
+		}
+		items = append(items, item)
+	}
+	if len(s.Pending[queue]) == 0 {
+		delete(s.Pending, queue)
+	}
+	return items, nil
+}
+
+// Ack 实现Backend接口
+func (b *MemoryBackend) Ack(worker string, ids ...string) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.state
+
+	acked := 0
+	for _, id := range ids {
+		if owner, ok := s.Owners[id]; !ok || owner != worker {
+			continue
+		}
+		delete(s.Owners, id)
+		delete(s.Leases, id)
+		delete(s.Items, id)
+		acked++
+	}
+	return acked, nil
+}
+
+// Retry 实现Backend接口
+func (b *MemoryBackend) Retry(item *QueueItem, due time.Time) (bool, error) {
+	stored, err := cloneItem(item)
+	if err != nil {
+		return false, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.state
+	if owner, ok := s.Owners[item.ID]; !ok || owner != item.Worker {
+		return false, nil
+	}
+	delete(s.Owners, item.ID)
+	delete(s.Leases, item.ID)
+	stored.Status = StatusRetrying
+	s.Items[item.ID] = stored
+	s.Delayed[item.ID] = due
+	return true, nil
+}
+
+// Promote 实现Backend接口
+func (b *MemoryBackend) Promote(now time.Time, limit int) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.state
+
+	ids := dueIDs(s.Delayed, now, limit)
+	for _, id := range ids {
+		delete(s.Delayed, id)
+		stored, ok := s.Items[id]
+		if !ok {
+			continue
+		}
+		stored.Status = StatusPending
+		name := queueName(stored)
+		s.Pending[name] = append(s.Pending[name], id)
+	}
+	return len(ids), nil
+}
+
+// Reap 实现Backend接口
+func (b *MemoryBackend) Reap(now time.Time, limit int) ([]QueueItem, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.state
+
+	var items []QueueItem
+	for _, id := range dueIDs(s.Leases, now, limit) {
+		delete(s.Leases, id)
+		delete(s.Owners, id)
+		stored, ok := s.Items[id]
+		if !ok {
+			continue
+		}
+		stored.Status = StatusPending
+		name := queueName(stored)
+		s.Pending[name] = append([]string{id}, s.Pending[name]...)
+
+		item, err := cloneItem(stored)
+		if err != nil {
+			return items, err
+		}
+		items = append(items, *item)
+	}
+	return items, nil
+}
+
+// dueIDs 按时间先后返回最多limit个不晚于now的ID，时间相同时按ID排序
+func dueIDs(times map[string]time.Time, now time.Time, limit int) []string {
+	var ids []string
+	for id, t := range times {
+		if !t.After(now) {
+			ids = append(ids, id)
+		}
+	}
+	return limitIDs(sortByTime(ids, times), limit)
+}
+
+// sortByTime 按时间先后排列ID，时间相同时按ID排序
+func sortByTime(ids []string, times map[string]time.Time) []string {
+	sort.Slice(ids, func(i, j int) bool {
+		ti, tj := times[ids[i]], times[ids[j]]
+		if ti.Equal(tj) {
+			return ids[i] < ids[j]
+		}
+		return ti.Before(tj)
+	})
+	return ids
+}
+
+// Quarantine 实现Backend接口
+func (b *MemoryBackend) Quarantine(item *QueueItem) (bool, error) {
+	stored, err := cloneItem(item)
+	if err != nil {
+		return false, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.state
+	if owner, ok := s.Owners[item.ID]; !ok || owner != item.Worker {
+		return false, nil
+	}
+	delete(s.Owners, item.ID)
+	delete(s.Leases, item.ID)
+	stored.Status = StatusQuarantined
+	s.Items[item.ID] = stored
+	s.Quarantine = append([]string{item.ID}, s.Quarantine...)
+	return true, nil
+}
+
+// Quarantined 实现Backend接口
+func (b *MemoryBackend) Quarantined(limit int) ([]QueueItem, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.state
+
+	return b.itemsLocked(limitIDs(s.Quarantine, limit))
+}
+
+// Release 实现Backend接口
+func (b *MemoryBackend) Release(id string) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.state
+
+	for i, quarantined := range s.Quarantine {
+		if quarantined != id {
+			continue
+		}
+		s.Quarantine = append(s.Quarantine[:i:i], s.Quarantine[i+1:]...)
+		if stored, ok := s.Items[id]; ok {
+			stored.Status = StatusPending
+			name := queueName(stored)
+			s.Pending[name] = append(s.Pending[name], id)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// Peek 实现Backend接口
+func (b *MemoryBackend) Peek(queue string, limit int) ([]QueueItem, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.itemsLocked(limitIDs(b.state.Pending[queue], limit))
+}
+
+// Retrying 实现Backend接口
+func (b *MemoryBackend) Retrying(limit int) ([]QueueItem, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ids := make([]string, 0, len(b.state.Delayed))
+	for id := range b.state.Delayed {
+		ids = append(ids, id)
+	}
+	return b.itemsLocked(limitIDs(sortByTime(ids, b.state.Delayed), limit))
+}
+
+// itemsLocked 按ID复制投递中的项，调用方需持有锁
+func (b *MemoryBackend) itemsLocked(ids []string) ([]QueueItem, error) {
+	items := make([]QueueItem, 0, len(ids))
+	for _, id := range ids {
+		stored, ok := b.state.Items[id]
+		if !ok {
+			continue
+		}
+		item, err := cloneItem(stored)
+		if err != nil {
+			return items, err
+		}
+		items = append(items, *item)
+	}
+	return items, nil
+}
+
+// limitIDs 返回前limit个ID，limit为0表示不限制
+func limitIDs(ids []string, limit int) []string {
+	if limit > 0 && len(ids) > limit {
+		return ids[:limit]
+	}
+	return ids
+}
+
+// Depths 实现Backend接口
+func (b *MemoryBackend) Depths(queues []string) (Depths, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.state
+
+	depths := Depths{
+		Pending:     make(map[string]int64, len(queues)),
+		Processing:  int64(len(s.Leases)),
+		Retrying:    int64(len(s.Delayed)),
+		Quarantined: int64(len(s.Quarantine)),
+		Dead:        int64(len(s.Archives[ArchiveDead])),
+	}
+	for _, name := range queues {
+		depths.Pending[name] = int64(len(s.Pending[name]))
+	}
+	return depths, nil
+}
+
+// Claim 实现Backend接口
+func (b *MemoryBackend) Claim(key string, window time.Duration) (bool, error) {
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if until, ok := b.state.Claims[key]; ok && until.After(now) {
+		return false, nil
+	}
+	setExpiring(b.state.Claims, key, now.Add(window), now)
+	return true, nil
+}
+
+// claimUntil 登记幂等键直到until，用于重放日志
+func (b *MemoryBackend) claimUntil(key string, until time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	setExpiring(b.state.Claims, key, until, time.Now())
+}
+
+// Unclaim 实现Backend接口
+func (b *MemoryBackend) Unclaim(key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.state.Claims, key)
+	return nil
+}
+
+// MarkProcessed 实现Backend接口
+func (b *MemoryBackend) MarkProcessed(key string, ttl time.Duration) error {
+	b.markProcessedUntil(key, time.Now().Add(ttl))
+	return nil
+}
+
+// markProcessedUntil 记录幂等键已处理直到until
+func (b *MemoryBackend) markProcessedUntil(key string, until time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	setExpiring(b.state.Done, key, until, time.Now())
+}
+
+// Processed 实现Backend接口
+func (b *MemoryBackend) Processed(key string) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	until, ok := b.state.Done[key]
+	return ok && until.After(time.Now()), nil
+}
+
+// setExpiring 设置带过期时间的键
+// 键的数量每翻一倍清理一次过期的键，避免长时间运行后无限增长
+func setExpiring(m map[string]time.Time, key string, until, now time.Time) {
+	m[key] = until
+	if n := len(m); n >= 1024 && n&(n-1) == 0 {
+		for k, t := range m {
+			if !t.After(now) {
+				delete(m, k)
+			}
+		}
+	}
+}
+
+// Save 实现Backend接口
+func (b *MemoryBackend) Save(items ...*QueueItem) error {
+	clones, err := cloneItems(items)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, item := range clones {
+		b.state.Records[item.ID] = item
+	}
+	trimRecords(b.state.Records, b.maxRecords, func(id string) bool {
+		_, inFlight := b.state.Items[id]
+		return inFlight
+	})
+	return nil
+}
+
+// Archive 实现Backend接口
+func (b *MemoryBackend) Archive(kind string, items ...*QueueItem) error {
+	clones, err := cloneItems(items)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	archive := b.state.Archives[kind]
+	if archive == nil {
+		archive = make(map[string]*QueueItem)
+		b.state.Archives[kind] = archive
+	}
+	for _, item := range clones {
+		archive[archiveKey(kind, item)] = item
+	}
+	trimRecords(archive, b.maxArchived, nil)
+	return nil
+}
+
+// trimRecords 记录数量超过上限时删除最早更新的记录，直到只剩上限的九成，避免每次写入都排序
+// keep返回true的记录不会被删除；结果只取决于记录内容，文件后端重放时得到相同的状态
+func trimRecords(m map[string]*QueueItem, limit int, keep func(id string) bool) {
+	if limit <= 0 || len(m) <= limit {
+		return
+	}
+
+	keys := make([]string, 0, len(m))
+	for key, item := range m {
+		if keep == nil || !keep(item.ID) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := m[keys[i]], m[keys[j]]
+		if a.UpdatedAt.Equal(b.UpdatedAt) {
+			return keys[i] < keys[j]
+		}
+		return a.UpdatedAt.Before(b.UpdatedAt)
+	})
+
+	target := limit - limit/10
+	for _, key := range keys {
+		if len(m) <= target {
+			break
+		}
+		delete(m, key)
+	}
+}
+
+// cloneItems 复制一组队列项
+func cloneItems(items []*QueueItem) ([]*QueueItem, error) {
+	clones := make([]*QueueItem, len(items))
+	for i, item := range items {
+		clone, err := cloneItem(item)
+		if err != nil {
+			return nil, err
+		}
+		clones[i] = clone
+	}
+	return clones, nil
+}
+
+// DeadLetters 实现Backend接口
+func (b *MemoryBackend) DeadLetters(query DeadLetterQuery) ([]QueueItem, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var items []QueueItem
+	for _, stored := range b.state.Archives[ArchiveDead] {
+		if !query.match(stored) {
+			continue
+		}
+		item, err := cloneItem(stored)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, *item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].UpdatedAt.Equal(items[j].UpdatedAt) {
+			return items[i].ID < items[j].ID
+		}
+		return items[i].UpdatedAt.After(items[j].UpdatedAt)
+	})
+	if query.Limit > 0 && len(items) > query.Limit {
+		items = items[:query.Limit]
+	}
+	return items, nil
+}
+
+// CountDeadLetters 实现Backend接口
+func (b *MemoryBackend) CountDeadLetters(query DeadLetterQuery) (int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var count int64
+	for _, stored := range b.state.Archives[ArchiveDead] {
+		if query.match(stored) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// UpdateDeadLetter 实现Backend接口
+func (b *MemoryBackend) UpdateDeadLetter(id string, data interface{}) (bool, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return false, err
+	}
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return false, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stored, ok := b.state.Archives[ArchiveDead][id]
+	if !ok {
+		return false, nil
+	}
+	stored.Data = value
+	stored.UpdatedAt = time.Now()
+	return true, nil
+}
+
+// DeleteDeadLetters 实现Backend接口
+func (b *MemoryBackend) DeleteDeadLetters(query DeadLetterQuery) (int64, error) {
+	ids := b.deleteDead(query)
+	return int64(len(ids)), nil
+}
+
+// deleteDead 删除满足条件的死信并返回其ID
+func (b *MemoryBackend) deleteDead(query DeadLetterQuery) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	archive := b.state.Archives[ArchiveDead]
+	var ids []string
+	for id, stored := range archive {
+		if query.match(stored) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		delete(archive, id)
+	}
+	return ids
+}
+
+// unarchive 删除归档中的指定记录
+func (b *MemoryBackend) unarchive(kind string, ids []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, id := range ids {
+		delete(b.state.Archives[kind], id)
+	}
+}
+
+// archived 返回归档中的单条记录
+func (b *MemoryBackend) archived(kind, id string) (*QueueItem, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stored, ok := b.state.Archives[kind][id]
+	if !ok {
+		return nil, false
+	}
+	item, err := cloneItem(stored)
+	return item, err == nil
+}
+
+// SaveMetrics 实现Backend接口，只保留最近的maxMemoryMetrics条
+func (b *MemoryBackend) SaveMetrics(point MetricsPoint) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.metrics = append(b.metrics, point)
+	if len(b.metrics) > maxMemoryMetrics {
+		b.metrics = b.metrics[len(b.metrics)-maxMemoryMetrics:]
+	}
+	return nil
+}
+
+// Metrics 实现Backend接口
+func (b *MemoryBackend) Metrics(since time.Time) ([]MetricsPoint, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	i := sort.Search(len(b.metrics), func(i int) bool { return !b.metrics[i].Time.Before(since) })
+	return append([]MetricsPoint(nil), b.metrics[i:]...), nil
+}
+
+// Record 返回队列项的主记录
+func (b *MemoryBackend) Record(id string) (*QueueItem, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stored, ok := b.state.Records[id]
+	if !ok {
+		return nil, false
+	}
+	item, err := cloneItem(stored)
+	return item, err == nil
+}
+
+// Archived 返回指定类型归档中的全部记录，按ID排序
+func (b *MemoryBackend) Archived(kind string) []QueueItem {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	items := make([]QueueItem, 0, len(b.state.Archives[kind]))
+	for _, stored := range b.state.Archives[kind] {
+		if item, err := cloneItem(stored); err == nil {
+			items = append(items, *item)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+	return items
+}
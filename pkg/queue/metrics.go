@@ -0,0 +1,336 @@
+package queue
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 延迟直方图的桶：第i个桶的上界为 1ms<<i，最后一个桶收集更长的耗时
+const (
+	latencyBucketBase = time.Millisecond
+	latencyBuckets    = 21 // 最后一个有上界的桶约为8.7分钟
+)
+
+// MetricsSnapshot 某一时刻的队列指标，不包含锁，可以直接复制、编码和持久化
+type MetricsSnapshot struct {
+	Time        time.Time                 `json:"time"`
+	Uptime      time.Duration             `json:"uptime"`       // 控制器运行时长
+	Enqueued    int64                     `json:"enqueued"`     // 累计入队数量
+	Dequeued    int64                     `json:"dequeued"`     // 累计被工作协程取出的数量（含重新投递）
+	Processed   int64                     `json:"processed"`    // 累计处理成功数量
+	Failed      int64                     `json:"failed"`       // 累计处理失败次数
+	EnqueueRate float64                   `json:"enqueue_rate"` // 最近一个统计区间的入队速率（每秒）
+	DequeueRate float64                   `json:"dequeue_rate"` // 最近一个统计区间的出队速率（每秒）
+	AverageTime time.Duration             `json:"average_time"` // 全部类型的平均处理时间
+	Depths      Depths                    `json:"depths"`       // 各状态的项数量
+	Latency     map[string]LatencySummary `json:"latency"`      // 数据类型 -> 处理耗时分布
+}
+
+// LatencySummary 处理耗时分布
+// 分位数由直方图估算，误差不超过所在桶的宽度
+type LatencySummary struct {
+	Count   int64         `json:"count"`
+	Average time.Duration `json:"average"`
+	P50     time.Duration `json:"p50"`
+	P95     time.Duration `json:"p95"`
+	P99     time.Duration `json:"p99"`
+	Max     time.Duration `json:"max"`
+}
+
+// MetricsPoint 持久化的指标时间序列中的一个点，记录一个统计区间内的增量
+// 为减小存储，字段名使用缩写，耗时以毫秒为单位
+type MetricsPoint struct {
+	Time        time.Time               `json:"t" bson:"t"`                     // 区间结束时间
+	Seconds     float64                 `json:"s" bson:"s"`                     // 区间长度（秒）
+	Enqueued    int64                   `json:"e,omitempty" bson:"e,omitempty"` // 区间内入队数量
+	Dequeued    int64                   `json:"d,omitempty" bson:"d,omitempty"` // 区间内出队数量
+	Processed   int64                   `json:"p,omitempty" bson:"p,omitempty"` // 区间内成功数量
+	Failed      int64                   `json:"f,omitempty" bson:"f,omitempty"` // 区间内失败次数
+	Pending     map[string]int64        `json:"q,omitempty" bson:"q,omitempty"` // 区间结束时各队列等待处理的数量
+	Processing  int64                   `json:"w,omitempty" bson:"w,omitempty"` // 区间结束时处理中的数量
+	Retrying    int64                   `json:"r,omitempty" bson:"r,omitempty"` // 区间结束时等待重试的数量
+	Quarantined int64                   `json:"i,omitempty" bson:"i,omitempty"` // 区间结束时隔离的数量
+	Dead        int64                   `json:"x,omitempty" bson:"x,omitempty"` // 区间结束时死信数量
+	Latency     map[string]LatencyPoint `json:"l,omitempty" bson:"l,omitempty"` // 数据类型 -> 区间内的处理耗时
+}
+
+// LatencyPoint 一个统计区间内某个数据类型的处理耗时（毫秒）
+type LatencyPoint struct {
+	Count int64 `json:"n" bson:"n"`
+	P50   int64 `json:"50" bson:"50"`
+	P95   int64 `json:"95" bson:"95"`
+	P99   int64 `json:"99" bson:"99"`
+	Max   int64 `json:"m" bson:"m"`
+}
+
+// histogram 处理耗时直方图
+type histogram struct {
+	counts [latencyBuckets + 1]int64
+	count  int64
+	sum    time.Duration
+	max    time.Duration
+}
+
+// observe 记录一次耗时
+func (h *histogram) observe(d time.Duration) {
+	i := 0
+	for i < latencyBuckets && d > latencyBucketBase<<i {
+		i++
+	}
+	h.counts[i]++
+	h.count++
+	h.sum += d
+	if d > h.max {
+		h.max = d
+	}
+}
+
+// quantile 估算分位数，在所在桶内线性插值
+func (h *histogram) quantile(q float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	rank := q * float64(h.count)
+	var seen int64
+	for i, n := range h.counts {
+		if n == 0 || float64(seen+n) < rank {
+			seen += n
+			continue
+		}
+		var lower, upper time.Duration
+		if i > 0 {
+			lower = latencyBucketBase << (i - 1)
+		}
+		if i < latencyBuckets {
+			upper = latencyBucketBase << i
+		}
+		if upper == 0 || upper > h.max {
+			upper = h.max
+		}
+		if lower > upper {
+			lower = upper
+		}
+		frac := (rank - float64(seen)) / float64(n)
+		return lower + time.Duration(frac*float64(upper-lower))
+	}
+	return h.max
+}
+
+// summary 汇总耗时分布
+func (h *histogram) summary() LatencySummary {
+	s := LatencySummary{
+		Count: h.count,
+		P50:   h.quantile(0.50),
+		P95:   h.quantile(0.95),
+		P99:   h.quantile(0.99),
+		Max:   h.max,
+	}
+	if h.count > 0 {
+		s.Average = h.sum / time.Duration(h.count)
+	}
+	return s
+}
+
+// point 转换为持久化的耗时记录
+func (h *histogram) point() LatencyPoint {
+	return LatencyPoint{
+		Count: h.count,
+		P50:   h.quantile(0.50).Milliseconds(),
+		P95:   h.quantile(0.95).Milliseconds(),
+		P99:   h.quantile(0.99).Milliseconds(),
+		Max:   h.max.Milliseconds(),
+	}
+}
+
+// metricsCounters 累计计数
+type metricsCounters struct {
+	enqueued, dequeued, processed, failed int64
+}
+
+// queueMetrics 队列指标的采集状态
+// 累计计数和直方图用于实时快照，interval中的直方图在每次持久化后清空
+type queueMetrics struct {
+	started  time.Time
+	total    metricsCounters
+	last     metricsCounters       // 上次持久化时的累计计数
+	lastTime time.Time             // 上次持久化的时间
+	latency  map[string]*histogram // 数据类型 -> 累计耗时
+	interval map[string]*histogram // 数据类型 -> 本区间耗时
+	mu       sync.Mutex
+}
+
+// newQueueMetrics 创建指标采集状态
+func newQueueMetrics() *queueMetrics {
+	now := time.Now()
+	return &queueMetrics{
+		started:  now,
+		lastTime: now,
+		latency:  make(map[string]*histogram),
+		interval: make(map[string]*histogram),
+	}
+}
+
+// addEnqueued 记录入队
+func (m *queueMetrics) addEnqueued(n int) {
+	m.mu.Lock()
+	m.total.enqueued += int64(n)
+	m.mu.Unlock()
+}
+
+// addDequeued 记录出队
+func (m *queueMetrics) addDequeued(n int) {
+	m.mu.Lock()
+	m.total.dequeued += int64(n)
+	m.mu.Unlock()
+}
+
+// addResults 记录处理成功和失败的数量
+func (m *queueMetrics) addResults(processed, failed int) {
+	m.mu.Lock()
+	m.total.processed += int64(processed)
+	m.total.failed += int64(failed)
+	m.mu.Unlock()
+}
+
+// observe 记录某个数据类型一次处理的耗时
+func (m *queueMetrics) observe(dataType string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, hists := range []map[string]*histogram{m.latency, m.interval} {
+		h, ok := hists[dataType]
+		if !ok {
+			h = &histogram{}
+			hists[dataType] = h
+		}
+		h.observe(d)
+	}
+}
+
+// snapshot 返回当前指标，速率按上次持久化以来的区间计算
+func (m *queueMetrics) snapshot(now time.Time) MetricsSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := MetricsSnapshot{
+		Time:      now,
+		Uptime:    now.Sub(m.started),
+		Enqueued:  m.total.enqueued,
+		Dequeued:  m.total.dequeued,
+		Processed: m.total.processed,
+		Failed:    m.total.failed,
+		Latency:   make(map[string]LatencySummary, len(m.latency)),
+	}
+	if seconds := now.Sub(m.lastTime).Seconds(); seconds > 0 {
+		s.EnqueueRate = float64(m.total.enqueued-m.last.enqueued) / seconds
+		s.DequeueRate = float64(m.total.dequeued-m.last.dequeued) / seconds
+	}
+
+	var count int64
+	var sum time.Duration
+	for dataType, h := range m.latency {
+		s.Latency[dataType] = h.summary()
+		count += h.count
+		sum += h.sum
+	}
+	if count > 0 {
+		s.AverageTime = sum / time.Duration(count)
+	}
+	return s
+}
+
+// flush 返回上次持久化以来的增量，并开始新的统计区间
+func (m *queueMetrics) flush(now time.Time) MetricsPoint {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p := MetricsPoint{
+		Time:      now,
+		Seconds:   now.Sub(m.lastTime).Seconds(),
+		Enqueued:  m.total.enqueued - m.last.enqueued,
+		Dequeued:  m.total.dequeued - m.last.dequeued,
+		Processed: m.total.processed - m.last.processed,
+		Failed:    m.total.failed - m.last.failed,
+	}
+	if len(m.interval) > 0 {
+		p.Latency = make(map[string]LatencyPoint, len(m.interval))
+		for dataType, h := range m.interval {
+			p.Latency[dataType] = h.point()
+		}
+	}
+
+	m.last = m.total
+	m.lastTime = now
+	m.interval = make(map[string]*histogram)
+	return p
+}
+
+// GetMetrics 获取当前队列指标
+func (qc *QueueController) GetMetrics() MetricsSnapshot {
+	snapshot := qc.metrics.snapshot(time.Now())
+	depths, err := qc.backend.Depths(qc.queues.names())
+	if err != nil {
+		log.Printf("统计队列深度失败: %v", err)
+	}
+	snapshot.Depths = depths
+	return snapshot
+}
+
+// startMetricsCollector 启动指标收集器
+func (qc *QueueController) startMetricsCollector() {
+	ticker := time.NewTicker(qc.config.MetricsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-qc.ctx.Done():
+			return
+		case <-ticker.C:
+			qc.collectMetrics()
+		}
+	}
+}
+
+// collectMetrics 记录当前队列指标并持久化
+func (qc *QueueController) collectMetrics() {
+	snapshot := qc.GetMetrics()
+
+	types := make([]string, 0, len(snapshot.Latency))
+	for dataType := range snapshot.Latency {
+		types = append(types, dataType)
+	}
+	sort.Strings(types)
+	for _, dataType := range types {
+		l := snapshot.Latency[dataType]
+		log.Printf("队列耗时 %s: 数量=%d p50=%s p95=%s p99=%s", dataType, l.Count, l.P50, l.P95, l.P99)
+	}
+	log.Printf("队列指标: 入队=%d(%.1f/s) 出队=%d(%.1f/s) 成功=%d 失败=%d 平均耗时=%s 待处理=%v 处理中=%d 重试=%d 隔离=%d 死信=%d",
+		snapshot.Enqueued, snapshot.EnqueueRate, snapshot.Dequeued, snapshot.DequeueRate,
+		snapshot.Processed, snapshot.Failed, snapshot.AverageTime, snapshot.Depths.Pending,
+		snapshot.Depths.Processing, snapshot.Depths.Retrying, snapshot.Depths.Quarantined, snapshot.Depths.Dead)
+
+	if err := qc.persistMetrics(); err != nil {
+		log.Printf("保存队列指标失败: %v", err)
+	}
+}
+
+// persistMetrics 保存上次保存以来的指标增量和当前各状态的数量
+func (qc *QueueController) persistMetrics() error {
+	point := qc.metrics.flush(time.Now())
+	depths, err := qc.backend.Depths(qc.queues.names())
+	if err != nil {
+		log.Printf("统计队列深度失败: %v", err)
+	}
+	point.Pending = depths.Pending
+	point.Processing = depths.Processing
+	point.Retrying = depths.Retrying
+	point.Quarantined = depths.Quarantined
+	point.Dead = depths.Dead
+	return qc.backend.SaveMetrics(point)
+}
+
+// MetricsHistory 返回since之后保存的指标时间序列，按时间先后排列
+func (qc *QueueController) MetricsHistory(since time.Time) ([]MetricsPoint, error) {
+	return qc.backend.Metrics(since)
+}
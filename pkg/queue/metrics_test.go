@@ -0,0 +1,116 @@
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+// 测试直方图分位数估算在所在桶的范围内
+func TestHistogramQuantiles(t *testing.T) {
+	var h histogram
+	for i := 1; i <= 100; i++ {
+		h.observe(time.Duration(i) * time.Millisecond)
+	}
+
+	tests := []struct {
+		q        float64
+		min, max time.Duration
+	}{
+		{0.50, 32 * time.Millisecond, 64 * time.Millisecond},
+		{0.95, 64 * time.Millisecond, 100 * time.Millisecond},
+		{0.99, 64 * time.Millisecond, 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := h.quantile(tt.q); got < tt.min || got > tt.max {
+			t.Errorf("quantile(%v) = %s，期望在 [%s, %s] 内", tt.q, got, tt.min, tt.max)
+		}
+	}
+
+	s := h.summary()
+	if s.Count != 100 || s.Max != 100*time.Millisecond || s.Average != 50500*time.Microsecond {
+		t.Errorf("summary() = %+v", s)
+	}
+	if empty := (&histogram{}).summary(); empty.P99 != 0 || empty.Average != 0 {
+		t.Errorf("空直方图 summary() = %+v", empty)
+	}
+}
+
+// 测试平均耗时、速率和区间增量
+func TestQueueMetricsSnapshotAndFlush(t *testing.T) {
+	m := newQueueMetrics()
+	start := m.lastTime
+
+	m.addEnqueued(10)
+	m.addDequeued(4)
+	m.addResults(3, 1)
+	m.observe("product", 10*time.Millisecond)
+	m.observe("product", 20*time.Millisecond)
+	m.observe("review", 30*time.Millisecond)
+
+	s := m.snapshot(start.Add(2 * time.Second))
+	if s.AverageTime != 20*time.Millisecond {
+		t.Errorf("AverageTime = %s，期望 20ms", s.AverageTime)
+	}
+	if s.EnqueueRate != 5 || s.DequeueRate != 2 {
+		t.Errorf("速率 = %v/%v，期望 5/2", s.EnqueueRate, s.DequeueRate)
+	}
+	if s.Latency["product"].Count != 2 || s.Latency["review"].Count != 1 {
+		t.Errorf("Latency = %+v", s.Latency)
+	}
+
+	p := m.flush(start.Add(2 * time.Second))
+	if p.Enqueued != 10 || p.Processed != 3 || p.Failed != 1 || p.Latency["product"].Count != 2 {
+		t.Errorf("flush() = %+v", p)
+	}
+
+	// 新区间只包含之后的增量，累计值不受影响
+	m.addEnqueued(1)
+	p = m.flush(start.Add(3 * time.Second))
+	if p.Enqueued != 1 || p.Seconds != 1 || p.Latency != nil {
+		t.Errorf("第二次 flush() = %+v", p)
+	}
+	if s := m.snapshot(start.Add(3 * time.Second)); s.Enqueued != 11 || s.Latency["product"].Count != 2 {
+		t.Errorf("累计值 = %+v", s)
+	}
+}
+
+// 测试控制器的指标快照和持久化的时间序列
+func TestQueueControllerMetrics(t *testing.T) {
+	for _, tb := range testBackends {
+		t.Run(tb.name, func(t *testing.T) {
+			qc, err := NewQueueControllerWithBackend(tb.open(t), testConfig())
+			if err != nil {
+				t.Fatalf("NewQueueControllerWithBackend() error = %v", err)
+			}
+			defer qc.Close()
+			RegisterHandlerFunc(qc, "product", func(p testProduct, item *QueueItem) error { return nil })
+
+			since := time.Now()
+			for _, url := range []string{"a", "b", "c"} {
+				if err := Push(qc, "product", 1, testProduct{URL: url}); err != nil {
+					t.Fatalf("Push() error = %v", err)
+				}
+			}
+			waitFor(t, "处理完成", func() bool { return qc.GetMetrics().Processed == 3 })
+
+			s := qc.GetMetrics()
+			if s.Enqueued != 3 || s.Dequeued != 3 || s.Latency["product"].Count != 3 {
+				t.Errorf("GetMetrics() = %+v", s)
+			}
+			if _, ok := s.Depths.Pending[DefaultQueue]; !ok {
+				t.Errorf("Depths = %+v，缺少默认队列", s.Depths)
+			}
+
+			if err := qc.persistMetrics(); err != nil {
+				t.Fatalf("persistMetrics() error = %v", err)
+			}
+			points, err := qc.MetricsHistory(since)
+			if err != nil || len(points) != 1 {
+				t.Fatalf("MetricsHistory() = %+v, %v", points, err)
+			}
+			if points[0].Processed != 3 || points[0].Latency["product"].Count != 3 {
+				t.Errorf("保存的指标 = %+v", points[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package queue
+
+import (
+	"log"
+	"time"
+)
+
+// handleUnknownType 处理类型没有注册处理器的项
+// 这类项不重试、也不转入死信，而是保留在隔离队列中，注册处理器后通过ReleaseQuarantined放回队列
+func (qc *QueueController) handleUnknownType(item *QueueItem, err error) {
+	item.Status = StatusQuarantined
+	item.Error = err.Error()
+	item.UpdatedAt = time.Now()
+
+	ok, err := qc.backend.Quarantine(item)
+	if err != nil {
+		log.Printf("隔离队列项 %s 失败: %v", item.ID, err)
+		return
+	}
+	if !ok {
+		log.Printf("队列项 %s 的租约已过期，已被重新投递", item.ID)
+		return
+	}
+
+	log.Printf("队列项 %s 的类型 %q 没有处理器，已转入隔离队列", item.ID, item.Type)
+	if err := qc.persistItem(item); err != nil {
+		log.Printf("更新队列项 %s 状态失败: %v", item.ID, err)
+	}
+}
+
+// ListQuarantined 列出隔离队列中的项，最近隔离的在前
+// 参数:
+//   - limit: 返回数量上限，0表示不限制
+func (qc *QueueController) ListQuarantined(limit int) ([]QueueItem, error) {
+	return qc.backend.Quarantined(limit)
+}
+
+// ReleaseQuarantined 把隔离队列中指定类型的项放回队列，通常在注册了对应处理器之后调用
+// 参数:
+//   - dataType: 只释放该类型的项，为空时释放全部
+//
+// 返回:
+//   - int: 放回队列的数量
+func (qc *QueueController) ReleaseQuarantined(dataType string) (int, error) {
+	items, err := qc.ListQuarantined(0)
+	if err != nil {
+		return 0, err
+	}
+
+	released := 0
+	for i := range items {
+		item := &items[i]
+		if dataType != "" && item.Type != dataType {
+			continue
+		}
+
+		ok, err := qc.backend.Release(item.ID)
+		if err != nil {
+			return released, err
+		}
+		if !ok {
+			continue
+		}
+		released++
+
+		item.Status = StatusPending
+		item.Error = ""
+		item.Worker = ""
+		item.UpdatedAt = time.Now()
+		if err := qc.persistItem(item); err != nil {
+			log.Printf("更新队列项 %s 状态失败: %v", item.ID, err)
+		}
+	}
+	return released, nil
+}
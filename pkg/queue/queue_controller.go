@@ -2,7 +2,7 @@ package queue
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"sync"
@@ -12,16 +12,19 @@ import (
 	"japan_spider/pkg/redis"
 
 	"github.com/google/uuid"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // QueueItem 队列项结构
 type QueueItem struct {
-	ID        string      `json:"id" bson:"_id"`          // 唯一标识
-	Data      interface{} `json:"data" bson:"data"`       // 数据内容
-	Status    string      `json:"status" bson:"status"`   // 处理状态：pending/processing/completed/failed
-	Retries   int         `json:"retries" bson:"retries"` // 重试次数
+	ID        string      `json:"id" bson:"_id"`                              // 唯一标识
+	Type      string      `json:"type,omitempty" bson:"type,omitempty"`       // 数据类型，决定由哪个处理器处理
+	Version   int         `json:"version,omitempty" bson:"version,omitempty"` // 数据结构版本
+	Queue     string      `json:"queue,omitempty" bson:"queue,omitempty"`     // 所属队列
+	Key       string      `json:"key,omitempty" bson:"key,omitempty"`         // 幂等键，相同键的项只处理一次
+	Data      interface{} `json:"data" bson:"data"`                           // 数据内容
+	Status    string      `json:"status" bson:"status"`                       // 处理状态：pending/processing/retrying/completed/dead
+	Retries   int         `json:"retries" bson:"retries"`                     // 重试次数
+	Worker    string      `json:"worker,omitempty" bson:"worker,omitempty"`   // 正在处理该项的工作协程
 	CreatedAt time.Time   `json:"created_at" bson:"created_at"`
 	UpdatedAt time.Time   `json:"updated_at" bson:"updated_at"`
 	Error     string      `json:"error,omitempty" bson:"error,omitempty"` // 错误信息
@@ -29,15 +32,26 @@ type QueueItem struct {
 
 // QueueController 队列控制器
 type QueueController struct {
-	redisClient *redis.RedisClient   // Redis客户端，用于临时存储和缓冲
-	mongoClient *mongodb.MongoClient // MongoDB客户端，用于持久化存储
-	config      Config               // 队列配置
-	handlers    map[string]Handler   // 数据处理器映射
-	mu          sync.RWMutex         // 读写锁
-	workerCount int                  // 工作协程数量
-	ctx         context.Context      // 上下文
-	cancel      context.CancelFunc   // 取消函数
-	metrics     *QueueMetrics        // 队列监控指标
+	backend     Backend                 // 队列存储后端
+	config      Config                  // 队列配置
+	handlers    map[string]Handler      // 数据处理器映射
+	batches     map[string]BatchHandler // 批量数据处理器映射
+	queues      *queueSet               // 命名队列配置
+	paused      map[string]bool         // 本进程暂停消费的队列
+	pausedAll   bool                    // 本进程是否暂停消费全部队列
+	mu          sync.RWMutex            // 读写锁
+	workerCount int                     // 工作协程数量
+	consumerID  string                  // 本进程的消费者标识
+	started     bool                    // 是否启动了工作协程和后台任务
+	drainCh     chan struct{}           // 关闭后不再接受新数据，工作协程处理完手头的项后退出
+	drainOnce   sync.Once               // 保证drainCh只关闭一次
+	workers     sync.WaitGroup          // 工作协程
+	background  sync.WaitGroup          // 回收、调度和监控等后台任务
+	inFlight    map[string]string       // 正在处理的队列项ID -> 工作协程
+	inFlightMu  sync.Mutex              // 保护inFlight
+	ctx         context.Context         // 上下文
+	cancel      context.CancelFunc      // 取消函数
+	metrics     *queueMetrics           // 队列监控指标
 }
 
 // Handler 数据处理器接口
@@ -45,55 +59,123 @@ type Handler interface {
 	Process(item *QueueItem) error
 }
 
-// QueueMetrics 队列监控指标
-type QueueMetrics struct {
-	TotalItems     int64         // 总项目数
-	ProcessedItems int64         // 已处理项目数
-	FailedItems    int64         // 失败项目数
-	AverageTime    time.Duration // 平均处理时间
-	mu             sync.Mutex    // 指标更新锁
+// NewQueueController 创建使用Redis和MongoDB的队列控制器
+// 队列提供至少一次投递：工作协程取出的项在确认前保存在各自的processing列表中，
+// 超过VisibilityTimeout仍未确认（例如进程崩溃）的项由回收器重新入队
+func NewQueueController(redisClient *redis.RedisClient, mongoClient *mongodb.MongoClient, config Config) (*QueueController, error) {
+	return NewQueueControllerWithBackend(NewRedisBackend(redisClient, mongoClient, config), config)
 }
 
-// NewQueueController 创建新的队列控制器
-func NewQueueController(redisClient *redis.RedisClient, mongoClient *mongodb.MongoClient, config Config) *QueueController {
-	ctx, cancel := context.WithCancel(context.Background())
+// NewQueueControllerWithBackend 创建使用指定存储后端的队列控制器
+// 参数:
+//   - backend: 存储后端，例如NewRedisBackend、NewMemoryBackend或NewFileBackend，由调用方关闭
+//   - config: 队列配置，后端相关的RedisKeyPrefix等配置项由后端自己使用
+func NewQueueControllerWithBackend(backend Backend, config Config) (*QueueController, error) {
+	qc, err := OpenQueueControllerWithBackend(backend, config)
+	if err != nil {
+		return nil, err
+	}
+	qc.started = true
 
-	qc := &QueueController{
-		redisClient: redisClient,
-		mongoClient: mongoClient,
+	// 启动工作协程
+	qc.startWorkers()
+	// 启动超时项回收和延迟重试调度
+	qc.goBackground(qc.startReaper)
+	qc.goBackground(qc.startScheduler)
+	// 启动监控
+	qc.goBackground(qc.startMetricsCollector)
+
+	return qc, nil
+}
+
+// OpenQueueController 创建只用于管理的队列控制器
+// 不启动工作协程和后台任务，用于查看队列、编辑和重放死信等运维操作
+func OpenQueueController(redisClient *redis.RedisClient, mongoClient *mongodb.MongoClient, config Config) (*QueueController, error) {
+	return OpenQueueControllerWithBackend(NewRedisBackend(redisClient, mongoClient, config), config)
+}
+
+// OpenQueueControllerWithBackend 创建使用指定存储后端、只用于管理的队列控制器
+func OpenQueueControllerWithBackend(backend Backend, config Config) (*QueueController, error) {
+	config = config.withDefaults()
+	queues, err := newQueueSet(config.Queues, config.Scheduling)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &QueueController{
+		backend:     backend,
 		config:      config,
 		handlers:    make(map[string]Handler),
+		batches:     make(map[string]BatchHandler),
+		queues:      queues,
+		paused:      make(map[string]bool),
+		drainCh:     make(chan struct{}),
+		inFlight:    make(map[string]string),
 		workerCount: config.WorkerCount,
+		consumerID:  newConsumerID(),
 		ctx:         ctx,
 		cancel:      cancel,
-		metrics:     &QueueMetrics{},
+		metrics:     newQueueMetrics(),
+	}, nil
+}
+
+// Push 将数据推入队列
+// data为包含"type"字段的map时按该字段选择处理器，其他数据请使用类型化的Push[T]或PushEnvelope
+func (qc *QueueController) Push(data interface{}) error {
+	return qc.push("", legacyType(data), 0, data)
+}
+
+// push 创建队列项并入队
+// key不为空时先登记幂等键，DedupWindow内已登记过的返回ErrDuplicate
+func (qc *QueueController) push(key, dataType string, version int, data interface{}) error {
+	if qc.isDraining() {
+		return ErrDraining
 	}
 
-	// 启动工作协程
-	qc.startWorkers()
-	// 启动监控
-	go qc.startMetricsCollector()
+	if key != "" {
+		claimed, err := qc.backend.Claim(key, qc.config.DedupWindow)
+		if err != nil {
+			return fmt.Errorf("登记幂等键失败: %w", err)
+		}
+		if !claimed {
+			return fmt.Errorf("%w: %s", ErrDuplicate, key)
+		}
+	}
 
-	return qc
+	if err := qc.insert(key, dataType, version, data); err != nil {
+		if key != "" {
+			if err := qc.backend.Unclaim(key); err != nil {
+				log.Printf("删除幂等键 %s 失败: %v", key, err)
+			}
+		}
+		return err
+	}
+	return nil
 }
 
-// Push 将数据推入队列
-func (qc *QueueController) Push(data interface{}) error {
+// insert 保存队列项并放入所属队列
+func (qc *QueueController) insert(key, dataType string, version int, data interface{}) error {
 	item := &QueueItem{
 		ID:        generateID(), // 生成唯一ID
+		Type:      dataType,
+		Version:   version,
+		Key:       key,
 		Data:      data,
-		Status:    "pending",
+		Status:    StatusPending,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
 
-	// 保存到Redis缓冲区
-	if err := qc.saveToRedis(item); err != nil {
-		return fmt.Errorf("保存到Redis失败: %w", err)
+	// 先保存主记录，保证之后的状态更新不会被入队记录覆盖
+	if err := qc.persistItem(item); err != nil {
+		return fmt.Errorf("保存队列项失败: %w", err)
 	}
 
-	// 异步持久化到MongoDB
-	go qc.persistToMongo(item)
+	// 放入队列
+	if err := qc.enqueue(item); err != nil {
+		return fmt.Errorf("队列项入队失败: %w", err)
+	}
 
 	return nil
 }
@@ -106,51 +188,90 @@ func (qc *QueueController) RegisterHandler(dataType string, handler Handler) {
 }
 
 // startWorkers 启动工作协程
+// WorkerCount个共享工作协程按调度方式处理所有队列，另外每个队列启动Workers个专属工作协程
 func (qc *QueueController) startWorkers() {
+	start := func(name string, queues func() []string) {
+		qc.workers.Add(1)
+		go func() {
+			defer qc.workers.Done()
+			qc.worker(name, queues)
+		}()
+	}
+
 	for i := 0; i < qc.workerCount; i++ {
-		go qc.worker()
+		start(fmt.Sprintf("%s-%d", qc.consumerID, i), qc.queues.order)
+	}
+	for _, spec := range qc.queues.specs {
+		queues := []string{spec.Name}
+		for i := 0; i < spec.Workers; i++ {
+			start(fmt.Sprintf("%s-%s-%d", qc.consumerID, spec.Name, i), func() []string { return queues })
+		}
 	}
 }
 
 // worker 工作协程
-func (qc *QueueController) worker() {
+// 参数:
+//   - name: 工作协程名称，决定其processing列表
+//   - queues: 返回本次依次尝试的队列
+//
+// 进入排空模式后，工作协程处理完手头的项即退出
+func (qc *QueueController) worker(name string, queues func() []string) {
 	for {
-		select {
-		case <-qc.ctx.Done():
+		if qc.isDraining() {
 			return
-		default:
-			// 从Redis获取待处理项
-			item, err := qc.getNextItem()
-			if err != nil {
-				time.Sleep(time.Second)
-				continue
-			}
+		}
 
-			// 处理数据
-			start := time.Now()
-			if err := qc.processItem(item); err != nil {
-				qc.handleFailure(item, err)
-			} else {
-				qc.handleSuccess(item)
+		// 获取待处理项，启用批处理时一次获取一批
+		items, err := qc.nextBatch(name, qc.activeQueues(queues()))
+		if err != nil {
+			if err != errEmpty {
+				log.Printf("获取队列项失败: %v", err)
+			}
+			select {
+			case <-qc.drainCh:
+				return
+			case <-time.After(qc.config.PollInterval):
 			}
-			qc.updateMetrics(time.Since(start))
+			continue
 		}
+
+		// 处理数据
+		qc.track(name, items)
+		qc.processItems(items)
+		qc.untrack(items)
+	}
+}
+
+// processOne 逐项处理单个队列项
+func (qc *QueueController) processOne(item *QueueItem) {
+	start := time.Now()
+	if err := qc.processItem(item); errors.Is(err, ErrUnknownType) {
+		qc.handleUnknownType(item, err)
+	} else if err != nil {
+		qc.handleFailure(item, err)
+	} else {
+		qc.handleSuccess(item)
 	}
+	qc.metrics.observe(itemType(item), time.Since(start))
 }
 
 // processItem 处理队列项
 func (qc *QueueController) processItem(item *QueueItem) error {
-	// 更新状态为处理中
-	item.Status = "processing"
-	item.UpdatedAt = time.Now()
+	// 记录处理中状态
 	if err := qc.updateItem(item); err != nil {
 		return err
 	}
 
+	// 相同幂等键的项已处理过，直接按成功处理
+	if qc.isProcessed(item) {
+		log.Printf("队列项 %s 的幂等键 %s 已处理过，跳过", item.ID, item.Key)
+		return nil
+	}
+
 	// 获取对应的处理器
 	handler, ok := qc.getHandler(item)
 	if !ok {
-		return fmt.Errorf("未找到处理器")
+		return fmt.Errorf("%w: %q", ErrUnknownType, item.Type)
 	}
 
 	// 处理数据
@@ -158,144 +279,110 @@ func (qc *QueueController) processItem(item *QueueItem) error {
 }
 
 // handleFailure 处理失败情况
+// 未达到最大重试次数的项保留ID和重试次数，按指数退避延迟重试；重试耗尽的项转入死信集合
 func (qc *QueueController) handleFailure(item *QueueItem, err error) {
-	item.Status = "failed"
 	item.Error = err.Error()
 	item.Retries++
 	item.UpdatedAt = time.Now()
 
 	// 检查是否需要重试
 	if item.Retries < qc.config.MaxRetries {
-		// 重新入队，等待重试
-		item.Status = "pending"
-		qc.Push(item.Data)
+		item.Status = StatusRetrying
+		if err := qc.scheduleRetry(item, qc.config.retryDelay(item.Retries)); err != nil {
+			log.Printf("队列项 %s 安排重试失败: %v", item.ID, err)
+			return
+		}
+		if err := qc.persistItem(item); err != nil {
+			log.Printf("更新队列项 %s 状态失败: %v", item.ID, err)
+		}
 	} else {
-		// 持久化失败记录
-		qc.persistFailure(item)
+		// 先写入死信集合再确认，确认前崩溃的项会被重新投递
+		item.Status = StatusDead
+		if err := qc.persistDead(item); err != nil {
+			log.Printf("保存死信 %s 失败: %v", item.ID, err)
+			return
+		}
+		qc.acknowledge(item)
 	}
 
-	qc.metrics.mu.Lock()
-	qc.metrics.FailedItems++
-	qc.metrics.mu.Unlock()
+	qc.metrics.addResults(0, 1)
 }
 
 // handleSuccess 处理成功情况
 func (qc *QueueController) handleSuccess(item *QueueItem) {
-	item.Status = "completed"
+	item.Status = StatusCompleted
 	item.UpdatedAt = time.Now()
 
-	// 持久化成功记录
-	qc.persistSuccess(item)
-
-	qc.metrics.mu.Lock()
-	qc.metrics.ProcessedItems++
-	qc.metrics.mu.Unlock()
-}
-
-// startMetricsCollector 启动指标收集器
-func (qc *QueueController) startMetricsCollector() {
-	ticker := time.NewTicker(qc.config.MetricsInterval)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-qc.ctx.Done():
-			return
-		case <-ticker.C:
-			qc.collectMetrics()
-		}
+	// 持久化成功记录后再确认，确认前崩溃的项会被重新投递
+	if err := qc.persistSuccess(item); err != nil {
+		log.Printf("保存成功记录 %s 失败: %v", item.ID, err)
+		return
 	}
-}
+	qc.markProcessed(item)
+	qc.acknowledge(item)
 
-// GetMetrics 获取当前队列指标
-func (qc *QueueController) GetMetrics() *QueueMetrics {
-	qc.metrics.mu.Lock()
-	defer qc.metrics.mu.Unlock()
-	return qc.metrics
+	qc.metrics.addResults(1, 0)
 }
 
 // Close 关闭队列控制器
+// 排空队列后关闭，最多等待DrainTimeout，未处理完的项会在可见性超时后被重新投递
 func (qc *QueueController) Close() {
-	qc.cancel()
-	// 等待所有工作协程完成
-	time.Sleep(time.Second)
-	// 保存最终指标
-	qc.persistMetrics()
+	if !qc.started {
+		qc.Drain()
+		qc.cancel()
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), qc.config.DrainTimeout)
+	defer cancel()
+	report, err := qc.Shutdown(ctx)
+	if err != nil {
+		log.Printf("队列关闭超时: %v", err)
+	}
+	log.Printf("队列已关闭: %s", report)
 }
 
 func generateID() string {
 	return uuid.New().String()
 }
 
-// saveToRedis 保存队列项到Redis
-func (qc *QueueController) saveToRedis(item *QueueItem) error {
-	key := qc.config.RedisKeyPrefix + "pending"
-	data, err := json.Marshal(item)
-	if err != nil {
-		return err
-	}
-	return qc.redisClient.RPush(key, string(data))
+// persistItem 更新队列项的主记录
+func (qc *QueueController) persistItem(item *QueueItem) error {
+	return qc.backend.Save(item)
 }
 
-// persistToMongo 持久化队列项到MongoDB
-func (qc *QueueController) persistToMongo(item *QueueItem) error {
-	collection := qc.mongoClient.Client().Database(qc.config.MongoDatabase).Collection(qc.config.MongoCollection)
-	_, err := collection.UpdateOne(
-		qc.mongoClient.Context(),
-		bson.M{"_id": item.ID},
-		bson.M{"$set": item},
-		options.Update().SetUpsert(true),
-	)
-	return err
+// getNextItem 依次从各队列获取下一个待处理项
+// 取出的项在确认前保留在工作协程的processing列表中
+func (qc *QueueController) getNextItem(worker string, queues []string) (*QueueItem, error) {
+	for _, queue := range queues {
+		items, err := qc.take(worker, queue, 1)
+		if err == errEmpty {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return items[0], nil
+	}
+	return nil, errEmpty
 }
 
-// getNextItem 从Redis获取下一个待处理项
-func (qc *QueueController) getNextItem() (*QueueItem, error) {
-	key := qc.config.RedisKeyPrefix + "pending"
-	data, err := qc.redisClient.LPop(key)
+// acknowledge 确认队列项处理完毕
+func (qc *QueueController) acknowledge(item *QueueItem) {
+	acked, err := qc.ack(item.Worker, item.ID)
 	if err != nil {
-		return nil, err
-	}
-
-	var item QueueItem
-	if err := json.Unmarshal([]byte(data), &item); err != nil {
-		return nil, err
+		log.Printf("确认队列项 %s 失败: %v", item.ID, err)
+		return
 	}
-
-	return &item, nil
-}
-
-// updateMetrics 更新队列指标
-func (qc *QueueController) updateMetrics(duration time.Duration) {
-	qc.metrics.mu.Lock()
-	defer qc.metrics.mu.Unlock()
-
-	qc.metrics.TotalItems++
-	// 更新平均处理时间
-	if qc.metrics.ProcessedItems > 0 {
-		qc.metrics.AverageTime = time.Duration(
-			(qc.metrics.AverageTime.Nanoseconds()*int64(qc.metrics.ProcessedItems-1) +
-				duration.Nanoseconds()) / int64(qc.metrics.ProcessedItems))
-	} else {
-		qc.metrics.AverageTime = duration
+	if acked == 0 {
+		log.Printf("队列项 %s 的租约已过期，已被重新投递", item.ID)
 	}
 }
 
 // updateItem 更新队列项状态
+// 投递状态由后端在入队、取出、确认和回收时原子维护，这里只更新主记录
 func (qc *QueueController) updateItem(item *QueueItem) error {
-	// 更新Redis中的状态
-	key := qc.config.RedisKeyPrefix + item.Status
-	data, err := json.Marshal(item)
-	if err != nil {
-		return err
-	}
-	if err := qc.redisClient.RPush(key, string(data)); err != nil {
-		return err
-	}
-
-	// 异步更新MongoDB
-	go qc.persistToMongo(item)
-	return nil
+	return qc.persistItem(item)
 }
 
 // getHandler 获取数据类型对应的处理器
@@ -303,50 +390,23 @@ func (qc *QueueController) getHandler(item *QueueItem) (Handler, bool) {
 	qc.mu.RLock()
 	defer qc.mu.RUnlock()
 
-	// 根据数据类型获取对应的处理器
-	if data, ok := item.Data.(map[string]interface{}); ok {
-		if dataType, ok := data["type"].(string); ok {
-			handler, exists := qc.handlers[dataType]
-			return handler, exists
-		}
-	}
-	return nil, false
+	// 根据数据类型获取对应的处理器，兼容旧格式数据中的type字段
+	handler, exists := qc.handlers[itemType(item)]
+	return handler, exists
 }
 
-// persistFailure 持久化失败记录
-func (qc *QueueController) persistFailure(item *QueueItem) error {
-	collection := qc.mongoClient.Client().Database(qc.config.MongoDatabase).Collection(qc.config.MongoCollection + "_failed")
-	_, err := collection.InsertOne(qc.mongoClient.Context(), item)
-	return err
+// persistDead 持久化死信记录
+func (qc *QueueController) persistDead(item *QueueItem) error {
+	if err := qc.persistItem(item); err != nil {
+		return err
+	}
+	return qc.backend.Archive(ArchiveDead, item)
 }
 
 // persistSuccess 持久化成功记录
 func (qc *QueueController) persistSuccess(item *QueueItem) error {
-	collection := qc.mongoClient.Client().Database(qc.config.MongoDatabase).Collection(qc.config.MongoCollection + "_completed")
-	_, err := collection.InsertOne(qc.mongoClient.Context(), item)
-	return err
-}
-
-// collectMetrics 收集当前队列指标
-func (qc *QueueController) collectMetrics() {
-	logStats := struct {
-		TotalItems     int64
-		ProcessedItems int64
-		FailedItems    int64
-		AverageTime    time.Duration
-	}{
-		TotalItems:     qc.metrics.TotalItems,
-		ProcessedItems: qc.metrics.ProcessedItems,
-		FailedItems:    qc.metrics.FailedItems,
-		AverageTime:    qc.metrics.AverageTime,
+	if err := qc.persistItem(item); err != nil {
+		return err
 	}
-	log.Printf("Queue Stats: %+v", logStats)
-	qc.persistMetrics()
-}
-
-// persistMetrics 持久化队列指标到MongoDB
-func (qc *QueueController) persistMetrics() error {
-	collection := qc.mongoClient.Client().Database(qc.config.MongoDatabase).Collection(qc.config.MongoCollection + "_metrics")
-	_, err := collection.InsertOne(qc.mongoClient.Context(), qc.metrics)
-	return err
+	return qc.backend.Archive(ArchiveCompleted, item)
 }
@@ -0,0 +1,210 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultQueue 默认队列名，没有匹配任何队列的类型进入该队列
+const DefaultQueue = "default"
+
+// ErrUnknownQueue 队列没有配置
+var ErrUnknownQueue = errors.New("队列不存在")
+
+// 跨队列调度方式
+const (
+	SchedulingStrict   = "strict"   // 严格优先级：总是先处理优先级最高且非空的队列
+	SchedulingWeighted = "weighted" // 加权公平：按权重轮流处理各队列，低优先级队列不会被饿死
+)
+
+// QueueSpec 命名队列配置
+type QueueSpec struct {
+	Name     string   // 队列名
+	Priority int      // 优先级，数值越大越优先（严格优先级调度时使用）
+	Weight   int      // 权重（加权公平调度时使用），默认1
+	Workers  int      // 专属工作协程数量，只处理该队列
+	Types    []string // 进入该队列的数据类型
+}
+
+// queueSet 队列配置和跨队列调度状态
+type queueSet struct {
+	specs      []QueueSpec       // 按优先级从高到低排列
+	byName     map[string]int    // 队列名 -> specs下标
+	byType     map[string]string // 数据类型 -> 队列名
+	scheduling string            // 调度方式
+	current    []int             // 平滑加权轮询的当前权重
+	mu         sync.Mutex        // 保护current
+}
+
+// newQueueSet 校验队列配置，并补上默认队列
+func newQueueSet(specs []QueueSpec, scheduling string) (*queueSet, error) {
+	switch scheduling {
+	case "":
+		scheduling = SchedulingStrict
+	case SchedulingStrict, SchedulingWeighted:
+	default:
+		return nil, fmt.Errorf("不支持的调度方式: %s", scheduling)
+	}
+
+	qs := &queueSet{
+		byName:     make(map[string]int),
+		byType:     make(map[string]string),
+		scheduling: scheduling,
+	}
+
+	hasDefault := false
+	for _, spec := range specs {
+		if spec.Name == "" || strings.ContainsAny(spec.Name, ": ") {
+			return nil, fmt.Errorf("队列名 %q 无效", spec.Name)
+		}
+		if spec.Name == DefaultQueue {
+			hasDefault = true
+		}
+		qs.specs = append(qs.specs, spec)
+	}
+	if !hasDefault {
+		qs.specs = append(qs.specs, QueueSpec{Name: DefaultQueue})
+	}
+
+	sort.SliceStable(qs.specs, func(i, j int) bool { return qs.specs[i].Priority > qs.specs[j].Priority })
+	for i := range qs.specs {
+		spec := &qs.specs[i]
+		if spec.Weight <= 0 {
+			spec.Weight = 1
+		}
+		if _, exists := qs.byName[spec.Name]; exists {
+			return nil, fmt.Errorf("队列 %s 重复配置", spec.Name)
+		}
+		qs.byName[spec.Name] = i
+		for _, dataType := range spec.Types {
+			if other, exists := qs.byType[dataType]; exists {
+				return nil, fmt.Errorf("类型 %s 同时配置在队列 %s 和 %s 中", dataType, other, spec.Name)
+			}
+			qs.byType[dataType] = spec.Name
+		}
+	}
+	qs.current = make([]int, len(qs.specs))
+	return qs, nil
+}
+
+// route 返回数据类型所属的队列
+func (qs *queueSet) route(dataType string) string {
+	if name, ok := qs.byType[dataType]; ok {
+		return name
+	}
+	return DefaultQueue
+}
+
+// has 判断队列是否存在
+func (qs *queueSet) has(name string) bool {
+	_, ok := qs.byName[name]
+	return ok
+}
+
+// names 按优先级从高到低返回所有队列名
+func (qs *queueSet) names() []string {
+	names := make([]string, len(qs.specs))
+	for i, spec := range qs.specs {
+		names[i] = spec.Name
+	}
+	return names
+}
+
+// order 返回共享工作协程本次尝试各队列的顺序
+// 严格优先级按优先级排列；加权公平用平滑加权轮询选出第一个队列，其余按优先级排列作为后备，
+// 这样被选中的队列为空时工作协程也不会空闲
+func (qs *queueSet) order() []string {
+	names := qs.names()
+	if qs.scheduling != SchedulingWeighted || len(names) == 1 {
+		return names
+	}
+
+	qs.mu.Lock()
+	total, best := 0, 0
+	for i, spec := range qs.specs {
+		qs.current[i] += spec.Weight
+		total += spec.Weight
+		if qs.current[i] > qs.current[best] {
+			best = i
+		}
+	}
+	qs.current[best] -= total
+	qs.mu.Unlock()
+
+	ordered := make([]string, 0, len(names))
+	ordered = append(ordered, names[best])
+	for i, name := range names {
+		if i != best {
+			ordered = append(ordered, name)
+		}
+	}
+	return ordered
+}
+
+// Queues 返回队列配置，按优先级从高到低排列
+func (qc *QueueController) Queues() []QueueSpec {
+	specs := make([]QueueSpec, len(qc.queues.specs))
+	copy(specs, qc.queues.specs)
+	return specs
+}
+
+// Pause 暂停本进程对队列的消费，name为空时暂停全部队列
+// 暂停不影响入队，也不影响其他进程的消费；工作协程处理完手头的项后不再从暂停的队列取新项
+func (qc *QueueController) Pause(name string) error {
+	if name != "" && !qc.queues.has(name) {
+		return fmt.Errorf("%w: %s", ErrUnknownQueue, name)
+	}
+	qc.mu.Lock()
+	defer qc.mu.Unlock()
+	if name == "" {
+		qc.pausedAll = true
+	} else {
+		qc.paused[name] = true
+	}
+	return nil
+}
+
+// Resume 恢复本进程对队列的消费，name为空时恢复全部队列（包括单独暂停的队列）
+func (qc *QueueController) Resume(name string) error {
+	if name != "" && !qc.queues.has(name) {
+		return fmt.Errorf("%w: %s", ErrUnknownQueue, name)
+	}
+	qc.mu.Lock()
+	defer qc.mu.Unlock()
+	if name == "" {
+		qc.pausedAll = false
+		qc.paused = make(map[string]bool)
+	} else {
+		delete(qc.paused, name)
+	}
+	return nil
+}
+
+// IsPaused 判断本进程是否暂停了对队列的消费
+func (qc *QueueController) IsPaused(name string) bool {
+	qc.mu.RLock()
+	defer qc.mu.RUnlock()
+	return qc.pausedAll || qc.paused[name]
+}
+
+// activeQueues 过滤掉暂停消费的队列
+func (qc *QueueController) activeQueues(names []string) []string {
+	qc.mu.RLock()
+	defer qc.mu.RUnlock()
+	if qc.pausedAll {
+		return nil
+	}
+	if len(qc.paused) == 0 {
+		return names
+	}
+	active := make([]string, 0, len(names))
+	for _, name := range names {
+		if !qc.paused[name] {
+			active = append(active, name)
+		}
+	}
+	return active
+}
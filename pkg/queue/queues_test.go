@@ -0,0 +1,52 @@
+package queue
+
+import "testing"
+
+// 测试队列配置校验、类型路由和严格优先级顺序
+func TestQueueSetStrict(t *testing.T) {
+	qs, err := newQueueSet([]QueueSpec{
+		{Name: "enrich", Priority: 1, Types: []string{"enrich"}},
+		{Name: "store", Priority: 10, Types: []string{"product"}},
+	}, "")
+	if err != nil {
+		t.Fatalf("newQueueSet() error = %v", err)
+	}
+
+	order := qs.order()
+	if len(order) != 3 || order[0] != "store" || order[1] != "enrich" || order[2] != DefaultQueue {
+		t.Errorf("order() = %v, 期望 [store enrich default]", order)
+	}
+	if qs.route("product") != "store" || qs.route("unknown") != DefaultQueue {
+		t.Errorf("route() 结果错误")
+	}
+
+	if _, err := newQueueSet([]QueueSpec{{Name: "a", Types: []string{"x"}}, {Name: "b", Types: []string{"x"}}}, ""); err == nil {
+		t.Error("同一类型配置在两个队列中应返回错误")
+	}
+	if _, err := newQueueSet(nil, "fifo"); err == nil {
+		t.Error("不支持的调度方式应返回错误")
+	}
+}
+
+// 测试加权公平调度按权重分配首选队列
+func TestQueueSetWeighted(t *testing.T) {
+	qs, err := newQueueSet([]QueueSpec{
+		{Name: "store", Priority: 10, Weight: 3},
+		{Name: DefaultQueue, Weight: 1},
+	}, SchedulingWeighted)
+	if err != nil {
+		t.Fatalf("newQueueSet() error = %v", err)
+	}
+
+	first := make(map[string]int)
+	for i := 0; i < 40; i++ {
+		order := qs.order()
+		if len(order) != 2 {
+			t.Fatalf("order() = %v", order)
+		}
+		first[order[0]]++
+	}
+	if first["store"] != 30 || first[DefaultQueue] != 10 {
+		t.Errorf("首选次数 = %v, 期望 store:30 default:10", first)
+	}
+}
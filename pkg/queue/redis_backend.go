@@ -0,0 +1,741 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"japan_spider/pkg/mongodb"
+	"japan_spider/pkg/redis"
+
+	goredis "github.com/go-redis/redis/v8"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Redis键布局（均以RedisKeyPrefix开头）:
+//   - items:             哈希，ID -> 队列项JSON
+//   - status:            哈希，ID -> 当前状态
+//   - pending:           列表，默认队列等待处理的ID，LPUSH入队、RPOPLPUSH出队
+//   - queue:<队列>:pending: 列表，命名队列等待处理的ID
+//   - routes:            哈希，ID -> 所属队列的pending列表键，重新入队时放回原队列
+//   - processing:<工作者>: 列表，该工作协程正在处理的ID
+//   - leases:            有序集合，ID -> 可见性截止时间（毫秒）
+//   - delayed:           有序集合，ID -> 重试时间（毫秒）
+//   - quarantine:        列表，类型没有处理器的ID，注册处理器后可释放回pending
+//   - owners:            哈希，ID -> 持有该项的processing列表键
+//   - dedup:<幂等键>:     字符串，去重窗口内已入队的幂等键，过期自动删除
+//   - processed:<幂等键>: 字符串，已处理的幂等键，过期自动删除
+
+// takeScript 原子地把最多N个ID从pending移到工作协程的processing列表，并登记租约
+// 返回 {ID, 队列项JSON, ID, 队列项JSON, ...}
+// KEYS: pending, processing, leases, owners, status, items
+// ARGV: 租约截止时间, 数量上限
+var takeScript = goredis.NewScript(`
+local result = {}
+for i = 1, tonumber(ARGV[2]) do
+	local id = redis.call('RPOPLPUSH', KEYS[1], KEYS[2])
+	if not id then
+		break
+	end
+	redis.call('ZADD', KEYS[3], ARGV[1], id)
+	redis.call('HSET', KEYS[4], id, KEYS[2])
+	redis.call('HSET', KEYS[5], id, 'processing')
+	table.insert(result, id)
+	table.insert(result, redis.call('HGET', KEYS[6], id) or '')
+end
+return result
+`)
+
+// adoptScript 把旧版本直接放在pending列表中的队列项JSON转换为按ID保存的格式
+// 旧条目已被takeScript当作ID移入processing列表，这里换成真正的ID并保留租约
+// KEYS: processing, leases, owners, status, items, routes
+// ARGV: 旧条目, ID, 队列项JSON, 租约截止时间, 所属队列的pending列表键
+var adoptScript = goredis.NewScript(`
+if redis.call('HGET', KEYS[3], ARGV[1]) ~= KEYS[1] then
+	return 0
+end
+redis.call('LREM', KEYS[1], 1, ARGV[1])
+redis.call('ZREM', KEYS[2], ARGV[1])
+redis.call('HDEL', KEYS[3], ARGV[1])
+redis.call('HDEL', KEYS[4], ARGV[1])
+redis.call('LPUSH', KEYS[1], ARGV[2])
+redis.call('ZADD', KEYS[2], ARGV[4], ARGV[2])
+redis.call('HSET', KEYS[3], ARGV[2], KEYS[1])
+redis.call('HSET', KEYS[4], ARGV[2], 'processing')
+redis.call('HSET', KEYS[5], ARGV[2], ARGV[3])
+redis.call('HSET', KEYS[6], ARGV[2], ARGV[5])
+return 1
+`)
+
+// ackScript 确认处理完成，删除这些项在Redis中的全部记录，返回确认的数量
+// 租约已过期并被其他工作协程取走的项不做任何修改
+// KEYS: processing, leases, owners, status, items, routes
+// ARGV: ID...
+var ackScript = goredis.NewScript(`
+local acked = 0
+for _, id in ipairs(ARGV) do
+	if redis.call('HGET', KEYS[3], id) == KEYS[1] then
+		redis.call('LREM', KEYS[1], 1, id)
+		redis.call('ZREM', KEYS[2], id)
+		redis.call('HDEL', KEYS[3], id)
+		redis.call('HDEL', KEYS[4], id)
+		redis.call('HDEL', KEYS[5], id)
+		redis.call('HDEL', KEYS[6], id)
+		acked = acked + 1
+	end
+end
+return acked
+`)
+
+// reapScript 把租约过期的项从持有者的processing列表移回所属队列的队首
+// 持有者列表键和所属队列键分别保存在owners和routes中，单机Redis下可以在脚本中直接访问
+// KEYS: leases, owners, status, pending（默认队列）, routes
+// ARGV: 当前时间（毫秒）, 数量上限
+var reapScript = goredis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, id in ipairs(ids) do
+	local owner = redis.call('HGET', KEYS[2], id)
+	if owner then
+		redis.call('LREM', owner, 1, id)
+	end
+	redis.call('ZREM', KEYS[1], id)
+	redis.call('HDEL', KEYS[2], id)
+	redis.call('HSET', KEYS[3], id, 'pending')
+	redis.call('RPUSH', redis.call('HGET', KEYS[5], id) or KEYS[4], id)
+end
+return ids
+`)
+
+// retryScript 把处理失败的项从processing列表移入延迟队列，并更新保存的队列项
+// 租约已过期并被其他工作协程取走时不做任何修改
+// KEYS: processing, leases, owners, status, items, delayed
+// ARGV: ID, 队列项JSON, 重试时间
+var retryScript = goredis.NewScript(`
+if redis.call('HGET', KEYS[3], ARGV[1]) ~= KEYS[1] then
+	return 0
+end
+redis.call('LREM', KEYS[1], 1, ARGV[1])
+redis.call('ZREM', KEYS[2], ARGV[1])
+redis.call('HDEL', KEYS[3], ARGV[1])
+redis.call('HSET', KEYS[4], ARGV[1], 'retrying')
+redis.call('HSET', KEYS[5], ARGV[1], ARGV[2])
+redis.call('ZADD', KEYS[6], ARGV[3], ARGV[1])
+return 1
+`)
+
+// quarantineScript 把没有处理器的项从processing列表移入隔离队列
+// 租约已过期并被其他工作协程取走时不做任何修改
+// KEYS: processing, leases, owners, status, items, quarantine
+// ARGV: ID, 队列项JSON
+var quarantineScript = goredis.NewScript(`
+if redis.call('HGET', KEYS[3], ARGV[1]) ~= KEYS[1] then
+	return 0
+end
+redis.call('LREM', KEYS[1], 1, ARGV[1])
+redis.call('ZREM', KEYS[2], ARGV[1])
+redis.call('HDEL', KEYS[3], ARGV[1])
+redis.call('HSET', KEYS[4], ARGV[1], 'quarantined')
+redis.call('HSET', KEYS[5], ARGV[1], ARGV[2])
+redis.call('LPUSH', KEYS[6], ARGV[1])
+return 1
+`)
+
+// releaseScript 把隔离队列中的项移回所属队列的队尾
+// KEYS: quarantine, status, pending（默认队列）, routes
+// ARGV: ID
+var releaseScript = goredis.NewScript(`
+if redis.call('LREM', KEYS[1], 1, ARGV[1]) == 0 then
+	return 0
+end
+redis.call('HSET', KEYS[2], ARGV[1], 'pending')
+redis.call('LPUSH', redis.call('HGET', KEYS[4], ARGV[1]) or KEYS[3], ARGV[1])
+return 1
+`)
+
+// promoteScript 把到期的延迟项移到所属队列的队尾
+// KEYS: delayed, status, pending（默认队列）, routes
+// ARGV: 当前时间（毫秒）, 数量上限
+var promoteScript = goredis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, id in ipairs(ids) do
+	redis.call('ZREM', KEYS[1], id)
+	redis.call('HSET', KEYS[2], id, 'pending')
+	redis.call('LPUSH', redis.call('HGET', KEYS[4], id) or KEYS[3], id)
+end
+return ids
+`)
+
+// RedisBackend 基于Redis和MongoDB的队列后端
+// Redis保存投递状态，所有状态转换由Lua脚本原子完成；MongoDB保存主记录、归档和指标
+type RedisBackend struct {
+	redisClient *redis.RedisClient   // Redis客户端，用于临时存储和缓冲
+	mongoClient *mongodb.MongoClient // MongoDB客户端，用于持久化存储
+	prefix      string               // Redis键前缀
+	database    string               // MongoDB数据库名
+	collection  string               // MongoDB集合名
+	indexOnce   sync.Once            // 保证成功记录集合的幂等键索引只创建一次
+}
+
+// NewRedisBackend 创建Redis+MongoDB队列后端
+// 使用config中的RedisKeyPrefix、MongoDatabase和MongoCollection
+func NewRedisBackend(redisClient *redis.RedisClient, mongoClient *mongodb.MongoClient, config Config) *RedisBackend {
+	return &RedisBackend{
+		redisClient: redisClient,
+		mongoClient: mongoClient,
+		prefix:      config.RedisKeyPrefix,
+		database:    config.MongoDatabase,
+		collection:  config.MongoCollection,
+	}
+}
+
+// key 返回带前缀的Redis键
+func (b *RedisBackend) key(name string) string {
+	return b.prefix + name
+}
+
+// processingKey 返回工作协程的processing列表键
+func (b *RedisBackend) processingKey(worker string) string {
+	return b.key("processing:" + worker)
+}
+
+// pendingKey 返回队列的pending列表键
+// 默认队列沿用原来的键（prefix+"pending"）。旧版本在该列表中直接保存队列项JSON，
+// Take取到这样的条目时就地转换为新格式（见adoptLegacy），升级时不需要停机迁移
+func (b *RedisBackend) pendingKey(queue string) string {
+	if queue == "" || queue == DefaultQueue {
+		return b.key("pending")
+	}
+	return b.key("queue:" + queue + ":pending")
+}
+
+// Enqueue 实现Backend接口
+func (b *RedisBackend) Enqueue(item *QueueItem) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+
+	ctx := b.redisClient.Context()
+	pending := b.pendingKey(item.Queue)
+	_, err = b.redisClient.Client().TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.HSet(ctx, b.key("items"), item.ID, data)
+		pipe.HSet(ctx, b.key("status"), item.ID, item.Status)
+		pipe.HSet(ctx, b.key("routes"), item.ID, pending)
+		pipe.LPush(ctx, pending, item.ID)
+		return nil
+	})
+	return err
+}
+
+// Take 实现Backend接口
+func (b *RedisBackend) Take(worker, queue string, n int, deadline time.Time) ([]*QueueItem, error) {
+	keys := []string{
+		b.pendingKey(queue),
+		b.processingKey(worker),
+		b.key("leases"),
+		b.key("owners"),
+		b.key("status"),
+		b.key("items"),
+	}
+
+	result, err := takeScript.Run(b.redisClient.Context(), b.redisClient.Client(), keys, deadline.UnixMilli(), n).StringSlice()
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*QueueItem, 0, len(result)/2)
+	for i := 0; i+1 < len(result); i += 2 {
+		id, data := result[i], result[i+1]
+		if legacy, ok := legacyItem(id); ok {
+			if err := b.adoptLegacy(worker, id, legacy, deadline); err != nil {
+				log.Printf("转换旧格式队列项 %s 失败: %v", legacy.ID, err)
+				continue
+			}
+			items = append(items, legacy)
+			continue
+		}
+		var item QueueItem
+		if data == "" {
+			// 数据丢失的ID无法处理，直接确认以免反复回收
+			log.Printf("队列项 %s 的数据不存在", id)
+			b.Ack(worker, id)
+			continue
+		}
+		if err := json.Unmarshal([]byte(data), &item); err != nil {
+			log.Printf("解析队列项 %s 失败: %v", id, err)
+			b.Ack(worker, id)
+			continue
+		}
+		items = append(items, &item)
+	}
+	return items, nil
+}
+
+// legacyItem 解析旧版本直接放在pending列表中的队列项JSON，不是旧格式时返回false
+func legacyItem(entry string) (*QueueItem, bool) {
+	if !strings.HasPrefix(entry, "{") {
+		return nil, false
+	}
+	var item QueueItem
+	if err := json.Unmarshal([]byte(entry), &item); err != nil {
+		return nil, false
+	}
+	if item.ID == "" {
+		item.ID = generateID()
+	}
+	item.Queue = DefaultQueue
+	item.Status = StatusProcessing
+	return &item, true
+}
+
+// adoptLegacy 把已取出的旧格式条目换成按ID保存的队列项，之后与普通队列项一样确认、重试和回收
+func (b *RedisBackend) adoptLegacy(worker, entry string, item *QueueItem, deadline time.Time) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	keys := []string{
+		b.processingKey(worker),
+		b.key("leases"),
+		b.key("owners"),
+		b.key("status"),
+		b.key("items"),
+		b.key("routes"),
+	}
+	n, err := adoptScript.Run(b.redisClient.Context(), b.redisClient.Client(), keys,
+		entry, item.ID, data, deadline.UnixMilli(), b.pendingKey(DefaultQueue)).Int()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("条目已不在工作协程 %s 的processing列表中", worker)
+	}
+	return nil
+}
+
+// Ack 实现Backend接口
+func (b *RedisBackend) Ack(worker string, ids ...string) (int, error) {
+	keys := []string{
+		b.processingKey(worker),
+		b.key("leases"),
+		b.key("owners"),
+		b.key("status"),
+		b.key("items"),
+		b.key("routes"),
+	}
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return ackScript.Run(b.redisClient.Context(), b.redisClient.Client(), keys, args...).Int()
+}
+
+// Retry 实现Backend接口
+func (b *RedisBackend) Retry(item *QueueItem, due time.Time) (bool, error) {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return false, err
+	}
+
+	keys := []string{
+		b.processingKey(item.Worker),
+		b.key("leases"),
+		b.key("owners"),
+		b.key("status"),
+		b.key("items"),
+		b.key("delayed"),
+	}
+	n, err := retryScript.Run(b.redisClient.Context(), b.redisClient.Client(), keys, item.ID, data, due.UnixMilli()).Int()
+	return n == 1, err
+}
+
+// Promote 实现Backend接口
+func (b *RedisBackend) Promote(now time.Time, limit int) (int, error) {
+	keys := []string{
+		b.key("delayed"),
+		b.key("status"),
+		b.key("pending"),
+		b.key("routes"),
+	}
+	ids, err := promoteScript.Run(b.redisClient.Context(), b.redisClient.Client(), keys, now.UnixMilli(), limit).StringSlice()
+	return len(ids), err
+}
+
+// Reap 实现Backend接口
+func (b *RedisBackend) Reap(now time.Time, limit int) ([]QueueItem, error) {
+	keys := []string{
+		b.key("leases"),
+		b.key("owners"),
+		b.key("status"),
+		b.key("pending"),
+		b.key("routes"),
+	}
+	ids, err := reapScript.Run(b.redisClient.Context(), b.redisClient.Client(), keys, now.UnixMilli(), limit).StringSlice()
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	return b.loadItems(ids)
+}
+
+// Quarantine 实现Backend接口
+func (b *RedisBackend) Quarantine(item *QueueItem) (bool, error) {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return false, err
+	}
+
+	keys := []string{
+		b.processingKey(item.Worker),
+		b.key("leases"),
+		b.key("owners"),
+		b.key("status"),
+		b.key("items"),
+		b.key("quarantine"),
+	}
+	n, err := quarantineScript.Run(b.redisClient.Context(), b.redisClient.Client(), keys, item.ID, data).Int()
+	return n == 1, err
+}
+
+// Quarantined 实现Backend接口
+func (b *RedisBackend) Quarantined(limit int) ([]QueueItem, error) {
+	stop := int64(-1)
+	if limit > 0 {
+		stop = int64(limit) - 1
+	}
+
+	ids, err := b.redisClient.Client().LRange(b.redisClient.Context(), b.key("quarantine"), 0, stop).Result()
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	return b.loadItems(ids)
+}
+
+// Release 实现Backend接口
+func (b *RedisBackend) Release(id string) (bool, error) {
+	keys := []string{
+		b.key("quarantine"),
+		b.key("status"),
+		b.key("pending"),
+		b.key("routes"),
+	}
+	n, err := releaseScript.Run(b.redisClient.Context(), b.redisClient.Client(), keys, id).Int()
+	return n == 1, err
+}
+
+// Peek 实现Backend接口
+// 入队在列表左端、取出在右端，因此从右端读取并反转为取出顺序
+func (b *RedisBackend) Peek(queue string, limit int) ([]QueueItem, error) {
+	start := int64(0)
+	if limit > 0 {
+		start = -int64(limit)
+	}
+	ids, err := b.redisClient.Client().LRange(b.redisClient.Context(), b.pendingKey(queue), start, -1).Result()
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	for i, j := 0, len(ids)-1; i < j; i, j = i+1, j-1 {
+		ids[i], ids[j] = ids[j], ids[i]
+	}
+	return b.loadItems(ids)
+}
+
+// Retrying 实现Backend接口
+func (b *RedisBackend) Retrying(limit int) ([]QueueItem, error) {
+	stop := int64(-1)
+	if limit > 0 {
+		stop = int64(limit) - 1
+	}
+	ids, err := b.redisClient.Client().ZRange(b.redisClient.Context(), b.key("delayed"), 0, stop).Result()
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	return b.loadItems(ids)
+}
+
+// Depths 实现Backend接口
+func (b *RedisBackend) Depths(queues []string) (Depths, error) {
+	ctx := context.Background()
+	pending := make([]*goredis.IntCmd, len(queues))
+
+	pipe := b.redisClient.Client().Pipeline()
+	for i, name := range queues {
+		pending[i] = pipe.LLen(ctx, b.pendingKey(name))
+	}
+	processing := pipe.ZCard(ctx, b.key("leases"))
+	retrying := pipe.ZCard(ctx, b.key("delayed"))
+	quarantined := pipe.LLen(ctx, b.key("quarantine"))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return Depths{}, err
+	}
+	dead, err := b.deadCollection().EstimatedDocumentCount(b.mongoClient.Context())
+	if err != nil {
+		return Depths{}, err
+	}
+
+	depths := Depths{
+		Pending:     make(map[string]int64, len(queues)),
+		Processing:  processing.Val(),
+		Retrying:    retrying.Val(),
+		Quarantined: quarantined.Val(),
+		Dead:        dead,
+	}
+	for i, name := range queues {
+		depths.Pending[name] = pending[i].Val()
+	}
+	return depths, nil
+}
+
+// Claim 实现Backend接口
+func (b *RedisBackend) Claim(key string, window time.Duration) (bool, error) {
+	return b.redisClient.Client().SetNX(b.redisClient.Context(), b.key("dedup:"+key), 1, window).Result()
+}
+
+// Unclaim 实现Backend接口
+func (b *RedisBackend) Unclaim(key string) error {
+	return b.redisClient.Client().Del(b.redisClient.Context(), b.key("dedup:"+key)).Err()
+}
+
+// MarkProcessed 实现Backend接口
+func (b *RedisBackend) MarkProcessed(key string, ttl time.Duration) error {
+	return b.redisClient.Client().Set(b.redisClient.Context(), b.key("processed:"+key), 1, ttl).Err()
+}
+
+// Processed 实现Backend接口
+func (b *RedisBackend) Processed(key string) (bool, error) {
+	n, err := b.redisClient.Client().Exists(b.redisClient.Context(), b.key("processed:"+key)).Result()
+	return n > 0, err
+}
+
+// loadItems 按ID读取保存的队列项，跳过不存在或无法解析的项
+// 旧格式的条目本身就是队列项JSON，直接解析
+func (b *RedisBackend) loadItems(ids []string) ([]QueueItem, error) {
+	values, err := b.redisClient.Client().HMGet(b.redisClient.Context(), b.key("items"), ids...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]QueueItem, 0, len(values))
+	for i, value := range values {
+		if legacy, ok := legacyItem(ids[i]); ok {
+			legacy.Status = StatusPending
+			items = append(items, *legacy)
+			continue
+		}
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var item QueueItem
+		if err := json.Unmarshal([]byte(data), &item); err != nil {
+			log.Printf("解析队列项 %s 失败: %v", ids[i], err)
+			continue
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// Save 实现Backend接口，按ID更新主集合，保留入队记录中没有变化的字段
+func (b *RedisBackend) Save(items ...*QueueItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	models := make([]mongo.WriteModel, len(items))
+	for i, item := range items {
+		models[i] = mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": item.ID}).
+			SetUpdate(bson.M{"$set": item}).
+			SetUpsert(true)
+	}
+	_, err := b.mongoCollection("").BulkWrite(b.mongoClient.Context(), models, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+// Archive 实现Backend接口，写入以"_"+kind为后缀的集合
+// 带幂等键的成功记录按key字段更新，保留第一次写入时的_id
+func (b *RedisBackend) Archive(kind string, items ...*QueueItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+	if kind == ArchiveCompleted {
+		b.indexOnce.Do(b.ensureKeyIndex)
+	}
+
+	models := make([]mongo.WriteModel, len(items))
+	for i, item := range items {
+		if archiveKey(kind, item) == item.ID {
+			models[i] = mongo.NewReplaceOneModel().
+				SetFilter(bson.M{"_id": item.ID}).
+				SetReplacement(item).
+				SetUpsert(true)
+			continue
+		}
+
+		fields, err := toBSON(item)
+		if err != nil {
+			return err
+		}
+		delete(fields, "_id")
+		models[i] = mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"key": item.Key}).
+			SetUpdate(bson.M{"$set": fields, "$setOnInsert": bson.M{"_id": item.ID}}).
+			SetUpsert(true)
+	}
+	_, err := b.mongoCollection("_"+kind).BulkWrite(b.mongoClient.Context(), models, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+// ensureKeyIndex 在成功记录集合上创建幂等键的唯一索引，保证并发写入同一幂等键时只有一条记录
+func (b *RedisBackend) ensureKeyIndex() {
+	_, err := b.mongoCollection("_"+ArchiveCompleted).Indexes().CreateOne(b.mongoClient.Context(), mongo.IndexModel{
+		Keys: bson.D{{Key: "key", Value: 1}},
+		Options: options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"key": bson.M{"$exists": true}}),
+	})
+	if err != nil {
+		log.Printf("创建幂等键索引失败: %v", err)
+	}
+}
+
+// toBSON 把队列项转换为bson.M
+func toBSON(item *QueueItem) (bson.M, error) {
+	data, err := bson.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+	var fields bson.M
+	err = bson.Unmarshal(data, &fields)
+	return fields, err
+}
+
+// DeadLetters 实现Backend接口
+func (b *RedisBackend) DeadLetters(query DeadLetterQuery) ([]QueueItem, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "updated_at", Value: -1}})
+	if query.Limit > 0 {
+		opts.SetLimit(int64(query.Limit))
+	}
+
+	ctx := b.mongoClient.Context()
+	cursor, err := b.deadCollection().Find(ctx, deadLetterFilter(query), opts)
+	if err != nil {
+		return nil, fmt.Errorf("查询死信失败: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var items []QueueItem
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, fmt.Errorf("解析死信失败: %w", err)
+	}
+	return items, nil
+}
+
+// CountDeadLetters 实现Backend接口
+func (b *RedisBackend) CountDeadLetters(query DeadLetterQuery) (int64, error) {
+	return b.deadCollection().CountDocuments(b.mongoClient.Context(), deadLetterFilter(query))
+}
+
+// UpdateDeadLetter 实现Backend接口
+func (b *RedisBackend) UpdateDeadLetter(id string, data interface{}) (bool, error) {
+	result, err := b.deadCollection().UpdateOne(
+		b.mongoClient.Context(),
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{"data": data, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// DeleteDeadLetters 实现Backend接口
+func (b *RedisBackend) DeleteDeadLetters(query DeadLetterQuery) (int64, error) {
+	result, err := b.deadCollection().DeleteMany(b.mongoClient.Context(), deadLetterFilter(query))
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+// SaveMetrics 实现Backend接口
+// 每小时的指标保存在同一个文档的points数组中（_id为该小时的开始时间），减少文档数量和索引大小
+func (b *RedisBackend) SaveMetrics(point MetricsPoint) error {
+	_, err := b.mongoCollection("_metrics").UpdateOne(
+		b.mongoClient.Context(),
+		bson.M{"_id": point.Time.UTC().Truncate(time.Hour)},
+		bson.M{"$push": bson.M{"points": point}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// Metrics 实现Backend接口
+func (b *RedisBackend) Metrics(since time.Time) ([]MetricsPoint, error) {
+	ctx := b.mongoClient.Context()
+	cursor, err := b.mongoCollection("_metrics").Find(ctx,
+		bson.M{"_id": bson.M{"$gte": since.UTC().Truncate(time.Hour)}},
+		options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var points []MetricsPoint
+	for cursor.Next(ctx) {
+		var doc struct {
+			Points []MetricsPoint `bson:"points"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		for _, point := range doc.Points {
+			if !point.Time.Before(since) {
+				points = append(points, point)
+			}
+		}
+	}
+	return points, cursor.Err()
+}
+
+// mongoCollection 返回以suffix为后缀的集合
+func (b *RedisBackend) mongoCollection(suffix string, opts ...*options.CollectionOptions) *mongo.Collection {
+	return b.mongoClient.Client().Database(b.database).Collection(b.collection+suffix, opts...)
+}
+
+// deadCollection 返回死信集合
+// 嵌套文档解码为map，保证重放时数据结构与入队时一致
+func (b *RedisBackend) deadCollection() *mongo.Collection {
+	return b.mongoCollection("_"+ArchiveDead,
+		options.Collection().SetBSONOptions(&options.BSONOptions{DefaultDocumentM: true}))
+}
+
+// deadLetterFilter 把死信查询条件转换为MongoDB查询条件
+func deadLetterFilter(q DeadLetterQuery) bson.M {
+	filter := bson.M{}
+	if len(q.IDs) > 0 {
+		filter["_id"] = bson.M{"$in": q.IDs}
+	}
+	if q.ErrorContains != "" {
+		filter["error"] = bson.M{"$regex": regexp.QuoteMeta(q.ErrorContains), "$options": "i"}
+	}
+
+	updated := bson.M{}
+	if !q.Since.IsZero() {
+		updated["$gte"] = q.Since
+	}
+	if !q.Until.IsZero() {
+		updated["$lt"] = q.Until
+	}
+	if len(updated) > 0 {
+		filter["updated_at"] = updated
+	}
+	return filter
+}
@@ -0,0 +1,179 @@
+package queue
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"japan_spider/pkg/redis"
+)
+
+// newTestRedisBackend 连接测试Redis创建后端，每个测试使用独立的键前缀，结束时删除
+// 测试Redis不可用时跳过
+func newTestRedisBackend(t *testing.T) (*RedisBackend, *redis.RedisClient) {
+	client, err := redis.NewRedisClient(&redis.Config{
+		Host:    "192.168.20.6",
+		Port:    32430,
+		DB:      1, // 使用不同的数据库避免影响生产环境
+		Timeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Skipf("测试Redis不可用: %v", err)
+	}
+
+	prefix := fmt.Sprintf("test:queue:%d:", time.Now().UnixNano())
+	t.Cleanup(func() {
+		ctx := client.Context()
+		iter := client.Client().Scan(ctx, 0, prefix+"*", 100).Iterator()
+		for iter.Next(ctx) {
+			client.Client().Del(ctx, iter.Val())
+		}
+		client.Close()
+	})
+	return NewRedisBackend(client, nil, Config{RedisKeyPrefix: prefix}), client
+}
+
+// 测试识别旧版本直接放在pending列表中的队列项JSON
+func TestLegacyItem(t *testing.T) {
+	if _, ok := legacyItem("8f14e45f-ceea-467f-a0e6-3f2d5c1b9c1a"); ok {
+		t.Error("普通ID不应识别为旧格式")
+	}
+
+	item, ok := legacyItem(`{"id":"1","data":{"url":"https://example.com"},"status":"pending"}`)
+	if !ok || item.ID != "1" || item.Status != StatusProcessing || item.Queue != DefaultQueue {
+		t.Fatalf("legacyItem() = %+v, %v", item, ok)
+	}
+	if item, ok := legacyItem(`{"data":{}}`); !ok || item.ID == "" {
+		t.Errorf("没有ID的旧队列项应生成ID: %+v", item)
+	}
+}
+
+// 测试升级前入队的旧格式队列项被转换并正常处理，而不是被丢弃
+func TestRedisBackendTakeLegacy(t *testing.T) {
+	b, client := newTestRedisBackend(t)
+
+	legacy, _ := json.Marshal(&QueueItem{ID: "legacy-1", Data: testProduct{URL: "a"}, Status: StatusPending})
+	if err := client.RPush(b.pendingKey(DefaultQueue), string(legacy)); err != nil {
+		t.Fatalf("RPush() error = %v", err)
+	}
+	if err := b.Enqueue(&QueueItem{ID: "new-1", Queue: DefaultQueue, Data: testProduct{URL: "b"}, Status: StatusPending}); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+
+	peeked, err := b.Peek(DefaultQueue, 0)
+	if err != nil || len(peeked) != 2 || peeked[0].ID != "legacy-1" {
+		t.Fatalf("Peek() = %+v, %v", peeked, err)
+	}
+
+	items, err := b.Take("w", DefaultQueue, 10, time.Now().Add(time.Minute))
+	if err != nil || len(items) != 2 {
+		t.Fatalf("Take() = %+v, %v", items, err)
+	}
+	if items[0].ID != "legacy-1" {
+		t.Errorf("旧队列项ID = %s", items[0].ID)
+	}
+
+	// 转换后的项有租约，可以按ID确认
+	if n, err := b.Ack("w", "legacy-1", "new-1"); n != 2 || err != nil {
+		t.Fatalf("Ack() = %d, %v", n, err)
+	}
+	ctx := client.Context()
+	if n := client.Client().LLen(ctx, b.processingKey("w")).Val(); n != 0 {
+		t.Errorf("确认后processing列表长度 = %d", n)
+	}
+	if n := client.Client().ZCard(ctx, b.key("leases")).Val(); n != 0 {
+		t.Errorf("确认后租约数量 = %d", n)
+	}
+}
+
+// 测试Redis后端的可见性租约：过期的项被回收到队首，原持有者不能再确认或安排重试
+func TestRedisBackendLeaseAndReap(t *testing.T) {
+	b, client := newTestRedisBackend(t)
+
+	for _, id := range []string{"a", "b"} {
+		if err := b.Enqueue(&QueueItem{ID: id, Queue: DefaultQueue, Data: testProduct{URL: id}, Status: StatusPending}); err != nil {
+			t.Fatalf("Enqueue() error = %v", err)
+		}
+	}
+
+	now := time.Now()
+	taken, err := b.Take("crashed", DefaultQueue, 1, now.Add(time.Minute))
+	if err != nil || len(taken) != 1 || taken[0].ID != "a" {
+		t.Fatalf("Take() = %+v, %v", taken, err)
+	}
+
+	// 租约未到期时不回收
+	if items, err := b.Reap(now, 10); len(items) != 0 || err != nil {
+		t.Fatalf("租约到期前 Reap() = %+v, %v", items, err)
+	}
+	items, err := b.Reap(now.Add(2*time.Minute), 10)
+	if err != nil || len(items) != 1 || items[0].ID != "a" {
+		t.Fatalf("Reap() = %+v, %v", items, err)
+	}
+	if n := client.Client().ZCard(client.Context(), b.key("leases")).Val(); n != 0 {
+		t.Errorf("回收后租约数量 = %d", n)
+	}
+
+	// 回收的项放回队首，先于其他项被取出
+	again, err := b.Take("other", DefaultQueue, 1, now.Add(time.Minute))
+	if err != nil || len(again) != 1 || again[0].ID != "a" {
+		t.Fatalf("回收后 Take() = %+v, %v", again, err)
+	}
+
+	stale := *taken[0]
+	stale.Worker = "crashed"
+	if ok, err := b.Retry(&stale, now); ok || err != nil {
+		t.Errorf("原持有者 Retry() = %v, %v，期望被拒绝", ok, err)
+	}
+	if n, err := b.Ack("crashed", "a"); n != 0 || err != nil {
+		t.Errorf("原持有者 Ack() = %d, %v，期望 0", n, err)
+	}
+	if n, err := b.Ack("other", "a"); n != 1 || err != nil {
+		t.Errorf("新持有者 Ack() = %d, %v，期望 1", n, err)
+	}
+}
+
+// 测试Redis后端的延迟重试：失败的项保留重试次数进入延迟队列，到期后回到所属队列
+func TestRedisBackendRetryAndPromote(t *testing.T) {
+	b, client := newTestRedisBackend(t)
+	ctx := client.Context()
+
+	if err := b.Enqueue(&QueueItem{ID: "a", Queue: DefaultQueue, Data: testProduct{URL: "a"}, Status: StatusPending}); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	now := time.Now()
+	taken, err := b.Take("w", DefaultQueue, 1, now.Add(time.Minute))
+	if err != nil || len(taken) != 1 {
+		t.Fatalf("Take() = %+v, %v", taken, err)
+	}
+
+	item := taken[0]
+	item.Worker, item.Retries, item.Status, item.Error = "w", 1, StatusRetrying, "请求超时"
+	if ok, err := b.Retry(item, now.Add(time.Hour)); !ok || err != nil {
+		t.Fatalf("Retry() = %v, %v", ok, err)
+	}
+	if n := client.Client().ZCard(ctx, b.key("leases")).Val(); n != 0 {
+		t.Errorf("安排重试后租约数量 = %d", n)
+	}
+
+	retrying, err := b.Retrying(0)
+	if err != nil || len(retrying) != 1 || retrying[0].Retries != 1 || retrying[0].Error != "请求超时" {
+		t.Fatalf("Retrying() = %+v, %v", retrying, err)
+	}
+
+	if n, err := b.Promote(now, 10); n != 0 || err != nil {
+		t.Fatalf("到期前 Promote() = %d, %v", n, err)
+	}
+	if n, err := b.Promote(now.Add(2*time.Hour), 10); n != 1 || err != nil {
+		t.Fatalf("到期后 Promote() = %d, %v", n, err)
+	}
+	if n := client.Client().LLen(ctx, b.pendingKey(DefaultQueue)).Val(); n != 1 {
+		t.Errorf("到期后队列长度 = %d", n)
+	}
+
+	again, err := b.Take("w", DefaultQueue, 1, now.Add(time.Minute))
+	if err != nil || len(again) != 1 || again[0].ID != "a" || again[0].Retries != 1 {
+		t.Fatalf("重试时 Take() = %+v, %v", again, err)
+	}
+}
@@ -0,0 +1,163 @@
+package queue
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 队列项状态
+const (
+	StatusPending     = "pending"     // 等待处理
+	StatusProcessing  = "processing"  // 已被工作协程取出，正在处理
+	StatusRetrying    = "retrying"    // 处理失败，等待延迟重试
+	StatusCompleted   = "completed"   // 处理成功
+	StatusDead        = "dead"        // 重试耗尽，已转入死信集合
+	StatusQuarantined = "quarantined" // 类型没有注册处理器，已转入隔离队列
+)
+
+// reapBatchSize 回收器和调度器每次最多移动的项数量
+const reapBatchSize = 100
+
+// newConsumerID 生成本进程的消费者标识，用于区分不同进程的processing列表
+func newConsumerID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), uuid.New().String()[:8])
+}
+
+// enqueue 按类型确定所属队列，并交给后端入队
+func (qc *QueueController) enqueue(item *QueueItem) error {
+	if item.Queue == "" || !qc.queues.has(item.Queue) {
+		item.Queue = qc.queues.route(itemType(item))
+	}
+	if err := qc.backend.Enqueue(item); err != nil {
+		return err
+	}
+	qc.metrics.addEnqueued(1)
+	return nil
+}
+
+// take 为工作协程从指定队列取出最多n个待处理项，并登记可见性租约
+// 队列为空时返回errEmpty
+func (qc *QueueController) take(worker, queue string, n int) ([]*QueueItem, error) {
+	deadline := time.Now().Add(qc.config.VisibilityTimeout)
+	items, err := qc.backend.Take(worker, queue, n, deadline)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, errEmpty
+	}
+	qc.metrics.addDequeued(len(items))
+
+	for _, item := range items {
+		item.Status = StatusProcessing
+		item.Worker = worker
+		item.UpdatedAt = time.Now()
+	}
+	return items, nil
+}
+
+// ack 确认队列项已处理完毕
+// 返回确认的数量，少于传入数量表示部分项的租约已过期并被重新入队
+func (qc *QueueController) ack(worker string, ids ...string) (int, error) {
+	return qc.backend.Ack(worker, ids...)
+}
+
+// startReaper 启动回收器，定期把可见性超时的项重新入队
+func (qc *QueueController) startReaper() {
+	ticker := time.NewTicker(qc.config.ReapInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-qc.ctx.Done():
+			return
+		case <-ticker.C:
+			if n, err := qc.reap(); err != nil {
+				log.Printf("回收超时队列项失败: %v", err)
+			} else if n > 0 {
+				log.Printf("已重新入队 %d 个超时的队列项", n)
+			}
+		}
+	}
+}
+
+// reap 把租约过期的项移回所属队列，返回重新入队的数量
+func (qc *QueueController) reap() (int, error) {
+	total := 0
+	for {
+		items, err := qc.backend.Reap(time.Now(), reapBatchSize)
+		if err != nil {
+			return total, err
+		}
+		total += len(items)
+
+		for i := range items {
+			qc.markRequeued(&items[i])
+		}
+		if len(items) < reapBatchSize {
+			return total, nil
+		}
+	}
+}
+
+// markRequeued 在主记录中记录被回收的项重新回到pending状态
+func (qc *QueueController) markRequeued(item *QueueItem) {
+	item.Status = StatusPending
+	item.Error = "可见性超时，重新入队"
+	item.UpdatedAt = time.Now()
+	if err := qc.persistItem(item); err != nil {
+		log.Printf("更新队列项 %s 状态失败: %v", item.ID, err)
+	}
+}
+
+// scheduleRetry 把处理失败的项放入延迟队列，保留其ID和重试次数
+func (qc *QueueController) scheduleRetry(item *QueueItem, delay time.Duration) error {
+	ok, err := qc.backend.Retry(item, time.Now().Add(delay))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		log.Printf("队列项 %s 的租约已过期，已被重新投递", item.ID)
+	}
+	return nil
+}
+
+// startScheduler 启动调度器，定期把到期的重试项移回所属队列
+func (qc *QueueController) startScheduler() {
+	ticker := time.NewTicker(qc.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-qc.ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := qc.promote(); err != nil {
+				log.Printf("调度重试队列项失败: %v", err)
+			}
+		}
+	}
+}
+
+// promote 把到期的延迟项移回所属队列，返回移动的数量
+func (qc *QueueController) promote() (int, error) {
+	total := 0
+	for {
+		n, err := qc.backend.Promote(time.Now(), reapBatchSize)
+		if err != nil {
+			return total, err
+		}
+		total += n
+		if n < reapBatchSize {
+			return total, nil
+		}
+	}
+}
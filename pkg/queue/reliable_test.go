@@ -0,0 +1,173 @@
+package queue
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 测试进程崩溃时未确认的项在重启后被重新投递，而不是丢失
+func TestRedeliverAfterCrash(t *testing.T) {
+	dir := t.TempDir()
+	config := testConfig()
+	config.VisibilityTimeout = 50 * time.Millisecond
+	config.ReapInterval = 5 * time.Millisecond
+
+	backend, err := NewFileBackend(dir)
+	if err != nil {
+		t.Fatalf("NewFileBackend() error = %v", err)
+	}
+	crashed, err := OpenQueueControllerWithBackend(backend, config)
+	if err != nil {
+		t.Fatalf("OpenQueueControllerWithBackend() error = %v", err)
+	}
+	if err := Push(crashed, "product", 1, testProduct{URL: "a"}); err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+	taken, err := crashed.take("crashed", DefaultQueue, 1)
+	if err != nil {
+		t.Fatalf("take() error = %v", err)
+	}
+	// 取出后没有确认就退出
+	crashed.Close()
+	backend.Close()
+
+	backend, err = NewFileBackend(dir)
+	if err != nil {
+		t.Fatalf("重新打开 NewFileBackend() error = %v", err)
+	}
+	defer backend.Close()
+	time.Sleep(config.VisibilityTimeout)
+
+	qc, err := NewQueueControllerWithBackend(backend, config)
+	if err != nil {
+		t.Fatalf("NewQueueControllerWithBackend() error = %v", err)
+	}
+	defer qc.Close()
+
+	var processed atomic.Int64
+	var redelivered atomic.Value
+	RegisterHandlerFunc(qc, "product", func(p testProduct, item *QueueItem) error {
+		redelivered.Store(item.ID)
+		processed.Add(1)
+		return nil
+	})
+
+	waitFor(t, "重新投递", func() bool { return processed.Load() > 0 })
+	if id := redelivered.Load(); id != taken[0].ID {
+		t.Errorf("重新投递的项 = %v, 期望 %s", id, taken[0].ID)
+	}
+	waitFor(t, "确认", func() bool {
+		depths, _ := backend.Depths([]string{DefaultQueue})
+		return depths.Processing == 0 && depths.Pending[DefaultQueue] == 0
+	})
+	if n, _ := qc.ack("crashed", taken[0].ID); n != 0 {
+		t.Error("崩溃前的工作协程不应能确认已重新投递的项")
+	}
+}
+
+// 测试重试等待时间按指数增长，并受上限约束
+func TestRetryDelay(t *testing.T) {
+	config := Config{RetryBackoff: time.Second, MaxRetryBackoff: 10 * time.Second}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for i, d := range want {
+		if got := config.retryDelay(i + 1); got != d {
+			t.Errorf("retryDelay(%d) = %v, 期望 %v", i+1, got, d)
+		}
+	}
+}
+
+// 测试处理失败的项保留ID和重试次数进入延迟队列，到期后才回到原队列
+func TestBackendRetryBackoff(t *testing.T) {
+	for _, tb := range testBackends {
+		t.Run(tb.name, func(t *testing.T) {
+			backend := tb.open(t)
+			config := testConfig()
+			config.RetryBackoff = time.Hour
+			config.MaxRetryBackoff = time.Hour
+			qc, err := OpenQueueControllerWithBackend(backend, config)
+			if err != nil {
+				t.Fatalf("OpenQueueControllerWithBackend() error = %v", err)
+			}
+			defer qc.Close()
+
+			if err := Push(qc, "product", 1, testProduct{URL: "a"}); err != nil {
+				t.Fatalf("Push() error = %v", err)
+			}
+			items, err := qc.take("w", DefaultQueue, 1)
+			if err != nil {
+				t.Fatalf("take() error = %v", err)
+			}
+			qc.handleFailure(items[0], errors.New("请求超时"))
+
+			retrying, err := backend.Retrying(0)
+			if err != nil || len(retrying) != 1 {
+				t.Fatalf("Retrying() = %+v, %v", retrying, err)
+			}
+			if retrying[0].ID != items[0].ID || retrying[0].Retries != 1 || retrying[0].Status != StatusRetrying {
+				t.Errorf("等待重试的项 = %+v", retrying[0])
+			}
+
+			// 未到期时不回到队列
+			if n, err := qc.promote(); n != 0 || err != nil {
+				t.Fatalf("到期前 promote() = %d, %v", n, err)
+			}
+			if n, err := backend.Promote(time.Now().Add(2*time.Hour), reapBatchSize); n != 1 || err != nil {
+				t.Fatalf("到期后 Promote() = %d, %v", n, err)
+			}
+
+			again, err := qc.take("w", DefaultQueue, 1)
+			if err != nil || again[0].ID != items[0].ID || again[0].Retries != 1 {
+				t.Fatalf("重试时取出 = %+v, %v", again, err)
+			}
+		})
+	}
+}
+
+// 测试编辑死信后重放，不存在的死信返回ErrDeadLetterNotFound
+func TestBackendUpdateDeadLetter(t *testing.T) {
+	for _, tb := range testBackends {
+		t.Run(tb.name, func(t *testing.T) {
+			config := testConfig()
+			config.MaxRetries = 1
+			qc, err := OpenQueueControllerWithBackend(tb.open(t), config)
+			if err != nil {
+				t.Fatalf("OpenQueueControllerWithBackend() error = %v", err)
+			}
+			defer qc.Close()
+
+			if err := Push(qc, "product", 1, testProduct{URL: "bad"}); err != nil {
+				t.Fatalf("Push() error = %v", err)
+			}
+			items, err := qc.take("w", DefaultQueue, 1)
+			if err != nil {
+				t.Fatalf("take() error = %v", err)
+			}
+			qc.handleFailure(items[0], errors.New("页面解析失败"))
+
+			id := items[0].ID
+			if _, err := qc.GetDeadLetter("missing"); !errors.Is(err, ErrDeadLetterNotFound) {
+				t.Errorf("GetDeadLetter(missing) error = %v", err)
+			}
+			if err := qc.UpdateDeadLetter("missing", testProduct{}); !errors.Is(err, ErrDeadLetterNotFound) {
+				t.Errorf("UpdateDeadLetter(missing) error = %v", err)
+			}
+			if err := qc.UpdateDeadLetter(id, testProduct{URL: "fixed"}); err != nil {
+				t.Fatalf("UpdateDeadLetter() error = %v", err)
+			}
+
+			if n, err := qc.ReplayDeadLetters(DeadLetterQuery{IDs: []string{id}}); n != 1 || err != nil {
+				t.Fatalf("ReplayDeadLetters() = %d, %v", n, err)
+			}
+			replayed, err := qc.take("w", DefaultQueue, 1)
+			if err != nil || replayed[0].ID != id || replayed[0].Retries != 0 {
+				t.Fatalf("重放后取出 = %+v, %v", replayed, err)
+			}
+			var p testProduct
+			if err := replayed[0].Decode(&p); err != nil || p.URL != "fixed" {
+				t.Errorf("重放的数据 = %+v, %v", p, err)
+			}
+		})
+	}
+}
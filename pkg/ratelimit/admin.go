@@ -0,0 +1,172 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// errBadRequest 请求参数错误
+var errBadRequest = errors.New("请求参数错误")
+
+// errUnknownDomain 域名还没有限制器
+var errUnknownDomain = errors.New("域名没有限制器")
+
+// DomainLimit 域名限制器的当前状态
+type DomainLimit struct {
+	Domain        string     `json:"domain"`
+	Rate          float64    `json:"rate"`                     // 自适应调节后的速率
+	Burst         int        `json:"burst"`                    // 突发请求数
+	EffectiveRate float64    `json:"effective_rate"`           // 按时间表调整后的实际速率
+	Tokens        float64    `json:"tokens"`                   // 当前令牌数，为负数表示已被预约
+	PausedUntil   *time.Time `json:"paused_until,omitempty"`   // 暂停请求直到该时间
+	CooldownUntil *time.Time `json:"cooldown_until,omitempty"` // 降速冷却结束时间
+}
+
+// AdminHandler 限流管理HTTP接口
+// 在发出请求的进程中挂载，例如:
+//
+//	http.Handle("/ratelimit/", http.StripPrefix("/ratelimit", ratelimit.NewAdminHandler(rlc)))
+//
+// 接口（均返回JSON）:
+//
+//	GET    /domains            各域名限制器的状态
+//	GET    /domains/{domain}   单个域名限制器的状态
+//	PUT    /domains/{domain}   设置域名的速率和突发数，请求体为 {"rate": 1.5, "burst": 3}
+//	DELETE /domains/{domain}   删除域名限制器和保存的速率，下一个请求按配置重新创建
+//	GET    /metrics            限流指标
+//	POST   /reload             重新加载配置文件
+type AdminHandler struct {
+	rlc *RateLimitController
+	mux *http.ServeMux
+}
+
+// NewAdminHandler 创建限流管理HTTP接口
+func NewAdminHandler(rlc *RateLimitController) *AdminHandler {
+	h := &AdminHandler{rlc: rlc, mux: http.NewServeMux()}
+	h.mux.HandleFunc("GET /domains", h.listDomains)
+	h.mux.HandleFunc("GET /domains/{domain}", h.getDomain)
+	h.mux.HandleFunc("PUT /domains/{domain}", h.setDomain)
+	h.mux.HandleFunc("DELETE /domains/{domain}", h.resetDomain)
+	h.mux.HandleFunc("GET /metrics", h.metrics)
+	h.mux.HandleFunc("POST /reload", h.reload)
+	return h
+}
+
+// ServeHTTP 实现http.Handler接口
+func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// listDomains 列出各域名限制器的状态
+func (h *AdminHandler) listDomains(w http.ResponseWriter, r *http.Request) {
+	limiters := h.rlc.domainLimiters()
+	domains := make([]DomainLimit, 0, len(limiters))
+	for domain, l := range limiters {
+		domains = append(domains, l.status(domain))
+	}
+	sort.Slice(domains, func(i, j int) bool { return domains[i].Domain < domains[j].Domain })
+	writeJSON(w, http.StatusOK, map[string]interface{}{"domains": domains, "count": len(domains)})
+}
+
+// getDomain 查看单个域名限制器的状态
+func (h *AdminHandler) getDomain(w http.ResponseWriter, r *http.Request) {
+	domain := r.PathValue("domain")
+	l, ok := h.rlc.domainLimiters()[domain]
+	if !ok {
+		writeError(w, fmt.Errorf("%w: %s", errUnknownDomain, domain))
+		return
+	}
+	writeJSON(w, http.StatusOK, l.status(domain))
+}
+
+// setDomain 设置域名的速率和突发数
+func (h *AdminHandler) setDomain(w http.ResponseWriter, r *http.Request) {
+	var limit struct {
+		Rate  *float64 `json:"rate"`
+		Burst *int     `json:"burst"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&limit); err != nil {
+		writeError(w, fmt.Errorf("%w: %v", errBadRequest, err))
+		return
+	}
+	if limit.Rate == nil || *limit.Rate < 0 || limit.Burst == nil || *limit.Burst < 1 {
+		writeError(w, fmt.Errorf("%w: 需要 rate >= 0 和 burst >= 1", errBadRequest))
+		return
+	}
+
+	domain := r.PathValue("domain")
+	h.rlc.SetRate(domain, *limit.Rate, *limit.Burst)
+	writeJSON(w, http.StatusOK, h.rlc.getLimiter(domain).status(domain))
+}
+
+// resetDomain 删除域名限制器和保存的速率
+func (h *AdminHandler) resetDomain(w http.ResponseWriter, r *http.Request) {
+	domain := r.PathValue("domain")
+	if err := h.rlc.ResetRate(domain); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"reset": domain})
+}
+
+// metrics 输出限流指标
+func (h *AdminHandler) metrics(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.rlc.GetMetrics())
+}
+
+// reload 重新加载配置文件
+func (h *AdminHandler) reload(w http.ResponseWriter, r *http.Request) {
+	if err := h.rlc.Reload(); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"reloaded": true})
+}
+
+// status 返回限制器的当前状态
+func (l *Limiter) status(domain string) DomainLimit {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.refill(now)
+	s := DomainLimit{
+		Domain:        domain,
+		Rate:          l.rate,
+		Burst:         l.burst,
+		EffectiveRate: l.effectiveRate(),
+		Tokens:        l.tokens,
+	}
+	if l.pausedUntil.After(now) {
+		t := l.pausedUntil
+		s.PausedUntil = &t
+	}
+	if l.feedback.cooldownUntil.After(now) {
+		t := l.feedback.cooldownUntil
+		s.CooldownUntil = &t
+	}
+	return s
+}
+
+// writeJSON 以JSON格式输出
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError 按错误类型输出对应的状态码
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, errBadRequest):
+		status = http.StatusBadRequest
+	case errors.Is(err, errUnknownDomain):
+		status = http.StatusNotFound
+	}
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,136 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// doAdmin 调用管理接口并解码JSON响应
+func doAdmin(t *testing.T, h http.Handler, method, path, body string, out interface{}) int {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s 响应无法解码: %s", method, path, rec.Body.String())
+		}
+	}
+	return rec.Code
+}
+
+// 测试重置域名时同时删除Redis中保存的速率，下一个请求按配置重新创建
+func TestAdminResetPersistedRate(t *testing.T) {
+	rlc := newRedisController(t, Config{DefaultRate: 10, DefaultBurst: 1})
+	h := NewAdminHandler(rlc)
+
+	if code := doAdmin(t, h, "PUT", "/domains/example.com", `{"rate": 2, "burst": 1}`, nil); code != http.StatusOK {
+		t.Fatalf("PUT 状态码 = %d", code)
+	}
+	if err := rlc.persistRates(); err != nil {
+		t.Fatalf("persistRates() error = %v", err)
+	}
+	if _, ok := rlc.loadRate("example.com"); !ok {
+		t.Fatal("设置的速率没有保存到Redis")
+	}
+
+	if code := doAdmin(t, h, "DELETE", "/domains/example.com", "", nil); code != http.StatusOK {
+		t.Fatalf("DELETE 状态码 = %d", code)
+	}
+	if rate, ok := rlc.loadRate("example.com"); ok {
+		t.Errorf("重置后Redis中仍保存速率 %v", rate)
+	}
+	if got := rlc.Rate("example.com"); got != 10 {
+		t.Errorf("重置后速率 = %v，期望配置的 10", got)
+	}
+}
+
+// 测试通过管理接口查看、设置和重置域名速率
+func TestAdminDomains(t *testing.T) {
+	rlc := newLocalController(10, 2)
+	defer rlc.Close()
+	h := NewAdminHandler(rlc)
+
+	if code := doAdmin(t, h, "GET", "/domains/example.com", "", nil); code != http.StatusNotFound {
+		t.Errorf("未使用的域名状态码 = %d", code)
+	}
+	rlc.Reserve("example.com")
+
+	var got DomainLimit
+	if code := doAdmin(t, h, "PUT", "/domains/example.com", `{"rate": 1.5, "burst": 3}`, &got); code != http.StatusOK {
+		t.Fatalf("PUT 状态码 = %d", code)
+	}
+	// 修改速率保留预约后剩余的令牌
+	if got.Rate != 1.5 || got.Burst != 3 || got.Tokens < 1 || got.Tokens > 1.1 {
+		t.Errorf("设置后状态 = %+v", got)
+	}
+	if code := doAdmin(t, h, "PUT", "/domains/example.com", `{"rate": 1}`, nil); code != http.StatusBadRequest {
+		t.Errorf("缺少burst时状态码 = %d", code)
+	}
+
+	var list struct {
+		Domains []DomainLimit `json:"domains"`
+	}
+	doAdmin(t, h, "GET", "/domains", "", &list)
+	if len(list.Domains) != 1 || list.Domains[0].Domain != "example.com" {
+		t.Errorf("域名列表 = %+v", list.Domains)
+	}
+
+	doAdmin(t, h, "DELETE", "/domains/example.com", "", nil)
+	if got := rlc.Rate("example.com"); got != 10 {
+		t.Errorf("重置后速率 = %v，期望默认速率 10", got)
+	}
+}
+
+// 测试修改配置文件后重新加载，配置变化的限制器使用新速率，未变化的保留原速率
+func TestReloadLimitsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ratelimit.yaml")
+	write := func(data string, mtime time.Time) {
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(path, mtime, mtime)
+	}
+	start := time.Now().Add(-time.Minute)
+	write("domain:\n  rate: 2\n  burst: 2\n  overrides:\n    a.com: {rate: 1, burst: 1}\n", start)
+
+	rlc := NewRateLimitController(nil, Config{DefaultRate: 10, DefaultBurst: 1, LimitsFile: path})
+	defer rlc.Close()
+	if got := rlc.Rate("a.com"); got != 1 {
+		t.Fatalf("a.com 初始速率 = %v，期望 1", got)
+	}
+	rlc.SetRate("b.com", 0.5, 1)
+
+	write("domain:\n  rate: 2\n  burst: 2\n  overrides:\n    a.com: {rate: 3, burst: 1}\nproxy:\n  rate: 1\n  burst: 1\n", start.Add(time.Second))
+	rlc.reloadIfChanged(time.Now())
+	if got := rlc.Rate("a.com"); got != 3 {
+		t.Errorf("重新加载后 a.com 速率 = %v，期望 3", got)
+	}
+	if got := rlc.Rate("b.com"); got != 0.5 {
+		t.Errorf("配置未变化的 b.com 速率 = %v，期望保留 0.5", got)
+	}
+	if n := len(rlc.limitersFor(Key{Domain: "a.com", Proxy: "p1"})); n != 2 {
+		t.Errorf("新增代理作用域后限制器数量 = %d，期望 2", n)
+	}
+
+	// 加载失败时保持原配置
+	write("domain:\n  rate: -1\n", start.Add(2*time.Second))
+	rlc.reloadIfChanged(time.Now())
+	if got := rlc.Rate("a.com"); got != 3 {
+		t.Errorf("加载失败后 a.com 速率 = %v，期望 3", got)
+	}
+	var result map[string]string
+	if code := doAdmin(t, NewAdminHandler(rlc), "POST", "/reload", "", &result); code != http.StatusInternalServerError || result["error"] == "" {
+		t.Errorf("POST /reload 加载失败时 = %d %v", code, result)
+	}
+
+	if err := rlc.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+}
@@ -4,13 +4,53 @@ import "time"
 
 // Config 限流控制器配置
 type Config struct {
-	RedisKeyPrefix    string        // Redis键前缀
-	DefaultRate       float64       // 默认每秒请求数
-	DefaultBurst      int           // 默认突发请求数
-	WindowSize        time.Duration // 滑动窗口大小
-	WindowLimit       int           // 窗口请求限制
-	AdjustInterval    time.Duration // 自适应调节间隔
-	ThrottleThreshold float64       // 限流阈值
-	MinRate           float64       // 最小速率
-	MaxRate           float64       // 最大速率
+	RedisKeyPrefix   string        // Redis键前缀
+	DefaultRate      float64       // 默认每秒请求数
+	DefaultBurst     int           // 默认突发请求数
+	WindowSize       time.Duration // 滑动窗口大小
+	WindowLimit      int           // 窗口请求限制
+	DistributedMode  string        // 分布式限流算法: sliding_window（默认）/gcra
+	DistributedBurst int           // GCRA模式允许的突发请求数，默认1
+	AdjustInterval   time.Duration // 自适应调节间隔，每个间隔内没有降速信号的域名按IncreaseStep提速，默认1分钟
+	MinRate          float64       // 最小速率，默认DefaultRate的1/20
+	MaxRate          float64       // 自适应调节的最大速率，未设置时以各域名配置的速率为上限
+	IncreaseStep     float64       // 加性增加的步长（每秒请求数），默认DefaultRate的1/10
+	DecreaseFactor   float64       // 乘性减少的系数，默认0.5
+	Cooldown         time.Duration // 降速后的冷却时间，期间不再重复降速也不提速，默认30秒
+	BanCooldown      time.Duration // 检测到封禁后暂停请求的时间，默认10分钟
+	LatencyFactor    float64       // 近期响应耗时超过基线的该倍数时降速，默认2
+	Scopes           Scopes        // 各作用域的限流配置，未配置域名作用域时使用DefaultRate/DefaultBurst
+	Schedule         *Schedule     // 域名速率的时间表，为nil时不按时间调整
+	LimitsFile       string        // 作用域限流配置文件（YAML），设置后覆盖Scopes并支持热加载
+	ScheduleFile     string        // 时间表配置文件（YAML），设置后覆盖Schedule并支持热加载
+	ReloadInterval   time.Duration // 检查配置文件是否修改的间隔，默认30秒
+}
+
+// withDefaults 用默认值补全未设置的配置项
+func (c Config) withDefaults() Config {
+	if c.AdjustInterval <= 0 {
+		c.AdjustInterval = time.Minute
+	}
+	if c.MinRate <= 0 {
+		c.MinRate = c.DefaultRate / 20
+	}
+	if c.IncreaseStep <= 0 {
+		c.IncreaseStep = c.DefaultRate / 10
+	}
+	if c.DecreaseFactor <= 0 || c.DecreaseFactor >= 1 {
+		c.DecreaseFactor = 0.5
+	}
+	if c.Cooldown <= 0 {
+		c.Cooldown = 30 * time.Second
+	}
+	if c.BanCooldown <= 0 {
+		c.BanCooldown = 10 * time.Minute
+	}
+	if c.ReloadInterval <= 0 {
+		c.ReloadInterval = 30 * time.Second
+	}
+	if c.LatencyFactor <= 1 {
+		c.LatencyFactor = 2
+	}
+	return c
 }
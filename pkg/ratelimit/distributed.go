@@ -0,0 +1,123 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// 分布式限流算法
+const (
+	ModeSlidingWindow = "sliding_window" // 滑动窗口日志：WindowSize内最多WindowLimit个请求
+	ModeGCRA          = "gcra"           // GCRA（通用信元速率算法，等价于令牌桶）：平均间隔WindowSize/WindowLimit，允许DistributedBurst个突发
+)
+
+// 两个脚本都使用Redis服务器的时间，多个节点的本地时钟不一致时限流仍然准确
+// Redis 5之前脚本调用TIME后不能再写入，需要先切换为按命令复制；Redis 5及之后默认按命令复制
+// 返回 {是否允许（1/0）, 需要等待的毫秒数}
+
+// slidingWindowScript 滑动窗口日志
+// 只记录允许通过的请求，成员唯一，分数为毫秒时间戳；键在窗口结束后过期
+// KEYS: 请求记录有序集合
+// ARGV: 窗口（毫秒）, 窗口内请求上限, 成员
+var slidingWindowScript = goredis.NewScript(`
+if redis.replicate_commands then
+	redis.replicate_commands()
+end
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local window = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+local count = redis.call('ZCARD', KEYS[1])
+if count < limit then
+	redis.call('ZADD', KEYS[1], now, ARGV[3])
+	redis.call('PEXPIRE', KEYS[1], window)
+	return {1, 0}
+end
+
+-- 第count-limit+1早的请求移出窗口后才有空位
+local entry = redis.call('ZRANGE', KEYS[1], count - limit, count - limit, 'WITHSCORES')
+local retry = tonumber(entry[2]) + window - now
+if retry < 1 then
+	retry = 1
+end
+return {0, retry}
+`)
+
+// gcraScript GCRA限流
+// 键保存理论到达时间（TAT，毫秒），请求在 TAT - 容差 之前到达时拒绝；键在TAT之后过期
+// KEYS: TAT键
+// ARGV: 发放间隔（毫秒）, 容差（毫秒，(突发数-1)*发放间隔）
+var gcraScript = goredis.NewScript(`
+if redis.replicate_commands then
+	redis.replicate_commands()
+end
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + tonumber(t[2]) / 1000
+local interval = tonumber(ARGV[1])
+local tolerance = tonumber(ARGV[2])
+
+local tat = tonumber(redis.call('GET', KEYS[1]) or now)
+if tat < now then
+	tat = now
+end
+
+local allowAt = tat - tolerance
+if now < allowAt then
+	return {0, math.ceil(allowAt - now)}
+end
+
+local newTat = tat + interval
+redis.call('SET', KEYS[1], string.format('%.3f', newTat), 'PX', math.ceil(newTat - now))
+return {1, 0}
+`)
+
+// checkDistributedLimit 检查分布式限流，多个节点对同一域名共享一个限额
+// 返回:
+//   - time.Duration: 被限流时需要等待的时间
+//   - error: 被限流时返回ErrThrottled，Redis出错时返回对应错误
+func (rlc *RateLimitController) checkDistributedLimit(ctx context.Context, domain string) (time.Duration, error) {
+	if rlc.redisClient == nil || rlc.config.WindowLimit <= 0 || rlc.config.WindowSize <= 0 {
+		return 0, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	var result []int64
+	var err error
+	switch rlc.config.DistributedMode {
+	case "", ModeSlidingWindow:
+		key := fmt.Sprintf("%s:%s:requests", rlc.config.RedisKeyPrefix, domain)
+		result, err = slidingWindowScript.Run(ctx, rlc.redisClient.Client(), []string{key},
+			rlc.config.WindowSize.Milliseconds(), rlc.config.WindowLimit, uuid.New().String()).Int64Slice()
+	case ModeGCRA:
+		key := fmt.Sprintf("%s:%s:gcra", rlc.config.RedisKeyPrefix, domain)
+		interval := float64(rlc.config.WindowSize.Milliseconds()) / float64(rlc.config.WindowLimit)
+		burst := rlc.config.DistributedBurst
+		if burst < 1 {
+			burst = 1
+		}
+		result, err = gcraScript.Run(ctx, rlc.redisClient.Client(), []string{key},
+			interval, interval*float64(burst-1)).Int64Slice()
+	default:
+		return 0, fmt.Errorf("不支持的分布式限流算法: %s", rlc.config.DistributedMode)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if len(result) != 2 {
+		return 0, fmt.Errorf("分布式限流脚本返回值异常: %v", result)
+	}
+
+	if result[0] == 1 {
+		return 0, nil
+	}
+	retryAfter := time.Duration(result[1]) * time.Millisecond
+	return retryAfter, fmt.Errorf("%w: %s 超过分布式限制，需等待 %s", ErrThrottled, domain, retryAfter)
+}
@@ -0,0 +1,169 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"japan_spider/pkg/redis"
+)
+
+// newRedisController 连接测试Redis创建控制器，每个测试使用独立的键前缀，结束时删除
+// 测试Redis不可用时跳过
+func newRedisController(t *testing.T, config Config) *RateLimitController {
+	client, err := redis.NewRedisClient(&redis.Config{
+		Host:    "192.168.20.6",
+		Port:    32430,
+		DB:      1, // 使用不同的数据库避免影响生产环境
+		Timeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Skipf("测试Redis不可用: %v", err)
+	}
+
+	config.RedisKeyPrefix = fmt.Sprintf("test:ratelimit:%d", time.Now().UnixNano())
+	if config.AdjustInterval <= 0 {
+		config.AdjustInterval = time.Hour
+	}
+	rlc := NewRateLimitController(client, config)
+	t.Cleanup(func() {
+		rlc.Close()
+		ctx := client.Context()
+		iter := client.Client().Scan(ctx, 0, config.RedisKeyPrefix+"*", 100).Iterator()
+		for iter.Next(ctx) {
+			client.Client().Del(ctx, iter.Val())
+		}
+		client.Close()
+	})
+	return rlc
+}
+
+// 测试滑动窗口脚本：窗口内超过上限的请求被拒绝，等待时间不超过窗口
+func TestSlidingWindowScript(t *testing.T) {
+	rlc := newRedisController(t, Config{
+		DefaultRate:  100,
+		DefaultBurst: 100,
+		WindowSize:   time.Second,
+		WindowLimit:  3,
+	})
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := rlc.checkDistributedLimit(ctx, "example.com"); err != nil {
+			t.Fatalf("第%d个请求 error = %v", i+1, err)
+		}
+	}
+	retryAfter, err := rlc.checkDistributedLimit(ctx, "example.com")
+	if !errors.Is(err, ErrThrottled) {
+		t.Fatalf("超过窗口上限 error = %v，期望 ErrThrottled", err)
+	}
+	if retryAfter <= 0 || retryAfter > time.Second {
+		t.Errorf("等待时间 = %s，期望在 (0, 1s] 内", retryAfter)
+	}
+	if _, err := rlc.checkDistributedLimit(ctx, "other.com"); err != nil {
+		t.Errorf("其他域名不受影响: %v", err)
+	}
+
+	time.Sleep(retryAfter)
+	if _, err := rlc.checkDistributedLimit(ctx, "example.com"); err != nil {
+		t.Errorf("等待后请求 error = %v", err)
+	}
+}
+
+// 测试GCRA脚本：允许突发后按平均间隔放行
+func TestGCRAScript(t *testing.T) {
+	rlc := newRedisController(t, Config{
+		DefaultRate:      100,
+		DefaultBurst:     100,
+		WindowSize:       time.Second,
+		WindowLimit:      10,
+		DistributedMode:  ModeGCRA,
+		DistributedBurst: 2,
+	})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := rlc.checkDistributedLimit(ctx, "example.com"); err != nil {
+			t.Fatalf("突发内第%d个请求 error = %v", i+1, err)
+		}
+	}
+	retryAfter, err := rlc.checkDistributedLimit(ctx, "example.com")
+	if !errors.Is(err, ErrThrottled) {
+		t.Fatalf("超过突发 error = %v，期望 ErrThrottled", err)
+	}
+	if retryAfter <= 0 || retryAfter > 100*time.Millisecond {
+		t.Errorf("等待时间 = %s，期望在 (0, 100ms] 内", retryAfter)
+	}
+
+	time.Sleep(retryAfter)
+	if _, err := rlc.checkDistributedLimit(ctx, "example.com"); err != nil {
+		t.Errorf("等待后请求 error = %v", err)
+	}
+}
+
+// 测试分布式限流拒绝时归还本地令牌
+func TestAllowKeyDistributedRefund(t *testing.T) {
+	rlc := newRedisController(t, Config{
+		DefaultRate:  0.001,
+		DefaultBurst: 5,
+		WindowSize:   time.Minute,
+		WindowLimit:  1,
+	})
+	ctx := context.Background()
+
+	if err := rlc.Allow(ctx, "example.com"); err != nil {
+		t.Fatalf("第一个请求 error = %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := rlc.Allow(ctx, "example.com"); !errors.Is(err, ErrThrottled) {
+			t.Fatalf("超过分布式限制 error = %v，期望 ErrThrottled", err)
+		}
+	}
+
+	l := rlc.getLimiter("example.com")
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.tokens < 3.99 {
+		t.Errorf("本地令牌数 = %v，被分布式限流拒绝的请求不应占用本地令牌", l.tokens)
+	}
+}
+
+// 测试保存的速率在重启后恢复，且不超过域名当前配置的速率
+func TestPersistRates(t *testing.T) {
+	fast := Scopes{ScopeDomain: {Overrides: map[string]Limit{"fast.com": {Rate: 40, Burst: 1}}}}
+	rlc := newRedisController(t, Config{DefaultRate: 10, DefaultBurst: 1, Scopes: fast})
+
+	rlc.Report("example.com", Feedback{StatusCode: http.StatusTooManyRequests})
+	rlc.Report("slow.com", Feedback{StatusCode: http.StatusTooManyRequests})
+	rlc.Report("fast.com", Feedback{StatusCode: http.StatusTooManyRequests})
+	if err := rlc.persistRates(); err != nil {
+		t.Fatalf("persistRates() error = %v", err)
+	}
+	if l := rlc.getLimiter("example.com"); l.feedback.dirty {
+		t.Error("保存成功后应清除变化标记")
+	}
+
+	restarted := NewRateLimitController(rlc.redisClient, Config{
+		RedisKeyPrefix: rlc.config.RedisKeyPrefix,
+		DefaultRate:    10,
+		DefaultBurst:   1,
+		AdjustInterval: time.Hour,
+		Scopes: Scopes{ScopeDomain: {Overrides: map[string]Limit{
+			"slow.com": {Rate: 2, Burst: 1},
+			"fast.com": {Rate: 40, Burst: 1},
+		}}},
+	})
+	defer restarted.Close()
+	if got := restarted.Rate("example.com"); got != 5 {
+		t.Errorf("恢复的速率 = %v，期望 5", got)
+	}
+	if got := restarted.Rate("slow.com"); got != 2 {
+		t.Errorf("恢复的速率 = %v，期望不超过域名配置的 2", got)
+	}
+	if got := restarted.Rate("fast.com"); got != 20 {
+		t.Errorf("恢复的速率 = %v，期望高于DefaultRate的 20", got)
+	}
+}
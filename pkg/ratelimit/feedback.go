@@ -0,0 +1,285 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+)
+
+// 响应耗时的指数移动平均系数：近期耗时反应快，基线耗时变化慢
+const (
+	latencyFastAlpha = 0.3
+	latencyBaseAlpha = 0.02
+	latencyMinCount  = 20 // 样本数达到该值后才根据耗时降速
+)
+
+// persistedRateTTL 保存的速率的过期时间，长时间未访问的域名重新从默认速率开始
+const persistedRateTTL = 7 * 24 * time.Hour
+
+// Feedback 一次请求的响应信号，由抓取器在收到响应后通过Report上报
+type Feedback struct {
+	StatusCode int           // HTTP状态码，0表示请求没有得到响应
+	RetryAfter time.Duration // Retry-After头给出的等待时间
+	Latency    time.Duration // 响应耗时
+	Banned     bool          // 抓取器检测到被封禁（验证码页面、封禁提示等）
+}
+
+// feedbackState 单个域名的AIMD状态，由Limiter的互斥锁保护
+type feedbackState struct {
+	cooldownUntil time.Time // 冷却结束时间，期间不重复降速也不提速
+	successes     int       // 本调节间隔内成功的请求数
+	latencyFast   float64   // 近期响应耗时（秒）
+	latencyBase   float64   // 基线响应耗时（秒）
+	latencyCount  int       // 耗时样本数
+	dirty         bool      // 速率变化后尚未保存
+}
+
+// FeedbackFromResponse 根据HTTP响应生成反馈
+// 封禁需要按站点的页面特征判断，由调用方设置Banned
+func FeedbackFromResponse(resp *http.Response, latency time.Duration) Feedback {
+	fb := Feedback{Latency: latency}
+	if resp != nil {
+		fb.StatusCode = resp.StatusCode
+		fb.RetryAfter = ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	}
+	return fb
+}
+
+// ParseRetryAfter 解析Retry-After头，支持秒数和HTTP日期两种格式
+// 无法解析或已过期时返回0
+func ParseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds <= 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// Report 上报指定域名一次请求的响应信号，按AIMD调整该域名的速率
+//   - 封禁: 速率降到MinRate，暂停请求BanCooldown
+//   - 429/503: 速率乘以DecreaseFactor，有Retry-After时暂停请求到指定时间
+//   - 近期耗时超过基线的LatencyFactor倍: 速率乘以DecreaseFactor
+//   - 其他成功响应: 计入本间隔的成功数，间隔结束时没有降速信号则加上IncreaseStep
+//
+// 降速后进入Cooldown冷却期，期间到达的降速信号（通常是降速前已发出的请求）不再重复降速
+func (rlc *RateLimitController) Report(domain string, fb Feedback) {
+	l := rlc.getLimiter(domain)
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	switch {
+	case fb.Banned:
+		l.pause(now, now.Add(rlc.config.BanCooldown))
+		l.setRate(now, rlc.config.MinRate, rlc.config.BanCooldown)
+		log.Printf("检测到 %s 封禁，暂停请求 %s，速率降为 %.2f/s", domain, rlc.config.BanCooldown, l.rate)
+
+	case fb.StatusCode == http.StatusTooManyRequests || fb.StatusCode == http.StatusServiceUnavailable:
+		if fb.RetryAfter > 0 {
+			l.pause(now, now.Add(fb.RetryAfter))
+		}
+		if rlc.decrease(l, now) {
+			log.Printf("%s 返回 %d，速率降为 %.2f/s", domain, fb.StatusCode, l.rate)
+		}
+
+	default:
+		if fb.Latency > 0 && l.observeLatency(fb.Latency, rlc.config.LatencyFactor) && rlc.decrease(l, now) {
+			log.Printf("%s 响应变慢（近期 %.2fs，基线 %.2fs），速率降为 %.2f/s",
+				domain, l.feedback.latencyFast, l.feedback.latencyBase, l.rate)
+		}
+		if fb.StatusCode > 0 && fb.StatusCode < http.StatusBadRequest {
+			l.feedback.successes++
+		}
+	}
+}
+
+// Rate 返回指定域名当前的速率
+func (rlc *RateLimitController) Rate(domain string) float64 {
+	l := rlc.getLimiter(domain)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+// decrease 乘性减少，冷却期内不重复降速
+// 调用方需持有l.mu
+func (rlc *RateLimitController) decrease(l *Limiter, now time.Time) bool {
+	if now.Before(l.feedback.cooldownUntil) {
+		return false
+	}
+	l.setRate(now, max(l.rate*rlc.config.DecreaseFactor, rlc.config.MinRate), rlc.config.Cooldown)
+	return true
+}
+
+// increase 加性增加，冷却期内或本间隔没有成功请求时不提速，速率不超过ceiling
+// 调用方需持有l.mu
+func (rlc *RateLimitController) increase(l *Limiter, now time.Time, ceiling float64) {
+	successes := l.feedback.successes
+	l.feedback.successes = 0
+	if successes == 0 || now.Before(l.feedback.cooldownUntil) || l.rate >= ceiling {
+		return
+	}
+	l.refill(now)
+	l.rate = min(l.rate+rlc.config.IncreaseStep, ceiling)
+	l.feedback.dirty = true
+}
+
+// rateCeiling 返回自适应调节时域名速率的上限：该域名配置的速率，设置了MaxRate时取两者中较小的一个
+// 调用方需持有rlc.mu
+func (rlc *RateLimitController) rateCeiling(domain string) float64 {
+	rate := rlc.domainLimit(domain).Rate
+	if rlc.config.MaxRate > 0 {
+		rate = min(rlc.config.MaxRate, rate)
+	}
+	return rate
+}
+
+// setRate 修改速率并进入冷却期
+// 调用方需持有l.mu
+func (l *Limiter) setRate(now time.Time, rate float64, cooldown time.Duration) {
+	// 先按旧速率补充到当前时间的令牌
+	l.refill(now)
+	l.rate = rate
+	l.feedback.cooldownUntil = now.Add(cooldown)
+	l.feedback.dirty = true
+}
+
+// pause 暂停请求直到until，暂停结束时最多有一个令牌
+// 调用方需持有l.mu
+func (l *Limiter) pause(now, until time.Time) {
+	if !until.After(l.pausedUntil) {
+		return
+	}
+	l.refill(now)
+	l.pausedUntil = until
+	l.tokens = min(l.tokens, 1)
+	l.lastUpdate = until
+}
+
+// observeLatency 记录响应耗时，返回近期耗时是否超过基线的factor倍
+// 调用方需持有l.mu
+func (l *Limiter) observeLatency(latency time.Duration, factor float64) bool {
+	s := &l.feedback
+	seconds := latency.Seconds()
+	if s.latencyCount == 0 {
+		s.latencyFast, s.latencyBase = seconds, seconds
+	} else {
+		s.latencyFast += latencyFastAlpha * (seconds - s.latencyFast)
+		s.latencyBase += latencyBaseAlpha * (seconds - s.latencyBase)
+	}
+	s.latencyCount++
+	return s.latencyCount >= latencyMinCount && s.latencyFast > s.latencyBase*factor
+}
+
+// adjustRates 对所有域名执行一次加性增加，并保存变化的速率；同时删除空闲的作用域限制器
+func (rlc *RateLimitController) adjustRates(now time.Time) {
+	rlc.evictIdleScoped(now, scopedIdleTimeout)
+	for domain, l := range rlc.domainLimiters() {
+		// 先取得上限再锁定限制器，加锁顺序与setLimits一致
+		rlc.mu.RLock()
+		ceiling := rlc.rateCeiling(domain)
+		rlc.mu.RUnlock()
+
+		l.mu.Lock()
+		rlc.increase(l, now, ceiling)
+		l.mu.Unlock()
+	}
+	if err := rlc.persistRates(); err != nil {
+		log.Printf("保存域名速率失败: %v", err)
+	}
+}
+
+// persistRates 保存上次保存以来变化的域名速率
+// 保存成功后才清除变化标记，保存失败的速率下次重试；保存期间速率又发生变化的域名保持标记
+func (rlc *RateLimitController) persistRates() error {
+	limiters := rlc.domainLimiters()
+	changed := make(map[string]interface{})
+	saved := make(map[string]float64)
+	for domain, l := range limiters {
+		l.mu.Lock()
+		if l.feedback.dirty {
+			changed[domain] = strconv.FormatFloat(l.rate, 'f', -1, 64)
+			saved[domain] = l.rate
+		}
+		l.mu.Unlock()
+	}
+	if err := rlc.saveRates(changed); err != nil {
+		return err
+	}
+
+	for domain, rate := range saved {
+		l := limiters[domain]
+		l.mu.Lock()
+		if l.rate == rate {
+			l.feedback.dirty = false
+		}
+		l.mu.Unlock()
+	}
+	return nil
+}
+
+// domainLimiters 返回当前所有域名限制器的副本
+func (rlc *RateLimitController) domainLimiters() map[string]*Limiter {
+	rlc.mu.RLock()
+	defer rlc.mu.RUnlock()
+
+	limiters := make(map[string]*Limiter, len(rlc.limiters))
+	for domain, l := range rlc.limiters {
+		limiters[domain] = l
+	}
+	return limiters
+}
+
+// ratesKey 保存各域名速率的Redis哈希
+func (rlc *RateLimitController) ratesKey() string {
+	return fmt.Sprintf("%s:rates", rlc.config.RedisKeyPrefix)
+}
+
+// saveRates 保存速率到Redis，没有Redis时不保存
+func (rlc *RateLimitController) saveRates(rates map[string]interface{}) error {
+	if rlc.redisClient == nil || len(rates) == 0 {
+		return nil
+	}
+	ctx := rlc.redisClient.Context()
+	_, err := rlc.redisClient.Client().TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.HSet(ctx, rlc.ratesKey(), rates)
+		pipe.Expire(ctx, rlc.ratesKey(), persistedRateTTL)
+		return nil
+	})
+	return err
+}
+
+// loadRate 读取上次保存的速率，调用方还需按rateCeiling限制
+func (rlc *RateLimitController) loadRate(domain string) (float64, bool) {
+	if rlc.redisClient == nil {
+		return 0, false
+	}
+	value, err := rlc.redisClient.HGet(rlc.ratesKey(), domain)
+	if err != nil {
+		if !errors.Is(err, goredis.Nil) {
+			log.Printf("读取 %s 的速率失败: %v", domain, err)
+		}
+		return 0, false
+	}
+	rate, err := strconv.ParseFloat(value, 64)
+	if err != nil || rate <= 0 {
+		return 0, false
+	}
+	return max(rate, rlc.config.MinRate), true
+}
@@ -0,0 +1,162 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// 测试429按乘性减少降速，冷却期内不重复降速，冷却结束后有成功请求时加性增加
+func TestReportAIMD(t *testing.T) {
+	rlc := newLocalController(10, 1)
+	rlc.config.Cooldown = 20 * time.Millisecond
+
+	rlc.Report("example.com", Feedback{StatusCode: http.StatusTooManyRequests})
+	rlc.Report("example.com", Feedback{StatusCode: http.StatusServiceUnavailable})
+	if got := rlc.Rate("example.com"); got != 5 {
+		t.Fatalf("两次限流响应后速率 = %v，期望 5", got)
+	}
+
+	rlc.Report("example.com", Feedback{StatusCode: http.StatusOK})
+	rlc.adjustRates(time.Now())
+	if got := rlc.Rate("example.com"); got != 5 {
+		t.Errorf("冷却期内速率 = %v，期望 5", got)
+	}
+
+	time.Sleep(25 * time.Millisecond)
+	rlc.adjustRates(time.Now())
+	if got := rlc.Rate("example.com"); got != 5 {
+		t.Errorf("没有成功请求时速率 = %v，期望 5", got)
+	}
+	rlc.Report("example.com", Feedback{StatusCode: http.StatusOK})
+	rlc.adjustRates(time.Now())
+	if got := rlc.Rate("example.com"); got != 6 {
+		t.Errorf("冷却结束后速率 = %v，期望 6", got)
+	}
+}
+
+// 测试加性增加不超过域名单独配置的速率
+func TestIncreaseDomainCeiling(t *testing.T) {
+	rlc := newLocalController(10, 1)
+	rlc.config.Scopes = Scopes{ScopeDomain: {Overrides: map[string]Limit{"slow.com": {Rate: 2, Burst: 1}}}}
+	rlc.config.Cooldown = time.Millisecond
+
+	rlc.Report("slow.com", Feedback{StatusCode: http.StatusTooManyRequests})
+	for i := 0; i < 5; i++ {
+		time.Sleep(2 * time.Millisecond)
+		rlc.Report("slow.com", Feedback{StatusCode: http.StatusOK})
+		rlc.adjustRates(time.Now())
+	}
+	if got := rlc.Rate("slow.com"); got != 2 {
+		t.Errorf("提速后速率 = %v，期望不超过域名配置的 2", got)
+	}
+}
+
+// 测试域名配置的速率高于DefaultRate时，降速后能恢复到域名配置的速率
+func TestIncreaseAboveDefaultRate(t *testing.T) {
+	rlc := newLocalController(1, 1)
+	rlc.config.Scopes = Scopes{ScopeDomain: {Overrides: map[string]Limit{"fast.com": {Rate: 4, Burst: 1}}}}
+	rlc.config.Cooldown = time.Millisecond
+
+	rlc.Report("fast.com", Feedback{StatusCode: http.StatusTooManyRequests})
+	if got := rlc.Rate("fast.com"); got != 2 {
+		t.Fatalf("降速后速率 = %v，期望 2", got)
+	}
+	for i := 0; i < 30; i++ {
+		time.Sleep(2 * time.Millisecond)
+		rlc.Report("fast.com", Feedback{StatusCode: http.StatusOK})
+		rlc.adjustRates(time.Now())
+	}
+	if got := rlc.Rate("fast.com"); got != 4 {
+		t.Errorf("提速后速率 = %v，期望恢复到域名配置的 4", got)
+	}
+
+	// 设置了MaxRate时不超过MaxRate
+	rlc.config.MaxRate = 3
+	rlc.Report("fast.com", Feedback{StatusCode: http.StatusTooManyRequests})
+	for i := 0; i < 30; i++ {
+		time.Sleep(2 * time.Millisecond)
+		rlc.Report("fast.com", Feedback{StatusCode: http.StatusOK})
+		rlc.adjustRates(time.Now())
+	}
+	if got := rlc.Rate("fast.com"); got != 3 {
+		t.Errorf("提速后速率 = %v，期望不超过MaxRate 3", got)
+	}
+}
+
+// 测试Retry-After和封禁暂停请求
+func TestReportPause(t *testing.T) {
+	rlc := newLocalController(100, 5)
+
+	rlc.Report("example.com", Feedback{StatusCode: http.StatusTooManyRequests, RetryAfter: 2 * time.Second})
+	if err := rlc.Allow(context.Background(), "example.com"); err == nil {
+		t.Error("Retry-After期间不应放行请求")
+	}
+	if d := rlc.Reserve("example.com").Delay(); d < 1900*time.Millisecond {
+		t.Errorf("Retry-After期间预约等待 %s，期望约 2s", d)
+	}
+
+	rlc.Report("banned.com", Feedback{StatusCode: http.StatusForbidden, Banned: true})
+	if got := rlc.Rate("banned.com"); got != rlc.config.MinRate {
+		t.Errorf("封禁后速率 = %v，期望 %v", got, rlc.config.MinRate)
+	}
+	if d := rlc.Reserve("banned.com").Delay(); d < rlc.config.BanCooldown-time.Second {
+		t.Errorf("封禁后预约等待 %s，期望约 %s", d, rlc.config.BanCooldown)
+	}
+}
+
+// 测试SetRate保留暂停和降速冷却，并标记速率待保存
+func TestSetRateKeepsPause(t *testing.T) {
+	rlc := newLocalController(10, 5)
+
+	rlc.Report("example.com", Feedback{StatusCode: http.StatusTooManyRequests, RetryAfter: 2 * time.Second})
+	rlc.SetRate("example.com", 20, 5)
+	if err := rlc.Allow(context.Background(), "example.com"); err == nil {
+		t.Error("SetRate后仍应遵守Retry-After暂停")
+	}
+
+	l := rlc.getLimiter("example.com")
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate != 20 || !l.feedback.dirty || !time.Now().Before(l.feedback.cooldownUntil) {
+		t.Errorf("SetRate后 rate=%v dirty=%v cooldownUntil=%s", l.rate, l.feedback.dirty, l.feedback.cooldownUntil)
+	}
+}
+
+// 测试响应耗时持续超过基线时降速
+func TestReportLatency(t *testing.T) {
+	rlc := newLocalController(10, 1)
+	for i := 0; i < latencyMinCount; i++ {
+		rlc.Report("example.com", Feedback{StatusCode: http.StatusOK, Latency: 100 * time.Millisecond})
+	}
+	if got := rlc.Rate("example.com"); got != 10 {
+		t.Fatalf("耗时稳定时速率 = %v，期望 10", got)
+	}
+	for i := 0; i < 5; i++ {
+		rlc.Report("example.com", Feedback{StatusCode: http.StatusOK, Latency: time.Second})
+	}
+	if got := rlc.Rate("example.com"); got != 5 {
+		t.Errorf("耗时增长后速率 = %v，期望 5", got)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{"-1", 0},
+		{"Mon, 01 Jan 2024 00:00:30 GMT", 30 * time.Second},
+		{"Sun, 31 Dec 2023 23:59:00 GMT", 0},
+		{"soon", 0},
+	}
+	for _, tt := range tests {
+		if got := ParseRetryAfter(tt.value, now); got != tt.want {
+			t.Errorf("ParseRetryAfter(%q) = %s，期望 %s", tt.value, got, tt.want)
+		}
+	}
+}
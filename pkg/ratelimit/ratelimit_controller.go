@@ -2,35 +2,53 @@ package ratelimit
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
 	"sync"
 	"time"
 
 	"japan_spider/pkg/redis"
 )
 
+// ErrThrottled 请求被限流
+var ErrThrottled = errors.New("请求被限流")
+
 // RateLimitController 请求频率限制控制器
 type RateLimitController struct {
-	redisClient *redis.RedisClient  // Redis客户端，用于分布式限流
-	config      Config              // 配置信息
-	limiters    map[string]*Limiter // 域名对应的限制器
-	mu          sync.RWMutex        // 读写锁
-	metrics     *RateLimitMetrics   // 限流指标
+	redisClient *redis.RedisClient   // Redis客户端，用于分布式限流，为nil时只做本地限流
+	config      Config               // 配置信息
+	limiters    map[string]*Limiter  // 域名对应的限制器
+	scoped      map[string]*Limiter  // 全局、代理、账号作用域的限制器，键为 作用域:名称
+	mu          sync.RWMutex         // 读写锁
+	metrics     *RateLimitMetrics    // 限流指标
+	factor      *rateFactor          // 时间表给出的域名速率倍数
+	files       map[string]time.Time // 配置文件 -> 上次加载时的修改时间
+	reloadMu    sync.Mutex           // 保证配置文件串行加载
+	ctx         context.Context      // 控制器上下文，Close时取消
+	cancel      context.CancelFunc   // 取消函数
+	wg          sync.WaitGroup       // 后台协程
+	closeOnce   sync.Once            // 保证只关闭一次
 }
 
 // Limiter 单个限制器
 type Limiter struct {
-	rate       float64    // 每秒请求数
-	burst      int        // 突发请求数
-	tokens     float64    // 当前令牌数
-	lastUpdate time.Time  // 上次更新时间
-	mu         sync.Mutex // 互斥锁
+	rate        float64       // 每秒请求数
+	burst       int           // 突发请求数
+	tokens      float64       // 当前令牌数
+	lastUpdate  time.Time     // 上次更新时间，暂停期间为暂停结束时间
+	factor      *rateFactor   // 速率倍数，为nil时不受时间表影响
+	pausedUntil time.Time     // 暂停请求直到该时间（Retry-After或封禁）
+	feedback    feedbackState // 响应反馈状态
+	mu          sync.Mutex    // 互斥锁
 }
 
 // RateLimitMetrics 限流指标
 type RateLimitMetrics struct {
 	TotalRequests     int64                  // 总请求数
 	ThrottledRequests int64                  // 被限流的请求数
+	Profile           string                 // 当前生效的时间段
+	RateFactor        float64                // 当前生效的域名速率倍数
 	DomainStats       map[string]*DomainStat // 域名统计
 	mu                sync.Mutex             // 互斥锁
 }
@@ -44,60 +62,149 @@ type DomainStat struct {
 }
 
 // NewRateLimitController 创建新的限流控制器
+// redisClient为nil时不做分布式限流，适合单进程运行和测试。
+// 配置了LimitsFile/ScheduleFile时从文件加载限流配置，加载失败时记录日志并使用config中的配置；
+// 之后每隔ReloadInterval检查文件是否修改并重新加载。不再使用时调用Close停止后台协程
 func NewRateLimitController(redisClient *redis.RedisClient, config Config) *RateLimitController {
+	ctx, cancel := context.WithCancel(context.Background())
 	rlc := &RateLimitController{
 		redisClient: redisClient,
-		config:      config,
+		config:      config.withDefaults(),
 		limiters:    make(map[string]*Limiter),
+		scoped:      make(map[string]*Limiter),
 		metrics: &RateLimitMetrics{
 			DomainStats: make(map[string]*DomainStat),
+			Profile:     DefaultProfile,
+			RateFactor:  1,
 		},
+		factor: newRateFactor(),
+		files:  make(map[string]time.Time),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	if rlc.config.LimitsFile != "" || rlc.config.ScheduleFile != "" {
+		if err := rlc.Reload(); err != nil {
+			log.Printf("加载限流配置失败: %v", err)
+		}
+		rlc.every(rlc.config.ReloadInterval, rlc.reloadIfChanged)
 	}
+	rlc.applySchedule(time.Now())
 
 	// 启动指标收集
-	go rlc.startMetricsCollector()
-	// 启动自适应调节
-	go rlc.startAdaptiveAdjustment()
+	rlc.every(rlc.config.AdjustInterval, rlc.updateAverageRates)
+	// 启动根据响应反馈的速率调节
+	rlc.every(rlc.config.AdjustInterval, rlc.adjustRates)
+	// 启动按时间表的速率调整
+	rlc.every(scheduleUpdateInterval, rlc.applySchedule)
 
 	return rlc
 }
 
-// Allow 检查请求是否允许通过
+// Close 停止后台协程，并保存尚未保存的域名速率
+// 可以重复调用
+func (rlc *RateLimitController) Close() error {
+	var err error
+	rlc.closeOnce.Do(func() {
+		rlc.cancel()
+		rlc.wg.Wait()
+		err = rlc.persistRates()
+	})
+	return err
+}
+
+// every 在后台每隔interval调用一次fn，直到Close
+func (rlc *RateLimitController) every(interval time.Duration, fn func(now time.Time)) {
+	rlc.wg.Add(1)
+	go func() {
+		defer rlc.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-rlc.ctx.Done():
+				return
+			case now := <-ticker.C:
+				fn(now)
+			}
+		}
+	}()
+}
+
+// Allow 检查指定域名的请求是否允许通过，同时遵守配置的全局限流
 func (rlc *RateLimitController) Allow(ctx context.Context, domain string) error {
-	// 获取域名对应的限制器
-	limiter := rlc.getLimiter(domain)
+	return rlc.AllowKey(ctx, Key{Domain: domain})
+}
 
-	// 检查分布式限流
-	if err := rlc.checkDistributedLimit(ctx, domain); err != nil {
-		rlc.recordThrottle(domain)
-		return err
-	}
+// AllowKey 检查请求是否允许通过
+// 请求需要同时从涉及的所有作用域（全局、域名、代理、账号）各取一个令牌，任一作用域令牌不足时都不扣除。
+// 本地令牌取到后才检查分布式限流，本地拒绝的请求不占用分布式限额；分布式限流拒绝或出错时归还本地令牌
+func (rlc *RateLimitController) AllowKey(ctx context.Context, key Key) error {
+	limiters := rlc.limitersFor(key)
 
 	// 检查本地限流
-	if !limiter.allow() {
-		rlc.recordThrottle(domain)
-		return fmt.Errorf("请求被限流: %s", domain)
+	if !acquire(limiters, time.Now()) {
+		rlc.recordThrottle(key.Domain)
+		return fmt.Errorf("%w: %s", ErrThrottled, key)
+	}
+
+	// 检查分布式限流
+	if key.Domain != "" {
+		if _, err := rlc.checkDistributedLimit(ctx, key.Domain); err != nil {
+			release(limiters)
+			rlc.recordThrottle(key.Domain)
+			return err
+		}
 	}
 
 	// 记录请求
-	rlc.recordRequest(domain)
+	rlc.recordRequest(key.Domain)
 	return nil
 }
 
-// SetRate 设置指定域名的请求速率
+// SetRate 设置指定域名的请求速率和突发数
+// 已有的限制器原地修改，保留当前令牌（不超过新的突发数）、暂停和降速冷却；新的速率会被保存，重启后恢复。
+// 配置文件重新加载时，如果该域名的配置发生变化，以配置文件为准
 func (rlc *RateLimitController) SetRate(domain string, rate float64, burst int) {
 	rlc.mu.Lock()
 	defer rlc.mu.Unlock()
 
-	limiter := &Limiter{
-		rate:       rate,
-		burst:      burst,
-		tokens:     float64(burst),
-		lastUpdate: time.Now(),
+	limit := Limit{Rate: rate, Burst: burst}
+	if limiter, exists := rlc.limiters[domain]; exists {
+		limiter.setLimit(limit)
+		return
 	}
+	limiter := newLimiter(limit)
+	limiter.factor = rlc.factor
+	limiter.feedback.dirty = true
 	rlc.limiters[domain] = limiter
 }
 
+// ResetRate 删除指定域名的限制器和保存的速率，下一个请求按配置重新创建
+func (rlc *RateLimitController) ResetRate(domain string) error {
+	rlc.mu.Lock()
+	defer rlc.mu.Unlock()
+
+	// 先删除保存的速率，否则下一个请求会从保存的速率恢复
+	if rlc.redisClient != nil {
+		if err := rlc.redisClient.Client().HDel(rlc.redisClient.Context(), rlc.ratesKey(), domain).Err(); err != nil {
+			return fmt.Errorf("删除 %s 保存的速率失败: %w", domain, err)
+		}
+	}
+	delete(rlc.limiters, domain)
+	return nil
+}
+
+// newLimiter 创建令牌桶已满的限制器
+func newLimiter(limit Limit) *Limiter {
+	return &Limiter{
+		rate:       limit.Rate,
+		burst:      limit.Burst,
+		tokens:     float64(limit.Burst),
+		lastUpdate: time.Now(),
+	}
+}
+
 // getLimiter 获取或创建限制器
 func (rlc *RateLimitController) getLimiter(domain string) *Limiter {
 	rlc.mu.RLock()
@@ -105,15 +212,19 @@ func (rlc *RateLimitController) getLimiter(domain string) *Limiter {
 	rlc.mu.RUnlock()
 
 	if !exists {
+		// 从上次运行保存的速率开始，避免重启后以全速请求
+		rate, restored := rlc.loadRate(domain)
+
 		rlc.mu.Lock()
 		// 双重检查
 		if limiter, exists = rlc.limiters[domain]; !exists {
-			limiter = &Limiter{
-				rate:       rlc.config.DefaultRate,
-				burst:      rlc.config.DefaultBurst,
-				tokens:     float64(rlc.config.DefaultBurst),
-				lastUpdate: time.Now(),
+			limit := rlc.domainLimit(domain)
+			if restored {
+				// 保存后配置可能已经调低，恢复的速率不超过当前上限
+				limit.Rate = min(rate, rlc.rateCeiling(domain))
 			}
+			limiter = newLimiter(limit)
+			limiter.factor = rlc.factor
 			rlc.limiters[domain] = limiter
 		}
 		rlc.mu.Unlock()
@@ -122,91 +233,44 @@ func (rlc *RateLimitController) getLimiter(domain string) *Limiter {
 	return limiter
 }
 
-// allow 令牌桶算法实现
-func (l *Limiter) allow() bool {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-
-	now := time.Now()
-	elapsed := now.Sub(l.lastUpdate).Seconds()
-	l.tokens = min(float64(l.burst), l.tokens+elapsed*l.rate)
-	l.lastUpdate = now
-
-	if l.tokens >= 1 {
-		l.tokens--
-		return true
-	}
-	return false
+// domainLimit 返回域名配置的令牌桶参数
+// 调用方需持有rlc.mu
+func (rlc *RateLimitController) domainLimit(domain string) Limit {
+	return rlc.config.Scopes[ScopeDomain].limit(domain, Limit{Rate: rlc.config.DefaultRate, Burst: rlc.config.DefaultBurst})
 }
 
-// checkDistributedLimit 检查分布式限流
-func (rlc *RateLimitController) checkDistributedLimit(ctx context.Context, domain string) error {
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	default:
-		key := fmt.Sprintf("%s:%s:requests", rlc.config.RedisKeyPrefix, domain)
-
-		// 使用Redis实现滑动窗口
-		now := time.Now().Unix()
-		windowStart := now - int64(rlc.config.WindowSize.Seconds())
-
-		// 清理过期的请求记录
-		err := rlc.redisClient.ZRemRangeByScore(key, 0, float64(windowStart))
-		if err != nil {
-			return err
-		}
-
-		// 添加当前请求记录
-		err = rlc.redisClient.ZAdd(key, float64(now), fmt.Sprintf("%d", now))
-		if err != nil {
-			return err
-		}
-
-		// 获取当前窗口的请求数
-		count, err := rlc.redisClient.ZCount(key, float64(windowStart), float64(now))
-		if err != nil {
-			return err
-		}
+// acquire 从所有限制器中各取一个令牌，任一限制器令牌不足或处于暂停时都不扣除
+// 限制器按limitersFor给出的固定顺序加锁，多个请求同时获取时不会死锁
+func acquire(limiters []*Limiter, now time.Time) bool {
+	for _, l := range limiters {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+	}
 
-		// 检查是否超过限制
-		if count > rlc.config.WindowLimit {
-			return fmt.Errorf("分布式限流: %s 超过窗口限制", domain)
+	for _, l := range limiters {
+		l.refill(now)
+		if now.Before(l.pausedUntil) || l.tokens < 1 {
+			return false
 		}
 	}
-
-	return nil
+	for _, l := range limiters {
+		l.tokens--
+	}
+	return true
 }
 
-// startAdaptiveAdjustment 启动自适应调节
-func (rlc *RateLimitController) startAdaptiveAdjustment() {
-	ticker := time.NewTicker(rlc.config.AdjustInterval)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		rlc.mu.Lock()
-		for domain, limiter := range rlc.limiters {
-			stats := rlc.metrics.DomainStats[domain]
-			if stats == nil {
-				continue
-			}
-
-			// 根据成功率调整速率
-			throttleRate := float64(stats.Throttled) / float64(stats.Requests)
-			if throttleRate > rlc.config.ThrottleThreshold {
-				// 降低速率
-				limiter.rate = max(limiter.rate*0.8, rlc.config.MinRate)
-			} else if throttleRate < rlc.config.ThrottleThreshold/2 {
-				// 提高速率
-				limiter.rate = min(limiter.rate*1.2, rlc.config.MaxRate)
-			}
-		}
-		rlc.mu.Unlock()
+// release 向所有限制器各归还一个令牌
+func release(limiters []*Limiter) {
+	for _, l := range limiters {
+		l.cancel()
 	}
 }
 
 // recordRequest 记录请求
 func (rlc *RateLimitController) recordRequest(domain string) {
+	if domain == "" {
+		return
+	}
 	rlc.metrics.mu.Lock()
 	defer rlc.metrics.mu.Unlock()
 
@@ -225,6 +289,9 @@ func (rlc *RateLimitController) recordRequest(domain string) {
 
 // recordThrottle 记录被限流的请求
 func (rlc *RateLimitController) recordThrottle(domain string) {
+	if domain == "" {
+		return
+	}
 	rlc.metrics.mu.Lock()
 	defer rlc.metrics.mu.Unlock()
 
@@ -235,11 +302,23 @@ func (rlc *RateLimitController) recordThrottle(domain string) {
 	}
 }
 
-// GetMetrics 获取限流指标
+// GetMetrics 获取限流指标的副本
 func (rlc *RateLimitController) GetMetrics() *RateLimitMetrics {
 	rlc.metrics.mu.Lock()
 	defer rlc.metrics.mu.Unlock()
-	return rlc.metrics
+
+	m := &RateLimitMetrics{
+		TotalRequests:     rlc.metrics.TotalRequests,
+		ThrottledRequests: rlc.metrics.ThrottledRequests,
+		Profile:           rlc.metrics.Profile,
+		RateFactor:        rlc.metrics.RateFactor,
+		DomainStats:       make(map[string]*DomainStat, len(rlc.metrics.DomainStats)),
+	}
+	for domain, stats := range rlc.metrics.DomainStats {
+		copied := *stats
+		m.DomainStats[domain] = &copied
+	}
+	return m
 }
 
 // min 返回两个float64中的较小值
@@ -258,20 +337,15 @@ func max(a, b float64) float64 {
 	return b
 }
 
-// startMetricsCollector 启动指标收集器
-func (rlc *RateLimitController) startMetricsCollector() {
-	ticker := time.NewTicker(rlc.config.AdjustInterval)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		rlc.metrics.mu.Lock()
-		// 更新各域名的平均请求率
-		for _, stats := range rlc.metrics.DomainStats {
-			elapsed := time.Since(stats.LastUpdate).Seconds()
-			if elapsed > 0 {
-				stats.AverageRate = float64(stats.Requests) / elapsed
-			}
+// updateAverageRates 更新各域名的平均请求率
+func (rlc *RateLimitController) updateAverageRates(now time.Time) {
+	rlc.metrics.mu.Lock()
+	defer rlc.metrics.mu.Unlock()
+
+	for _, stats := range rlc.metrics.DomainStats {
+		elapsed := now.Sub(stats.LastUpdate).Seconds()
+		if elapsed > 0 {
+			stats.AverageRate = float64(stats.Requests) / elapsed
 		}
-		rlc.metrics.mu.Unlock()
 	}
 }
@@ -0,0 +1,125 @@
+package ratelimit
+
+import (
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// Reload 重新加载LimitsFile和ScheduleFile
+// 配置变化的域名、代理、账号限制器立即使用新的速率和突发数（包括SetRate设置过的域名），
+// 配置未变化的限制器保留自适应调节后的速率。任一文件加载失败时保持原配置
+func (rlc *RateLimitController) Reload() error {
+	rlc.reloadMu.Lock()
+	defer rlc.reloadMu.Unlock()
+
+	scopes, schedule := rlc.limits()
+	files := make(map[string]time.Time)
+	if path := rlc.config.LimitsFile; path != "" {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if scopes, err = LoadScopes(path); err != nil {
+			return err
+		}
+		files[path] = info.ModTime()
+	}
+	if path := rlc.config.ScheduleFile; path != "" {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if schedule, err = LoadSchedule(path); err != nil {
+			return err
+		}
+		files[path] = info.ModTime()
+	}
+
+	rlc.setLimits(scopes, schedule)
+	rlc.files = files
+	rlc.applySchedule(time.Now())
+	return nil
+}
+
+// reloadIfChanged 配置文件修改后重新加载
+// 加载失败时记录日志，文件再次修改前不再重试
+func (rlc *RateLimitController) reloadIfChanged(time.Time) {
+	changed := false
+	modified := make(map[string]time.Time)
+	rlc.reloadMu.Lock()
+	for _, path := range []string{rlc.config.LimitsFile, rlc.config.ScheduleFile} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		modified[path] = info.ModTime()
+		if !info.ModTime().Equal(rlc.files[path]) {
+			changed = true
+		}
+	}
+	rlc.reloadMu.Unlock()
+	if !changed {
+		return
+	}
+
+	if err := rlc.Reload(); err != nil {
+		log.Printf("重新加载限流配置失败: %v", err)
+		rlc.reloadMu.Lock()
+		rlc.files = modified
+		rlc.reloadMu.Unlock()
+		return
+	}
+	log.Printf("已重新加载限流配置")
+}
+
+// limits 返回当前的作用域配置和时间表
+func (rlc *RateLimitController) limits() (Scopes, *Schedule) {
+	rlc.mu.RLock()
+	defer rlc.mu.RUnlock()
+	return rlc.config.Scopes, rlc.config.Schedule
+}
+
+// setLimits 替换作用域配置和时间表，并更新配置发生变化的限制器
+func (rlc *RateLimitController) setLimits(scopes Scopes, schedule *Schedule) {
+	rlc.mu.Lock()
+	defer rlc.mu.Unlock()
+
+	old := rlc.config.Scopes
+	rlc.config.Scopes = scopes
+	rlc.config.Schedule = schedule
+
+	fallback := Limit{Rate: rlc.config.DefaultRate, Burst: rlc.config.DefaultBurst}
+	for domain, l := range rlc.limiters {
+		if limit := scopes[ScopeDomain].limit(domain, fallback); limit != old[ScopeDomain].limit(domain, fallback) {
+			l.setLimit(limit)
+		}
+	}
+	for id, l := range rlc.scoped {
+		scope, name, _ := strings.Cut(id, ":")
+		limit := scopes[Scope(scope)].limit(name, Limit{})
+		switch {
+		case limit.Rate <= 0:
+			// 不再限流的名称
+			delete(rlc.scoped, id)
+		case limit != old[Scope(scope)].limit(name, Limit{}):
+			l.setLimit(limit)
+		}
+	}
+}
+
+// setLimit 修改速率和突发数，保留当前令牌（不超过新的突发数）
+func (l *Limiter) setLimit(limit Limit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill(time.Now())
+	l.rate = limit.Rate
+	l.burst = limit.Burst
+	l.tokens = min(l.tokens, float64(limit.Burst))
+	l.feedback.dirty = true
+}
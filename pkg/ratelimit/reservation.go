@@ -0,0 +1,234 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Reservation 预约的令牌
+// 预约时令牌已从令牌桶中扣除，调用方应等待Delay()后再发出请求；不再需要时调用Cancel归还令牌
+type Reservation struct {
+	limiters  []*Limiter // 预约令牌的限制器
+	ok        bool       // 是否预约成功
+	timeToAct time.Time  // 令牌可用的时间
+	cancelled bool       // 是否已归还
+}
+
+// OK 返回是否预约成功
+// 速率为0且没有剩余令牌时永远不会有新令牌，预约失败
+func (r *Reservation) OK() bool {
+	return r.ok
+}
+
+// Delay 返回距离令牌可用还需等待的时间，0表示可以立即发出请求
+func (r *Reservation) Delay() time.Duration {
+	if !r.ok {
+		return 0
+	}
+	if d := time.Until(r.timeToAct); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// Cancel 归还尚未使用的令牌
+// 令牌可用时间已过的预约视为已使用，不再归还
+func (r *Reservation) Cancel() {
+	if !r.ok || !time.Now().Before(r.timeToAct) {
+		return
+	}
+	r.refund()
+}
+
+// refund 无条件归还令牌，用于令牌已经可用但请求最终没有发出的情况（例如被分布式限流拒绝）
+func (r *Reservation) refund() {
+	if !r.ok || r.cancelled {
+		return
+	}
+	r.cancelled = true
+	release(r.limiters)
+}
+
+// Reserve 为指定域名预约一个本地令牌，返回的预约记录了距离令牌可用的等待时间
+// 与Allow不同，令牌不足时不会失败，而是把令牌借到未来，调用方据此精确控制请求节奏。
+// Reserve只做本地限流，需要同时遵守分布式限流时使用Wait
+func (rlc *RateLimitController) Reserve(domain string) *Reservation {
+	return rlc.ReserveKey(Key{Domain: domain})
+}
+
+// ReserveKey 从请求涉及的所有作用域各预约一个本地令牌，等待时间取各作用域中最长的
+func (rlc *RateLimitController) ReserveKey(key Key) *Reservation {
+	r := reserve(rlc.limitersFor(key), time.Now())
+	if r.ok {
+		rlc.recordRequest(key.Domain)
+	} else {
+		rlc.recordThrottle(key.Domain)
+	}
+	return r
+}
+
+// TryAcquire 尝试立即取得指定域名请求的令牌，同时遵守本地和分布式限流
+func (rlc *RateLimitController) TryAcquire(ctx context.Context, domain string) (time.Duration, error) {
+	return rlc.TryAcquireKey(ctx, Key{Domain: domain})
+}
+
+// TryAcquireKey 尝试立即取得请求的令牌，不能立即放行时不占用令牌，并返回需要等待的时间
+// 与Allow不同，被限流时给出距离令牌可用的时间，调度器据此安排下次尝试；只有放行的请求计入请求数
+//
+// 返回:
+//   - time.Duration: 被限流时需要等待的时间，速率为0时为0
+//   - error: 被限流时返回ErrThrottled，ctx结束或Redis出错时返回对应错误
+func (rlc *RateLimitController) TryAcquireKey(ctx context.Context, key Key) (time.Duration, error) {
+	r := reserve(rlc.limitersFor(key), time.Now())
+	if !r.ok {
+		rlc.recordThrottle(key.Domain)
+		return 0, fmt.Errorf("%w: %s 的速率为0", ErrThrottled, key)
+	}
+	if d := r.Delay(); d > 0 {
+		r.refund()
+		rlc.recordThrottle(key.Domain)
+		return d, fmt.Errorf("%w: %s 需要等待 %s", ErrThrottled, key, d.Round(time.Millisecond))
+	}
+
+	if key.Domain != "" {
+		if retryAfter, err := rlc.checkDistributedLimit(ctx, key.Domain); err != nil {
+			r.refund()
+			rlc.recordThrottle(key.Domain)
+			return retryAfter, err
+		}
+	}
+	rlc.recordRequest(key.Domain)
+	return 0, nil
+}
+
+// Wait 阻塞直到指定域名的请求允许通过，或ctx结束
+func (rlc *RateLimitController) Wait(ctx context.Context, domain string) error {
+	return rlc.WaitKey(ctx, Key{Domain: domain})
+}
+
+// WaitKey 阻塞直到请求允许通过，或ctx结束
+// 先等待所有作用域的本地令牌，再检查域名的分布式限流；分布式限流拒绝或出错时归还本地令牌，
+// 被拒绝时按其给出的等待时间等待后重试。
+// ctx的截止时间早于令牌可用时间时立即返回错误，不占用令牌
+//
+// 返回:
+//   - error: ctx结束、预约失败或Redis出错时返回错误
+func (rlc *RateLimitController) WaitKey(ctx context.Context, key Key) error {
+	limiters := rlc.limitersFor(key)
+	for {
+		r := reserve(limiters, time.Now())
+		if !r.ok {
+			rlc.recordThrottle(key.Domain)
+			return fmt.Errorf("%w: %s 的速率为0", ErrThrottled, key)
+		}
+		if deadline, ok := ctx.Deadline(); ok && deadline.Before(r.timeToAct) {
+			r.Cancel()
+			return fmt.Errorf("%w: %s 需要等待 %s，超过截止时间", ErrThrottled, key, r.Delay().Round(time.Millisecond))
+		}
+		if err := sleepContext(ctx, r.Delay()); err != nil {
+			r.Cancel()
+			return err
+		}
+		if key.Domain == "" {
+			return nil
+		}
+
+		retryAfter, err := rlc.checkDistributedLimit(ctx, key.Domain)
+		if err == nil {
+			rlc.recordRequest(key.Domain)
+			return nil
+		}
+		// 请求没有发出，令牌可用时间已过，Cancel不会再归还
+		r.refund()
+		if !errors.Is(err, ErrThrottled) {
+			return err
+		}
+		rlc.recordThrottle(key.Domain)
+		if err := sleepContext(ctx, retryAfter); err != nil {
+			return err
+		}
+	}
+}
+
+// reserve 从令牌桶中扣除一个令牌，令牌不足时借用未来的令牌
+func (l *Limiter) reserve(now time.Time) *Reservation {
+	return reserve([]*Limiter{l}, now)
+}
+
+// reserve 从所有限制器中各预约一个令牌，任一限制器永远不会有新令牌时都不扣除
+// 加锁顺序与acquire相同
+func reserve(limiters []*Limiter, now time.Time) *Reservation {
+	for _, l := range limiters {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+	}
+
+	for _, l := range limiters {
+		l.refill(now)
+		if l.tokens < 1 && l.effectiveRate() <= 0 {
+			return &Reservation{limiters: limiters}
+		}
+	}
+
+	r := &Reservation{limiters: limiters, ok: true, timeToAct: now}
+	for _, l := range limiters {
+		if t := l.take(now); t.After(r.timeToAct) {
+			r.timeToAct = t
+		}
+	}
+	return r
+}
+
+// take 扣除一个令牌，返回令牌可用的时间
+// 调用方需持有l.mu
+func (l *Limiter) take(now time.Time) time.Time {
+	// 暂停期间令牌从暂停结束时开始计算
+	start := now
+	if l.pausedUntil.After(now) {
+		start = l.pausedUntil
+	}
+	l.tokens--
+	if l.tokens >= 0 {
+		return start
+	}
+	return start.Add(time.Duration(-l.tokens / l.effectiveRate() * float64(time.Second)))
+}
+
+// cancel 归还一个令牌
+func (l *Limiter) cancel() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill(time.Now())
+	l.tokens = min(float64(l.burst), l.tokens+1)
+}
+
+// refill 按经过的时间补充令牌
+// 暂停期间lastUpdate在未来，不会补充令牌
+func (l *Limiter) refill(now time.Time) {
+	if elapsed := now.Sub(l.lastUpdate).Seconds(); elapsed > 0 {
+		l.tokens = min(float64(l.burst), l.tokens+elapsed*l.effectiveRate())
+		l.lastUpdate = now
+	}
+}
+
+// effectiveRate 返回按时间表调整后的速率
+func (l *Limiter) effectiveRate() float64 {
+	return l.rate * l.factor.get()
+}
+
+// sleepContext 等待d或ctx结束
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,115 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// newLocalController 创建只做本地限流的控制器
+func newLocalController(rate float64, burst int) *RateLimitController {
+	return NewRateLimitController(nil, Config{
+		DefaultRate:    rate,
+		DefaultBurst:   burst,
+		AdjustInterval: time.Hour,
+	})
+}
+
+// 测试令牌不足时预约把令牌借到未来，取消后归还
+func TestReserveDelay(t *testing.T) {
+	l := &Limiter{rate: 10, burst: 2, tokens: 2, lastUpdate: time.Now()}
+	now := l.lastUpdate
+
+	for i := 0; i < 2; i++ {
+		if r := l.reserve(now); !r.ok || !r.timeToAct.Equal(now) {
+			t.Fatalf("第%d次预约应立即可用", i+1)
+		}
+	}
+	r := l.reserve(now)
+	if got := r.timeToAct.Sub(now); got != 100*time.Millisecond {
+		t.Fatalf("第3次预约等待 %s，期望 100ms", got)
+	}
+	if got := l.reserve(now).timeToAct.Sub(now); got != 200*time.Millisecond {
+		t.Fatalf("第4次预约等待 %s，期望 200ms", got)
+	}
+
+	r.Cancel()
+	if l.tokens < -1.01 || l.tokens > -0.99 {
+		t.Errorf("取消后令牌数 = %v，期望约 -1", l.tokens)
+	}
+
+	zero := &Limiter{rate: 0, burst: 1, tokens: 0, lastUpdate: now}
+	if zero.reserve(now).OK() {
+		t.Error("速率为0且没有令牌时预约应失败")
+	}
+}
+
+// 测试Wait按速率放行请求，截止时间不够时立即返回
+func TestWait(t *testing.T) {
+	rlc := newLocalController(50, 1)
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := rlc.Wait(ctx, "example.com"); err != nil {
+			t.Fatalf("Wait() error = %v", err)
+		}
+	}
+	// 第一个请求立即放行，其余3个各等待20ms
+	if elapsed := time.Since(start); elapsed < 55*time.Millisecond {
+		t.Errorf("4个请求耗时 %s，期望至少 60ms", elapsed)
+	}
+
+	short, cancel := context.WithTimeout(ctx, 5*time.Millisecond)
+	defer cancel()
+	rlc.SetRate("slow.com", 1, 1)
+	if err := rlc.Wait(short, "slow.com"); err != nil {
+		t.Fatalf("第一个请求应立即放行: %v", err)
+	}
+	if err := rlc.Wait(short, "slow.com"); !errors.Is(err, ErrThrottled) {
+		t.Errorf("截止时间前等不到令牌时 error = %v，期望 ErrThrottled", err)
+	}
+	if d := rlc.Reserve("slow.com").Delay(); d < 900*time.Millisecond {
+		t.Errorf("超时返回的请求不应占用令牌，下一次预约等待 %s", d)
+	}
+}
+
+// 测试令牌可用后请求没有发出时refund仍然归还令牌，而Cancel视为已使用
+func TestReservationRefund(t *testing.T) {
+	l := &Limiter{rate: 0.001, burst: 1, tokens: 1, lastUpdate: time.Now()}
+
+	r := l.reserve(time.Now())
+	r.Cancel()
+	if l.tokens > 0.01 {
+		t.Fatalf("立即可用的预约Cancel后令牌数 = %v，期望不归还", l.tokens)
+	}
+
+	r.refund()
+	if l.tokens < 0.99 {
+		t.Errorf("refund后令牌数 = %v，期望约 1", l.tokens)
+	}
+	r.refund()
+	if l.tokens > 1.01 {
+		t.Errorf("重复refund不应多归还令牌: %v", l.tokens)
+	}
+}
+
+// 测试TryAcquire不能立即放行时不占用令牌，只有放行的请求计入请求数
+func TestTryAcquire(t *testing.T) {
+	rlc := newLocalController(10, 1)
+	ctx := context.Background()
+
+	if _, err := rlc.TryAcquire(ctx, "example.com"); err != nil {
+		t.Fatalf("第一个请求 error = %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		wait, err := rlc.TryAcquire(ctx, "example.com")
+		if !errors.Is(err, ErrThrottled) || wait <= 0 || wait > 100*time.Millisecond {
+			t.Fatalf("令牌不足时 TryAcquire() = %s, %v，期望等待不超过100ms", wait, err)
+		}
+	}
+	if stats := rlc.GetMetrics().DomainStats["example.com"]; stats.Requests != 1 || stats.Throttled != 3 {
+		t.Errorf("请求统计 = %+v，期望 1 个请求、3 个被限流", stats)
+	}
+}
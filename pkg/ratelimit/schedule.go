@@ -0,0 +1,256 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// 速率时间表的参数
+const (
+	scheduleUpdateInterval = 10 * time.Second // 重新计算速率倍数的间隔
+	transitionSamples      = 60               // 计算过渡期平均倍数的采样点数
+)
+
+// DefaultProfile 不在任何时间段内时的名称，速率倍数为1
+const DefaultProfile = "default"
+
+// Schedule 按时间段调整域名速率的时间表
+// 时间段内域名限制器的实际速率为 自适应调节后的速率 × Factor；
+// 切换时间段时，倍数在Transition内线性过渡到新值，避免请求速率突变
+type Schedule struct {
+	Location   *time.Location // 时间段所在的时区，为nil时使用本地时区
+	Transition time.Duration  // 过渡时长，为0时立即切换
+	Profiles   []Profile      // 时间段，按顺序匹配第一个
+}
+
+// Profile 一个时间段
+type Profile struct {
+	Name   string         // 名称，显示在指标中
+	Days   []time.Weekday // 开始于这些星期几，为空表示每天
+	Start  time.Duration  // 开始时间（距0点）
+	End    time.Duration  // 结束时间（距0点），不大于Start时跨过午夜，等于Start时持续24小时
+	Factor float64        // 速率倍数，必须大于0
+}
+
+// scheduleFile 时间表的YAML格式
+type scheduleFile struct {
+	TimeZone   string `yaml:"timezone"`
+	Transition string `yaml:"transition"`
+	Profiles   []struct {
+		Name   string   `yaml:"name"`
+		Days   []string `yaml:"days"`
+		Start  string   `yaml:"start"`
+		End    string   `yaml:"end"`
+		Factor float64  `yaml:"factor"`
+	} `yaml:"profiles"`
+}
+
+// weekdays YAML中星期几的写法
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ParseSchedule 解析YAML格式的时间表
+//
+//	timezone: Asia/Tokyo
+//	transition: 30m
+//	profiles:
+//	  - name: afternoon
+//	    days: [mon, tue, wed, thu, fri]
+//	    start: "13:00"
+//	    end: "18:00"
+//	    factor: 0.3
+func ParseSchedule(data []byte) (*Schedule, error) {
+	var file scheduleFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("解析速率时间表失败: %w", err)
+	}
+
+	s := &Schedule{}
+	if file.TimeZone != "" {
+		loc, err := time.LoadLocation(file.TimeZone)
+		if err != nil {
+			return nil, fmt.Errorf("时区 %s: %w", file.TimeZone, err)
+		}
+		s.Location = loc
+	}
+	if file.Transition != "" {
+		d, err := time.ParseDuration(file.Transition)
+		if err != nil {
+			return nil, fmt.Errorf("过渡时长 %s: %w", file.Transition, err)
+		}
+		s.Transition = d
+	}
+
+	for i, p := range file.Profiles {
+		profile := Profile{Name: p.Name, Factor: p.Factor}
+		if profile.Name == "" {
+			profile.Name = fmt.Sprintf("profile-%d", i+1)
+		}
+		for _, day := range p.Days {
+			key := strings.ToLower(day)
+			if len(key) > 3 {
+				key = key[:3]
+			}
+			wd, ok := weekdays[key]
+			if !ok {
+				return nil, fmt.Errorf("%s: 无法识别的星期: %s", profile.Name, day)
+			}
+			profile.Days = append(profile.Days, wd)
+		}
+		var err error
+		if profile.Start, err = parseClock(p.Start); err != nil {
+			return nil, fmt.Errorf("%s: %w", profile.Name, err)
+		}
+		if profile.End, err = parseClock(p.End); err != nil {
+			return nil, fmt.Errorf("%s: %w", profile.Name, err)
+		}
+		s.Profiles = append(s.Profiles, profile)
+	}
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// LoadSchedule 从YAML文件加载时间表
+func LoadSchedule(path string) (*Schedule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSchedule(data)
+}
+
+// parseClock 解析 HH:MM 格式的时间，返回距0点的时长
+func parseClock(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("无法识别的时间 %s，应为 HH:MM", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// validate 检查时间表
+func (s *Schedule) validate() error {
+	if s.Transition < 0 {
+		return fmt.Errorf("过渡时长不能为负数: %s", s.Transition)
+	}
+	for _, p := range s.Profiles {
+		if p.Factor <= 0 {
+			return fmt.Errorf("%s: 速率倍数必须大于0: %v", p.Name, p.Factor)
+		}
+		if p.Start < 0 || p.Start >= 24*time.Hour || p.End < 0 || p.End >= 24*time.Hour {
+			return fmt.Errorf("%s: 时间必须在 00:00 到 23:59 之间", p.Name)
+		}
+	}
+	return nil
+}
+
+// profileAt 返回t所在的时间段，不在任何时间段内时返回倍数为1的默认时间段
+func (s *Schedule) profileAt(t time.Time) (string, float64) {
+	loc := s.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	t = t.In(loc)
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	clock := t.Sub(midnight)
+
+	for _, p := range s.Profiles {
+		if p.Start < p.End {
+			if p.onDay(t.Weekday()) && clock >= p.Start && clock < p.End {
+				return p.Name, p.Factor
+			}
+			continue
+		}
+		// 跨过午夜：开始当天的Start之后，或前一天开始的时间段在End之前
+		if p.onDay(t.Weekday()) && clock >= p.Start {
+			return p.Name, p.Factor
+		}
+		if p.onDay((t.Weekday()+6)%7) && clock < p.End {
+			return p.Name, p.Factor
+		}
+	}
+	return DefaultProfile, 1
+}
+
+// onDay 返回时间段是否开始于星期day
+func (p Profile) onDay(day time.Weekday) bool {
+	if len(p.Days) == 0 {
+		return true
+	}
+	for _, d := range p.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// At 返回t时刻所在时间段的名称和生效的速率倍数
+// 倍数为过去Transition内各时刻倍数的平均值，因此时间段切换后在Transition内线性过渡
+func (s *Schedule) At(t time.Time) (string, float64) {
+	name, factor := s.profileAt(t)
+	if s.Transition <= 0 {
+		return name, factor
+	}
+
+	step := s.Transition / transitionSamples
+	sum := 0.0
+	for i := 0; i < transitionSamples; i++ {
+		_, f := s.profileAt(t.Add(-time.Duration(i) * step))
+		sum += f
+	}
+	return name, sum / transitionSamples
+}
+
+// rateFactor 当前生效的速率倍数，由所有域名限制器共享
+type rateFactor struct {
+	bits atomic.Uint64
+}
+
+// newRateFactor 创建倍数为1的速率倍数
+func newRateFactor() *rateFactor {
+	f := &rateFactor{}
+	f.set(1)
+	return f
+}
+
+// get 返回速率倍数，nil表示不受时间表影响
+func (f *rateFactor) get() float64 {
+	if f == nil {
+		return 1
+	}
+	return math.Float64frombits(f.bits.Load())
+}
+
+// set 设置速率倍数
+func (f *rateFactor) set(v float64) {
+	f.bits.Store(math.Float64bits(v))
+}
+
+// applySchedule 按t时刻的时间表更新速率倍数，并记录到指标中
+// 没有时间表时倍数为1
+func (rlc *RateLimitController) applySchedule(t time.Time) {
+	name, factor := DefaultProfile, 1.0
+	if _, schedule := rlc.limits(); schedule != nil {
+		name, factor = schedule.At(t)
+	}
+	rlc.factor.set(factor)
+
+	rlc.metrics.mu.Lock()
+	rlc.metrics.Profile = name
+	rlc.metrics.RateFactor = factor
+	rlc.metrics.mu.Unlock()
+}
@@ -0,0 +1,88 @@
+package ratelimit
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// 测试按日本时间匹配时间段，包括跨过午夜和星期限制
+func TestScheduleProfileAt(t *testing.T) {
+	s, err := LoadSchedule("../../config/ratelimit_schedule.yaml")
+	if err != nil {
+		t.Fatalf("LoadSchedule() error = %v", err)
+	}
+	jst := s.Location
+
+	tests := []struct {
+		at         time.Time
+		wantName   string
+		wantFactor float64
+	}{
+		{time.Date(2024, 1, 10, 14, 0, 0, 0, jst), "afternoon", 0.3}, // 星期三
+		{time.Date(2024, 1, 13, 14, 0, 0, 0, jst), "daytime", 0.6},   // 星期六
+		{time.Date(2024, 1, 10, 23, 30, 0, 0, jst), "night", 1},
+		{time.Date(2024, 1, 11, 7, 59, 0, 0, jst), "night", 1},
+		{time.Date(2024, 1, 10, 4, 0, 0, 0, time.UTC), "afternoon", 0.3}, // 日本时间13:00
+	}
+	for _, tt := range tests {
+		name, factor := s.profileAt(tt.at)
+		if name != tt.wantName || factor != tt.wantFactor {
+			t.Errorf("profileAt(%s) = %s %v，期望 %s %v", tt.at, name, factor, tt.wantName, tt.wantFactor)
+		}
+	}
+
+	for _, data := range []string{
+		"profiles:\n  - start: \"25:00\"\n    factor: 1\n",
+		"profiles:\n  - days: [someday]\n    factor: 1\n",
+		"profiles:\n  - start: \"13:00\"\n    factor: 0\n",
+		"timezone: Mars/Olympus\n",
+	} {
+		if _, err := ParseSchedule([]byte(data)); err == nil {
+			t.Errorf("ParseSchedule(%q) 应返回错误", data)
+		}
+	}
+}
+
+// 测试切换时间段时倍数在过渡时长内线性变化
+func TestScheduleTransition(t *testing.T) {
+	s := &Schedule{
+		Location:   time.UTC,
+		Transition: time.Hour,
+		Profiles:   []Profile{{Name: "slow", Start: 12 * time.Hour, End: 18 * time.Hour, Factor: 0.2}},
+	}
+	day := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		clock time.Duration
+		want  float64
+	}{
+		{11 * time.Hour, 1},
+		{12*time.Hour + 30*time.Minute, 0.6},
+		{13 * time.Hour, 0.2},
+		{18*time.Hour + 15*time.Minute, 0.4},
+	}
+	for _, tt := range tests {
+		if _, got := s.At(day.Add(tt.clock)); math.Abs(got-tt.want) > 0.02 {
+			t.Errorf("At(%s) = %v，期望约 %v", tt.clock, got, tt.want)
+		}
+	}
+}
+
+// 测试时间表的倍数作用于域名限制器，并显示在指标中
+func TestScheduleAppliesToLimiters(t *testing.T) {
+	rlc := NewRateLimitController(nil, Config{
+		DefaultRate:    10,
+		DefaultBurst:   1,
+		AdjustInterval: time.Hour,
+		Schedule:       &Schedule{Profiles: []Profile{{Name: "always", Factor: 0.5}}},
+	})
+
+	if m := rlc.GetMetrics(); m.Profile != "always" || m.RateFactor != 0.5 {
+		t.Errorf("指标中的时间段 = %s %v", m.Profile, m.RateFactor)
+	}
+	rlc.Reserve("example.com")
+	if d := rlc.Reserve("example.com").Delay(); d < 190*time.Millisecond || d > 200*time.Millisecond {
+		t.Errorf("速率减半后预约等待 %s，期望约 200ms", d)
+	}
+}
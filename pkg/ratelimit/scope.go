@@ -0,0 +1,232 @@
+package ratelimit
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// scopedIdleTimeout 代理、账号作用域的限制器超过该时间未使用时被删除
+const scopedIdleTimeout = 10 * time.Minute
+
+// Scope 限流作用域
+type Scope string
+
+// 限流作用域，一个请求按以下顺序从各作用域取令牌
+const (
+	ScopeGlobal  Scope = "global"  // 全局，所有请求共享一个令牌桶
+	ScopeDomain  Scope = "domain"  // 目标域名
+	ScopeProxy   Scope = "proxy"   // 出口代理（IP）
+	ScopeAccount Scope = "account" // 登录账号或会话
+)
+
+// scopeOrder 作用域的加锁顺序
+var scopeOrder = []Scope{ScopeGlobal, ScopeDomain, ScopeProxy, ScopeAccount}
+
+// Key 一次请求涉及的限流对象
+// 为空的字段不参与对应作用域的限流；代理和账号作用域只在配置后生效
+type Key struct {
+	Domain  string // 目标域名
+	Proxy   string // 出口代理地址
+	Account string // 登录账号或会话ID
+}
+
+// String 返回便于日志输出的描述
+func (k Key) String() string {
+	parts := make([]string, 0, 3)
+	if k.Domain != "" {
+		parts = append(parts, k.Domain)
+	}
+	if k.Proxy != "" {
+		parts = append(parts, "proxy="+k.Proxy)
+	}
+	if k.Account != "" {
+		parts = append(parts, "account="+k.Account)
+	}
+	return strings.Join(parts, " ")
+}
+
+// name 返回请求在指定作用域中的名称，空字符串表示不参与
+func (k Key) name(scope Scope) string {
+	switch scope {
+	case ScopeDomain:
+		return k.Domain
+	case ScopeProxy:
+		return k.Proxy
+	case ScopeAccount:
+		return k.Account
+	}
+	return ""
+}
+
+// Limit 令牌桶参数
+type Limit struct {
+	Rate  float64 `yaml:"rate"`  // 每秒请求数
+	Burst int     `yaml:"burst"` // 突发请求数
+}
+
+// ScopeConfig 单个作用域的限流配置
+// 作用域内每个名称（域名、代理、账号）各有一个令牌桶，默认使用Rate/Burst，Overrides中的名称使用单独的配置
+type ScopeConfig struct {
+	Limit     `yaml:",inline"`
+	Overrides map[string]Limit `yaml:"overrides"`
+}
+
+// Scopes 各作用域的限流配置，对应YAML:
+//
+//	global:
+//	  rate: 50
+//	  burst: 100
+//	domain:
+//	  rate: 2
+//	  burst: 5
+//	  overrides:
+//	    www.amazon.co.jp: {rate: 1, burst: 2}
+//	proxy:
+//	  rate: 1
+//	  burst: 3
+//	account:
+//	  rate: 0.5
+//	  burst: 1
+type Scopes map[Scope]ScopeConfig
+
+// limit 返回名称对应的令牌桶参数，作用域未配置时返回fallback
+func (c ScopeConfig) limit(name string, fallback Limit) Limit {
+	if l, ok := c.Overrides[name]; ok {
+		return l
+	}
+	if c.Rate > 0 {
+		return c.Limit
+	}
+	return fallback
+}
+
+// configured 返回作用域是否配置了限流
+func (s Scopes) configured(scope Scope) bool {
+	c, ok := s[scope]
+	return ok && (c.Rate > 0 || len(c.Overrides) > 0)
+}
+
+// ParseScopes 解析YAML格式的作用域限流配置
+func ParseScopes(data []byte) (Scopes, error) {
+	var scopes Scopes
+	if err := yaml.UnmarshalStrict(data, &scopes); err != nil {
+		return nil, fmt.Errorf("解析限流配置失败: %w", err)
+	}
+	for scope, c := range scopes {
+		if !isScope(scope) {
+			return nil, fmt.Errorf("未知的限流作用域: %s", scope)
+		}
+		if err := c.validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", scope, err)
+		}
+		for name, l := range c.Overrides {
+			if err := (ScopeConfig{Limit: l}).validate(); err != nil {
+				return nil, fmt.Errorf("%s.%s: %w", scope, name, err)
+			}
+		}
+	}
+	return scopes, nil
+}
+
+// LoadScopes 从YAML文件加载作用域限流配置
+func LoadScopes(path string) (Scopes, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseScopes(data)
+}
+
+// validate 检查令牌桶参数
+func (c ScopeConfig) validate() error {
+	if c.Rate < 0 {
+		return fmt.Errorf("速率不能为负数: %v", c.Rate)
+	}
+	if c.Rate > 0 && c.Burst < 1 {
+		return fmt.Errorf("突发请求数至少为1: %d", c.Burst)
+	}
+	return nil
+}
+
+// isScope 检查是否为已知的作用域
+func isScope(scope Scope) bool {
+	for _, s := range scopeOrder {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// limitersFor 返回请求涉及的限制器，按scopeOrder排列
+func (rlc *RateLimitController) limitersFor(key Key) []*Limiter {
+	scopes, _ := rlc.limits()
+	limiters := make([]*Limiter, 0, len(scopeOrder))
+	for _, scope := range scopeOrder {
+		switch {
+		case scope == ScopeDomain:
+			if key.Domain != "" {
+				limiters = append(limiters, rlc.getLimiter(key.Domain))
+			}
+		case !scopes.configured(scope):
+		case scope == ScopeGlobal || key.name(scope) != "":
+			if l := rlc.getScopeLimiter(scope, key.name(scope)); l != nil {
+				limiters = append(limiters, l)
+			}
+		}
+	}
+	return limiters
+}
+
+// getScopeLimiter 获取或创建全局、代理、账号作用域的限制器
+// 作用域只为部分名称配置了限制时，其他名称不限流，返回nil
+func (rlc *RateLimitController) getScopeLimiter(scope Scope, name string) *Limiter {
+	id := string(scope) + ":" + name
+
+	rlc.mu.RLock()
+	limiter, exists := rlc.scoped[id]
+	rlc.mu.RUnlock()
+	if exists {
+		return limiter
+	}
+
+	rlc.mu.Lock()
+	defer rlc.mu.Unlock()
+	if limiter, exists = rlc.scoped[id]; !exists {
+		limit := rlc.config.Scopes[scope].limit(name, Limit{})
+		if limit.Rate <= 0 {
+			return nil
+		}
+		limiter = newLimiter(limit)
+		rlc.scoped[id] = limiter
+	}
+	return limiter
+}
+
+// evictIdleScoped 删除超过idle未使用且令牌已满的代理、账号作用域限制器，返回删除的数量
+// 令牌已满且没有暂停的限制器与新建的没有区别，删除后再次使用时按配置重新创建；
+// 轮换代理和会话时这些限制器会不断增加，全局作用域只有一个，不删除
+func (rlc *RateLimitController) evictIdleScoped(now time.Time, idle time.Duration) int {
+	rlc.mu.Lock()
+	defer rlc.mu.Unlock()
+
+	evicted := 0
+	for id, l := range rlc.scoped {
+		if strings.HasPrefix(id, string(ScopeGlobal)+":") {
+			continue
+		}
+		l.mu.Lock()
+		elapsed := now.Sub(l.lastUpdate)
+		full := l.tokens+elapsed.Seconds()*l.effectiveRate() >= float64(l.burst)
+		if elapsed >= idle && full && !l.pausedUntil.After(now) {
+			delete(rlc.scoped, id)
+			evicted++
+		}
+		l.mu.Unlock()
+	}
+	return evicted
+}
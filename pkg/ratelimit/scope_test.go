@@ -0,0 +1,123 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// 测试解析示例配置文件和非法配置
+func TestLoadScopes(t *testing.T) {
+	scopes, err := LoadScopes("../../config/ratelimit.yaml")
+	if err != nil {
+		t.Fatalf("LoadScopes() error = %v", err)
+	}
+	if got := scopes[ScopeGlobal].Limit; got != (Limit{Rate: 50, Burst: 100}) {
+		t.Errorf("global = %+v", got)
+	}
+	if got := scopes[ScopeDomain].limit("www.amazon.co.jp", Limit{}); got != (Limit{Rate: 1, Burst: 2}) {
+		t.Errorf("amazon 域名限制 = %+v", got)
+	}
+	if got := scopes[ScopeDomain].limit("example.com", Limit{}); got != (Limit{Rate: 2, Burst: 5}) {
+		t.Errorf("默认域名限制 = %+v", got)
+	}
+
+	for _, data := range []string{
+		"ip:\n  rate: 1\n  burst: 1\n",
+		"proxy:\n  rate: -1\n",
+		"proxy:\n  rate: 1\n",
+		"proxy:\n  rate: 1\n  burst: 1\n  overrides:\n    a: {rate: 1}\n",
+		"proxy:\n  rate: 1\n  bust: 1\n",
+	} {
+		if _, err := ParseScopes([]byte(data)); err == nil {
+			t.Errorf("ParseScopes(%q) 应返回错误", data)
+		}
+	}
+}
+
+// 测试请求同时从多个作用域取令牌，任一作用域不足时不扣除其他作用域的令牌
+func TestAllowKeyScopes(t *testing.T) {
+	rlc := NewRateLimitController(nil, Config{
+		DefaultRate:    1,
+		DefaultBurst:   2,
+		AdjustInterval: time.Hour,
+		Scopes: Scopes{
+			ScopeProxy:   {Limit: Limit{Rate: 1, Burst: 1}},
+			ScopeAccount: {Limit: Limit{Rate: 1, Burst: 5}},
+		},
+	})
+	ctx := context.Background()
+
+	if err := rlc.AllowKey(ctx, Key{Domain: "example.com", Proxy: "p1", Account: "a1"}); err != nil {
+		t.Fatalf("第一个请求 error = %v", err)
+	}
+	// 代理p1的令牌用完，域名和账号的令牌不应被扣除
+	if err := rlc.AllowKey(ctx, Key{Domain: "example.com", Proxy: "p1", Account: "a1"}); !errors.Is(err, ErrThrottled) {
+		t.Fatalf("代理令牌用完时 error = %v，期望 ErrThrottled", err)
+	}
+	if err := rlc.AllowKey(ctx, Key{Domain: "example.com", Proxy: "p2", Account: "a1"}); err != nil {
+		t.Fatalf("换代理后 error = %v", err)
+	}
+	// 域名的2个令牌都已用完
+	if err := rlc.AllowKey(ctx, Key{Domain: "example.com", Proxy: "p3"}); !errors.Is(err, ErrThrottled) {
+		t.Errorf("域名令牌用完时 error = %v，期望 ErrThrottled", err)
+	}
+	if got := rlc.getScopeLimiter(ScopeAccount, "a1").tokens; got < 2.9 || got > 3.1 {
+		t.Errorf("账号剩余令牌 = %v，期望约 3", got)
+	}
+
+	// 预约的等待时间取各作用域中最长的
+	r := rlc.ReserveKey(Key{Domain: "other.com", Proxy: "p1"})
+	if d := r.Delay(); d < 900*time.Millisecond {
+		t.Errorf("代理令牌不足时预约等待 %s，期望约 1s", d)
+	}
+	r.Cancel()
+	if got := rlc.getLimiter("other.com").tokens; got < 1.9 {
+		t.Errorf("取消预约后域名令牌 = %v，期望 2", got)
+	}
+}
+
+// 测试空闲且令牌已满的代理、账号限制器被删除，全局和仍在恢复令牌的限制器保留
+func TestEvictIdleScoped(t *testing.T) {
+	rlc := NewRateLimitController(nil, Config{
+		DefaultRate:    1,
+		DefaultBurst:   1,
+		AdjustInterval: time.Hour,
+		Scopes: Scopes{
+			ScopeGlobal:  {Limit: Limit{Rate: 100, Burst: 100}},
+			ScopeProxy:   {Limit: Limit{Rate: 1, Burst: 1}},
+			ScopeAccount: {Limit: Limit{Rate: 0.001, Burst: 1}},
+		},
+	})
+	ctx := context.Background()
+
+	if err := rlc.AllowKey(ctx, Key{Domain: "example.com", Proxy: "p1", Account: "a1"}); err != nil {
+		t.Fatalf("AllowKey() error = %v", err)
+	}
+	rlc.getScopeLimiter(ScopeProxy, "p2")
+
+	now := time.Now()
+	if n := rlc.evictIdleScoped(now, time.Minute); n != 0 {
+		t.Fatalf("未到空闲时间时删除了 %d 个限制器", n)
+	}
+
+	// 一分钟后p1、p2的令牌已满；a1每秒0.001个令牌，仍未恢复
+	later := now.Add(2 * time.Minute)
+	if n := rlc.evictIdleScoped(later, time.Minute); n != 2 {
+		t.Errorf("删除了 %d 个限制器，期望 2", n)
+	}
+	rlc.mu.RLock()
+	_, global := rlc.scoped["global:"]
+	_, account := rlc.scoped["account:a1"]
+	_, proxy := rlc.scoped["proxy:p1"]
+	rlc.mu.RUnlock()
+	if !global || !account || proxy {
+		t.Errorf("删除后 global/account/proxy = %v/%v/%v，期望 true/true/false", global, account, proxy)
+	}
+
+	// 删除后再次使用时重新创建
+	if err := rlc.AllowKey(ctx, Key{Domain: "other.com", Proxy: "p1"}); err != nil {
+		t.Errorf("重新创建后 AllowKey() error = %v", err)
+	}
+}
@@ -53,6 +53,17 @@ func NewRedisClient(cfg *Config) (*RedisClient, error) {
 	}, nil
 }
 
+// Client 获取Redis客户端实例
+// 用于执行封装之外的命令，例如事务和Lua脚本
+func (r *RedisClient) Client() *redis.Client {
+	return r.client
+}
+
+// Context 获取上下文
+func (r *RedisClient) Context() context.Context {
+	return r.ctx
+}
+
 // Close 关闭Redis连接
 func (r *RedisClient) Close() error {
 	return r.client.Close()
@@ -163,6 +174,29 @@ func (r *RedisClient) Get(key string) (string, error) {
 	return r.client.Get(r.ctx, key).Result()
 }
 
+// HSetAll 批量设置哈希表字段的值
+func (r *RedisClient) HSetAll(key string, values map[string]string) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	// 使用管道批量写入
+	pipe := r.client.Pipeline()
+	for field, value := range values {
+		pipe.HSet(r.ctx, key, field, value)
+	}
+
+	if _, err := pipe.Exec(r.ctx); err != nil {
+		return fmt.Errorf("批量写入Redis哈希表失败: %w", err)
+	}
+	return nil
+}
+
+// HGetAll 获取哈希表的所有字段和值
+func (r *RedisClient) HGetAll(key string) (map[string]string, error) {
+	return r.client.HGetAll(r.ctx, key).Result()
+}
+
 // HSet 设置哈希表字段的值
 func (c *RedisClient) HSet(key, field, value string) error {
 	ctx := context.Background()
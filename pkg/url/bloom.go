@@ -0,0 +1,84 @@
+package url
+
+import (
+	"context"
+	"math"
+	"sync"
+)
+
+// maxBloomBits 单个Bloom过滤器的最大位数，受Redis位图偏移量上限限制
+const maxBloomBits = 1<<32 - 1
+
+// bloomSize 按预计数量和误判率计算Bloom过滤器的位数m和哈希函数个数k
+func bloomSize(capacity int64, errorRate float64) (m uint64, k int) {
+	bits := math.Ceil(-float64(capacity) * math.Log(errorRate) / (math.Ln2 * math.Ln2))
+	m = uint64(math.Min(math.Max(bits, 64), maxBloomBits))
+	k = int(math.Max(1, math.Round(float64(m)/float64(capacity)*math.Ln2)))
+	return m, k
+}
+
+// MemoryBloom 本地内存Bloom过滤器
+// 大小在创建时按预计数量和误判率确定，超过预计数量后误判率上升；重启后内容丢失
+type MemoryBloom struct {
+	bits  []uint64
+	m     uint64
+	k     int
+	count int64
+	mu    sync.RWMutex
+}
+
+// NewMemoryBloom 创建本地内存Bloom过滤器
+// 1000万个URL、误判率0.001约占用17MB内存
+func NewMemoryBloom(capacity int64, errorRate float64) *MemoryBloom {
+	m, k := bloomSize(capacity, errorRate)
+	return &MemoryBloom{bits: make([]uint64, (m+63)/64), m: m, k: k}
+}
+
+// Add 记录URL，返回URL是否为新URL
+func (b *MemoryBloom) Add(ctx context.Context, url string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	h1, h2 := bloomHash(url)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	added := false
+	for i := 0; i < b.k; i++ {
+		pos := (h1 + uint64(i)*h2) % b.m
+		word, mask := pos/64, uint64(1)<<(pos%64)
+		if b.bits[word]&mask == 0 {
+			b.bits[word] |= mask
+			added = true
+		}
+	}
+	if added {
+		b.count++
+	}
+	return added, nil
+}
+
+// Contains 返回URL是否已记录
+func (b *MemoryBloom) Contains(ctx context.Context, url string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	h1, h2 := bloomHash(url)
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for i := 0; i < b.k; i++ {
+		pos := (h1 + uint64(i)*h2) % b.m
+		if b.bits[pos/64]&(1<<(pos%64)) == 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Count 返回已记录的URL数量（近似值，误判为已存在的URL不计入）
+func (b *MemoryBloom) Count() int64 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.count
+}
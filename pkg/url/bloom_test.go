@@ -0,0 +1,51 @@
+package url
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+// 测试Bloom过滤器的大小计算
+func TestBloomSize(t *testing.T) {
+	m, k := bloomSize(10_000_000, 0.001)
+	if mb := m / 8 / 1024 / 1024; mb < 16 || mb > 18 {
+		t.Errorf("1000万个URL的过滤器大小 = %dMB，期望约17MB", mb)
+	}
+	if k != 10 {
+		t.Errorf("哈希函数个数 = %d，期望 10", k)
+	}
+	if m, _ := bloomSize(1<<40, 0.001); m != maxBloomBits {
+		t.Errorf("超大容量的位数 = %d，应限制为 %d", m, uint64(maxBloomBits))
+	}
+}
+
+// 测试内存Bloom过滤器不漏判已添加的URL，误判率接近配置值
+func TestMemoryBloom(t *testing.T) {
+	ctx := context.Background()
+	const n = 20000
+	b := NewMemoryBloom(n, 0.01)
+
+	for i := 0; i < n; i++ {
+		url := fmt.Sprintf("https://www.amazon.co.jp/dp/B%08d", i)
+		if added, _ := b.Add(ctx, url); !added && i < 100 {
+			t.Errorf("前100个URL不应被误判为已存在: %s", url)
+		}
+		if added, _ := b.Add(ctx, url); added {
+			t.Fatalf("重复添加返回新URL: %s", url)
+		}
+	}
+
+	falsePositives := 0
+	for i := 0; i < n; i++ {
+		if ok, _ := b.Contains(ctx, fmt.Sprintf("https://www.amazon.co.jp/dp/C%08d", i)); ok {
+			falsePositives++
+		}
+	}
+	if rate := float64(falsePositives) / n; rate > 0.02 {
+		t.Errorf("误判率 = %.4f，期望约 0.01", rate)
+	}
+	if c := b.Count(); c < n*0.98 || c > n {
+		t.Errorf("Count() = %d", c)
+	}
+}
@@ -0,0 +1,329 @@
+package url
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// trackingParams 所有站点都删除的跟踪参数，以*结尾的为前缀匹配
+var trackingParams = []string{
+	"utm_*", "ref", "fbclid", "gclid", "yclid", "msclkid", "dclid", "mc_cid", "mc_eid", "_ga", "_gl", "spm",
+}
+
+// Rule 特定站点的规范化规则
+type Rule struct {
+	Domains     []string       // 适用的域名，同时匹配其子域名
+	StripParams []string       // 额外删除的参数，以*结尾的为前缀匹配
+	Rewrite     func(*url.URL) // 改写路径或参数，在通用规范化之前调用，主机名已转为小写
+}
+
+// matches 返回规则是否适用于主机名
+func (r Rule) matches(host string) bool {
+	for _, domain := range r.Domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// Canonicalizer URL规范化器，把指向同一内容的不同写法转换为同一个URL
+//   - scheme和主机名转为小写，国际化域名转为punycode，删除末尾的点和默认端口
+//   - 解析路径中的 . 和 .. 段，空路径改为 /
+//   - 百分号编码统一：非保留字符解码，其余编码使用大写十六进制
+//   - 删除跟踪参数，其余查询参数按名称和值排序
+//   - 删除片段（#之后的部分）
+//   - 按站点规则改写，例如亚马逊商品页统一为 /dp/<ASIN>
+type Canonicalizer struct {
+	rules []Rule
+	mu    sync.RWMutex
+}
+
+// NewCanonicalizer 创建带有内置站点规则的URL规范化器
+func NewCanonicalizer() *Canonicalizer {
+	return &Canonicalizer{rules: []Rule{amazonRule, tiktokRule}}
+}
+
+// AddRule 添加站点规则，后添加的规则先执行
+func (c *Canonicalizer) AddRule(rule Rule) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rules = append([]Rule{rule}, c.rules...)
+}
+
+// Canonicalize 返回URL的规范形式
+// 只接受带主机名的http/https URL
+func (c *Canonicalizer) Canonicalize(rawURL string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "", err
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("不支持的URL协议: %s", rawURL)
+	}
+	host, err := canonicalHost(u.Hostname())
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", rawURL, err)
+	}
+	if host == "" {
+		return "", fmt.Errorf("URL缺少主机名: %s", rawURL)
+	}
+	port := u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	u.Host = host
+	if strings.Contains(host, ":") {
+		u.Host = "[" + host + "]"
+	}
+	if port != "" {
+		u.Host += ":" + port
+	}
+
+	// 站点规则
+	strip := trackingParams
+	c.mu.RLock()
+	for _, rule := range c.rules {
+		if !rule.matches(host) {
+			continue
+		}
+		if rule.Rewrite != nil {
+			rule.Rewrite(u)
+		}
+		strip = append(strip[:len(strip):len(strip)], rule.StripParams...)
+	}
+	c.mu.RUnlock()
+
+	var b strings.Builder
+	b.WriteString(u.Scheme)
+	b.WriteString("://")
+	if u.User != nil {
+		b.WriteString(u.User.String())
+		b.WriteByte('@')
+	}
+	b.WriteString(u.Host)
+
+	path := removeDotSegments(normalizeEscapes(u.EscapedPath()))
+	if path == "" {
+		path = "/"
+	}
+	b.WriteString(path)
+
+	if query := canonicalQuery(u.RawQuery, strip); query != "" {
+		b.WriteByte('?')
+		b.WriteString(query)
+	}
+	return b.String(), nil
+}
+
+// labelDots 国际化域名中与"."等价的句点
+var labelDots = strings.NewReplacer("\u3002", ".", "\uff0e", ".", "\uff61", ".")
+
+// canonicalHost 主机名转为小写的ASCII形式
+// ASCII标签只转为小写，不做域名字符检查（允许my_host这样的主机名）；
+// 其余标签按UTS #46映射（全角字符、大小写等）后转为punycode；IPv6地址只转为小写
+func canonicalHost(host string) (string, error) {
+	if strings.Contains(host, ":") {
+		return strings.ToLower(host), nil
+	}
+
+	labels := strings.Split(labelDots.Replace(host), ".")
+	for i, label := range labels {
+		if isASCII(label) {
+			labels[i] = strings.ToLower(label)
+			continue
+		}
+		ascii, err := idna.Lookup.ToASCII(label)
+		if err != nil {
+			return "", err
+		}
+		labels[i] = ascii
+	}
+	return strings.TrimSuffix(strings.Join(labels, "."), "."), nil
+}
+
+// isASCII 判断字符串是否只包含ASCII字符
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// canonicalQuery 删除strip中的参数，其余参数统一编码后按名称和值排序
+func canonicalQuery(rawQuery string, strip []string) string {
+	type param struct{ key, value, raw string }
+	var params []param
+	for _, piece := range strings.Split(rawQuery, "&") {
+		if piece == "" {
+			continue
+		}
+		key, value, hasValue := strings.Cut(piece, "=")
+		key = unescapeQuery(key)
+		if key == "" || stripped(key, strip) {
+			continue
+		}
+		p := param{key: key, value: unescapeQuery(value), raw: url.QueryEscape(key)}
+		if hasValue {
+			p.raw += "=" + url.QueryEscape(p.value)
+		}
+		params = append(params, p)
+	}
+
+	sort.SliceStable(params, func(i, j int) bool {
+		if params[i].key != params[j].key {
+			return params[i].key < params[j].key
+		}
+		return params[i].value < params[j].value
+	})
+	pieces := make([]string, len(params))
+	for i, p := range params {
+		pieces[i] = p.raw
+	}
+	return strings.Join(pieces, "&")
+}
+
+// unescapeQuery 解码查询参数，编码不合法时按原样保留
+func unescapeQuery(s string) string {
+	if v, err := url.QueryUnescape(s); err == nil {
+		return v
+	}
+	return s
+}
+
+// stripped 返回参数是否在删除列表中
+func stripped(key string, strip []string) bool {
+	key = strings.ToLower(key)
+	for _, name := range strip {
+		if prefix, ok := strings.CutSuffix(name, "*"); ok {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		} else if key == name {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeEscapes 统一百分号编码：非保留字符（字母、数字、-._~）解码，其余编码转为大写十六进制
+func normalizeEscapes(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]) {
+			c := unhex(s[i+1])<<4 | unhex(s[i+2])
+			if isUnreserved(c) {
+				b.WriteByte(c)
+			} else {
+				b.WriteByte('%')
+				b.WriteString(strings.ToUpper(s[i+1 : i+3]))
+			}
+			i += 2
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// removeDotSegments 按RFC 3986 5.2.4解析路径中的 . 和 .. 段
+func removeDotSegments(path string) string {
+	if !strings.Contains(path, ".") || !strings.HasPrefix(path, "/") {
+		return path
+	}
+	in := strings.Split(path, "/")[1:]
+	out := make([]string, 0, len(in))
+	for i, seg := range in {
+		last := i == len(in)-1
+		switch seg {
+		case ".":
+		case "..":
+			if len(out) > 0 {
+				out = out[:len(out)-1]
+			}
+		default:
+			out = append(out, seg)
+			continue
+		}
+		// 以 . 或 .. 结尾的路径指向目录
+		if last {
+			out = append(out, "")
+		}
+	}
+	return "/" + strings.Join(out, "/")
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+// amazonDomains 亚马逊各站点
+var amazonDomains = []string{
+	"amazon.co.jp", "amazon.com", "amazon.co.uk", "amazon.de", "amazon.fr", "amazon.it", "amazon.es",
+	"amazon.ca", "amazon.com.au", "amazon.com.mx", "amazon.com.br", "amazon.in", "amazon.nl", "amazon.sg",
+}
+
+// amazonProductPath 亚马逊商品页的各种路径写法
+var amazonProductPath = regexp.MustCompile(`(?i)/(?:dp|gp/product|gp/aw/d|dp/product|exec/obidos/asin|o/asin)/([A-Z0-9]{10})(?:/|$)`)
+
+// amazonRefSegment 亚马逊路径末尾的 /ref=xxx 跟踪段
+var amazonRefSegment = regexp.MustCompile(`/ref=[^/]*$`)
+
+// amazonRule 亚马逊：商品页统一为 /dp/<ASIN> 并删除全部参数，其他页面删除 /ref= 段和跟踪参数
+var amazonRule = Rule{
+	Domains: amazonDomains,
+	StripParams: []string{
+		"ref_", "pd_rd_*", "pf_rd_*", "qid", "sr", "sprefix", "crid", "dib", "dib_tag", "content-id",
+		"psc", "th", "_encoding", "linkcode", "linkid", "tag", "camp", "creative", "creativeasin", "ascsubtag",
+		"smid", "spla", "sbo", "dchild",
+	},
+	Rewrite: func(u *url.URL) {
+		if m := amazonProductPath.FindStringSubmatch(u.Path); m != nil {
+			u.Path, u.RawPath, u.RawQuery = "/dp/"+strings.ToUpper(m[1]), "", ""
+			return
+		}
+		if loc := amazonRefSegment.FindStringIndex(u.Path); loc != nil {
+			u.Path, u.RawPath = u.Path[:loc[0]], ""
+			if u.Path == "" {
+				u.Path = "/"
+			}
+		}
+	},
+}
+
+// tiktokRule TikTok：删除分享链接带的来源参数
+var tiktokRule = Rule{
+	Domains: []string{"tiktok.com"},
+	StripParams: []string{
+		"is_from_webapp", "sender_device", "sender_web_id", "is_copy_url", "_r", "_t", "_d", "u_code",
+		"share_app_id", "share_item_id", "share_link_id", "social_sharing", "source", "web_id", "lang",
+	},
+}
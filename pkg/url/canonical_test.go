@@ -0,0 +1,73 @@
+package url
+
+import "testing"
+
+func TestCanonicalize(t *testing.T) {
+	c := NewCanonicalizer()
+	tests := []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{"空路径", "https://example.com", "https://example.com/"},
+		{"主机名小写", "HTTPS://Example.COM./Path", "https://example.com/Path"},
+		{"默认端口", "http://example.com:80/a", "http://example.com/a"},
+		{"非默认端口", "https://example.com:8443/a", "https://example.com:8443/a"},
+		{"片段", "https://example.com/a#reviews", "https://example.com/a"},
+		{"点段", "https://example.com/a/./b/../c/", "https://example.com/a/c/"},
+		{"以点段结尾", "https://example.com/a/b/..", "https://example.com/a/"},
+		{"双斜杠保留", "https://example.com/a//b", "https://example.com/a//b"},
+		{"百分号编码", "https://example.com/%7euser/%e3%81%82%2f", "https://example.com/~user/%E3%81%82%2F"},
+		{"非ASCII路径", "https://example.com/検索", "https://example.com/%E6%A4%9C%E7%B4%A2"},
+		{"参数排序", "https://example.com/s?b=2&a=1&a=0", "https://example.com/s?a=0&a=1&b=2"},
+		{"参数编码", "https://example.com/s?q=a%20b&k=%e6%97%a5", "https://example.com/s?k=%E6%97%A5&q=a+b"},
+		{"跟踪参数", "https://example.com/?utm_source=x&UTM_Medium=y&gclid=1&id=3&ref=home", "https://example.com/?id=3"},
+		{"国际化域名", "https://日本語.jp/", "https://xn--wgv71a119e.jp/"},
+		{"国际化域名混合", "http://Bücher.example/", "http://xn--bcher-kva.example/"},
+		{"全角域名", "https://ｅｘａｍｐｌｅ.com/", "https://example.com/"},
+		{"国际化域名非过渡处理", "https://Faß.de/", "https://xn--fa-hia.de/"},
+		{"全角句点", "https://日本語。jp/", "https://xn--wgv71a119e.jp/"},
+		{"主机名包含下划线", "https://My_Host.Example.com/a", "https://my_host.example.com/a"},
+		{"全角字母", "https://ｅｘａｍｐｌｅ.com/", "https://example.com/"},
+		{"IPv6", "http://[::1]:80/a", "http://[::1]/a"},
+		{"亚马逊商品页", "https://www.amazon.co.jp/Some-Product-Name/dp/b08n5wrwnw/ref=sr_1_1?keywords=x&qid=1&sr=8-1&th=1", "https://www.amazon.co.jp/dp/B08N5WRWNW"},
+		{"亚马逊gp/product", "https://www.amazon.co.jp/gp/product/B08N5WRWNW?pd_rd_i=x&psc=1", "https://www.amazon.co.jp/dp/B08N5WRWNW"},
+		{"亚马逊搜索页", "https://www.amazon.co.jp/s/ref=nb_sb_noss?k=%E3%83%9A%E3%83%B3&crid=ABC&sprefix=x&ref=nb_sb", "https://www.amazon.co.jp/s?k=%E3%83%9A%E3%83%B3"},
+		{"TikTok分享链接", "https://www.tiktok.com/@user/video/123?is_from_webapp=1&sender_device=pc&web_id=9", "https://www.tiktok.com/@user/video/123"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.Canonicalize(tt.raw)
+			if err != nil {
+				t.Fatalf("Canonicalize(%q) error = %v", tt.raw, err)
+			}
+			if got != tt.want {
+				t.Errorf("Canonicalize(%q) = %q，期望 %q", tt.raw, got, tt.want)
+			}
+			// 规范形式再次规范化不变
+			if again, _ := c.Canonicalize(got); again != got {
+				t.Errorf("再次规范化 = %q，期望不变 %q", again, got)
+			}
+		})
+	}
+
+	for _, raw := range []string{"/relative/path", "ftp://example.com/a", "mailto:a@example.com", "http://", "http://-日本-.example/"} {
+		if _, err := c.Canonicalize(raw); err == nil {
+			t.Errorf("Canonicalize(%q) 应返回错误", raw)
+		}
+	}
+}
+
+// 测试自定义站点规则
+func TestCanonicalizerAddRule(t *testing.T) {
+	c := NewCanonicalizer()
+	c.AddRule(Rule{Domains: []string{"rakuten.co.jp"}, StripParams: []string{"scid", "s-id"}})
+
+	got, _ := c.Canonicalize("https://item.rakuten.co.jp/shop/item/?scid=af_pc&s-id=top&variant=2")
+	if want := "https://item.rakuten.co.jp/shop/item/?variant=2"; got != want {
+		t.Errorf("Canonicalize() = %q，期望 %q", got, want)
+	}
+	if got, _ := c.Canonicalize("https://example.com/?scid=1"); got != "https://example.com/?scid=1" {
+		t.Errorf("规则不应作用于其他域名: %q", got)
+	}
+}
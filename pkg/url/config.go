@@ -2,10 +2,80 @@ package url
 
 import "time"
 
+// URL去重方式
+const (
+	DedupSet         = "set"          // Redis集合，精确去重（默认）
+	DedupRedisBloom  = "redis_bloom"  // Redis位图实现的可扩展Bloom过滤器，多个节点共享
+	DedupMemoryBloom = "memory_bloom" // 本地内存Bloom过滤器，只在单个进程内去重
+)
+
 // Config URL管理器配置
 type Config struct {
-	RedisKeyPrefix  string        // Redis键前缀
-	MaxDepth        int           // 最大深度限制
-	MaxPriority     int           // 最大优先级
-	MetricsInterval time.Duration // 指标收集间隔
+	RedisKeyPrefix     string        // Redis键前缀
+	MaxDepth           int           // 最大深度限制
+	MaxPriority        int           // 最大优先级
+	MetricsInterval    time.Duration // 指标收集间隔
+	Dedup              string        // URL去重方式: set/redis_bloom/memory_bloom，默认set
+	BloomCapacity      int64         // Bloom过滤器预计的URL数量，Redis过滤器超过后自动扩容，默认1000万
+	BloomErrorRate     float64       // Bloom过滤器的误判率（新URL被误认为已存在的概率），默认0.001
+	ProcessingTimeout  time.Duration // 取出后超过该时间仍未完成的URL重新放回队列，默认10分钟
+	StaleCheckInterval time.Duration // 检查超时URL的间隔，默认1分钟
+	ItemTTL            time.Duration // 已完成和失败的URL项保留的时间，超过后删除以控制Redis内存，默认7天，负数表示永久保留
+}
+
+// withDefaults 用默认值补全未设置的配置项
+func (c Config) withDefaults() Config {
+	if c.MetricsInterval <= 0 {
+		c.MetricsInterval = time.Minute
+	}
+	if c.ProcessingTimeout <= 0 {
+		c.ProcessingTimeout = 10 * time.Minute
+	}
+	if c.StaleCheckInterval <= 0 {
+		c.StaleCheckInterval = time.Minute
+	}
+	if c.ItemTTL == 0 {
+		c.ItemTTL = 7 * 24 * time.Hour
+	}
+	if c.Dedup == "" {
+		c.Dedup = DedupSet
+	}
+	if c.BloomCapacity <= 0 {
+		c.BloomCapacity = 10_000_000
+	}
+	if c.BloomErrorRate <= 0 || c.BloomErrorRate >= 1 {
+		c.BloomErrorRate = 0.001
+	}
+	return c
+}
+
+// FrontierConfig URL调度器配置
+type FrontierConfig struct {
+	BufferSize   int           // 从URL管理器预取到内存的最大URL数，默认1000
+	MaxPerHost   int           // 每个主机最多缓存的URL数，超出的URL放回URL管理器，默认100
+	Delay        time.Duration // 同一主机两次请求的最小间隔，默认1秒，负数表示不限制
+	MaxBufferAge time.Duration // 预取后超过该时间仍未取出的URL放回URL管理器，应小于ProcessingTimeout，默认5分钟
+	PollInterval time.Duration // 没有可处理的URL时重新预取的间隔，默认1秒
+}
+
+// withDefaults 用默认值补全未设置的配置项
+func (c FrontierConfig) withDefaults() FrontierConfig {
+	if c.BufferSize <= 0 {
+		c.BufferSize = 1000
+	}
+	if c.MaxPerHost <= 0 {
+		c.MaxPerHost = 100
+	}
+	if c.Delay < 0 {
+		c.Delay = 0
+	} else if c.Delay == 0 {
+		c.Delay = time.Second
+	}
+	if c.MaxBufferAge <= 0 {
+		c.MaxBufferAge = 5 * time.Minute
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = time.Second
+	}
+	return c
 }
@@ -0,0 +1,66 @@
+package url
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+
+	"japan_spider/pkg/redis"
+)
+
+// DedupStore URL去重存储
+// Bloom过滤器实现可能把新URL误判为已存在（概率由误判率配置决定），但不会把已存在的URL判为新URL
+type DedupStore interface {
+	// Add 记录URL，返回URL是否为新URL；检查和记录是原子的，多个节点同时添加同一URL时只有一个返回true
+	Add(ctx context.Context, url string) (bool, error)
+	// Contains 返回URL是否已记录
+	Contains(ctx context.Context, url string) (bool, error)
+}
+
+// NewDedupStore 按配置创建URL去重存储
+func NewDedupStore(redisClient *redis.RedisClient, config Config) (DedupStore, error) {
+	config = config.withDefaults()
+	switch config.Dedup {
+	case DedupSet:
+		return NewSetStore(redisClient, fmt.Sprintf("%s:urls", config.RedisKeyPrefix)), nil
+	case DedupRedisBloom:
+		return NewRedisBloom(redisClient, fmt.Sprintf("%s:bloom", config.RedisKeyPrefix), config.BloomCapacity, config.BloomErrorRate), nil
+	case DedupMemoryBloom:
+		return NewMemoryBloom(config.BloomCapacity, config.BloomErrorRate), nil
+	}
+	return nil, fmt.Errorf("不支持的URL去重方式: %s", config.Dedup)
+}
+
+// SetStore 用Redis集合精确去重，每个URL都完整保存，内存占用随URL数量线性增长
+type SetStore struct {
+	redisClient *redis.RedisClient
+	key         string
+}
+
+// NewSetStore 创建Redis集合去重存储
+func NewSetStore(redisClient *redis.RedisClient, key string) *SetStore {
+	return &SetStore{redisClient: redisClient, key: key}
+}
+
+// Add 记录URL，返回URL是否为新URL
+func (s *SetStore) Add(ctx context.Context, url string) (bool, error) {
+	n, err := s.redisClient.Client().SAdd(ctx, s.key, url).Result()
+	return n == 1, err
+}
+
+// Contains 返回URL是否已记录
+func (s *SetStore) Contains(ctx context.Context, url string) (bool, error) {
+	return s.redisClient.Client().SIsMember(ctx, s.key, url).Result()
+}
+
+// bloomHash 计算URL的两个32位哈希值，第i个位置为 h1 + i*h2（双重哈希）
+// 使用32位是为了在Redis Lua脚本的双精度数中精确计算位置
+func bloomHash(url string) (h1, h2 uint64) {
+	h := fnv.New128a()
+	h.Write([]byte(url))
+	sum := h.Sum(nil)
+	h1 = uint64(binary.BigEndian.Uint32(sum[0:4]) ^ binary.BigEndian.Uint32(sum[8:12]))
+	h2 = uint64(binary.BigEndian.Uint32(sum[4:8])^binary.BigEndian.Uint32(sum[12:16])) | 1
+	return h1, h2
+}
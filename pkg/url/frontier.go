@@ -0,0 +1,445 @@
+package url
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"japan_spider/pkg/ratelimit"
+)
+
+// ErrFrontierClosed 调度器已关闭
+var ErrFrontierClosed = errors.New("URL调度器已关闭")
+
+// FrontierSource 调度器的URL来源，URLController实现了该接口
+type FrontierSource interface {
+	// GetNextURL 取出一个待处理的URL，没有时返回ErrNoPendingURL
+	GetNextURL(ctx context.Context) (*URLItem, error)
+	// UpdateStatus 更新URL状态，调度器用它把未分发的URL改回pending
+	UpdateStatus(ctx context.Context, url string, status string) error
+}
+
+// Frontier 按主机礼貌抓取的URL调度器
+// 从URL管理器预取URL，按主机分到各自的队列；每个主机记录下次允许请求的时间，
+// 所有主机按该时间放在堆中。Next在已到时间的主机中选择队首优先级最高的URL，
+// 一个主机的URL再多也只能按它的请求间隔被取出，不会占满整个抓取。
+type Frontier struct {
+	source       FrontierSource
+	limiter      *ratelimit.RateLimitController // 可选，非nil时分发前按域名取得令牌
+	config       FrontierConfig
+	hosts        map[string]*hostQueue    // 主机 -> 主机队列，队列为空但仍在请求间隔内的主机也保留
+	ready        hostHeap                 // 有待分发URL的主机，按下次允许请求的时间排列
+	delays       map[string]time.Duration // 单独设置了请求间隔的主机
+	size         int                      // 缓存的URL总数
+	seq          uint64                   // 预取顺序，同一优先级先进先出
+	mu           sync.Mutex
+	fillMu       sync.Mutex // 同一时间只有一个协程预取
+	drainedUntil time.Time  // 在此之前不再预取，受fillMu保护
+	expiredAt    time.Time  // 上次检查过期URL的时间，受fillMu保护
+	wake         chan struct{}
+	done         chan struct{}
+	closeOnce    sync.Once
+}
+
+// frontierItem 缓存的URL
+type frontierItem struct {
+	item    *URLItem
+	seq     uint64
+	fetched time.Time // 从URL管理器取出的时间
+}
+
+// hostQueue 一个主机的待分发URL
+type hostQueue struct {
+	host     string
+	items    itemHeap
+	readyAt  time.Time // 下次允许请求的时间
+	index    int       // 在ready堆中的位置，不在堆中时为-1
+	checking bool      // 正在向限流器取令牌，期间不放入ready堆，也不清理
+}
+
+// NewFrontier 创建URL调度器
+// limiter为nil时只按请求间隔调度。不再使用时调用Close把缓存的URL放回URL管理器
+func NewFrontier(source FrontierSource, limiter *ratelimit.RateLimitController, config FrontierConfig) *Frontier {
+	return &Frontier{
+		source:  source,
+		limiter: limiter,
+		config:  config.withDefaults(),
+		hosts:   make(map[string]*hostQueue),
+		delays:  make(map[string]time.Duration),
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+}
+
+// Next 阻塞直到有主机允许请求，返回其中优先级最高的URL，或ctx结束
+// 返回的URL状态为processing，处理后调用URL管理器的UpdateStatus。
+// 配置了限流器时分发前已取得令牌（包括分布式限流），调用方不需要再调用Wait
+func (f *Frontier) Next(ctx context.Context) (*URLItem, error) {
+	for {
+		select {
+		case <-f.done:
+			return nil, ErrFrontierClosed
+		default:
+		}
+
+		f.fill(ctx)
+		item, wait := f.next(ctx, time.Now())
+		if item != nil {
+			return item, nil
+		}
+		if wait <= 0 || wait > f.config.PollInterval {
+			wait = f.config.PollInterval
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-f.done:
+			timer.Stop()
+			return nil, ErrFrontierClosed
+		case <-f.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// SetDelay 设置单个主机的请求间隔，例如robots.txt中的Crawl-delay
+// d为负数时该主机不限制请求间隔
+func (f *Frontier) SetDelay(host string, d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.delays[host] = d
+}
+
+// Len 返回缓存的URL数量
+func (f *Frontier) Len() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.size
+}
+
+// Close 停止分发，并把缓存的URL改回pending放回URL管理器
+// 可以重复调用，返回第一个放回失败的错误
+func (f *Frontier) Close() error {
+	var items []*URLItem
+	f.closeOnce.Do(func() {
+		close(f.done)
+
+		f.mu.Lock()
+		for _, hq := range f.hosts {
+			for _, fi := range hq.items {
+				items = append(items, fi.item)
+			}
+		}
+		f.hosts = make(map[string]*hostQueue)
+		f.ready = nil
+		f.size = 0
+		f.mu.Unlock()
+	})
+
+	var firstErr error
+	for _, item := range items {
+		if err := f.source.UpdateStatus(context.Background(), item.URL, StatusPending); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// next 在已到时间的主机中按队首URL的优先级依次尝试，返回第一个取得令牌的主机的URL
+// 没有可分发的URL时返回距离最近的主机允许请求还需等待的时间，没有缓存的URL时为0。
+// 向限流器取令牌可能访问Redis，期间不持有f.mu
+func (f *Frontier) next(ctx context.Context, now time.Time) (*URLItem, time.Duration) {
+	for {
+		hq, fi := f.pick(now)
+		if fi == nil {
+			return nil, f.untilReady(now)
+		}
+		wait, ok := f.acquire(ctx, hq.host)
+		if item := f.finish(ctx, hq, fi, now, wait, ok); item != nil {
+			return item, 0
+		}
+	}
+}
+
+// pick 取出已到时间的主机中队首优先级最高的URL，该主机在finish之前不参与调度
+func (f *Frontier) pick(now time.Time) (*hostQueue, *frontierItem) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var candidates []*hostQueue
+	for len(f.ready) > 0 && !f.ready[0].readyAt.After(now) {
+		candidates = append(candidates, heap.Pop(&f.ready).(*hostQueue))
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return itemBefore(candidates[i].items[0], candidates[j].items[0])
+	})
+	for _, hq := range candidates[1:] {
+		heap.Push(&f.ready, hq)
+	}
+
+	hq := candidates[0]
+	hq.checking = true
+	fi := heap.Pop(&hq.items).(*frontierItem)
+	f.size--
+	return hq, fi
+}
+
+// finish 根据取令牌的结果分发URL或把它放回主机队列，并安排主机下次允许请求的时间
+// 调度器在取令牌期间关闭时，未分发的URL放回URL管理器
+func (f *Frontier) finish(ctx context.Context, hq *hostQueue, fi *frontierItem, now time.Time, wait time.Duration, ok bool) *URLItem {
+	f.mu.Lock()
+	hq.checking = false
+	select {
+	case <-f.done:
+		f.mu.Unlock()
+		if ok {
+			return fi.item
+		}
+		f.release(ctx, []*URLItem{fi.item})
+		return nil
+	default:
+	}
+
+	if ok {
+		hq.readyAt = now.Add(f.delay(hq.host))
+	} else {
+		heap.Push(&hq.items, fi)
+		f.size++
+		hq.readyAt = now.Add(wait)
+	}
+	if len(hq.items) > 0 {
+		heap.Push(&f.ready, hq)
+	}
+	f.mu.Unlock()
+
+	if ok {
+		return fi.item
+	}
+	return nil
+}
+
+// untilReady 返回距离最近的主机允许请求还需等待的时间，没有待分发的URL时为0
+func (f *Frontier) untilReady(now time.Time) time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.ready) == 0 {
+		return 0
+	}
+	return f.ready[0].readyAt.Sub(now)
+}
+
+// acquire 向限流器取得主机的令牌（包括分布式限流），不能立即请求时返回需要等待的时间
+func (f *Frontier) acquire(ctx context.Context, host string) (time.Duration, bool) {
+	if f.limiter == nil {
+		return 0, true
+	}
+	wait, err := f.limiter.TryAcquire(ctx, host)
+	if err == nil {
+		return 0, true
+	}
+	if !errors.Is(err, ratelimit.ErrThrottled) && ctx.Err() == nil {
+		log.Printf("检查 %s 的限流失败: %v", host, err)
+	}
+	if wait <= 0 {
+		wait = f.config.PollInterval
+	}
+	return wait, false
+}
+
+// delay 返回主机的请求间隔
+func (f *Frontier) delay(host string) time.Duration {
+	d, ok := f.delays[host]
+	if !ok {
+		d = f.config.Delay
+	}
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// add 把URL放入主机队列，主机队列已满或调度器已关闭时返回false
+func (f *Frontier) add(item *URLItem, now time.Time) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return false
+	default:
+	}
+
+	host := urlDomain(item.URL)
+	hq, ok := f.hosts[host]
+	if !ok {
+		hq = &hostQueue{host: host, index: -1}
+		f.hosts[host] = hq
+	}
+	if len(hq.items) >= f.config.MaxPerHost {
+		return false
+	}
+
+	f.seq++
+	heap.Push(&hq.items, &frontierItem{item: item, seq: f.seq, fetched: now})
+	f.size++
+	if hq.index < 0 && !hq.checking {
+		heap.Push(&f.ready, hq)
+	}
+	return true
+}
+
+// fill 从URL管理器预取URL直到缓存已满
+// 主机队列已满的URL放回URL管理器，本轮结束后等待PollInterval再预取，
+// 避免一个主机的大量URL在URL管理器和调度器之间反复搬运
+func (f *Frontier) fill(ctx context.Context) {
+	if !f.fillMu.TryLock() {
+		return
+	}
+	defer f.fillMu.Unlock()
+
+	now := time.Now()
+	if now.Sub(f.expiredAt) >= f.config.PollInterval {
+		f.expiredAt = now
+		f.release(ctx, f.expire(now))
+	}
+	if now.Before(f.drainedUntil) {
+		return
+	}
+
+	added, released := 0, 0
+	for n := f.config.BufferSize - f.Len(); n > 0; n-- {
+		item, err := f.source.GetNextURL(ctx)
+		if err != nil {
+			if !errors.Is(err, ErrNoPendingURL) {
+				log.Printf("预取URL失败: %v", err)
+			}
+			f.drainedUntil = time.Now().Add(f.config.PollInterval)
+			break
+		}
+		if f.add(item, time.Now()) {
+			added++
+		} else {
+			f.release(ctx, []*URLItem{item})
+			released++
+		}
+	}
+	if released > 0 {
+		f.drainedUntil = time.Now().Add(f.config.PollInterval)
+	}
+	if added > 0 {
+		select {
+		case f.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// expire 取出预取后超过MaxBufferAge仍未分发的URL，并清理已过请求间隔的空主机
+func (f *Frontier) expire(now time.Time) []*URLItem {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	cutoff := now.Add(-f.config.MaxBufferAge)
+	var expired []*URLItem
+	for host, hq := range f.hosts {
+		kept := hq.items[:0]
+		for _, fi := range hq.items {
+			if fi.fetched.Before(cutoff) {
+				expired = append(expired, fi.item)
+			} else {
+				kept = append(kept, fi)
+			}
+		}
+		if len(kept) < len(hq.items) {
+			f.size -= len(hq.items) - len(kept)
+			hq.items = kept
+			heap.Init(&hq.items)
+			if len(hq.items) == 0 && hq.index >= 0 {
+				heap.Remove(&f.ready, hq.index)
+			}
+		}
+		if len(hq.items) == 0 && !hq.checking && !hq.readyAt.After(now) {
+			delete(f.hosts, host)
+		}
+	}
+	return expired
+}
+
+// release 把URL改回pending放回URL管理器
+func (f *Frontier) release(ctx context.Context, items []*URLItem) {
+	for _, item := range items {
+		if err := f.source.UpdateStatus(ctx, item.URL, StatusPending); err != nil {
+			log.Printf("放回URL失败 %s: %v", item.URL, err)
+		}
+	}
+}
+
+// itemHeap 主机队列，优先级高的在前，同一优先级先进先出
+type itemHeap []*frontierItem
+
+func (h itemHeap) Len() int { return len(h) }
+
+func (h itemHeap) Less(i, j int) bool {
+	return itemBefore(h[i], h[j])
+}
+
+func (h itemHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *itemHeap) Push(x interface{}) { *h = append(*h, x.(*frontierItem)) }
+
+func (h *itemHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return x
+}
+
+// itemBefore 返回a是否应先于b分发
+func itemBefore(a, b *frontierItem) bool {
+	if a.item.Priority != b.item.Priority {
+		return a.item.Priority > b.item.Priority
+	}
+	return a.seq < b.seq
+}
+
+// hostHeap 有待分发URL的主机，下次允许请求的时间早的在前
+type hostHeap []*hostQueue
+
+func (h hostHeap) Len() int { return len(h) }
+
+func (h hostHeap) Less(i, j int) bool { return h[i].readyAt.Before(h[j].readyAt) }
+
+func (h hostHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *hostHeap) Push(x interface{}) {
+	hq := x.(*hostQueue)
+	hq.index = len(*h)
+	*h = append(*h, hq)
+}
+
+func (h *hostHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	hq := old[n-1]
+	old[n-1] = nil
+	hq.index = -1
+	*h = old[:n-1]
+	return hq
+}
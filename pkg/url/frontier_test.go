@@ -0,0 +1,174 @@
+package url
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"japan_spider/pkg/ratelimit"
+)
+
+// testSource 内存中的URL来源，按加入顺序取出
+type testSource struct {
+	pending  []*URLItem
+	released []string
+	mu       sync.Mutex
+}
+
+func (s *testSource) add(rawURL string, priority int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = append(s.pending, &URLItem{URL: rawURL, Priority: priority, Status: StatusPending})
+}
+
+func (s *testSource) GetNextURL(ctx context.Context) (*URLItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.pending) == 0 {
+		return nil, ErrNoPendingURL
+	}
+	item := s.pending[0]
+	s.pending = s.pending[1:]
+	item.Status = StatusProcessing
+	return item, nil
+}
+
+func (s *testSource) UpdateStatus(ctx context.Context, url string, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.released = append(s.released, url)
+	return nil
+}
+
+// 测试同一主机按请求间隔分发，其他主机的低优先级URL不会被饿死
+func TestFrontierPoliteness(t *testing.T) {
+	source := &testSource{}
+	for _, path := range []string{"/1", "/2", "/3"} {
+		source.add("https://www.amazon.co.jp"+path, 5)
+	}
+	source.add("https://www.tiktok.com/a", 1)
+	source.add("https://www.amazon.co.jp/0", 9)
+
+	f := NewFrontier(source, nil, FrontierConfig{Delay: time.Hour})
+	ctx := context.Background()
+	f.fill(ctx)
+	now := time.Now()
+
+	want := []string{"https://www.amazon.co.jp/0", "https://www.tiktok.com/a"}
+	for _, url := range want {
+		item, _ := f.next(ctx, now)
+		if item == nil || item.URL != url {
+			t.Fatalf("next() = %+v，期望 %s", item, url)
+		}
+	}
+	if item, wait := f.next(ctx, now); item != nil || wait != time.Hour {
+		t.Fatalf("请求间隔内 next() = %+v, %s", item, wait)
+	}
+
+	// 过了请求间隔后按优先级和加入顺序继续分发
+	if item, _ := f.next(ctx, now.Add(time.Hour)); item == nil || item.URL != "https://www.amazon.co.jp/1" {
+		t.Fatalf("间隔后 next() = %+v", item)
+	}
+	if f.Len() != 2 {
+		t.Errorf("Len() = %d，期望 2", f.Len())
+	}
+}
+
+// 测试主机队列已满和关闭时URL被放回来源
+func TestFrontierRelease(t *testing.T) {
+	source := &testSource{}
+	for _, path := range []string{"/1", "/2", "/3"} {
+		source.add("https://example.com"+path, 1)
+	}
+
+	f := NewFrontier(source, nil, FrontierConfig{MaxPerHost: 2})
+	f.fill(context.Background())
+	if f.Len() != 2 || len(source.released) != 1 || source.released[0] != "https://example.com/3" {
+		t.Fatalf("预取后 Len() = %d，放回 %v", f.Len(), source.released)
+	}
+
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if len(source.released) != 3 {
+		t.Errorf("关闭后放回 %v", source.released)
+	}
+	if _, err := f.Next(context.Background()); !errors.Is(err, ErrFrontierClosed) {
+		t.Errorf("关闭后 Next() error = %v", err)
+	}
+}
+
+// 测试Next遵守限流器的速率，并在ctx结束时返回
+func TestFrontierNextRateLimit(t *testing.T) {
+	source := &testSource{}
+	for _, path := range []string{"/1", "/2", "/3"} {
+		source.add("https://example.com"+path, 1)
+	}
+	limiter := ratelimit.NewRateLimitController(nil, ratelimit.Config{
+		DefaultRate:    20,
+		DefaultBurst:   1,
+		AdjustInterval: time.Hour,
+	})
+	defer limiter.Close()
+
+	f := NewFrontier(source, limiter, FrontierConfig{Delay: -1, PollInterval: 10 * time.Millisecond})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := f.Next(ctx); err != nil {
+			t.Fatalf("Next() error = %v", err)
+		}
+	}
+	// 第一个URL立即分发，其余2个各等待50ms
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("3个URL用时 %s，期望至少100ms", elapsed)
+	}
+
+	short, cancelShort := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancelShort()
+	if _, err := f.Next(short); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("没有URL时 Next() error = %v", err)
+	}
+}
+
+// 测试被限流的主机不阻塞其他主机，只有分发出去的URL计入限流器的请求数
+func TestFrontierThrottledHost(t *testing.T) {
+	source := &testSource{}
+	source.add("https://slow.example/1", 9)
+	source.add("https://slow.example/2", 9)
+	source.add("https://fast.example/1", 1)
+	limiter := ratelimit.NewRateLimitController(nil, ratelimit.Config{
+		DefaultRate:    100,
+		DefaultBurst:   1,
+		AdjustInterval: time.Hour,
+	})
+	defer limiter.Close()
+	limiter.SetRate("slow.example", 0.01, 1)
+
+	f := NewFrontier(source, limiter, FrontierConfig{Delay: -1})
+	ctx := context.Background()
+	f.fill(ctx)
+	now := time.Now()
+
+	want := []string{"https://slow.example/1", "https://fast.example/1"}
+	for _, url := range want {
+		if item, _ := f.next(ctx, now); item == nil || item.URL != url {
+			t.Fatalf("next() = %+v，期望 %s", item, url)
+		}
+	}
+	if item, wait := f.next(ctx, now); item != nil || wait < 90*time.Second {
+		t.Errorf("被限流的主机 next() = %+v, %s，期望等待约100秒", item, wait)
+	}
+	if f.Len() != 1 {
+		t.Errorf("被限流的URL应留在调度器中，Len() = %d", f.Len())
+	}
+
+	m := limiter.GetMetrics()
+	if m.DomainStats["slow.example"].Requests != 1 || m.DomainStats["fast.example"].Requests != 1 {
+		t.Errorf("只有分发的URL计入请求数: slow=%+v fast=%+v", m.DomainStats["slow.example"], m.DomainStats["fast.example"])
+	}
+}
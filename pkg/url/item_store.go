@@ -0,0 +1,217 @@
+package url
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+)
+
+// URL状态
+const (
+	StatusPending    = "pending"    // 等待处理
+	StatusProcessing = "processing" // 已被取出，正在处理
+	StatusCompleted  = "completed"  // 处理成功
+	StatusFailed     = "failed"     // 处理失败，可以重新放回队列
+)
+
+// transitions 新状态 -> 允许的原状态
+// processing只能通过GetNextURL进入
+var transitions = map[string][]string{
+	StatusPending:   {StatusProcessing, StatusFailed},
+	StatusCompleted: {StatusProcessing},
+	StatusFailed:    {StatusProcessing},
+}
+
+var (
+	// ErrNoPendingURL 没有待处理的URL
+	ErrNoPendingURL = errors.New("没有待处理的URL")
+	// ErrURLNotFound URL不存在
+	ErrURLNotFound = errors.New("URL不存在")
+	// ErrInvalidTransition 不允许的状态变化
+	ErrInvalidTransition = errors.New("不允许的状态变化")
+)
+
+// Redis键布局（<p>为RedisKeyPrefix）:
+//
+//	<p>:url:<sha1(url)>  哈希，URL项的全部字段，时间为毫秒时间戳；已完成和失败的URL项在ItemTTL后过期
+//	<p>:priority:<n>     列表，优先级为n的待处理URL
+//	<p>:processing       有序集合，正在处理的URL，分数为处理超时的时间（毫秒）
+//	<p>:stats            哈希，计数: total、status:<状态>、depth:<深度>、domain:<域名>
+//
+// 状态变化和计数在同一个Lua脚本中完成，计数始终与状态变化一致；计数是累计值，过期删除的URL项仍计入。
+// URL项过期后去重存储仍记录该URL，不会被重新添加。
+// 脚本根据参数拼接键名，只适用于单机Redis
+
+// addScript 保存新的URL项并放入优先级队列，URL项已存在时返回0
+// ARGV: 前缀, url, depth, priority, parent, spider, 当前时间, 域名
+var addScript = goredis.NewScript(`
+local prefix = ARGV[1]
+local url = ARGV[2]
+local key = prefix .. ':url:' .. redis.sha1hex(url)
+if redis.call('EXISTS', key) == 1 then
+	return 0
+end
+redis.call('HSET', key, 'url', url, 'depth', ARGV[3], 'priority', ARGV[4], 'parent', ARGV[5], 'spider', ARGV[6],
+	'status', 'pending', 'attempts', 0, 'created_at', ARGV[7], 'updated_at', ARGV[7])
+redis.call('RPUSH', prefix .. ':priority:' .. ARGV[4], url)
+
+local stats = prefix .. ':stats'
+redis.call('HINCRBY', stats, 'total', 1)
+redis.call('HINCRBY', stats, 'status:pending', 1)
+redis.call('HINCRBY', stats, 'depth:' .. ARGV[3], 1)
+redis.call('HINCRBY', stats, 'domain:' .. ARGV[8], 1)
+return 1
+`)
+
+// nextScript 按优先级从高到低取出一个待处理的URL，标记为processing并返回URL项的全部字段
+// 队列中状态不是pending的URL（例如已被回收后处理完成）直接丢弃；
+// 没有URL项的旧数据按优先级补建URL项
+// ARGV: 前缀, 最大优先级, 当前时间, 处理超时时间
+var nextScript = goredis.NewScript(`
+local prefix = ARGV[1]
+local now = ARGV[3]
+local stats = prefix .. ':stats'
+for p = tonumber(ARGV[2]), 0, -1 do
+	local list = prefix .. ':priority:' .. p
+	while true do
+		local url = redis.call('LPOP', list)
+		if not url then
+			break
+		end
+		local key = prefix .. ':url:' .. redis.sha1hex(url)
+		local status = redis.call('HGET', key, 'status')
+		if not status then
+			redis.call('HSET', key, 'url', url, 'depth', 0, 'priority', p, 'status', 'pending', 'attempts', 0,
+				'created_at', now)
+			redis.call('HINCRBY', stats, 'total', 1)
+			redis.call('HINCRBY', stats, 'status:pending', 1)
+			status = 'pending'
+		end
+		if status == 'pending' then
+			redis.call('HSET', key, 'status', 'processing', 'updated_at', now)
+			redis.call('HINCRBY', key, 'attempts', 1)
+			redis.call('ZADD', prefix .. ':processing', ARGV[4], url)
+			redis.call('HINCRBY', stats, 'status:pending', -1)
+			redis.call('HINCRBY', stats, 'status:processing', 1)
+			return redis.call('HGETALL', key)
+		end
+	end
+end
+return false
+`)
+
+// statusScript 修改URL状态，原状态不在允许列表中时不修改
+// 改为pending时重新放入优先级队列；改为completed/failed时URL项在保留时间后过期，改回pending时取消过期
+// ARGV: 前缀, url, 新状态, 当前时间, 保留时间（毫秒，0表示永久保留）, 允许的原状态...
+// 返回: {1 成功 / 0 URL不存在 / -1 不允许, 原状态}
+var statusScript = goredis.NewScript(`
+local prefix = ARGV[1]
+local url = ARGV[2]
+local status = ARGV[3]
+local key = prefix .. ':url:' .. redis.sha1hex(url)
+local old = redis.call('HGET', key, 'status')
+if not old then
+	return {0, ''}
+end
+local allowed = false
+for i = 6, #ARGV do
+	if ARGV[i] == old then
+		allowed = true
+	end
+end
+if not allowed then
+	return {-1, old}
+end
+
+redis.call('HSET', key, 'status', status, 'updated_at', ARGV[4])
+if old == 'processing' then
+	redis.call('ZREM', prefix .. ':processing', url)
+end
+if status == 'pending' then
+	redis.call('RPUSH', prefix .. ':priority:' .. redis.call('HGET', key, 'priority'), url)
+	redis.call('PERSIST', key)
+elseif tonumber(ARGV[5]) > 0 then
+	redis.call('PEXPIRE', key, ARGV[5])
+end
+redis.call('HINCRBY', prefix .. ':stats', 'status:' .. old, -1)
+redis.call('HINCRBY', prefix .. ':stats', 'status:' .. status, 1)
+return {1, old}
+`)
+
+// requeueScript 把处理超时的URL改回pending并放到优先级队列的队首
+// ARGV: 前缀, 当前时间, 最多处理的数量
+// 返回: 重新入队的数量
+var requeueScript = goredis.NewScript(`
+local prefix = ARGV[1]
+local processing = prefix .. ':processing'
+local urls = redis.call('ZRANGEBYSCORE', processing, '-inf', ARGV[2], 'LIMIT', 0, tonumber(ARGV[3]))
+local requeued = 0
+for _, url in ipairs(urls) do
+	redis.call('ZREM', processing, url)
+	local key = prefix .. ':url:' .. redis.sha1hex(url)
+	if redis.call('HGET', key, 'status') == 'processing' then
+		redis.call('HSET', key, 'status', 'pending', 'updated_at', ARGV[2])
+		redis.call('LPUSH', prefix .. ':priority:' .. redis.call('HGET', key, 'priority'), url)
+		redis.call('HINCRBY', prefix .. ':stats', 'status:processing', -1)
+		redis.call('HINCRBY', prefix .. ':stats', 'status:pending', 1)
+		requeued = requeued + 1
+	end
+end
+return requeued
+`)
+
+// itemKey 返回URL项的键，与脚本中的 redis.sha1hex 一致
+func itemKey(prefix, rawURL string) string {
+	sum := sha1.Sum([]byte(rawURL))
+	return fmt.Sprintf("%s:url:%s", prefix, hex.EncodeToString(sum[:]))
+}
+
+// urlDomain 返回URL的主机名，用于按域名计数
+func urlDomain(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil && u.Hostname() != "" {
+		return u.Hostname()
+	}
+	return "unknown"
+}
+
+// millis 转换为毫秒时间戳
+func millis(t time.Time) int64 {
+	return t.UnixMilli()
+}
+
+// itemFromFields 从URL项的哈希字段还原URL项
+func itemFromFields(fields map[string]string) *URLItem {
+	item := &URLItem{
+		URL:    fields["url"],
+		Status: fields["status"],
+		Parent: fields["parent"],
+		Spider: fields["spider"],
+	}
+	item.Depth, _ = strconv.Atoi(fields["depth"])
+	item.Priority, _ = strconv.Atoi(fields["priority"])
+	item.Attempts, _ = strconv.Atoi(fields["attempts"])
+	if ms, err := strconv.ParseInt(fields["created_at"], 10, 64); err == nil {
+		item.CreatedAt = time.UnixMilli(ms)
+	}
+	if ms, err := strconv.ParseInt(fields["updated_at"], 10, 64); err == nil {
+		item.UpdatedAt = time.UnixMilli(ms)
+	}
+	return item
+}
+
+// fieldsFromReply 把HGETALL的数组结果转换为字段表
+func fieldsFromReply(reply []interface{}) map[string]string {
+	fields := make(map[string]string, len(reply)/2)
+	for i := 0; i+1 < len(reply); i += 2 {
+		k, _ := reply[i].(string)
+		v, _ := reply[i+1].(string)
+		fields[k] = v
+	}
+	return fields
+}
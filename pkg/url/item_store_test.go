@@ -0,0 +1,144 @@
+package url
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"japan_spider/pkg/redis"
+)
+
+// 测试从Lua脚本返回的HGETALL结果还原URL项
+func TestItemFromReply(t *testing.T) {
+	reply := []interface{}{
+		"url", "https://example.com/a", "depth", "2", "priority", "5",
+		"parent", "https://example.com/", "spider", "amazon", "status", StatusProcessing,
+		"attempts", "3", "created_at", "1700000000000", "updated_at", "1700000060000",
+	}
+	item := itemFromFields(fieldsFromReply(reply))
+
+	if item.URL != "https://example.com/a" || item.Depth != 2 || item.Priority != 5 {
+		t.Errorf("itemFromFields() = %+v", item)
+	}
+	if item.Parent != "https://example.com/" || item.Spider != "amazon" || item.Status != StatusProcessing || item.Attempts != 3 {
+		t.Errorf("itemFromFields() = %+v", item)
+	}
+	if !item.CreatedAt.Equal(time.UnixMilli(1700000000000)) || item.UpdatedAt.Sub(item.CreatedAt) != time.Minute {
+		t.Errorf("时间 = %v, %v", item.CreatedAt, item.UpdatedAt)
+	}
+}
+
+// 测试URL项的键与Lua中 redis.sha1hex 的结果一致
+func TestItemKey(t *testing.T) {
+	// sha1("abc")
+	want := "url:url:a9993e364706816aba3e25717850c26c9cd0d89d"
+	if got := itemKey("url", "abc"); got != want {
+		t.Errorf("itemKey() = %s, want %s", got, want)
+	}
+}
+
+// 测试每个可设置的状态都有允许的原状态，processing不能直接设置
+func TestTransitions(t *testing.T) {
+	if _, ok := transitions[StatusProcessing]; ok {
+		t.Error("processing只能通过GetNextURL进入")
+	}
+	for status, from := range transitions {
+		if len(from) == 0 {
+			t.Errorf("状态 %s 没有允许的原状态", status)
+		}
+	}
+}
+
+// newTestController 创建使用测试Redis的URL管理器
+func newTestController(t *testing.T, config Config) (*URLController, *redis.RedisClient) {
+	client, prefix := newTestRedis(t)
+	config.RedisKeyPrefix = prefix
+	uc, err := NewURLController(client, config)
+	if err != nil {
+		t.Fatalf("NewURLController() error = %v", err)
+	}
+	t.Cleanup(uc.Close)
+	return uc, client
+}
+
+// 测试URL项的状态流转：按优先级取出、修改状态、完成和失败后过期、改回pending后取消过期
+func TestURLItemLifecycle(t *testing.T) {
+	uc, client := newTestController(t, Config{MaxDepth: 3, MaxPriority: 3, ItemTTL: time.Hour})
+	ctx := context.Background()
+
+	uc.AddURL(ctx, "https://example.com/low", 1, 1)
+	uc.AddURL(ctx, "https://example.com/high", 2, 3)
+
+	item, err := uc.GetNextURL(ctx)
+	if err != nil || item.URL != "https://example.com/high" || item.Status != StatusProcessing || item.Attempts != 1 {
+		t.Fatalf("GetNextURL() = %+v, %v，期望优先级高的URL", item, err)
+	}
+	if err := uc.UpdateStatus(ctx, item.URL, StatusCompleted); err != nil {
+		t.Fatalf("UpdateStatus(completed) error = %v", err)
+	}
+	if err := uc.UpdateStatus(ctx, item.URL, StatusFailed); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("completed -> failed error = %v，期望 ErrInvalidTransition", err)
+	}
+	if ttl := client.Client().PTTL(ctx, itemKey(uc.config.RedisKeyPrefix, item.URL)).Val(); ttl <= 0 || ttl > time.Hour {
+		t.Errorf("已完成的URL项过期时间 = %s，期望在 (0, 1h] 内", ttl)
+	}
+
+	item, _ = uc.GetNextURL(ctx)
+	if err := uc.UpdateStatus(ctx, item.URL, StatusFailed); err != nil {
+		t.Fatalf("UpdateStatus(failed) error = %v", err)
+	}
+	if err := uc.UpdateStatus(ctx, item.URL, StatusPending); err != nil {
+		t.Fatalf("failed -> pending error = %v", err)
+	}
+	if ttl := client.Client().PTTL(ctx, itemKey(uc.config.RedisKeyPrefix, item.URL)).Val(); ttl != -1 {
+		t.Errorf("改回pending后过期时间 = %s，期望永久保留", ttl)
+	}
+	if again, err := uc.GetNextURL(ctx); err != nil || again.URL != item.URL || again.Attempts != 2 {
+		t.Errorf("重新入队后 GetNextURL() = %+v, %v", again, err)
+	}
+	if _, err := uc.GetNextURL(ctx); !errors.Is(err, ErrNoPendingURL) {
+		t.Errorf("队列为空时 error = %v，期望 ErrNoPendingURL", err)
+	}
+	if err := uc.UpdateStatus(ctx, "https://example.com/missing", StatusCompleted); !errors.Is(err, ErrURLNotFound) {
+		t.Errorf("不存在的URL error = %v，期望 ErrURLNotFound", err)
+	}
+
+	uc.updateMetrics()
+	m := uc.GetMetrics()
+	if m.TotalURLs != 2 || m.ProcessedURLs != 1 || m.ProcessingURLs != 1 || m.PendingURLs != 0 || m.FailedURLs != 0 {
+		t.Errorf("状态统计 = %+v", m)
+	}
+	if m.DomainStats["example.com"] != 2 || m.DepthStats[1] != 1 || m.DepthStats[2] != 1 {
+		t.Errorf("域名和深度统计 = %v %v", m.DomainStats, m.DepthStats)
+	}
+}
+
+// 测试处理超时的URL被放回队列的队首
+func TestRequeueStale(t *testing.T) {
+	uc, _ := newTestController(t, Config{MaxDepth: 3, MaxPriority: 3, ProcessingTimeout: time.Millisecond})
+	ctx := context.Background()
+
+	uc.AddURL(ctx, "https://example.com/a", 0, 1)
+	uc.AddURL(ctx, "https://example.com/b", 0, 1)
+	item, err := uc.GetNextURL(ctx)
+	if err != nil {
+		t.Fatalf("GetNextURL() error = %v", err)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	if n, err := uc.RequeueStale(ctx); n != 1 || err != nil {
+		t.Fatalf("RequeueStale() = %d, %v", n, err)
+	}
+	if got, _ := uc.GetURL(ctx, item.URL); got == nil || got.Status != StatusPending {
+		t.Errorf("放回后 GetURL() = %+v", got)
+	}
+	if next, _ := uc.GetNextURL(ctx); next == nil || next.URL != item.URL {
+		t.Errorf("超时的URL应放回队首，GetNextURL() = %+v", next)
+	}
+
+	uc.updateMetrics()
+	if m := uc.GetMetrics(); m.PendingURLs != 1 || m.ProcessingURLs != 1 {
+		t.Errorf("状态统计 = %+v", m)
+	}
+}
@@ -0,0 +1,181 @@
+package url
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	goredis "github.com/go-redis/redis/v8"
+
+	"japan_spider/pkg/redis"
+)
+
+// 可扩展Bloom过滤器的参数
+// 第i层（从0开始）的容量为 capacity*2^i，误判率为 errorRate/2^(i+1)，各层误判率之和不超过errorRate
+const (
+	bloomGrowth    = 2
+	bloomTightness = 0.5
+)
+
+// redisBloomScript 在Redis位图上检查并记录URL
+// 键布局（KEYS[1]为前缀）:
+//
+//	<前缀>      哈希: layers 层数, count 当前层已记录的数量, total 总数
+//	<前缀>:<i>  第i层的位图
+//
+// 先检查所有层，任一层包含该URL即视为已存在；否则在最后一层设置各位，最后一层记满后新建一层。
+// 层的位图键由脚本拼接，只适用于单机Redis
+// ARGV: h1, h2, 第0层容量, 总误判率, 是否记录（1/0）
+// 返回: 1 新URL（或未记录时不存在），0 已存在
+var redisBloomScript = goredis.NewScript(`
+local meta = KEYS[1]
+local h1 = tonumber(ARGV[1])
+local h2 = tonumber(ARGV[2])
+local capacity = tonumber(ARGV[3])
+local errorRate = tonumber(ARGV[4])
+local add = ARGV[5] == '1'
+
+local ln2 = math.log(2)
+local function size(i)
+	local n = capacity * (` + strconv.Itoa(bloomGrowth) + ` ^ i)
+	local p = errorRate * (` + strconv.FormatFloat(bloomTightness, 'f', -1, 64) + ` ^ (i + 1))
+	local m = math.ceil(-n * math.log(p) / (ln2 * ln2))
+	m = math.min(math.max(m, 64), 4294967295)
+	local k = math.max(1, math.floor(m / n * ln2 + 0.5))
+	return n, m, k
+end
+
+local layers = tonumber(redis.call('HGET', meta, 'layers') or '1')
+for i = 0, layers - 1 do
+	local _, m, k = size(i)
+	local found = true
+	for j = 0, k - 1 do
+		if redis.call('GETBIT', meta .. ':' .. i, (h1 + j * h2) % m) == 0 then
+			found = false
+			break
+		end
+	end
+	if found then
+		return 0
+	end
+end
+if not add then
+	return 1
+end
+
+local layer = layers - 1
+local count = tonumber(redis.call('HGET', meta, 'count') or '0')
+local n, m, k = size(layer)
+if count >= n then
+	layer = layers
+	count = 0
+	n, m, k = size(layer)
+	redis.call('HSET', meta, 'layers', layer + 1)
+end
+for j = 0, k - 1 do
+	redis.call('SETBIT', meta .. ':' .. layer, (h1 + j * h2) % m, 1)
+end
+redis.call('HSET', meta, 'count', count + 1)
+redis.call('HINCRBY', meta, 'total', 1)
+return 1
+`)
+
+// RedisBloom Redis位图实现的可扩展Bloom过滤器
+// 检查和记录在一个Lua脚本中完成，多个节点共享同一个过滤器；
+// 记录的URL超过当前容量后自动新增一层，整体误判率保持在配置值以内
+type RedisBloom struct {
+	redisClient *redis.RedisClient
+	key         string
+	capacity    int64
+	errorRate   float64
+}
+
+// BloomStats Bloom过滤器的状态
+type BloomStats struct {
+	Layers int   // 层数
+	Count  int64 // 已记录的URL数量
+	Bytes  int64 // 位图占用的字节数
+}
+
+// NewRedisBloom 创建Redis Bloom过滤器
+// capacity为第一层的容量，errorRate为整体误判率；同一个key的参数创建后不能修改，否则已记录的位置会失效
+func NewRedisBloom(redisClient *redis.RedisClient, key string, capacity int64, errorRate float64) *RedisBloom {
+	return &RedisBloom{redisClient: redisClient, key: key, capacity: capacity, errorRate: errorRate}
+}
+
+// Add 记录URL，返回URL是否为新URL
+func (b *RedisBloom) Add(ctx context.Context, url string) (bool, error) {
+	return b.run(ctx, b.redisClient.Client(), url, true)
+}
+
+// Contains 返回URL是否已记录
+func (b *RedisBloom) Contains(ctx context.Context, url string) (bool, error) {
+	isNew, err := b.run(ctx, b.redisClient.Client(), url, false)
+	return !isNew, err
+}
+
+// AddBatch 批量记录URL，通过管道一次发送，返回每个URL是否为新URL
+func (b *RedisBloom) AddBatch(ctx context.Context, urls []string) ([]bool, error) {
+	client := b.redisClient.Client()
+	if err := redisBloomScript.Load(ctx, client).Err(); err != nil {
+		return nil, err
+	}
+
+	pipe := client.Pipeline()
+	cmds := make([]*goredis.Cmd, len(urls))
+	for i, url := range urls {
+		cmds[i] = redisBloomScript.EvalSha(ctx, pipe, []string{b.key}, b.args(url, true)...)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	added := make([]bool, len(urls))
+	for i, cmd := range cmds {
+		n, err := cmd.Int()
+		if err != nil {
+			return nil, err
+		}
+		added[i] = n == 1
+	}
+	return added, nil
+}
+
+// Stats 返回过滤器的层数、数量和占用空间
+func (b *RedisBloom) Stats(ctx context.Context) (BloomStats, error) {
+	client := b.redisClient.Client()
+	meta, err := client.HGetAll(ctx, b.key).Result()
+	if err != nil {
+		return BloomStats{}, err
+	}
+
+	stats := BloomStats{Layers: 1}
+	if v, ok := meta["layers"]; ok {
+		stats.Layers, _ = strconv.Atoi(v)
+	}
+	stats.Count, _ = strconv.ParseInt(meta["total"], 10, 64)
+	for i := 0; i < stats.Layers; i++ {
+		n, err := client.StrLen(ctx, fmt.Sprintf("%s:%d", b.key, i)).Result()
+		if err != nil {
+			return stats, err
+		}
+		stats.Bytes += n
+	}
+	return stats, nil
+}
+
+// run 执行检查或记录脚本
+func (b *RedisBloom) run(ctx context.Context, client goredis.Scripter, url string, add bool) (bool, error) {
+	n, err := redisBloomScript.Run(ctx, client, []string{b.key}, b.args(url, add)...).Int()
+	return n == 1, err
+}
+
+// args 脚本参数
+func (b *RedisBloom) args(url string, add bool) []interface{} {
+	h1, h2 := bloomHash(url)
+	flag := 0
+	if add {
+		flag = 1
+	}
+	return []interface{}{h1, h2, b.capacity, b.errorRate, flag}
+}
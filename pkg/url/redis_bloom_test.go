@@ -0,0 +1,127 @@
+package url
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"japan_spider/pkg/redis"
+)
+
+// newTestRedis 连接测试Redis，返回客户端和本测试独占的键前缀，结束时删除前缀下的键
+// 测试Redis不可用时跳过
+func newTestRedis(t *testing.T) (*redis.RedisClient, string) {
+	client, err := redis.NewRedisClient(&redis.Config{
+		Host:    "192.168.20.6",
+		Port:    32430,
+		DB:      1, // 使用不同的数据库避免影响生产环境
+		Timeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Skipf("测试Redis不可用: %v", err)
+	}
+
+	prefix := fmt.Sprintf("test:url:%d", time.Now().UnixNano())
+	t.Cleanup(func() {
+		ctx := client.Context()
+		iter := client.Client().Scan(ctx, 0, prefix+"*", 100).Iterator()
+		for iter.Next(ctx) {
+			client.Client().Del(ctx, iter.Val())
+		}
+		client.Close()
+	})
+	return client, prefix
+}
+
+// 测试Redis Bloom过滤器：已记录的URL不会被判为新URL，超过容量后新增一层
+func TestRedisBloom(t *testing.T) {
+	client, prefix := newTestRedis(t)
+	bloom := NewRedisBloom(client, prefix+":bloom", 100, 0.01)
+	ctx := context.Background()
+
+	added := 0
+	for i := 0; i < 250; i++ {
+		url := fmt.Sprintf("https://example.com/%d", i)
+		if ok, _ := bloom.Contains(ctx, url); ok {
+			continue // 误判
+		}
+		isNew, err := bloom.Add(ctx, url)
+		if err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+		if !isNew {
+			t.Fatalf("Contains返回false的URL被Add判为已存在: %s", url)
+		}
+		added++
+	}
+	if added < 245 {
+		t.Errorf("250个新URL中只有 %d 个判为新URL，误判率过高", added)
+	}
+
+	for i := 0; i < 250; i++ {
+		url := fmt.Sprintf("https://example.com/%d", i)
+		if ok, err := bloom.Contains(ctx, url); !ok || err != nil {
+			t.Fatalf("Contains(%s) = %v, %v，已记录的URL不能判为不存在", url, ok, err)
+		}
+		if isNew, _ := bloom.Add(ctx, url); isNew {
+			t.Fatalf("重复Add(%s)返回新URL", url)
+		}
+	}
+
+	stats, err := bloom.Stats(ctx)
+	if err != nil {
+		t.Fatalf("Stats() error = %v", err)
+	}
+	if stats.Layers != 2 || stats.Count != int64(added) || stats.Bytes == 0 {
+		t.Errorf("Stats() = %+v，期望2层、%d个URL", stats, added)
+	}
+}
+
+// 测试批量记录与逐个记录结果一致，批内重复的URL只有第一个为新URL
+func TestRedisBloomAddBatch(t *testing.T) {
+	client, prefix := newTestRedis(t)
+	bloom := NewRedisBloom(client, prefix+":bloom", 1000, 0.001)
+	ctx := context.Background()
+
+	if _, err := bloom.Add(ctx, "https://example.com/old"); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	added, err := bloom.AddBatch(ctx, []string{
+		"https://example.com/a", "https://example.com/old", "https://example.com/b", "https://example.com/a",
+	})
+	if err != nil {
+		t.Fatalf("AddBatch() error = %v", err)
+	}
+	want := []bool{true, false, true, false}
+	for i := range want {
+		if added[i] != want[i] {
+			t.Errorf("AddBatch() = %v，期望 %v", added, want)
+			break
+		}
+	}
+	if ok, _ := bloom.Contains(ctx, "https://example.com/b"); !ok {
+		t.Error("批量记录的URL应已存在")
+	}
+}
+
+// 测试添加URL先保存再记录去重，重复添加被拒绝
+func TestAddURLItem(t *testing.T) {
+	uc, _ := newTestController(t, Config{MaxDepth: 3, MaxPriority: 3})
+	ctx := context.Background()
+
+	if err := uc.AddURL(ctx, "https://example.com/a", 1, 2); err != nil {
+		t.Fatalf("AddURL() error = %v", err)
+	}
+	if exists, _ := uc.Exists(ctx, "https://example.com/a"); !exists {
+		t.Error("保存后URL应记录到去重存储")
+	}
+	if err := uc.AddURL(ctx, "https://example.com/a", 1, 2); err == nil {
+		t.Error("重复添加应返回错误")
+	}
+
+	item, err := uc.GetURL(ctx, "https://example.com/a")
+	if err != nil || item.Status != StatusPending || item.Priority != 2 {
+		t.Errorf("GetURL() = %+v, %v", item, err)
+	}
+}
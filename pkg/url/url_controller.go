@@ -2,22 +2,34 @@ package url
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"net/url"
+	"log"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	goredis "github.com/go-redis/redis/v8"
+
 	"japan_spider/pkg/redis"
 )
 
+// requeueBatchSize 每次回收超时URL的最大数量
+const requeueBatchSize = 100
+
 // URLController URL管理器
 type URLController struct {
 	redisClient *redis.RedisClient // Redis客户端，用于存储URL
+	dedup       DedupStore         // URL去重存储
 	config      Config             // 配置信息
 	filters     []Filter           // URL过滤规则
+	canonical   *Canonicalizer     // URL规范化器
 	metrics     *URLMetrics        // URL统计指标
 	mu          sync.RWMutex       // 读写锁
+	ctx         context.Context    // 控制器上下文，Close时取消
+	cancel      context.CancelFunc // 取消函数
+	wg          sync.WaitGroup     // 后台协程
 }
 
 // URLItem URL项
@@ -26,6 +38,9 @@ type URLItem struct {
 	Depth     int       `json:"depth"`      // 当前深度
 	Priority  int       `json:"priority"`   // 优先级
 	Status    string    `json:"status"`     // 状态：pending/processing/completed/failed
+	Parent    string    `json:"parent"`     // 发现该URL的页面
+	Spider    string    `json:"spider"`     // 负责抓取的爬虫
+	Attempts  int       `json:"attempts"`   // 被取出处理的次数
 	CreatedAt time.Time `json:"created_at"` // 创建时间
 	UpdatedAt time.Time `json:"updated_at"` // 更新时间
 }
@@ -37,55 +52,112 @@ type Filter interface {
 
 // URLMetrics URL统计指标
 type URLMetrics struct {
-	TotalURLs     int64            // 总URL数
-	ProcessedURLs int64            // 已处理URL数
-	FailedURLs    int64            // 失败URL数
-	DepthStats    map[int]int64    // 各深度URL统计
-	DomainStats   map[string]int64 // 各域名URL统计
-	mu            sync.Mutex       // 互斥锁
+	TotalURLs      int64            // 总URL数
+	PendingURLs    int64            // 等待处理的URL数
+	ProcessingURLs int64            // 正在处理的URL数
+	ProcessedURLs  int64            // 已处理URL数
+	FailedURLs     int64            // 失败URL数
+	DepthStats     map[int]int64    // 各深度URL统计
+	DomainStats    map[string]int64 // 各域名URL统计
+	mu             sync.Mutex       // 互斥锁
 }
 
-// NewURLController 创建新的URL管理器
-func NewURLController(redisClient *redis.RedisClient, config Config) *URLController {
+// NewURLController 创建新的URL管理器，按config.Dedup创建URL去重存储
+func NewURLController(redisClient *redis.RedisClient, config Config) (*URLController, error) {
+	dedup, err := NewDedupStore(redisClient, config)
+	if err != nil {
+		return nil, err
+	}
+	return NewURLControllerWithStore(redisClient, dedup, config), nil
+}
+
+// NewURLControllerWithStore 使用指定的URL去重存储创建URL管理器
+// 不再使用时调用Close停止后台协程
+func NewURLControllerWithStore(redisClient *redis.RedisClient, dedup DedupStore, config Config) *URLController {
+	ctx, cancel := context.WithCancel(context.Background())
 	uc := &URLController{
 		redisClient: redisClient,
-		config:      config,
+		dedup:       dedup,
+		config:      config.withDefaults(),
 		filters:     make([]Filter, 0),
+		canonical:   NewCanonicalizer(),
 		metrics: &URLMetrics{
 			DepthStats:  make(map[int]int64),
 			DomainStats: make(map[string]int64),
 		},
+		ctx:    ctx,
+		cancel: cancel,
 	}
 
 	// 启动指标收集
-	go uc.startMetricsCollector()
+	uc.every(uc.config.MetricsInterval, uc.updateMetrics)
+	// 启动超时URL回收
+	uc.every(uc.config.StaleCheckInterval, func() {
+		if n, err := uc.RequeueStale(uc.ctx); err != nil {
+			log.Printf("回收超时URL失败: %v", err)
+		} else if n > 0 {
+			log.Printf("已将 %d 个处理超时的URL放回队列", n)
+		}
+	})
 
 	return uc
 }
 
+// Close 停止后台协程
+func (uc *URLController) Close() {
+	uc.cancel()
+	uc.wg.Wait()
+}
+
+// every 在后台每隔interval调用一次fn，直到Close
+func (uc *URLController) every(interval time.Duration, fn func()) {
+	uc.wg.Add(1)
+	go func() {
+		defer uc.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-uc.ctx.Done():
+				return
+			case <-ticker.C:
+				fn()
+			}
+		}
+	}()
+}
+
 // AddURL 添加新的URL
 func (uc *URLController) AddURL(ctx context.Context, rawURL string, depth int, priority int) error {
-	// URL规范化
-	normalizedURL, err := uc.normalizeURL(rawURL)
+	return uc.AddURLItem(ctx, &URLItem{URL: rawURL, Depth: depth, Priority: priority})
+}
+
+// AddURLItem 添加新的URL项，item.URL会被规范化
+// 除URL、Depth、Priority外，调用方可以设置Parent和Spider，其余字段由管理器填写
+func (uc *URLController) AddURLItem(ctx context.Context, item *URLItem) error {
+	// URL规范化，等价的URL只保存一次
+	normalizedURL, err := uc.normalizeURL(item.URL)
 	if err != nil {
 		return err
 	}
 
 	// 检查深度限制
-	if depth > uc.config.MaxDepth {
+	if item.Depth > uc.config.MaxDepth {
 		return fmt.Errorf("超出最大深度限制: %d", uc.config.MaxDepth)
 	}
-
-	// 创建URL项
-	item := &URLItem{
-		URL:       normalizedURL,
-		Depth:     depth,
-		Priority:  priority,
-		Status:    "pending",
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+	if item.Priority < 0 || item.Priority > uc.config.MaxPriority {
+		return fmt.Errorf("优先级超出范围 0-%d: %d", uc.config.MaxPriority, item.Priority)
 	}
 
+	// 填写URL项
+	now := time.Now()
+	item.URL = normalizedURL
+	item.Status = StatusPending
+	item.Attempts = 0
+	item.CreatedAt = now
+	item.UpdatedAt = now
+
 	// 应用过滤规则
 	for _, filter := range uc.filters {
 		if !filter.Allow(item) {
@@ -93,8 +165,8 @@ func (uc *URLController) AddURL(ctx context.Context, rawURL string, depth int, p
 		}
 	}
 
-	// 检查URL是否已存在
-	exists, err := uc.exists(ctx, normalizedURL)
+	// 检查URL是否已添加过
+	exists, err := uc.dedup.Contains(ctx, normalizedURL)
 	if err != nil {
 		return err
 	}
@@ -102,20 +174,47 @@ func (uc *URLController) AddURL(ctx context.Context, rawURL string, depth int, p
 		return fmt.Errorf("URL已存在: %s", normalizedURL)
 	}
 
-	// 保存到Redis
-	return uc.saveURL(ctx, item)
+	// 先保存到Redis再记录去重，保存失败的URL不会被记为已添加；
+	// 多个节点同时添加同一URL时，保存脚本检查URL项是否存在，只有一个节点保存成功
+	if err := uc.saveURL(ctx, item); err != nil {
+		return err
+	}
+	if _, err := uc.dedup.Add(ctx, normalizedURL); err != nil {
+		return fmt.Errorf("URL已保存，记录去重失败: %w", err)
+	}
+	return nil
 }
 
-// GetNextURL 获取下一个待处理的URL
+// GetNextURL 获取下一个待处理的URL，按优先级从高到低，同一优先级先进先出
+// 取出的URL状态变为processing，超过ProcessingTimeout仍未更新状态时会被放回队列
+// GetNextURL不考虑主机，需要按主机控制请求间隔时通过Frontier取URL
 func (uc *URLController) GetNextURL(ctx context.Context) (*URLItem, error) {
-	// 按优先级从高到低获取URL
-	for priority := uc.config.MaxPriority; priority >= 0; priority-- {
-		item, err := uc.getURLByPriority(ctx, priority)
-		if err == nil && item != nil {
-			return item, nil
-		}
+	now := time.Now()
+	reply, err := nextScript.Run(ctx, uc.redisClient.Client(), nil,
+		uc.config.RedisKeyPrefix, uc.config.MaxPriority, millis(now), millis(now.Add(uc.config.ProcessingTimeout))).Slice()
+	if errors.Is(err, goredis.Nil) {
+		return nil, ErrNoPendingURL
+	}
+	if err != nil {
+		return nil, err
 	}
-	return nil, fmt.Errorf("没有待处理的URL")
+	return itemFromFields(fieldsFromReply(reply)), nil
+}
+
+// GetURL 获取URL项
+func (uc *URLController) GetURL(ctx context.Context, rawURL string) (*URLItem, error) {
+	normalizedURL, err := uc.normalizeURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := uc.redisClient.Client().HGetAll(ctx, itemKey(uc.config.RedisKeyPrefix, normalizedURL)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrURLNotFound, normalizedURL)
+	}
+	return itemFromFields(fields), nil
 }
 
 // AddFilter 添加URL过滤规则
@@ -126,137 +225,146 @@ func (uc *URLController) AddFilter(filter Filter) {
 }
 
 // UpdateStatus 更新URL状态
+// 允许的变化: processing -> completed/failed/pending，failed -> pending；改为pending时重新放入队列。
+// 已完成和失败的URL项保留ItemTTL后删除，删除后GetURL和UpdateStatus返回ErrURLNotFound
 func (uc *URLController) UpdateStatus(ctx context.Context, url string, status string) error {
-	item, err := uc.getURLItem(ctx, url)
+	from, ok := transitions[status]
+	if !ok {
+		return fmt.Errorf("%w: 不能直接设置为 %s", ErrInvalidTransition, status)
+	}
+	normalizedURL, err := uc.normalizeURL(url)
 	if err != nil {
 		return err
 	}
 
-	item.Status = status
-	item.UpdatedAt = time.Now()
-	return uc.saveURL(ctx, item)
-}
-
-// normalizeURL 规范化URL
-func (uc *URLController) normalizeURL(rawURL string) (string, error) {
-	parsedURL, err := url.Parse(rawURL)
+	ttl := uc.config.ItemTTL.Milliseconds()
+	if ttl < 0 {
+		ttl = 0
+	}
+	args := []interface{}{uc.config.RedisKeyPrefix, normalizedURL, status, millis(time.Now()), ttl}
+	for _, s := range from {
+		args = append(args, s)
+	}
+	reply, err := statusScript.Run(ctx, uc.redisClient.Client(), nil, args...).Slice()
 	if err != nil {
-		return "", err
+		return err
 	}
-
-	// 移除片段
-	parsedURL.Fragment = ""
-
-	// 规范化路径
-	if parsedURL.Path == "" {
-		parsedURL.Path = "/"
+	code, _ := reply[0].(int64)
+	old, _ := reply[1].(string)
+	switch code {
+	case 0:
+		return fmt.Errorf("%w: %s", ErrURLNotFound, normalizedURL)
+	case -1:
+		return fmt.Errorf("%w: %s 从 %s 到 %s", ErrInvalidTransition, normalizedURL, old, status)
 	}
-
-	return parsedURL.String(), nil
+	return nil
 }
 
-// exists 检查URL是否已存在
-func (uc *URLController) exists(ctx context.Context, url string) (bool, error) {
-	select {
-	case <-ctx.Done():
-		return false, ctx.Err()
-	default:
-		key := fmt.Sprintf("%s:urls", uc.config.RedisKeyPrefix)
-		return uc.redisClient.SIsMember(key, url)
+// RequeueStale 把处理超时的URL放回队列，返回放回的数量
+func (uc *URLController) RequeueStale(ctx context.Context) (int, error) {
+	total := 0
+	for {
+		n, err := requeueScript.Run(ctx, uc.redisClient.Client(), nil,
+			uc.config.RedisKeyPrefix, millis(time.Now()), requeueBatchSize).Int()
+		total += n
+		if err != nil || n < requeueBatchSize {
+			return total, err
+		}
 	}
 }
 
-// saveURL 保存URL到Redis
-func (uc *URLController) saveURL(ctx context.Context, item *URLItem) error {
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	default:
-		urlKey := fmt.Sprintf("%s:urls", uc.config.RedisKeyPrefix)
-		// 保存到URL集合
-		if err := uc.redisClient.SAdd(urlKey, item.URL); err != nil {
-			return err
-		}
-
-		// 保存到优先级队列
-		priorityKey := fmt.Sprintf("%s:priority:%d", uc.config.RedisKeyPrefix, item.Priority)
-		return uc.redisClient.RPush(priorityKey, item.URL)
-	}
+// AddRule 添加站点的URL规范化规则
+func (uc *URLController) AddRule(rule Rule) {
+	uc.canonical.AddRule(rule)
 }
 
-// getURLByPriority 获取指定优先级的URL
-func (uc *URLController) getURLByPriority(ctx context.Context, priority int) (*URLItem, error) {
-	select {
-	case <-ctx.Done():
-		return nil, ctx.Err()
-	default:
-		key := fmt.Sprintf("%s:priority:%d", uc.config.RedisKeyPrefix, priority)
-		url, err := uc.redisClient.LPop(key)
-		if err != nil {
-			return nil, err
-		}
-		return &URLItem{
-			URL:      url,
-			Priority: priority,
-			Status:   "pending",
-		}, nil
-	}
+// normalizeURL 规范化URL
+func (uc *URLController) normalizeURL(rawURL string) (string, error) {
+	return uc.canonical.Canonicalize(rawURL)
 }
 
-// getURLItem 获取URL项信息
-func (uc *URLController) getURLItem(ctx context.Context, url string) (*URLItem, error) {
-	select {
-	case <-ctx.Done():
-		return nil, ctx.Err()
-	default:
-		key := fmt.Sprintf("%s:url:%s", uc.config.RedisKeyPrefix, url)
-		data, err := uc.redisClient.Get(key)
-		if err != nil {
-			return nil, err
-		}
-		var item URLItem
-		if err := json.Unmarshal([]byte(data), &item); err != nil {
-			return nil, err
-		}
-		return &item, nil
+// Exists 检查URL是否已添加过
+// 使用Bloom过滤器去重时，少量从未添加的URL也可能返回true
+func (uc *URLController) Exists(ctx context.Context, rawURL string) (bool, error) {
+	normalizedURL, err := uc.normalizeURL(rawURL)
+	if err != nil {
+		return false, err
 	}
+	return uc.dedup.Contains(ctx, normalizedURL)
 }
 
-// startMetricsCollector 启动指标收集器
-func (uc *URLController) startMetricsCollector() {
-	ticker := time.NewTicker(uc.config.MetricsInterval)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		uc.updateMetrics()
+// saveURL 保存URL项并放入优先级队列
+func (uc *URLController) saveURL(ctx context.Context, item *URLItem) error {
+	added, err := addScript.Run(ctx, uc.redisClient.Client(), nil,
+		uc.config.RedisKeyPrefix, item.URL, item.Depth, item.Priority, item.Parent, item.Spider,
+		millis(item.CreatedAt), urlDomain(item.URL)).Int()
+	if err != nil {
+		return err
+	}
+	if added == 0 {
+		return fmt.Errorf("URL已存在: %s", item.URL)
 	}
+	return nil
 }
 
-// updateMetrics 更新URL统计指标
+// updateMetrics 从Redis计数更新URL统计指标
 func (uc *URLController) updateMetrics() {
+	key := fmt.Sprintf("%s:stats", uc.config.RedisKeyPrefix)
+	stats, err := uc.redisClient.HGetAll(key)
+	if err != nil {
+		log.Printf("读取URL统计失败: %v", err)
+		return
+	}
+
 	uc.metrics.mu.Lock()
 	defer uc.metrics.mu.Unlock()
 
-	// 更新深度统计
-	for depth := 0; depth <= uc.config.MaxDepth; depth++ {
-		key := fmt.Sprintf("%s:depth:%d", uc.config.RedisKeyPrefix, depth)
-		count, _ := uc.redisClient.SCard(key)
-		uc.metrics.DepthStats[depth] = int64(count)
-	}
-
-	// 更新域名统计
-	domainKey := fmt.Sprintf("%s:domains", uc.config.RedisKeyPrefix)
-	domains, _ := uc.redisClient.SMembers(domainKey)
-	for _, domain := range domains {
-		key := fmt.Sprintf("%s:domain:%s", uc.config.RedisKeyPrefix, domain)
-		count, _ := uc.redisClient.SCard(key)
-		uc.metrics.DomainStats[domain] = int64(count)
+	for field, value := range stats {
+		n, _ := strconv.ParseInt(value, 10, 64)
+		name, arg, _ := strings.Cut(field, ":")
+		switch name {
+		case "total":
+			uc.metrics.TotalURLs = n
+		case "status":
+			switch arg {
+			case StatusPending:
+				uc.metrics.PendingURLs = n
+			case StatusProcessing:
+				uc.metrics.ProcessingURLs = n
+			case StatusCompleted:
+				uc.metrics.ProcessedURLs = n
+			case StatusFailed:
+				uc.metrics.FailedURLs = n
+			}
+		case "depth":
+			if depth, err := strconv.Atoi(arg); err == nil {
+				uc.metrics.DepthStats[depth] = n
+			}
+		case "domain":
+			uc.metrics.DomainStats[arg] = n
+		}
 	}
 }
 
-// GetMetrics 获取URL统计指标
+// GetMetrics 获取URL统计指标的副本
 func (uc *URLController) GetMetrics() *URLMetrics {
 	uc.metrics.mu.Lock()
 	defer uc.metrics.mu.Unlock()
-	return uc.metrics
+
+	m := &URLMetrics{
+		TotalURLs:      uc.metrics.TotalURLs,
+		PendingURLs:    uc.metrics.PendingURLs,
+		ProcessingURLs: uc.metrics.ProcessingURLs,
+		ProcessedURLs:  uc.metrics.ProcessedURLs,
+		FailedURLs:     uc.metrics.FailedURLs,
+		DepthStats:     make(map[int]int64, len(uc.metrics.DepthStats)),
+		DomainStats:    make(map[string]int64, len(uc.metrics.DomainStats)),
+	}
+	for depth, n := range uc.metrics.DepthStats {
+		m.DepthStats[depth] = n
+	}
+	for domain, n := range uc.metrics.DomainStats {
+		m.DomainStats[domain] = n
+	}
+	return m
 }
@@ -15,6 +15,11 @@ import (
 	"japan_spider/pkg/redis"
 )
 
+const (
+	geonodeProxiesKey = "geonode_proxies"       // Redis中存放代理地址的集合
+	geonodeDetailsKey = "geonode_proxy_details" // Redis中存放代理详情的哈希表
+)
+
 // GeonodeSpider 代理IP爬虫结构，包含爬虫所需的所有配置和状态
 type GeonodeSpider struct {
 	Name        string        // 爬虫名称，用于标识和日志输出
@@ -29,16 +34,83 @@ type GeonodeSpider struct {
 }
 
 // ProxyInfo 存储单个代理IP的详细信息
+// 字段与 geonode API 返回的JSON保持一致
 type ProxyInfo struct {
-	IP         string   `json:"ip"`           // 代理IP地址
-	Port       string   `json:"port"`         // 代理端口
-	Protocols  []string `json:"protocols"`    // 支持的协议（如HTTP、HTTPS）
-	Country    string   `json:"country_name"` // 代理所在国家
-	Speed      float64  `json:"speed"`        // 代理速度
-	Uptime     float64  `json:"uptime"`       // 在线时间
-	LastCheck  string   `json:"last_checked"` // 最后检查时间
-	Anonymous  bool     `json:"anonymity"`    // 是否匿名
-	WorkingPct float64  `json:"reliability"`  // 可用性百分比
+	IP         string   `json:"ip"`             // 代理IP地址
+	Port       string   `json:"port"`           // 代理端口
+	Protocols  []string `json:"protocols"`      // 支持的协议（如HTTP、HTTPS）
+	Country    string   `json:"country"`        // 代理所在国家代码，例如 JP
+	City       string   `json:"city"`           // 代理所在城市
+	Speed      float64  `json:"speed"`          // 代理速度
+	Latency    float64  `json:"latency"`        // 延迟（毫秒）
+	Uptime     float64  `json:"upTime"`         // 在线时间百分比
+	LastCheck  int64    `json:"lastChecked"`    // 最后检查时间（Unix时间戳）
+	Anonymity  string   `json:"anonymityLevel"` // 匿名级别：elite/anonymous/transparent
+	WorkingPct float64  `json:"workingPercent"` // 可用性百分比
+}
+
+// countryNames 常见国家代码对应的国家名称
+// 用于按国家名称（例如 Japan）筛选代理
+var countryNames = map[string]string{
+	"JP": "Japan",
+	"CN": "China",
+	"HK": "Hong Kong",
+	"TW": "Taiwan",
+	"KR": "South Korea",
+	"SG": "Singapore",
+	"US": "United States",
+	"CA": "Canada",
+	"GB": "United Kingdom",
+	"DE": "Germany",
+	"FR": "France",
+	"NL": "Netherlands",
+	"RU": "Russia",
+	"IN": "India",
+	"ID": "Indonesia",
+	"TH": "Thailand",
+	"VN": "Vietnam",
+	"BR": "Brazil",
+}
+
+// Address 返回代理地址，格式为 ip:port
+func (p ProxyInfo) Address() string {
+	return fmt.Sprintf("%s:%s", p.IP, p.Port)
+}
+
+// Document 将代理信息转换为MongoDB中的完整记录
+func (p ProxyInfo) Document() mongodb.ProxyDocument {
+	code := strings.ToUpper(p.Country)
+	name, ok := countryNames[code]
+	if !ok {
+		name = code
+	}
+
+	protocols := make([]string, 0, len(p.Protocols))
+	for _, protocol := range p.Protocols {
+		protocols = append(protocols, strings.ToLower(protocol))
+	}
+
+	var lastChecked time.Time
+	if p.LastCheck > 0 {
+		lastChecked = time.Unix(p.LastCheck, 0)
+	}
+
+	return mongodb.ProxyDocument{
+		Proxy:       p.Address(),
+		IP:          p.IP,
+		Port:        p.Port,
+		Protocols:   protocols,
+		Country:     name,
+		CountryCode: code,
+		City:        p.City,
+		Anonymity:   strings.ToLower(p.Anonymity),
+		Speed:       p.Speed,
+		Latency:     p.Latency,
+		Uptime:      p.Uptime,
+		Reliability: p.WorkingPct,
+		LastChecked: lastChecked,
+		Source:      "geonode",
+	}
 }
 
 // Stats 记录爬虫运行的统计信息
@@ -261,14 +333,22 @@ func (s *GeonodeSpider) scrapeURL(ctx context.Context, url string, redisClient *
 		return fmt.Errorf("解析JSON失败: %w", err)
 	}
 
-	// 直接将结果保存到Redis
+	// 直接将结果保存到Redis，地址写入集合，完整信息写入哈希表
 	proxies := make([]string, 0, len(response.Data))
+	details := make(map[string]string, len(response.Data))
 	for _, proxy := range response.Data {
-		proxyStr := fmt.Sprintf("%s:%s", proxy.IP, proxy.Port)
+		proxyStr := proxy.Address()
 		proxies = append(proxies, proxyStr)
+		if data, err := json.Marshal(proxy); err == nil {
+			details[proxyStr] = string(data)
+		}
+	}
+
+	if err := redisClient.HSetAll(geonodeDetailsKey, details); err != nil {
+		return fmt.Errorf("保存代理详情到Redis失败: %w", err)
 	}
 
-	if err := redisClient.SaveProxies("geonode_proxies", proxies); err != nil {
+	if err := redisClient.SaveProxies(geonodeProxiesKey, proxies); err != nil {
 		return fmt.Errorf("保存到Redis失败: %w", err)
 	}
 
@@ -294,8 +374,9 @@ func (s *GeonodeSpider) printStats() {
 }
 
 // SaveToMongoDB 从Redis读取所有代理并保存到MongoDB（包含去重）
+// 保存的是完整的代理记录，包括国家、协议、匿名级别、速度和可靠性
 func (s *GeonodeSpider) SaveToMongoDB(redisClient *redis.RedisClient, mongoClient *mongodb.MongoClient) error {
-	const redisKey = "geonode_proxies"
+	const redisKey = geonodeProxiesKey
 
 	// 1. 从Redis获取所有代理
 	log.Printf("从Redis读取所有代理...")
@@ -321,28 +402,43 @@ func (s *GeonodeSpider) SaveToMongoDB(redisClient *redis.RedisClient, mongoClien
 	}
 	log.Printf("去重完成，剩余数量: %d", len(unique))
 
-	// 3. 转换为MongoDB文档格式
-	documents := make([]interface{}, len(unique))
+	// 3. 读取代理详情
+	details, err := redisClient.HGetAll(geonodeDetailsKey)
+	if err != nil {
+		log.Printf("警告：读取代理详情失败，仅保存代理地址: %v", err)
+		details = map[string]string{}
+	}
+
+	// 4. 转换为MongoDB文档格式
+	documents := make([]mongodb.ProxyDocument, len(unique))
 	for i, proxy := range unique {
-		documents[i] = map[string]interface{}{
-			"proxy":    proxy,
-			"source":   "geonode",
-			"createAt": time.Now(),
-			"verified": false,
+		doc := mongodb.ProxyDocument{Proxy: proxy, Source: "geonode"}
+		var info ProxyInfo
+		if data, ok := details[proxy]; ok && json.Unmarshal([]byte(data), &info) == nil {
+			doc = info.Document()
 		}
+		documents[i] = doc
 	}
 
-	// 4. 保存到MongoDB
+	// 5. 以代理地址为键写入MongoDB，已有代理只更新元数据和last_seen
 	log.Printf("开始保存到MongoDB...")
-	if err := mongoClient.SaveProxies("proxy_pool", "proxies", documents); err != nil {
+	if err := mongoClient.EnsureProxyIndexes("proxy_pool", "proxies"); err != nil {
+		return fmt.Errorf("创建代理索引失败: %w", err)
+	}
+	result, err := mongoClient.UpsertProxies("proxy_pool", "proxies", documents)
+	if err != nil {
 		return fmt.Errorf("保存到MongoDB失败: %w", err)
 	}
+	log.Printf("保存完成: 新增 %d，更新 %d，未变化 %d", result.Inserted, result.Updated, result.Unchanged)
 
-	// 5. 清理Redis数据
+	// 6. 清理Redis数据
 	log.Printf("清理Redis数据...")
 	if err := redisClient.RemoveKey(redisKey); err != nil {
 		log.Printf("警告：清理Redis数据失败: %v", err)
 	}
+	if err := redisClient.RemoveKey(geonodeDetailsKey); err != nil {
+		log.Printf("警告：清理代理详情失败: %v", err)
+	}
 
 	return nil
 }